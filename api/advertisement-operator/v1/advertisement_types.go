@@ -16,6 +16,7 @@ limitations under the License.
 package v1
 
 import (
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
 	object_references "github.com/liqoTech/liqo/pkg/object-references"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -25,8 +26,24 @@ type NetworkInfo struct {
 	PodCIDR          string `json:"podCIDR"`
 	GatewayIP        string `json:"gatewayIP"`
 	GatewayPrivateIP string `json:"gatewayPrivateIP"`
+	// the UDP port the gateway is reachable at, used by the tunnel protocols encapsulated in UDP
+	// +optional
+	GatewayPort int32 `json:"gatewayPort,omitempty"`
+	// the tunnel protocols supported by the gateway, in order of preference
 	// +optional
 	SupportedProtocols []string `json:"supportedProtocols,omitempty"`
+	// the public key of the gateway, used by the tunnel protocols requiring a key exchange
+	// +optional
+	TunnelPublicKey string `json:"tunnelPublicKey,omitempty"`
+	// the CIDR of the ClusterIP Services, set only if the cluster lets the peering clusters reach them
+	// +optional
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	// the pod CIDRs of the cluster besides PodCIDR, they are routed without being remapped
+	// +optional
+	AdditionalPodCIDRs []string `json:"additionalPodCIDRs,omitempty"`
+	// the clusters the cluster is able to reach, excluding the ones reached through the receiver of the advertisement
+	// +optional
+	Neighbors []liqonetv1.NeighborNetwork `json:"neighbors,omitempty"`
 }
 
 type NamespacedName struct {
@@ -20,6 +20,7 @@ limitations under the License.
 package v1
 
 import (
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
 	corev1 "k8s.io/api/core/v1"
 	resource "k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -183,6 +184,16 @@ func (in *NetworkInfo) DeepCopyInto(out *NetworkInfo) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.AdditionalPodCIDRs != nil {
+		in, out := &in.AdditionalPodCIDRs, &out.AdditionalPodCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Neighbors != nil {
+		in, out := &in.Neighbors, &out.Neighbors
+		*out = make([]liqonetv1.NeighborNetwork, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkInfo.
@@ -69,17 +69,101 @@ type DiscoveryConfig struct {
 	// --- DNS ---
 
 	DnsServer string `json:"dnsServer"`
+	//the registration of the cluster in a DNS zone, so that the other clusters discover it through a SearchDomain
+	DnsRegistration DnsRegistrationConfig `json:"dnsRegistration,omitempty"`
 
 	// --- CA ---
 
 	AllowUntrustedCA bool `json:"allowUntrustedCA"`
+	//the URL the API server is reached at by the other clusters, e.g. through a load balancer or an ingress. If set it
+	//is advertised in the TXT records in place of the address they are resolved to
+	ApiUrl string `json:"apiUrl,omitempty"`
+}
+
+//the cluster is registered with RFC 2136 dynamic updates, which publish the PTR, SRV and TXT records read by the DNS
+//discovery, and removed when the discovery component stops
+type DnsRegistrationConfig struct {
+	//the domain the cluster is registered in, the one set in the SearchDomains of the other clusters. If empty the
+	//cluster is not registered
+	Domain string `json:"domain,omitempty"`
+	//the zone the records are updated in, if empty the domain is used
+	Zone string `json:"zone,omitempty"`
+	//the primary server (host:port) of the zone accepting the updates, if empty the dnsServer is used
+	Server string `json:"server,omitempty"`
+	//the name of the TSIG key authenticating the updates, if empty the updates are not signed
+	TsigKeyName string `json:"tsigKeyName,omitempty"`
+	// +kubebuilder:validation:Enum="";hmac-sha1;hmac-sha256;hmac-sha512
+	//the algorithm of the TSIG key, hmac-sha256 if empty
+	TsigAlgorithm string `json:"tsigAlgorithm,omitempty"`
+	//the Secret in the Liqo namespace holding the base64 encoded TSIG secret in its "secret" key
+	TsigSecretName string `json:"tsigSecretName,omitempty"`
+	// +kubebuilder:validation:Minimum=30
+	//the TTL of the records in seconds, 300 if not set. The records are updated again after each TTL
+	TTL int32 `json:"ttl,omitempty"`
 }
 
 type LiqonetConfig struct {
 	//contains a list of reserved subnets in CIDR notation used by the k8s cluster like the podCIDR and ClusterCIDR
-	ReservedSubnets  []string               `json:"reservedSubnets"`
-	GatewayPrivateIP string                 `json:"gatewayPrivateIP"`
-	VxlanNetConfig   liqonet.VxlanNetConfig `json:"vxlanNetConfig,omitempty"`
+	ReservedSubnets []string               `json:"reservedSubnets"`
+	VxlanNetConfig  liqonet.VxlanNetConfig `json:"vxlanNetConfig,omitempty"`
+	//contains the pools of addresses used to remap the pod CIDRs of the peered clusters conflicting with the local subnets,
+	//if empty 10.0.0.0/8 split in /16 subnets and fd00:10::/40 split in /48 subnets are used. Changes are applied at the
+	//restart of the tunnelEndpointCreator
+	AddressPools []AddressPool `json:"addressPools,omitempty"`
+	//the endpoint the gateway is reachable at from the peering clusters, if empty the address of the gateway node is used
+	PublicEndpoint PublicEndpointConfig `json:"publicEndpoint,omitempty"`
+	// +kubebuilder:validation:Enum="";iptables;nftables
+	//the backend the rules of the route operators are applied through, if empty the one used by each node is detected.
+	//Changes are applied at the restart of the route operators
+	FirewallBackend string `json:"firewallBackend,omitempty"`
+	//if true the gateway filters the traffic exchanged with the peering clusters according to the NetworkPolicies of the
+	//local cluster and to the networkPolicyDefault of the ForeignClusters. Changes are applied at the restart of the
+	//route operators
+	EnforceNetworkPolicies bool `json:"enforceNetworkPolicies,omitempty"`
+	//the CIDR of the ClusterIP Services, if set it is advertised to the peering clusters, which route it through the
+	//tunnel so that their pods can reach the Services by ClusterIP
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	// +kubebuilder:validation:Minimum=576
+	// +kubebuilder:validation:Maximum=65535
+	//the MTU of the network between the gateways, if not set it is discovered probing the path toward each remote
+	//gateway. The tunnels are re-established when it changes
+	MTU int32 `json:"mtu,omitempty"`
+	//the pod CIDRs of the cluster, if empty they are detected from the resources of the CNI plugin, the configuration of
+	//kube-controller-manager and kube-proxy and the pod CIDRs of the nodes. The first one is remapped when it overlaps
+	//with the subnets of a peering cluster. Changes are applied at the restart of the liqonet components
+	PodCIDRs []string `json:"podCIDRs,omitempty"`
+}
+
+//the public endpoint of the gateway is the first one available among: the given address, the address of the Service
+//exposing the gateway and the address discovered through the STUN servers
+type PublicEndpointConfig struct {
+	//the public address of the gateway, e.g. the address of the NAT or of the firewall in front of it
+	Address string `json:"address,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	//the public UDP port mapped to the tunnel port of the gateway, if not set the tunnel port is used, or the public port
+	//discovered through the STUN servers
+	Port int32 `json:"port,omitempty"`
+	//the LoadBalancer or NodePort Service exposing the tunnel port of the gateway
+	Service *ServiceReference `json:"service,omitempty"`
+	//the STUN servers (host:port) used to discover the public address of the gateway and the public port the tunnel
+	//port is mapped to
+	StunServers []string `json:"stunServers,omitempty"`
+}
+
+type ServiceReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+//a block of addresses split in subnets of the same length
+type AddressPool struct {
+	//the block of addresses in CIDR notation
+	CIDR string `json:"cidr"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=128
+	//the prefix length of the subnets allocated from the pool
+	PrefixLength int32 `json:"prefixLength"`
 }
 
 //contains a list of resources identified by their GVR
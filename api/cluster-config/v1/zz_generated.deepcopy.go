@@ -23,6 +23,21 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddressPool) DeepCopyInto(out *AddressPool) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddressPool.
+func (in *AddressPool) DeepCopy() *AddressPool {
+	if in == nil {
+		return nil
+	}
+	out := new(AddressPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AdvertisementConfig) DeepCopyInto(out *AdvertisementConfig) {
 	*out = *in
@@ -134,6 +149,7 @@ func (in *ClusterConfigStatus) DeepCopy() *ClusterConfigStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DiscoveryConfig) DeepCopyInto(out *DiscoveryConfig) {
 	*out = *in
+	out.DnsRegistration = in.DnsRegistration
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveryConfig.
@@ -166,6 +182,21 @@ func (in *DispatcherConfig) DeepCopy() *DispatcherConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DnsRegistrationConfig) DeepCopyInto(out *DnsRegistrationConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DnsRegistrationConfig.
+func (in *DnsRegistrationConfig) DeepCopy() *DnsRegistrationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(DnsRegistrationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LiqonetConfig) DeepCopyInto(out *LiqonetConfig) {
 	*out = *in
@@ -175,6 +206,17 @@ func (in *LiqonetConfig) DeepCopyInto(out *LiqonetConfig) {
 		copy(*out, *in)
 	}
 	out.VxlanNetConfig = in.VxlanNetConfig
+	if in.AddressPools != nil {
+		in, out := &in.AddressPools, &out.AddressPools
+		*out = make([]AddressPool, len(*in))
+		copy(*out, *in)
+	}
+	in.PublicEndpoint.DeepCopyInto(&out.PublicEndpoint)
+	if in.PodCIDRs != nil {
+		in, out := &in.PodCIDRs, &out.PodCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LiqonetConfig.
@@ -187,6 +229,31 @@ func (in *LiqonetConfig) DeepCopy() *LiqonetConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublicEndpointConfig) DeepCopyInto(out *PublicEndpointConfig) {
+	*out = *in
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(ServiceReference)
+		**out = **in
+	}
+	if in.StunServers != nil {
+		in, out := &in.StunServers, &out.StunServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublicEndpointConfig.
+func (in *PublicEndpointConfig) DeepCopy() *PublicEndpointConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PublicEndpointConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Resource) DeepCopyInto(out *Resource) {
 	*out = *in
@@ -201,3 +268,18 @@ func (in *Resource) DeepCopy() *Resource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceReference) DeepCopyInto(out *ServiceReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceReference.
+func (in *ServiceReference) DeepCopy() *ServiceReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceReference)
+	in.DeepCopyInto(out)
+	return out
+}
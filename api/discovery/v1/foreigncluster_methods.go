@@ -1,7 +1,12 @@
 package v1
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
 	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
 	"github.com/liqoTech/liqo/pkg/crdClient"
 	v1 "k8s.io/api/core/v1"
@@ -11,6 +16,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
+	"strings"
 )
 
 func (fc *ForeignCluster) GetConfig(client kubernetes.Interface) (*rest.Config, error) {
@@ -27,6 +33,10 @@ func (fc *ForeignCluster) GetConfig(client kubernetes.Interface) (*rest.Config,
 			klog.Error(err, err.Error())
 			return nil, err
 		}
+		// the expected fingerprint may have been set after the CA has been loaded
+		if err = fc.checkCaFingerprint(secret.Data["caData"]); err != nil {
+			return nil, err
+		}
 		cnf = rest.Config{
 			Host: fc.Spec.ApiUrl,
 			TLSClientConfig: rest.TLSClientConfig{
@@ -62,6 +72,10 @@ func (fc *ForeignCluster) LoadForeignCA(localClient kubernetes.Interface, localN
 	if err != nil {
 		return err
 	}
+	// the connection is not authenticated, the CA is stored only if it matches the expected fingerprint
+	if err = fc.verifyCa(secret.Data["ca.crt"]); err != nil {
+		return err
+	}
 	localSecret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: fc.Name + "-ca-data",
@@ -88,6 +102,16 @@ func (fc *ForeignCluster) LoadForeignCA(localClient kubernetes.Interface, localN
 		if err != nil {
 			return err
 		}
+		// it may hold a CA which does not match the expected fingerprint anymore
+		if !bytes.Equal(localSecret.Data["caData"], secret.Data["ca.crt"]) {
+			localSecret.Data = map[string][]byte{
+				"caData": secret.Data["ca.crt"],
+			}
+			localSecret, err = localClient.CoreV1().Secrets(localNamespace).Update(context.TODO(), localSecret, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+		}
 	}
 	fc.Status.Outgoing.CaDataRef = &v1.ObjectReference{
 		Kind:       "Secret",
@@ -99,6 +123,121 @@ func (fc *ForeignCluster) LoadForeignCA(localClient kubernetes.Interface, localN
 	return nil
 }
 
+// GetCaFingerprint returns the hex encoded SHA-256 fingerprint of the first certificate of the PEM encoded CA data
+func GetCaFingerprint(caData []byte) (string, error) {
+	block, _ := pem.Decode(caData)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("no PEM encoded certificate found in the CA data")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NormalizeCaFingerprint returns the fingerprint in the form returned by GetCaFingerprint, removing the sha256: prefix
+// of the hashes handed out of band and the colons separating the bytes
+func NormalizeCaFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(fingerprint)), "sha256:")
+	return strings.ReplaceAll(fingerprint, ":", "")
+}
+
+// GetExpectedCaFingerprint returns the fingerprint the CA of the foreign cluster has to match: the hash handed out of
+// band if set, the one advertised by the foreign cluster otherwise. It is empty if none is known
+func (fc *ForeignCluster) GetExpectedCaFingerprint() string {
+	if fc.Spec.CaCertHash != "" {
+		return NormalizeCaFingerprint(fc.Spec.CaCertHash)
+	}
+	return NormalizeCaFingerprint(fc.Spec.CaFingerprint)
+}
+
+// CaFingerprintMismatchError is returned when the CA of the foreign cluster does not match the expected fingerprint
+type CaFingerprintMismatchError struct {
+	Expected string
+	// empty if the CA data does not contain a certificate
+	Actual string
+}
+
+func (err *CaFingerprintMismatchError) Error() string {
+	if err.Actual == "" {
+		return "the CA of the foreign cluster contains no certificate, expected fingerprint " + err.Expected
+	}
+	return "the fingerprint of the CA of the foreign cluster is " + err.Actual + ", expected " + err.Expected
+}
+
+func (fc *ForeignCluster) checkCaFingerprint(caData []byte) error {
+	expected := fc.GetExpectedCaFingerprint()
+	if expected == "" {
+		return nil
+	}
+	// an invalid CA is reported as a mismatch
+	actual, _ := GetCaFingerprint(caData)
+	if actual != expected {
+		return &CaFingerprintMismatchError{
+			Expected: expected,
+			Actual:   actual,
+		}
+	}
+	return nil
+}
+
+// verifyCa checks the CA downloaded from the foreign cluster against the expected fingerprint and reports the result
+// in the CaVerified condition. Without a known fingerprint the CA is trusted on first use
+func (fc *ForeignCluster) verifyCa(caData []byte) error {
+	condition := ForeignClusterCondition{
+		Type: CaVerifiedCondition,
+	}
+	err := fc.checkCaFingerprint(caData)
+	switch {
+	case err != nil:
+		condition.Status = v1.ConditionFalse
+		condition.Reason = CaFingerprintMismatchReason
+		condition.Message = err.Error() + ", the peering is blocked"
+	case fc.GetExpectedCaFingerprint() == "":
+		condition.Status = v1.ConditionUnknown
+		condition.Reason = CaNoFingerprintReason
+		condition.Message = "no fingerprint is known for the foreign cluster, its CA has been trusted on first use"
+	default:
+		condition.Status = v1.ConditionTrue
+		condition.Reason = CaFingerprintMatchReason
+		condition.Message = "the CA of the foreign cluster matches the expected fingerprint"
+	}
+	fc.Status.SetCondition(condition)
+	return err
+}
+
+// GetCondition returns the condition of the given type, nil if it has not been reported
+func (s *ForeignClusterStatus) GetCondition(conditionType ForeignClusterConditionType) *ForeignClusterCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition, the transition time changes only if the status does;
+// it returns true if the status of the condition changed
+func (s *ForeignClusterStatus) SetCondition(condition ForeignClusterCondition) bool {
+	existing := s.GetCondition(condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, condition)
+		return true
+	}
+	changed := existing.Status != condition.Status
+	if changed {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = condition.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	return changed
+}
+
 func (fc *ForeignCluster) SetAdvertisement(adv *protocolv1.Advertisement, discoveryClient *crdClient.CRDClient) error {
 	if fc.Status.Outgoing.Advertisement == nil {
 		// Advertisement has not been set in ForeignCluster yet
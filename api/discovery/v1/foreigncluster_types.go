@@ -36,6 +36,21 @@ const (
 	IncomingPeeringDiscovery DiscoveryType = "IncomingPeering"
 )
 
+// NetworkPolicyDefault is the treatment, at the gateway, of the traffic coming from the pods of a foreign cluster
+// and not allowed by any NetworkPolicy
+// +kubebuilder:validation:Enum=AllowAll;DenyAll;AllowReflectedServices
+type NetworkPolicyDefault string
+
+const (
+	// NetworkPolicyAllowAll accepts all the traffic, it is used when no default is set
+	NetworkPolicyAllowAll NetworkPolicyDefault = "AllowAll"
+	// NetworkPolicyDenyAll drops all the traffic
+	NetworkPolicyDenyAll NetworkPolicyDefault = "DenyAll"
+	// NetworkPolicyAllowReflectedServices accepts only the traffic directed to the endpoints of the Services
+	// reflected in the foreign cluster
+	NetworkPolicyAllowReflectedServices NetworkPolicyDefault = "AllowReflectedServices"
+)
+
 // ForeignClusterSpec defines the desired state of ForeignCluster
 type ForeignClusterSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -47,6 +62,35 @@ type ForeignClusterSpec struct {
 	ApiUrl           string        `json:"apiUrl"`
 	DiscoveryType    DiscoveryType `json:"discoveryType"`
 	AllowUntrustedCA bool          `json:"allowUntrustedCA"`
+	// NetworkPolicyDefault is applied to the traffic coming from the pods of the foreign cluster which is not
+	// selected by any NetworkPolicy
+	NetworkPolicyDefault NetworkPolicyDefault `json:"networkPolicyDefault,omitempty"`
+	// Bandwidth limits the traffic exchanged with the foreign cluster through the tunnel
+	Bandwidth BandwidthLimits `json:"bandwidth,omitempty"`
+	// ClusterName is the human-readable name of the foreign cluster
+	ClusterName string `json:"clusterName,omitempty"`
+	// LiqoVersion is the version of Liqo running in the foreign cluster
+	LiqoVersion string `json:"liqoVersion,omitempty"`
+	// NetworkProtocols are the tunnel protocols supported by the gateway of the foreign cluster
+	NetworkProtocols []string `json:"networkProtocols,omitempty"`
+	// CaFingerprint is the hex encoded SHA-256 fingerprint of the CA certificate of the foreign cluster
+	CaFingerprint string `json:"caFingerprint,omitempty"`
+	// Capabilities are the optional features supported by the foreign cluster
+	Capabilities []string `json:"capabilities,omitempty"`
+	// +kubebuilder:validation:Pattern=`^sha256:([0-9a-fA-F]{2}:?){31}[0-9a-fA-F]{2}$`
+	// CaCertHash is the hash of the CA certificate of the foreign cluster handed out of band, in the sha256:<hex> form.
+	// When set, the CA downloaded in untrusted mode has to match it instead of CaFingerprint, which is updated by the
+	// discovery
+	CaCertHash string `json:"caCertHash,omitempty"`
+}
+
+// BandwidthLimits contains the rates, in bits per second and written as quantities (e.g. 10M), the traffic exchanged
+// with a foreign cluster is limited to. The traffic is not limited if they are empty
+type BandwidthLimits struct {
+	// Egress limits the traffic sent to the foreign cluster
+	Egress string `json:"egress,omitempty"`
+	// Ingress limits the traffic received from the foreign cluster
+	Ingress string `json:"ingress,omitempty"`
 }
 
 // ForeignClusterStatus defines the observed state of ForeignCluster
@@ -57,6 +101,32 @@ type ForeignClusterStatus struct {
 	Outgoing Outgoing `json:"outgoing,omitempty"`
 	Incoming Incoming `json:"incoming,omitempty"`
 	Ttl      int      `json:"ttl,omitempty"`
+	// Conditions report the checks the peering with the foreign cluster depends on
+	Conditions []ForeignClusterCondition `json:"conditions,omitempty"`
+}
+
+type ForeignClusterConditionType string
+
+const (
+	// the CA downloaded from the foreign cluster in untrusted mode has been checked against the expected fingerprint
+	CaVerifiedCondition ForeignClusterConditionType = "CaVerified"
+)
+
+const (
+	// the CA matches the expected fingerprint
+	CaFingerprintMatchReason = "FingerprintMatch"
+	// the CA does not match the expected fingerprint, the peering is blocked
+	CaFingerprintMismatchReason = "FingerprintMismatch"
+	// no fingerprint is known for the foreign cluster, the CA has been trusted on first use
+	CaNoFingerprintReason = "NoFingerprint"
+)
+
+type ForeignClusterCondition struct {
+	Type               ForeignClusterConditionType `json:"type"`
+	Status             v1.ConditionStatus          `json:"status"`
+	LastTransitionTime metav1.Time                 `json:"lastTransitionTime,omitempty"`
+	Reason             string                      `json:"reason,omitempty"`
+	Message            string                      `json:"message,omitempty"`
 }
 
 type Outgoing struct {
@@ -24,12 +24,27 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BandwidthLimits) DeepCopyInto(out *BandwidthLimits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BandwidthLimits.
+func (in *BandwidthLimits) DeepCopy() *BandwidthLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(BandwidthLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ForeignCluster) DeepCopyInto(out *ForeignCluster) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -51,6 +66,22 @@ func (in *ForeignCluster) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForeignClusterCondition) DeepCopyInto(out *ForeignClusterCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForeignClusterCondition.
+func (in *ForeignClusterCondition) DeepCopy() *ForeignClusterCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ForeignClusterCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ForeignClusterList) DeepCopyInto(out *ForeignClusterList) {
 	*out = *in
@@ -86,6 +117,17 @@ func (in *ForeignClusterList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ForeignClusterSpec) DeepCopyInto(out *ForeignClusterSpec) {
 	*out = *in
+	out.Bandwidth = in.Bandwidth
+	if in.NetworkProtocols != nil {
+		in, out := &in.NetworkProtocols, &out.NetworkProtocols
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForeignClusterSpec.
@@ -103,6 +145,13 @@ func (in *ForeignClusterStatus) DeepCopyInto(out *ForeignClusterStatus) {
 	*out = *in
 	in.Outgoing.DeepCopyInto(&out.Outgoing)
 	in.Incoming.DeepCopyInto(&out.Incoming)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ForeignClusterCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForeignClusterStatus.
@@ -33,4 +33,6 @@ var (
 
 	// AddToScheme adds the types in this group-version to the given scheme.
 	AddToScheme = SchemeBuilder.AddToScheme
+
+	GroupResource = schema.GroupResource{Group: GroupVersion.Group, Resource: "tunnelendpoints"}
 )
@@ -0,0 +1,54 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IpamStorageSpec defines the state of the IPAM used to remap the pod CIDRs of the peered clusters and to address
+// the nodes in the vxlan overlay network
+type IpamStorageSpec struct {
+	// ClusterSubnets contains, for each peered cluster, the subnet its pods are reachable at:
+	// the remapped subnet if its pod CIDR conflicts with the local ones, the pod CIDR itself otherwise
+	ClusterSubnets map[string]string `json:"clusterSubnets,omitempty"`
+	// VxlanIPs contains, for each node of the cluster, the address of its interface in the vxlan overlay network
+	VxlanIPs map[string]string `json:"vxlanIPs,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// IpamStorage is the Schema for the ipamstorages API
+type IpamStorage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IpamStorageSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpamStorageList contains a list of IpamStorage
+type IpamStorageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpamStorage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpamStorage{}, &IpamStorageList{})
+}
@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"errors"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// create a client for TunnelEndpoint CR using a provided kubeconfig
+func CreateTunnelEndpointClient(kubeconfig string) (*crdClient.CRDClient, error) {
+	var config *rest.Config
+	var err error
+
+	if err = AddToScheme(scheme.Scheme); err != nil {
+		panic(err)
+	}
+
+	config, err = crdClient.NewKubeconfig(kubeconfig, &GroupVersion)
+	if err != nil {
+		panic(err)
+	}
+
+	clientSet, err := crdClient.NewFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	crdClient.AddToRegistry("tunnelendpoints",
+		&TunnelEndpoint{},
+		&TunnelEndpointList{},
+		Keyer,
+		GroupResource)
+
+	return clientSet, nil
+}
+
+func Keyer(obj runtime.Object) (string, error) {
+	tep, ok := obj.(*TunnelEndpoint)
+	if !ok {
+		return "", errors.New("cannot cast received object to TunnelEndpoint")
+	}
+
+	return tep.Name, nil
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -31,22 +32,152 @@ type TunnelEndpointSpec struct {
 	PodCIDR         string `json:"podCIDR"`
 	TunnelPublicIP  string `json:"tunnelPublicIP"`
 	TunnelPrivateIP string `json:"tunnelPrivateIP"`
+	// the tunnel protocols supported by the remote gateway
+	SupportedProtocols []string `json:"supportedProtocols,omitempty"`
+	// the public key of the remote gateway, used by the tunnel protocols requiring a key exchange
+	TunnelPublicKey string `json:"tunnelPublicKey,omitempty"`
+	// the UDP port the remote gateway is reachable at, used by the tunnel protocols encapsulated in UDP
+	TunnelPublicPort int32 `json:"tunnelPublicPort,omitempty"`
+	// the CIDR of the ClusterIP Services of the remote cluster, set only if they can be reached through the tunnel
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	// the pod CIDRs of the remote cluster besides PodCIDR, they are routed without being remapped
+	AdditionalPodCIDRs []string `json:"additionalPodCIDRs,omitempty"`
+	// the clusters the remote cluster is able to reach, as advertised by it
+	Neighbors []NeighborNetwork `json:"neighbors,omitempty"`
 }
 
 // TunnelEndpointStatus defines the observed state of TunnelEndpoint
 type TunnelEndpointStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file\
-	Phase                 string `json:"phase,omitempty"` //two phases: New, Processed
-	LocalRemappedPodCIDR  string `json:"localRemappedPodCIDR,omitempty"`
-	RemoteRemappedPodCIDR string `json:"remoteRemappedPodCIDR,omitempty"`
-	NATEnabled            bool   `json:"NAT,omitempty"`
-	RemoteTunnelPublicIP  string `json:"remoteTunnelPublicIP,omitempty"`
-	RemoteTunnelPrivateIP string `json:"remoteTunnelPrivateIP,omitempty"`
-	LocalTunnelPublicIP   string `json:"localTunnelPublicIP,omitempty"`
-	LocalTunnelPrivateIP  string `json:"localTunnelPrivateIP,omitempty"`
-	TunnelIFaceIndex      int    `json:"tunnelIFaceIndex,omitempty"`
-	TunnelIFaceName       string `json:"tunnelIFaceName,omitempty"`
+	Phase                  string `json:"phase,omitempty"` //phases: New, Processed, Ready
+	LocalRemappedPodCIDR   string `json:"localRemappedPodCIDR,omitempty"`
+	RemoteRemappedPodCIDR  string `json:"remoteRemappedPodCIDR,omitempty"`
+	NATEnabled             bool   `json:"NAT,omitempty"`
+	RemoteTunnelPublicIP   string `json:"remoteTunnelPublicIP,omitempty"`
+	RemoteTunnelPublicPort int32  `json:"remoteTunnelPublicPort,omitempty"`
+	RemoteTunnelPrivateIP  string `json:"remoteTunnelPrivateIP,omitempty"`
+	LocalTunnelPublicIP    string `json:"localTunnelPublicIP,omitempty"`
+	LocalTunnelPrivateIP   string `json:"localTunnelPrivateIP,omitempty"`
+	TunnelIFaceIndex       int    `json:"tunnelIFaceIndex,omitempty"`
+	TunnelIFaceName        string `json:"tunnelIFaceName,omitempty"`
+	TunnelProtocol         string `json:"tunnelProtocol,omitempty"`
+	// the subnet the remote service CIDR is reached at when it overlaps with the local subnets, None otherwise
+	RemoteRemappedServiceCIDR string `json:"remoteRemappedServiceCIDR,omitempty"`
+	// the health of the tunnel and of the routes installed on each node
+	Conditions []TunnelEndpointCondition `json:"conditions,omitempty"`
+	// the result of the last probe of the remote end of the tunnel
+	Connection ConnectionStatus `json:"connection,omitempty"`
+	// the traffic exchanged with the remote cluster and the limits applied to it
+	Traffic TrafficStatus `json:"traffic,omitempty"`
+	// the MTU of the path between the gateways, configured or discovered probing the remote gateway
+	PathMTU int `json:"pathMTU,omitempty"`
+	// the MTU of the tunnel interface, the largest packet reaching the remote cluster without being fragmented
+	MTU int `json:"mtu,omitempty"`
+	// the additional pod CIDRs of the remote cluster routed through the tunnel, the ones overlapping with the local
+	// subnets are left out
+	AdditionalPodCIDRs []string `json:"additionalPodCIDRs,omitempty"`
+	// the clusters not directly peered with the local one that are reached through the remote cluster
+	TransitRoutes []TransitRoute `json:"transitRoutes,omitempty"`
+	// the routing table, and the mark, of the traffic toward the remapped networks of the remote cluster on the
+	// gateway, allocated to each remote cluster
+	RoutingTable int `json:"routingTable,omitempty"`
+}
+
+// NeighborNetwork is a cluster the advertising cluster is able to reach, either directly or through its own neighbors
+type NeighborNetwork struct {
+	ClusterID string `json:"clusterID"`
+	// the pod CIDR of the cluster as it is reached by the advertising cluster
+	PodCIDR string `json:"podCIDR"`
+	// the number of tunnels the advertising cluster crosses to reach the cluster, 1 if they are directly peered
+	Hops int32 `json:"hops"`
+}
+
+// TransitRoute is a cluster reached through the remote cluster of the TunnelEndpoint
+type TransitRoute struct {
+	ClusterID string `json:"clusterID"`
+	// the pod CIDR of the cluster as it is reached by the remote cluster
+	PodCIDR string `json:"podCIDR"`
+	// the subnet the pod CIDR is reached at when it overlaps with the local subnets, None otherwise
+	RemappedPodCIDR string `json:"remappedPodCIDR"`
+	// the number of tunnels crossed to reach the cluster from the local one
+	Hops int32 `json:"hops"`
+}
+
+type TunnelEndpointConditionType string
+
+const (
+	// the remote tunnel private IP replies to the probes
+	TunnelUpCondition TunnelEndpointConditionType = "TunnelUp"
+	// the routes toward the remote cluster are installed on a node, there is a condition for each node
+	RoutesInstalledCondition TunnelEndpointConditionType = "RoutesInstalled"
+)
+
+type TunnelEndpointCondition struct {
+	Type TunnelEndpointConditionType `json:"type"`
+	// the node the condition refers to, set only for the conditions reported by each node
+	Node               string                 `json:"node,omitempty"`
+	Status             corev1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+}
+
+type ConnectionStatus struct {
+	LastProbe metav1.Time `json:"lastProbe,omitempty"`
+	// the average round trip time of the replies
+	RTT metav1.Duration `json:"rtt,omitempty"`
+	// the percentage of the probes without a reply
+	PacketLoss int `json:"packetLoss,omitempty"`
+	// the number of consecutive probes the remote end did not reply to, the tunnel is re-created after a threshold
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+}
+
+type TrafficStatus struct {
+	LastUpdate metav1.Time `json:"lastUpdate,omitempty"`
+	// the counters of the traffic exchanged through the tunnel, they restart from zero when the tunnel is re-created
+	SentBytes       int64 `json:"sentBytes,omitempty"`
+	ReceivedBytes   int64 `json:"receivedBytes,omitempty"`
+	SentPackets     int64 `json:"sentPackets,omitempty"`
+	ReceivedPackets int64 `json:"receivedPackets,omitempty"`
+	// the rates, in bits per second, the traffic sent to and received from the remote cluster is limited to
+	EgressLimit  string `json:"egressLimit,omitempty"`
+	IngressLimit string `json:"ingressLimit,omitempty"`
+}
+
+// GetCondition returns the condition of the given type reported for the node, an empty node for the conditions
+// of the whole tunnel
+func (s *TunnelEndpointStatus) GetCondition(conditionType TunnelEndpointConditionType, node string) *TunnelEndpointCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType && s.Conditions[i].Node == node {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition, the transition time changes only if the status does;
+// it returns true if the status of the condition changed
+func (s *TunnelEndpointStatus) SetCondition(condition TunnelEndpointCondition) bool {
+	existing := s.GetCondition(condition.Type, condition.Node)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, condition)
+		return true
+	}
+	changed := existing.Status != condition.Status
+	if changed {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = condition.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	return changed
 }
 
 // +kubebuilder:object:root=true
@@ -23,13 +23,132 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionStatus) DeepCopyInto(out *ConnectionStatus) {
+	*out = *in
+	in.LastProbe.DeepCopyInto(&out.LastProbe)
+	out.RTT = in.RTT
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionStatus.
+func (in *ConnectionStatus) DeepCopy() *ConnectionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamStorage) DeepCopyInto(out *IpamStorage) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamStorage.
+func (in *IpamStorage) DeepCopy() *IpamStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpamStorage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamStorageList) DeepCopyInto(out *IpamStorageList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IpamStorage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamStorageList.
+func (in *IpamStorageList) DeepCopy() *IpamStorageList {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamStorageList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpamStorageList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamStorageSpec) DeepCopyInto(out *IpamStorageSpec) {
+	*out = *in
+	if in.ClusterSubnets != nil {
+		in, out := &in.ClusterSubnets, &out.ClusterSubnets
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.VxlanIPs != nil {
+		in, out := &in.VxlanIPs, &out.VxlanIPs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamStorageSpec.
+func (in *IpamStorageSpec) DeepCopy() *IpamStorageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamStorageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NeighborNetwork) DeepCopyInto(out *NeighborNetwork) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NeighborNetwork.
+func (in *NeighborNetwork) DeepCopy() *NeighborNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(NeighborNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TunnelEndpoint) DeepCopyInto(out *TunnelEndpoint) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TunnelEndpoint.
@@ -50,6 +169,22 @@ func (in *TunnelEndpoint) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TunnelEndpointCondition) DeepCopyInto(out *TunnelEndpointCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TunnelEndpointCondition.
+func (in *TunnelEndpointCondition) DeepCopy() *TunnelEndpointCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(TunnelEndpointCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TunnelEndpointList) DeepCopyInto(out *TunnelEndpointList) {
 	*out = *in
@@ -85,6 +220,21 @@ func (in *TunnelEndpointList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TunnelEndpointSpec) DeepCopyInto(out *TunnelEndpointSpec) {
 	*out = *in
+	if in.SupportedProtocols != nil {
+		in, out := &in.SupportedProtocols, &out.SupportedProtocols
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalPodCIDRs != nil {
+		in, out := &in.AdditionalPodCIDRs, &out.AdditionalPodCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Neighbors != nil {
+		in, out := &in.Neighbors, &out.Neighbors
+		*out = make([]NeighborNetwork, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TunnelEndpointSpec.
@@ -100,6 +250,56 @@ func (in *TunnelEndpointSpec) DeepCopy() *TunnelEndpointSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TunnelEndpointStatus) DeepCopyInto(out *TunnelEndpointStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]TunnelEndpointCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Connection.DeepCopyInto(&out.Connection)
+	in.Traffic.DeepCopyInto(&out.Traffic)
+	if in.AdditionalPodCIDRs != nil {
+		in, out := &in.AdditionalPodCIDRs, &out.AdditionalPodCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TransitRoutes != nil {
+		in, out := &in.TransitRoutes, &out.TransitRoutes
+		*out = make([]TransitRoute, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficStatus) DeepCopyInto(out *TrafficStatus) {
+	*out = *in
+	in.LastUpdate.DeepCopyInto(&out.LastUpdate)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficStatus.
+func (in *TrafficStatus) DeepCopy() *TrafficStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TransitRoute) DeepCopyInto(out *TransitRoute) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TransitRoute.
+func (in *TransitRoute) DeepCopy() *TransitRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(TransitRoute)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TunnelEndpointStatus.
@@ -16,6 +16,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -34,6 +35,18 @@ type NetworkConfigSpec struct {
 	TunnelPublicIP string `json:"tunnelPublicIP"`
 	//the IP address of the node in the private VPN subnet
 	TunnelPrivateIP string `json:"tunnelPrivateIP"`
+	//the tunnel protocols supported by the gateway
+	SupportedProtocols []string `json:"supportedProtocols,omitempty"`
+	//the public key of the gateway, used by the tunnel protocols requiring a key exchange
+	TunnelPublicKey string `json:"tunnelPublicKey,omitempty"`
+	//the UDP port the gateway is reachable at, used by the tunnel protocols encapsulated in UDP
+	TunnelPublicPort int32 `json:"tunnelPublicPort,omitempty"`
+	//the CIDR of the ClusterIP Services, set only if they can be reached through the tunnel
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	//the pod CIDRs of the local cluster besides PodCIDR, they are routed without being remapped
+	AdditionalPodCIDRs []string `json:"additionalPodCIDRs,omitempty"`
+	//the clusters the local cluster is able to reach, excluding the ones reached through the remote cluster
+	Neighbors []liqonetv1.NeighborNetwork `json:"neighbors,omitempty"`
 }
 
 // NetworkConfigStatus defines the observed state of NetworkConfig
@@ -42,7 +55,8 @@ type NetworkConfigStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	//indicates if the NAT is enabled for the remote cluster
 	NATEnabled bool `json:"natEnabled,omitempty"`
-	//the new subnet used to NAT the pods' subnet of the remote cluster
+	//the new subnet used to NAT the pods' subnet of the remote cluster, None if it does not overlap with the local
+	//subnets and it is used as it is
 	PodCIDRNAT string `json:"podCIDRNAT,omitempty"`
 }
 
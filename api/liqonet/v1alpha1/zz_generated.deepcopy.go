@@ -20,6 +20,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"github.com/liqoTech/liqo/api/liqonet/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -28,7 +29,7 @@ func (in *NetworkConfig) DeepCopyInto(out *NetworkConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
@@ -85,6 +86,21 @@ func (in *NetworkConfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkConfigSpec) DeepCopyInto(out *NetworkConfigSpec) {
 	*out = *in
+	if in.SupportedProtocols != nil {
+		in, out := &in.SupportedProtocols, &out.SupportedProtocols
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalPodCIDRs != nil {
+		in, out := &in.AdditionalPodCIDRs, &out.AdditionalPodCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Neighbors != nil {
+		in, out := &in.Neighbors, &out.Neighbors
+		*out = make([]v1.NeighborNetwork, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkConfigSpec.
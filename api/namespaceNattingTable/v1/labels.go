@@ -0,0 +1,10 @@
+package v1
+
+const (
+	// HomeClusterIDLabel is set on every object created by a virtual kubelet in the foreign cluster,
+	// and contains the id of the home cluster owning it
+	HomeClusterIDLabel = "liqo/home-cluster-id"
+	// HomeNamespaceAnnotation is set on the namespaces created by a virtual kubelet in the foreign cluster,
+	// and contains the name of the home namespace they reflect
+	HomeNamespaceAnnotation = "liqo/home-namespace"
+)
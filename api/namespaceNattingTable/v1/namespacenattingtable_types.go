@@ -23,6 +23,25 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// NattingStrategy defines how the name of a remote namespace is derived from the home one
+// +kubebuilder:validation:Enum=Suffix;Prefix;Hash;Mapping
+type NattingStrategy string
+
+const (
+	// NattingStrategySuffix builds remote names as <namespace>-<homeClusterId>
+	NattingStrategySuffix NattingStrategy = "Suffix"
+	// NattingStrategyPrefix builds remote names as <homeClusterId>-<namespace>
+	NattingStrategyPrefix NattingStrategy = "Prefix"
+	// NattingStrategyHash behaves like Suffix, but when the result does not fit in a DNS-1123 label
+	// the name is truncated and completed with a hash of the home namespace and cluster id
+	NattingStrategyHash NattingStrategy = "Hash"
+	// NattingStrategyMapping only nats the namespaces explicitly listed in the NamespaceMapping field
+	NattingStrategyMapping NattingStrategy = "Mapping"
+
+	// DefaultNattingStrategy is used when no strategy is set in the NamespaceNattingTable
+	DefaultNattingStrategy = NattingStrategyHash
+)
+
 // NamespaceNattingTableSpec defines the desired state of NamespaceNattingTable
 type NamespaceNattingTableSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -31,12 +50,49 @@ type NamespaceNattingTableSpec struct {
 	ClusterId      string            `json:"clusterId"`
 	NattingTable   map[string]string `json:"nattingTable,omitempty"`
 	DeNattingTable map[string]string `json:"deNattingTable,omitempty"`
+
+	// NattingStrategy is the strategy used to compute the names of the new remote namespaces,
+	// the namespaces already in the NattingTable are never renamed
+	NattingStrategy NattingStrategy `json:"nattingStrategy,omitempty"`
+	// NamespaceMapping contains the home namespace -> remote namespace translations used by the Mapping strategy
+	NamespaceMapping map[string]string `json:"namespaceMapping,omitempty"`
+}
+
+// NamespaceNattingPhase describes the result of the natting of a namespace
+// +kubebuilder:validation:Enum=Natted;Error
+type NamespaceNattingPhase string
+
+const (
+	NamespaceNattingPhaseNatted NamespaceNattingPhase = "Natted"
+	NamespaceNattingPhaseError  NamespaceNattingPhase = "Error"
+)
+
+// NamespaceNattingStatus contains the observed state of the natting of a single home namespace
+type NamespaceNattingStatus struct {
+	Namespace       string                `json:"namespace"`
+	NattedNamespace string                `json:"nattedNamespace,omitempty"`
+	Phase           NamespaceNattingPhase `json:"phase"`
+	Message         string                `json:"message,omitempty"`
 }
 
 // NamespaceNattingTableStatus defines the observed state of NamespaceNattingTable
 type NamespaceNattingTableStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Namespaces contains the outcome of the natting of every namespace handled by the virtual kubelet
+	Namespaces []NamespaceNattingStatus `json:"namespaces,omitempty"`
+}
+
+// SetNamespaceStatus adds or replaces the status entry of the given home namespace
+func (s *NamespaceNattingTableStatus) SetNamespaceStatus(status NamespaceNattingStatus) {
+	for i := range s.Namespaces {
+		if s.Namespaces[i].Namespace == status.Namespace {
+			s.Namespaces[i] = status
+			return
+		}
+	}
+	s.Namespaces = append(s.Namespaces, status)
 }
 
 // +kubebuilder:object:root=true
@@ -18,6 +18,8 @@ package main
 import (
 	"flag"
 	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	garbage_collector "github.com/liqoTech/liqo/internal/garbage-collector"
 	"github.com/liqoTech/liqo/pkg/crdClient"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -155,8 +157,17 @@ func main() {
 
 	r.WatchConfiguration(localKubeconfig)
 
+	nattingClient, err := nattingv1.CreateClient(localKubeconfig)
+	if err != nil {
+		klog.Errorln(err, "unable to create local client for NamespaceNattingTable")
+		os.Exit(1)
+	}
+	stop := ctrl.SetupSignalHandler()
+	gc := garbage_collector.NewHomeGarbageCollector(advClient, nattingClient, garbage_collector.DefaultGracePeriod)
+	go gc.Start(garbage_collector.DefaultPeriod, stop)
+
 	klog.Info("starting manager as advertisement-operator")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		klog.Error(err)
 		os.Exit(1)
 	}
@@ -85,8 +85,13 @@ func main() {
 	klog.Info("Starting ForeignCluster operator")
 	foreign_cluster_operator.StartOperator(&mgr, namespace, time.Duration(requeueAfter)*time.Second, discoveryCtl, kubeconfigPath)
 
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	stop := ctrl.SetupSignalHandler()
+	// the records are removed from the DNS zone when the component stops
+	dnsUnregistered := discoveryCtl.StartDnsRegistration(stop)
+
+	if err := mgr.Start(stop); err != nil {
 		klog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	<-dnsUnregistered
 }
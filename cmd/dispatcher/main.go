@@ -27,8 +27,10 @@ func init() {
 
 func main() {
 	remoteKubeConfig := flag.String("remoteConfig", "", "path to the kubeConfig of the remote cluster")
+	localClusterID := flag.String("clusterID", "", "ID of the local cluster")
+	remoteClusterID := flag.String("remoteClusterID", "remoteCluster", "ID of the remote cluster")
 	flag.Parse()
-	clusterID := "remoteCluster"
+	clusterID := *remoteClusterID
 
 	cfg := ctrl.GetConfigOrDie()
 	fmt.Println(remoteKubeConfig)
@@ -38,6 +40,7 @@ func main() {
 	}
 	d := &dispatcher.DispatcherReconciler{
 		Scheme:           scheme,
+		LocalClusterID:   *localClusterID,
 		LocalDynClient:   dynamic.NewForConfigOrDie(cfg),
 		RemoteDynClients: make(map[string]dynamic.Interface),
 		RunningWatchers:  make(map[string]chan bool),
@@ -20,10 +20,15 @@ import (
 	"github.com/coreos/go-iptables/iptables"
 	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
 	clusterConfig "github.com/liqoTech/liqo/api/cluster-config/v1"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
 	"github.com/liqoTech/liqo/api/liqonet/v1"
+	netv1alpha1 "github.com/liqoTech/liqo/api/liqonet/v1alpha1"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
 	"github.com/liqoTech/liqo/internal/liqonet"
+	"github.com/liqoTech/liqo/pkg/clusterID"
 	"github.com/liqoTech/liqo/pkg/liqonet"
 	"github.com/vishvananda/netlink"
+	"io/ioutil"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"net"
@@ -34,7 +39,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -57,6 +64,14 @@ func init() {
 
 	_ = protocolv1.AddToScheme(scheme)
 
+	_ = discoveryv1.AddToScheme(scheme)
+
+	_ = nattingv1.AddToScheme(scheme)
+
+	_ = netv1alpha1.AddToScheme(scheme)
+
+	_ = clusterConfig.AddToScheme(scheme)
+
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -81,6 +96,7 @@ func main() {
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
+		LeaderElectionID:   runAs + ".liqonet.liqo.io",
 		Port:               9443,
 	})
 	if err != nil {
@@ -104,9 +120,16 @@ func main() {
 		if err != nil {
 			setupLog.Error(err, "unable to convert vxlan port "+vxlanConfig.Port+" from string to int.")
 		}
-		err = liqonet.CreateVxLANInterface(clientset, vxlanConfig)
+		//the client reads directly from the API server, the caches of the manager are not started yet
+		vxlanClient, err := client.New(config, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create the client used to allocate the vxlan address")
+			os.Exit(1)
+		}
+		err = liqonet.CreateVxLANInterface(vxlanClient, clientset, vxlanConfig)
 		if err != nil {
 			setupLog.Error(err, "an error occurred while creating vxlan interface")
+			os.Exit(2)
 		}
 		//Enable loose mode reverse path filtering on the vxlan interfaces
 		err = liqonet.Enable_rp_filter()
@@ -114,32 +137,62 @@ func main() {
 			setupLog.Error(err, "an error occurred while enabling loose mode reverse path filtering")
 			os.Exit(3)
 		}
-		isGatewayNode, err := liqonet.IsGatewayNode(clientset)
-		if err != nil {
-			setupLog.Error(err, "an error occurred while checking if the node is the GatewayNode")
-			os.Exit(2)
-		}
 		//get node name
 		nodeName, err := liqonet.GetNodeName()
 		if err != nil {
 			setupLog.Error(err, "an error occurred while retrieving node name")
 			os.Exit(4)
 		}
-		//get node name
-		podCIDR, err := liqonet.GetClusterPodCIDR()
+		//get the pod CIDRs of the cluster, the first one is the one remapped by the remote clusters
+		podCIDRs, err := controllers.GetClusterPodCIDRs(config, &clusterConfig.GroupVersion)
 		if err != nil {
 			setupLog.Error(err, "an error occurred while retrieving cluster pod cidr")
 			os.Exit(6)
 		}
-		gatewayVxlanIP, err := liqonet.GetGatewayVxlanIP(clientset, vxlanConfig)
+		setupLog.Info("pod CIDRs of the cluster", "podCIDRs", podCIDRs)
+		firewallBackend, err := controllers.GetFirewallBackend(config, &clusterConfig.GroupVersion)
 		if err != nil {
-			setupLog.Error(err, "unable to derive gatewayVxlanIP")
-			os.Exit(5)
+			setupLog.Error(err, "unable to get the firewall backend")
+			os.Exit(1)
+		}
+		setupLog.Info("the rules are applied through " + firewallBackend)
+		var ipt liqonet.IPTables
+		if firewallBackend == liqonet.NFTablesBackend {
+			if liqonet.IPTablesNFTInUse() {
+				setupLog.Info("the iptables-nft tables are in use, the traffic accepted by the nftables rules can still be dropped by their rules")
+			}
+			ipt = liqonet.NewNFTables(&liqonet.NFTCommand{})
+		} else {
+			//the rules are applied through the iptables flavor of the node, whatever the default one of the image
+			if flavor := liqonet.DetectIPTablesFlavor(); flavor != "" {
+				if dir, err := ioutil.TempDir("", "iptables"); err != nil {
+					setupLog.Error(err, "unable to select the iptables flavor of the node")
+				} else if err := liqonet.UseIPTablesFlavor(flavor, dir); err != nil {
+					setupLog.Error(err, "unable to select the iptables flavor of the node, using the default one")
+				} else {
+					setupLog.Info("the rules are applied through iptables-" + flavor)
+				}
+			}
+			//the rules are applied through iptables or ip6tables according to the family of their addresses
+			dualStack := &liqonet.DualStackIPTables{}
+			if ipv4, err := iptables.New(); err != nil {
+				setupLog.Error(err, "unable to initialize iptables: %v. check if the ipatable are present in the system", err)
+			} else {
+				dualStack.IPv4 = ipv4
+			}
+			if ipv6, err := iptables.NewWithProtocol(iptables.ProtocolIPv6); err != nil {
+				setupLog.Error(err, "unable to initialize ip6tables, the IPv6 rules are not supported")
+			} else {
+				dualStack.IPv6 = ipv6
+			}
+			ipt = dualStack
 		}
-		ipt, err := iptables.New()
+		enforceNetworkPolicies, err := controllers.IsNetworkPolicyEnforcementEnabled(config, &clusterConfig.GroupVersion)
 		if err != nil {
-			setupLog.Error(err, "unable to initialize iptables: %v. check if the ipatable are present in the system", err)
+			setupLog.Error(err, "unable to get the network policy configuration")
+			os.Exit(1)
 		}
+		setupLog.Info("network policy enforcement", "enabled", enforceNetworkPolicies)
 
 		r := &controllers.RouteController{
 			Client:                             mgr.GetClient(),
@@ -147,8 +200,9 @@ func main() {
 			Scheme:                             mgr.GetScheme(),
 			RouteOperator:                      runAsRouteOperator,
 			ClientSet:                          clientset,
+			RemoteVTEPs:                        make(map[string]string),
 			RoutesPerRemoteCluster:             make(map[string][]netlink.Route),
-			IsGateway:                          isGatewayNode,
+			ServiceRulesPerRemoteCluster:       make(map[string]netlink.Rule),
 			VxlanNetwork:                       vxlanConfig.Network,
 			VxlanIfaceName:                     vxlanConfig.DeviceName,
 			VxlanPort:                          vxlanPort,
@@ -156,16 +210,47 @@ func main() {
 			IPTablesChains:                     make(map[string]liqonet.IPTableChain),
 			IPtablesRuleSpecsPerRemoteCluster:  make(map[string][]liqonet.IPtableRule),
 			NodeName:                           nodeName,
-			GatewayVxlanIP:                     gatewayVxlanIP,
-			ClusterPodCIDR:                     podCIDR,
+			ClusterPodCIDR:                     podCIDRs[0],
+			AdditionalClusterPodCIDRs:          podCIDRs[1:],
 			RetryTimeout:                       30 * time.Second,
 			IPtables:                           ipt,
 			NetLink:                            &liqonet.RouteManager{},
+			Recorder:                           mgr.GetEventRecorderFor("route-operator"),
+			EnforceNetworkPolicies:             enforceNetworkPolicies,
 		}
 		if err = r.SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Route")
 			os.Exit(1)
 		}
+		//the resources the filter rules are derived from are watched only if the policies are enforced
+		if enforceNetworkPolicies {
+			if err = r.SetupNetworkPolicyWatchWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "NetworkPolicy")
+				os.Exit(1)
+			}
+		}
+		if err = r.SetupVTEPWatchWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "VTEP")
+			os.Exit(1)
+		}
+		//the active gateway is retrieved once the caches are synced, and then checked periodically to detect a failover
+		err = mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+			r.WatchGateway(stop, 10*time.Second)
+			return nil
+		}))
+		if err != nil {
+			setupLog.Error(err, "unable to start the gateway watcher")
+			os.Exit(1)
+		}
+		//the routes and the rules are checked periodically, and rebuilt from the TunnelEndpoints after a restart
+		err = mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+			r.AuditState(stop, time.Minute)
+			return nil
+		}))
+		if err != nil {
+			setupLog.Error(err, "unable to start the audit of the routes and the rules")
+			os.Exit(1)
+		}
 		setupLog.Info("Starting manager as Route-Operator")
 		if err := mgr.Start(r.SetupSignalHandlerForRouteOperator()); err != nil {
 			setupLog.Error(err, "problem running manager")
@@ -173,16 +258,61 @@ func main() {
 		}
 
 	case "tunnel-operator":
+		nodeName, err := liqonet.GetNodeName()
+		if err != nil {
+			setupLog.Error(err, "an error occurred while retrieving node name")
+			os.Exit(4)
+		}
+		tunnelDrivers := map[string]liqonet.TunnelDriver{
+			liqonet.GreProtocol: &liqonet.GreDriver{},
+		}
+		//wireguard is used only if it is supported by the node, otherwise the gateway falls back to gre,
+		//encapsulated in UDP to cross the NATs if the node supports it. Only one driver listens on the tunnel port
+		if wireGuardDriver, err := setupWireGuardDriver(clientset); err != nil {
+			setupLog.Error(err, "wireguard is not available, only the gre tunnels are supported")
+			if greUdpDriver, err := liqonet.NewGreUdpDriver(liqonet.TunnelPort); err != nil {
+				setupLog.Error(err, "the gre tunnels can not be encapsulated in UDP")
+			} else {
+				tunnelDrivers[liqonet.GreUdpProtocol] = greUdpDriver
+			}
+		} else {
+			tunnelDrivers[liqonet.WireGuardProtocol] = wireGuardDriver
+		}
+		if err := liqonet.SetTunnelProtocolsAnnotation(clientset, nodeName, liqonet.GetSupportedProtocols(tunnelDrivers)); err != nil {
+			setupLog.Error(err, "unable to publish the tunnel protocols supported by the gateway")
+			os.Exit(1)
+		}
 		r := &controllers.TunnelController{
 			Client:                       mgr.GetClient(),
 			Log:                          ctrl.Log.WithName("controllers").WithName("TunnelEndpoint"),
 			Scheme:                       mgr.GetScheme(),
 			TunnelIFacesPerRemoteCluster: make(map[string]int),
+			RetryTimeout:                 30 * time.Second,
+			TunnelDrivers:                tunnelDrivers,
+			NodeName:                     nodeName,
+			ClientSet:                    clientset,
+			Prober:                       &liqonet.ICMPProber{},
+			ProbeInterval:                30 * time.Second,
+			FailureThreshold:             3,
+			Recorder:                     mgr.GetEventRecorderFor("tunnel-operator"),
+			Shaper:                       liqonet.NewTCShaper(&liqonet.TCCommand{}),
+			MTUProber:                    &liqonet.ICMPPathMTUProber{},
 		}
+		r.WatchConfiguration(config, &clusterConfig.GroupVersion)
 		if err = r.SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "TunnelEndpoint")
 			os.Exit(1)
 		}
+		//when leader election is enabled the runnable is started only on the elected operator,
+		//the ones running on the other gateway nodes are on standby
+		if err = mgr.Add(manager.RunnableFunc(r.ActivateGateway)); err != nil {
+			setupLog.Error(err, "unable to add the gateway activation")
+			os.Exit(1)
+		}
+		if err = mgr.Add(manager.RunnableFunc(r.MonitorTunnels)); err != nil {
+			setupLog.Error(err, "unable to add the tunnel monitor")
+			os.Exit(1)
+		}
 		setupLog.Info("Starting manager as Tunnel-Operator")
 		if err := mgr.Start(r.SetupSignalHandlerForTunnelOperator()); err != nil {
 			setupLog.Error(err, "problem running manager")
@@ -190,6 +320,23 @@ func main() {
 		}
 
 	case "tunnelEndpointCreator-operator":
+		//the IPAM state is loaded before the manager starts, hence the client does not use the caches
+		ipamClient, err := client.New(config, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create the client for the IPAM storage")
+			os.Exit(1)
+		}
+		podCIDRs, err := controllers.GetClusterPodCIDRs(config, &clusterConfig.GroupVersion)
+		if err != nil {
+			setupLog.Error(err, "an error occurred while retrieving cluster pod cidr")
+			os.Exit(6)
+		}
+		setupLog.Info("pod CIDRs of the cluster", "podCIDRs", podCIDRs)
+		clusterId, err := clusterID.NewClusterID("")
+		if err != nil {
+			setupLog.Error(err, "unable to get the cluster ID")
+			os.Exit(1)
+		}
 		r := &controllers.TunnelEndpointCreator{
 			Client:          mgr.GetClient(),
 			Log:             ctrl.Log.WithName("controllers").WithName("TunnelEndpointCreator"),
@@ -201,15 +348,28 @@ func main() {
 				FreeSubnets:        make(map[string]*net.IPNet),
 				SubnetPerCluster:   make(map[string]*net.IPNet),
 				ConflictingSubnets: make(map[string]*net.IPNet),
+				Storage:            liqonet.NewIpamCRDStorage(ipamClient),
 				Log:                ctrl.Log.WithName("IPAM"),
 			},
 			RetryTimeout: 30 * time.Second,
+			PodCIDRs:     podCIDRs,
+			ClusterID:    clusterId,
 		}
 		r.WatchConfiguration(config, &clusterConfig.GroupVersion)
 		if err = r.SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "TunnelEndpointCreator")
 			os.Exit(1)
 		}
+		//the network parameters are negotiated through the NetworkConfigs as well, sharing the IPAM
+		n := &controllers.NetworkConfigController{
+			TunnelEndpointCreator: r,
+			PodCIDR:               podCIDRs[0],
+			AdditionalPodCIDRs:    podCIDRs[1:],
+		}
+		if err = n.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NetworkConfig")
+			os.Exit(1)
+		}
 		setupLog.Info("starting manager as tunnelEndpointCreator-operator")
 		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 			setupLog.Error(err, "problem running manager")
@@ -217,3 +377,27 @@ func main() {
 		}
 	}
 }
+
+//creates the wireguard driver and publishes its public key on the gateway node
+func setupWireGuardDriver(clientset kubernetes.Interface) (*liqonet.WireGuardDriver, error) {
+	namespace, err := liqonet.GetPodNamespace()
+	if err != nil {
+		return nil, err
+	}
+	nodeName, err := liqonet.GetNodeName()
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := liqonet.GetWireGuardPrivateKey(clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := liqonet.NewWireGuardDriver(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := liqonet.SetWireGuardPublicKeyAnnotation(clientset, nodeName, driver.PublicKey); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
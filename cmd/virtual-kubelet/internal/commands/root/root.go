@@ -221,6 +221,18 @@ func runRootCommand(ctx context.Context, s *provider.Store, c Opts) error {
 		return errors.Wrap(err, "error setting up pod controller")
 	}
 
+	// the natting table is needed to match the pods already running in the foreign cluster
+	// with the home ones, before the pod controller starts to sync them
+	if err := p.ConfigureReflection(); err != nil {
+		return err
+	}
+
+	if r, ok := p.(provider.RemotePodsReconciler); ok {
+		if err := r.ReconcileRemotePods(ctx); err != nil {
+			klog.Errorf("cannot reconcile the pods running in the foreign cluster - %v", err)
+		}
+	}
+
 	go podInformerFactory.Start(ctx.Done())
 	go scmInformerFactory.Start(ctx.Done())
 
@@ -259,10 +271,6 @@ func runRootCommand(ctx context.Context, s *provider.Store, c Opts) error {
 		}
 	}()
 
-	if err := p.ConfigureReflection(); err != nil {
-		return err
-	}
-
 	nodeRunner.Ready()
 
 	klog.Info("setup ended")
@@ -34,6 +34,12 @@ type Provider interface {
 	StartNodeUpdater(nodeRunner *node.NodeController) (chan struct{}, chan struct{}, error)
 }
 
+// RemotePodsReconciler is an optional interface that providers can implement to align, at startup,
+// the pods they are running with the pods scheduled on the virtual node
+type RemotePodsReconciler interface {
+	ReconcileRemotePods(context.Context) error
+}
+
 // PodMetricsProvider is an optional interface that providers can implement to expose pod stats
 type PodMetricsProvider interface {
 	GetStatsSummary(context.Context) (*stats.Summary, error)
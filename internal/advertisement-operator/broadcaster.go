@@ -6,8 +6,10 @@ import (
 	"github.com/liqoTech/liqo/internal/discovery/kubeconfig"
 	pkg "github.com/liqoTech/liqo/pkg/advertisement-operator"
 	"github.com/liqoTech/liqo/pkg/crdClient"
+	"github.com/liqoTech/liqo/pkg/liqonet"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/klog"
 	"strings"
 	"sync"
@@ -16,12 +18,17 @@ import (
 	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
 	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
 	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	resourcehelper "k8s.io/kubectl/pkg/util/resource"
 )
 
+// the pod CIDR advertised when it can be neither detected nor derived from the nodes (e.g. minikube)
+const defaultPodCIDR = "172.17.0.0/16"
+
 type AdvertisementBroadcaster struct {
 	// local-related variables
 	LocalClient     *crdClient.CRDClient
@@ -32,9 +39,12 @@ type AdvertisementBroadcaster struct {
 	// configuration variables
 	HomeClusterId      string
 	ForeignClusterId   string
-	GatewayPrivateIP   string
 	PeeringRequestName string
 	ClusterConfig      policyv1.ClusterConfigSpec
+	// client used to detect the pod CIDRs from the custom resources of the CNI plugin, it can be nil
+	LocalDynClient dynamic.Interface
+	// client used to read the TunnelEndpoints, the clusters they reach are advertised as neighbors; it can be nil
+	TunEndpointClient *crdClient.CRDClient
 }
 
 // start the broadcaster which sends Advertisement messages
@@ -42,10 +52,9 @@ type AdvertisementBroadcaster struct {
 // parameters
 // - homeClusterId: the cluster ID of your cluster (must be a UUID)
 // - localKubeconfigPath: the path to the kubeconfig of the local cluster. Set it only when you are debugging and need to launch the program as a process and not inside Kubernetes
-// - gatewayPrivateIP: the private IP address of the gateway node
 // - peeringRequestName: the name of the PeeringRequest containing the reference to the secret with the kubeconfig for creating Advertisements CR on foreign cluster
 // - saName: The name of the ServiceAccount used to create the kubeconfig that will be sent to the foreign cluster with the permissions to create resources on local cluster
-func StartBroadcaster(homeClusterId, localKubeconfigPath, gatewayPrivateIP, peeringRequestName, saName string) error {
+func StartBroadcaster(homeClusterId, localKubeconfigPath, peeringRequestName, saName string) error {
 	klog.V(6).Info("starting broadcaster")
 
 	// create the Advertisement client to the local cluster
@@ -66,6 +75,18 @@ func StartBroadcaster(homeClusterId, localKubeconfigPath, gatewayPrivateIP, peer
 		klog.Error(err, err.Error())
 		return err
 	}
+	// the dynamic client is used only to detect the pod CIDRs, the detection goes on without it
+	var localDynClient dynamic.Interface
+	if !crdClient.Fake {
+		if localDynClient, err = dynamic.NewForConfig(config); err != nil {
+			klog.Warningf("unable to create the dynamic client, the pod CIDRs of the CNI plugins configured through custom resources will not be detected: %v", err)
+		}
+	}
+	// the TunnelEndpoints are read to advertise the reachable clusters, the advertisement is sent without them
+	tunEndpointClient, err := liqonetv1.CreateTunnelEndpointClient(localKubeconfigPath)
+	if err != nil {
+		klog.Warningf("unable to create the TunnelEndpoint client, the neighbor clusters will not be advertised: %v", err)
+	}
 
 	// get the PeeringRequest from the foreign cluster which requested resources
 	tmp, err := discoveryClient.Resource("peeringrequests").Get(peeringRequestName, metav1.GetOptions{})
@@ -152,11 +173,13 @@ func StartBroadcaster(homeClusterId, localKubeconfigPath, gatewayPrivateIP, peer
 		RemoteClient:               remoteClient,
 		HomeClusterId:              homeClusterId,
 		ForeignClusterId:           pr.Name,
-		GatewayPrivateIP:           gatewayPrivateIP,
 		PeeringRequestName:         peeringRequestName,
+		LocalDynClient:             localDynClient,
+		TunEndpointClient:          tunEndpointClient,
 	}
 
 	broadcaster.WatchConfiguration(localKubeconfigPath, nil)
+	go broadcaster.WatchGateway()
 
 	broadcaster.GenerateAdvertisement()
 	// if we come here there has been an error while the broadcaster was running
@@ -201,11 +224,16 @@ func (b *AdvertisementBroadcaster) CreateAdvertisement(physicalNodes *corev1.Nod
 
 	// set prices field
 	prices := ComputePrices(images)
-	// use virtual nodes to build neighbours
+	// use virtual nodes to build neighbours, the foreign cluster does not need to be advertised its own resources
 	neighbours := make(map[corev1.ResourceName]corev1.ResourceList)
 	for _, vnode := range virtualNodes.Items {
+		if vnode.Annotations["cluster-id"] == b.ForeignClusterId {
+			continue
+		}
 		neighbours[corev1.ResourceName(vnode.Name)] = vnode.Status.Allocatable
 	}
+	supportedProtocols, tunnelPublicKey := GetTunnelProtocols(physicalNodes.Items)
+	podCIDRs := b.getPodCIDRs(physicalNodes.Items)
 
 	adv := protocolv1.Advertisement{
 		ObjectMeta: metav1.ObjectMeta{
@@ -235,10 +263,15 @@ func (b *AdvertisementBroadcaster) CreateAdvertisement(physicalNodes *corev1.Nod
 			Properties: nil,
 			Prices:     prices,
 			Network: protocolv1.NetworkInfo{
-				PodCIDR:            GetPodCIDR(physicalNodes.Items),
+				PodCIDR:            podCIDRs[0],
+				AdditionalPodCIDRs: podCIDRs[1:],
 				GatewayIP:          GetGateway(physicalNodes.Items),
-				GatewayPrivateIP:   b.GatewayPrivateIP,
-				SupportedProtocols: nil,
+				GatewayPort:        GetGatewayPort(physicalNodes.Items),
+				GatewayPrivateIP:   b.getGatewayPrivateIP(podCIDRs[0]),
+				SupportedProtocols: supportedProtocols,
+				TunnelPublicKey:    tunnelPublicKey,
+				ServiceCIDR:        b.ClusterConfig.LiqonetConfig.ServiceCIDR,
+				Neighbors:          b.getNeighborNetworks(),
 			},
 			KubeConfigRef: corev1.SecretReference{
 				Namespace: b.KubeconfigSecretForForeign.Namespace,
@@ -273,6 +306,12 @@ func (b *AdvertisementBroadcaster) GetResourcesForAdv() (physicalNodes, virtualN
 		klog.Errorln("Could not list pods, retry in 1 minute")
 		return nil, nil, nil, nil, nil, err
 	}
+	// the pods offloaded by the foreign cluster are already accounted by its scheduler on the virtual node,
+	// hence they are not subtracted from the resources offered to it
+	if err = b.removeOffloadedPods(nodeNonTerminatedPodsList); err != nil {
+		klog.Errorln("Could not list the namespaces of the foreign cluster, retry in 1 minute")
+		return nil, nil, nil, nil, nil, err
+	}
 	reqs, limits := GetAllPodsResources(nodeNonTerminatedPodsList)
 	// compute resources to be announced to the other cluster
 	availability, images = ComputeAnnouncedResources(physicalNodes, reqs, int64(b.ClusterConfig.AdvertisementConfig.ResourceSharingPercentage))
@@ -342,28 +381,127 @@ func (b *AdvertisementBroadcaster) NotifyAdvertisementDeletion() error {
 	return nil
 }
 
-func GetPodCIDR(nodes []corev1.Node) string {
-	var podCIDR string
-	token := strings.Split(nodes[0].Spec.PodCIDR, ".")
-	if len(token) >= 2 {
-		podCIDR = token[0] + "." + token[1] + "." + "0" + "." + "0/16"
-	} else {
-		// in some cases (e.g. minikube) node PodCIDR is null, set a default one
-		podCIDR = "172.17.0.0/16"
+// getPodCIDRs returns the pod CIDRs advertised to the foreign cluster: the ones set in the ClusterConfig, the detected
+// ones or, if the detection fails, the ones assigned to the nodes. The first one is the one remapped in case of conflicts
+func (b *AdvertisementBroadcaster) getPodCIDRs(nodes []corev1.Node) []string {
+	if podCIDRs, err := liqonet.NormalizePodCIDRs(b.ClusterConfig.LiqonetConfig.PodCIDRs); err != nil {
+		klog.Errorf("the pod CIDRs of the ClusterConfig are not valid, detecting them: %v", err)
+	} else if len(podCIDRs) > 0 {
+		return podCIDRs
+	}
+	podCIDRs, err := liqonet.DetectPodCIDRs(b.LocalClient.Client(), b.LocalDynClient)
+	if err == nil {
+		return podCIDRs
+	}
+	klog.Warningf("%v, advertising the pod CIDRs of the nodes", err)
+	if podCIDRs := liqonet.GetNodesPodCIDRs(nodes); len(podCIDRs) > 0 {
+		return podCIDRs
+	}
+	return []string{defaultPodCIDR}
+}
+
+// getGatewayPrivateIP returns the tunnel private IP of the local cluster toward the foreign one, derived from the IDs of
+// the two clusters so that each peering gets its own one
+func (b *AdvertisementBroadcaster) getGatewayPrivateIP(podCIDR string) string {
+	gatewayPrivateIP, _ := liqonet.GetTunnelPrivateIPs(b.HomeClusterId, b.ForeignClusterId, liqonet.IsIPv6String(podCIDR))
+	return gatewayPrivateIP
+}
+
+// getNeighborNetworks returns the clusters the local one reaches, either directly or through its neighbors, advertised
+// to the foreign cluster so that it can reach them through the local cluster. The ones reached through the foreign
+// cluster itself are left out
+func (b *AdvertisementBroadcaster) getNeighborNetworks() []liqonetv1.NeighborNetwork {
+	if b.TunEndpointClient == nil {
+		return nil
+	}
+	tmp, err := b.TunEndpointClient.Resource("tunnelendpoints").List(metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("unable to list the TunnelEndpoints, the neighbor clusters are not advertised: %v", err)
+		return nil
+	}
+	tepList, ok := tmp.(*liqonetv1.TunnelEndpointList)
+	if !ok {
+		klog.Error("retrieved object is not a TunnelEndpointList")
+		return nil
+	}
+	return liqonet.GetNeighborNetworks(tepList.Items, b.ForeignClusterId)
+}
+
+// GetTunnelProtocols returns the tunnel protocols supported by the gateway and its public key: the gateways which did
+// not publish their protocols support wireguard only if they published their key
+func GetTunnelProtocols(nodes []corev1.Node) ([]string, string) {
+	if node := getGatewayNode(nodes); node != nil {
+		key := node.Annotations[liqonet.WireGuardPublicKeyAnnotation]
+		if protocols := node.Annotations[liqonet.TunnelProtocolsAnnotation]; protocols != "" {
+			return strings.Split(protocols, ","), key
+		}
+		if key != "" {
+			return []string{liqonet.WireGuardProtocol, liqonet.GreProtocol}, key
+		}
 	}
-	return podCIDR
+	return []string{liqonet.GreProtocol}, ""
 }
 
 func GetGateway(nodes []corev1.Node) string {
-	for _, node := range nodes {
-		if node.Labels["liqonet.liqo.io/gateway"] != "" {
-			return node.Status.Addresses[0].Address
+	if node := getGatewayNode(nodes); node != nil {
+		// the gateway behind a NAT or a load balancer publishes the address it is reachable at
+		if address, _, ok := liqonet.GetPublicEndpoint(node); ok {
+			return address
 		}
+		return node.Status.Addresses[0].Address
 	}
 	// node with required label not found, return the first one
 	return nodes[0].Status.Addresses[0].Address
 }
 
+// GetGatewayPort returns the UDP port the gateway is reachable at, if it published its public endpoint
+func GetGatewayPort(nodes []corev1.Node) int32 {
+	if node := getGatewayNode(nodes); node != nil {
+		if _, port, ok := liqonet.GetPublicEndpoint(node); ok {
+			return port
+		}
+	}
+	return 0
+}
+
+// getGatewayNode returns the active gateway node, or the first gateway node if no one has been marked as the active one
+func getGatewayNode(nodes []corev1.Node) *corev1.Node {
+	var gateway *corev1.Node
+	for i := range nodes {
+		if nodes[i].Labels[liqonet.ActiveGatewayLabelKey] == "true" {
+			return &nodes[i]
+		}
+		if gateway == nil && nodes[i].Labels[liqonet.GatewayLabelKey] != "" {
+			gateway = &nodes[i]
+		}
+	}
+	return gateway
+}
+
+// removeOffloadedPods removes from the list the pods running in the namespaces created by the foreign cluster
+func (b *AdvertisementBroadcaster) removeOffloadedPods(podList *corev1.PodList) error {
+	namespaces, err := b.LocalClient.Client().CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: nattingv1.HomeClusterIDLabel + "=" + b.ForeignClusterId,
+	})
+	if err != nil {
+		return err
+	}
+
+	offloaded := make(map[string]bool, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		offloaded[ns.Name] = true
+	}
+
+	pods := podList.Items[:0]
+	for _, pod := range podList.Items {
+		if !offloaded[pod.Namespace] {
+			pods = append(pods, pod)
+		}
+	}
+	podList.Items = pods
+	return nil
+}
+
 // get resources used by pods on physical nodes
 func GetAllPodsResources(nodeNonTerminatedPodsList *corev1.PodList) (requests corev1.ResourceList, limits corev1.ResourceList) {
 	// remove pods on virtual nodes
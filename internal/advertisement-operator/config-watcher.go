@@ -35,10 +35,20 @@ func (b *AdvertisementBroadcaster) WatchConfiguration(kubeconfigPath string, cli
 			}
 		}
 
+		changed := false
 		if configuration.Spec.AdvertisementConfig.ResourceSharingPercentage != b.ClusterConfig.AdvertisementConfig.ResourceSharingPercentage {
 			klog.V(3).Info("ClusterConfig changed")
 			b.ClusterConfig.AdvertisementConfig.ResourceSharingPercentage = configuration.Spec.AdvertisementConfig.ResourceSharingPercentage
-			// update Advertisement with new resources (given by the new sharing percentage)
+			changed = true
+		}
+		// the service CIDR is routed by the foreign cluster only if it is advertised
+		if configuration.Spec.LiqonetConfig.ServiceCIDR != b.ClusterConfig.LiqonetConfig.ServiceCIDR {
+			klog.V(3).Info("ClusterConfig changed")
+			b.ClusterConfig.LiqonetConfig.ServiceCIDR = configuration.Spec.LiqonetConfig.ServiceCIDR
+			changed = true
+		}
+		if changed {
+			// update Advertisement with new resources (given by the new sharing percentage) and network configuration
 			physicalNodes, virtualNodes, availability, limits, images, err := b.GetResourcesForAdv()
 			if err != nil {
 				klog.Errorln(err, "Error while computing resources for Advertisement")
@@ -0,0 +1,61 @@
+package advertisement_operator
+
+import (
+	"context"
+	"github.com/liqoTech/liqo/pkg/liqonet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"net"
+	"strconv"
+	"time"
+)
+
+// WatchGateway sends again the Advertisement when the active gateway or its public endpoint change, so that the foreign
+// cluster re-establishes the tunnel toward the new endpoint without waiting for the next periodic Advertisement
+func (b *AdvertisementBroadcaster) WatchGateway() {
+	var gatewayIP string
+	for {
+		physicalNodes, err := b.LocalClient.Client().CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: "type != virtual-node"})
+		if err != nil || len(physicalNodes.Items) == 0 {
+			klog.Errorln(err, "Unable to list the nodes to retrieve the gateway")
+			time.Sleep(1 * time.Minute)
+			continue
+		}
+		currentGatewayIP := net.JoinHostPort(GetGateway(physicalNodes.Items), strconv.Itoa(int(GetGatewayPort(physicalNodes.Items))))
+		// the first Advertisement is sent by GenerateAdvertisement
+		if gatewayIP != "" && currentGatewayIP != gatewayIP {
+			klog.Info("The gateway changed from " + gatewayIP + " to " + currentGatewayIP + ", updating the Advertisement for cluster " + b.ForeignClusterId)
+			if err := b.updateAdvertisement(); err != nil {
+				klog.Errorln(err, "Error while sending Advertisement to cluster "+b.ForeignClusterId)
+				time.Sleep(1 * time.Minute)
+				continue
+			}
+		}
+		gatewayIP = currentGatewayIP
+
+		// the events are triggered when the active gateway label is set on a node or removed from it,
+		// or when the active gateway is updated, e.g. it publishes a new public endpoint
+		watcher, err := b.LocalClient.Client().CoreV1().Nodes().Watch(context.TODO(), metav1.ListOptions{
+			LabelSelector:   liqonet.ActiveGatewayLabelKey + "=true",
+			ResourceVersion: physicalNodes.ResourceVersion,
+		})
+		if err != nil {
+			klog.Errorln(err, "Unable to watch the gateway nodes")
+			time.Sleep(1 * time.Minute)
+			continue
+		}
+		// wait for a change, then the nodes are listed again
+		<-watcher.ResultChan()
+		watcher.Stop()
+	}
+}
+
+func (b *AdvertisementBroadcaster) updateAdvertisement() error {
+	physicalNodes, virtualNodes, availability, limits, images, err := b.GetResourcesForAdv()
+	if err != nil {
+		return err
+	}
+	advToCreate := b.CreateAdvertisement(physicalNodes, virtualNodes, availability, images, limits)
+	_, err = b.SendAdvertisementToForeignCluster(advToCreate)
+	return err
+}
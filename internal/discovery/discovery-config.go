@@ -55,6 +55,10 @@ func (discovery *DiscoveryCtrl) handleConfiguration(config policyv1.DiscoveryCon
 			reloadCa = true
 			reloadServer = true
 		}
+		if discovery.Config.ApiUrl != config.ApiUrl {
+			discovery.Config.ApiUrl = config.ApiUrl
+			reloadServer = true
+		}
 		if discovery.Config.Service != config.Service {
 			discovery.Config.Service = config.Service
 			reloadServer = true
@@ -80,6 +84,10 @@ func (discovery *DiscoveryCtrl) handleConfiguration(config policyv1.DiscoveryCon
 			discovery.Config.EnableDiscovery = config.EnableDiscovery
 			reloadClient = true
 		}
+		if discovery.Config.DnsRegistration != config.DnsRegistration {
+			// applied by the DNS registration at the next update
+			discovery.Config.DnsRegistration = config.DnsRegistration
+		}
 		if reloadServer {
 			discovery.reloadServer()
 		}
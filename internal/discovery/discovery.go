@@ -18,6 +18,8 @@ type DiscoveryCtrl struct {
 	crdClient *crdClient.CRDClient
 	advClient *crdClient.CRDClient
 	ClusterId *clusterID.ClusterID
+	// the records published in the DNS zone the cluster is registered in
+	dnsRegistration *dnsRegistration
 }
 
 func NewDiscoveryCtrl(namespace string, clusterId *clusterID.ClusterID, kubeconfigPath string) (*DiscoveryCtrl, error) {
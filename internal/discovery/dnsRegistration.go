@@ -0,0 +1,264 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	"github.com/liqoTech/liqo/internal/discovery/kubeconfig"
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDnsRegistrationTTL = 300
+	defaultDnsService         = "_liqo._tcp"
+	// key of the Secret holding the TSIG secret
+	tsigSecretKey = "secret"
+)
+
+// the records published in the DNS zone, with the configuration they have been published with
+type dnsRegistration struct {
+	config    policyv1.DnsRegistrationConfig
+	records   []dns.RR
+	published time.Time
+}
+
+// StartDnsRegistration keeps the records of the cluster updated in the configured DNS zone until the stop channel is
+// closed, then removes them. The returned channel is closed when they have been removed
+func (discovery *DiscoveryCtrl) StartDnsRegistration(stop <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Second * time.Duration(math.Max(float64(discovery.Config.UpdateTime), 1)))
+		defer ticker.Stop()
+		for {
+			if err := discovery.RegisterDns(); err != nil {
+				klog.Error(err, err.Error())
+			}
+			select {
+			case <-stop:
+				if err := discovery.UnregisterDns(); err != nil {
+					klog.Error(err, err.Error())
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+// RegisterDns publishes the records of the cluster in the configured DNS zone when the address of the API server or
+// the TXT data changed, or their TTL expired. The records published with a previous configuration are removed
+func (discovery *DiscoveryCtrl) RegisterDns() error {
+	config := discovery.Config.DnsRegistration
+	if config.Domain == "" {
+		return discovery.UnregisterDns()
+	}
+	address, port, err := kubeconfig.GetApiServerAddress(discovery.crdClient.Client())
+	if err != nil {
+		return err
+	}
+	txt, err := discovery.GetTxtData().Encode()
+	if err != nil {
+		return err
+	}
+	records, err := getDnsRecords(&config, discovery.ClusterId.GetClusterID(), discovery.Config.Service, address, port, txt)
+	if err != nil {
+		return err
+	}
+
+	previous := discovery.dnsRegistration
+	if previous != nil && previous.config != config {
+		// the records have been published in another zone, or with other names
+		if err := discovery.UnregisterDns(); err != nil {
+			return err
+		}
+		previous = nil
+	}
+	if previous != nil && sameDnsRecords(previous.records, records) && time.Since(previous.published) < getDnsRegistrationTTL(&config) {
+		return nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(getDnsRegistrationZone(&config))
+	if previous != nil {
+		removeDnsRecords(msg, previous.records)
+	}
+	// the records left by a previous run are replaced as well
+	removeDnsRecords(msg, records)
+	msg.Insert(records)
+	if err := discovery.sendDnsUpdate(&config, msg); err != nil {
+		return err
+	}
+	discovery.dnsRegistration = &dnsRegistration{
+		config:    config,
+		records:   records,
+		published: time.Now(),
+	}
+	klog.Info("Cluster registered in DNS domain " + config.Domain + " with API server " + net.JoinHostPort(address, port))
+	return nil
+}
+
+// UnregisterDns removes the records of the cluster from the DNS zone they have been published in
+func (discovery *DiscoveryCtrl) UnregisterDns() error {
+	previous := discovery.dnsRegistration
+	if previous == nil {
+		return nil
+	}
+	msg := new(dns.Msg)
+	msg.SetUpdate(getDnsRegistrationZone(&previous.config))
+	removeDnsRecords(msg, previous.records)
+	if err := discovery.sendDnsUpdate(&previous.config, msg); err != nil {
+		return err
+	}
+	discovery.dnsRegistration = nil
+	klog.Info("Cluster unregistered from DNS domain " + previous.config.Domain)
+	return nil
+}
+
+func (discovery *DiscoveryCtrl) sendDnsUpdate(config *policyv1.DnsRegistrationConfig, msg *dns.Msg) error {
+	c := new(dns.Client)
+	c.DialTimeout = 30 * time.Second
+	// the signed updates easily exceed the size of the UDP messages
+	c.Net = "tcp"
+	if config.TsigKeyName != "" {
+		secret, err := discovery.getTsigSecret(config.TsigSecretName)
+		if err != nil {
+			return err
+		}
+		keyName := strings.ToLower(dns.Fqdn(config.TsigKeyName))
+		c.TsigSecret = map[string]string{keyName: secret}
+		msg.SetTsig(keyName, getTsigAlgorithm(config), 300, time.Now().Unix())
+	}
+	server := config.Server
+	if server == "" {
+		server = discovery.Config.DnsServer
+	}
+	in, _, err := c.Exchange(msg, server)
+	if err != nil {
+		return err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update of DNS zone %s refused by %s: %s", msg.Question[0].Name, server, dns.RcodeToString[in.Rcode])
+	}
+	return nil
+}
+
+func (discovery *DiscoveryCtrl) getTsigSecret(secretName string) (string, error) {
+	if secretName == "" {
+		return "", errors.New("no Secret set for the TSIG key")
+	}
+	secret, err := discovery.crdClient.Client().CoreV1().Secrets(discovery.Namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[tsigSecretKey]
+	if !ok {
+		return "", fmt.Errorf("Secret %s has no %s key", secretName, tsigSecretKey)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// the records registering a cluster in a DNS domain: the PTR record of the domain pointing to the instance of the
+// cluster, the SRV record of the instance pointing to the API server and its TXT record. When the API server is
+// reached by IP the SRV record points to an A or AAAA record named after the cluster
+func getDnsRecords(config *policyv1.DnsRegistrationConfig, clusterID string, service string, address string, port string, txt []string) ([]dns.RR, error) {
+	if service == "" {
+		service = defaultDnsService
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server port %s: %v", port, err)
+	}
+	domain := dns.Fqdn(config.Domain)
+	instance := clusterID + "." + service + "." + domain
+	ttl := uint32(getDnsRegistrationTTL(config).Seconds())
+
+	records := []dns.RR{
+		&dns.PTR{
+			Hdr: dns.RR_Header{Name: domain, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+			Ptr: instance,
+		},
+	}
+	target := dns.Fqdn(address)
+	if ip := net.ParseIP(address); ip != nil {
+		target = clusterID + "." + domain
+		if ip.To4() != nil {
+			records = append(records, &dns.A{
+				Hdr: dns.RR_Header{Name: target, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+				A:   ip.To4(),
+			})
+		} else {
+			records = append(records, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: target, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+				AAAA: ip,
+			})
+		}
+	}
+	records = append(records,
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: instance, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: ttl},
+			Port:   uint16(portNumber),
+			Target: target,
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+			Txt: txt,
+		},
+	)
+	return records, nil
+}
+
+// the names of the cluster are owned by it and removed entirely, while the PTR record of the domain is shared with
+// the other clusters and only the one pointing to the cluster is removed
+func removeDnsRecords(msg *dns.Msg, records []dns.RR) {
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypePTR {
+			// the record is modified to mark its removal
+			msg.Remove([]dns.RR{dns.Copy(rr)})
+		} else {
+			msg.RemoveName([]dns.RR{rr})
+		}
+	}
+}
+
+func sameDnsRecords(a []dns.RR, b []dns.RR) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+func getDnsRegistrationZone(config *policyv1.DnsRegistrationConfig) string {
+	if config.Zone != "" {
+		return dns.Fqdn(config.Zone)
+	}
+	return dns.Fqdn(config.Domain)
+}
+
+func getDnsRegistrationTTL(config *policyv1.DnsRegistrationConfig) time.Duration {
+	if config.TTL > 0 {
+		return time.Duration(config.TTL) * time.Second
+	}
+	return defaultDnsRegistrationTTL * time.Second
+}
+
+func getTsigAlgorithm(config *policyv1.DnsRegistrationConfig) string {
+	if config.TsigAlgorithm == "" {
+		return dns.HmacSHA256
+	}
+	return dns.Fqdn(config.TsigAlgorithm)
+}
@@ -193,6 +193,20 @@ func (r *ForeignClusterReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 	if fc.Status.Outgoing.CaDataRef == nil && fc.Spec.AllowUntrustedCA {
 		klog.Info("Get CA Data")
 		err = fc.LoadForeignCA(r.crdClient.Client(), r.Namespace, r.ForeignConfig)
+		var mismatch *discoveryv1.CaFingerprintMismatchError
+		if goerrors.As(err, &mismatch) {
+			// the peering is blocked until the expected fingerprint or the CA of the foreign cluster change,
+			// the reason is reported in the CaVerified condition
+			klog.Error("CA of ForeignCluster " + fc.Name + " not trusted: " + err.Error())
+			_, err = r.crdClient.Resource("foreignclusters").Update(fc.Name, fc, metav1.UpdateOptions{})
+			if err != nil {
+				klog.Error(err, err.Error())
+			}
+			return ctrl.Result{
+				Requeue:      true,
+				RequeueAfter: r.RequeueAfter,
+			}, err
+		}
 		if err != nil {
 			klog.Error(err, err.Error())
 			return ctrl.Result{
@@ -520,6 +534,12 @@ func (r *ForeignClusterReconciler) createClusterRoleIfNotExists(clusterID string
 					APIGroups: []string{"protocol.liqo.io", ""},
 					Resources: []string{"advertisements", "advertisements/status", "secrets"},
 				},
+				// the NetworkConfigs are written by the network operator of the foreign cluster
+				{
+					Verbs:     []string{"get", "list", "create", "update", "delete", "watch"},
+					APIGroups: []string{"liqonet.liqo.io"},
+					Resources: []string{"networkconfigs", "networkconfigs/status"},
+				},
 			},
 		}
 		return r.crdClient.Client().RbacV1().ClusterRoles().Create(context.TODO(), role, metav1.CreateOptions{})
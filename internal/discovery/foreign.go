@@ -7,6 +7,7 @@ import (
 	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog"
+	"reflect"
 )
 
 // 1. checks if cluster ID is already known
@@ -134,6 +135,7 @@ func (discovery *DiscoveryCtrl) createForeign(txtData *TxtData, sd *v1.SearchDom
 			AllowUntrustedCA: txtData.AllowUntrustedCA,
 		},
 	}
+	setTxtInfo(&fc.Spec, txtData)
 	if discovery.Config.AutoJoin && !txtData.AllowUntrustedCA {
 		fc.Spec.Join = true
 	} else if discovery.Config.AutoJoinUntrusted && txtData.AllowUntrustedCA {
@@ -168,11 +170,13 @@ func (discovery *DiscoveryCtrl) createForeign(txtData *TxtData, sd *v1.SearchDom
 }
 
 func (discovery *DiscoveryCtrl) CheckUpdate(txtData *TxtData, fc *v1.ForeignCluster, discoveryType v1.DiscoveryType) (*v1.ForeignCluster, error) {
-	if fc.Spec.ApiUrl != txtData.ApiUrl || fc.Spec.Namespace != txtData.Namespace || fc.Spec.AllowUntrustedCA != txtData.AllowUntrustedCA {
+	if fc.Spec.ApiUrl != txtData.ApiUrl || fc.Spec.Namespace != txtData.Namespace || fc.Spec.AllowUntrustedCA != txtData.AllowUntrustedCA ||
+		fc.Spec.CaFingerprint != txtData.CaFingerprint {
 		fc.Spec.ApiUrl = txtData.ApiUrl
 		fc.Spec.Namespace = txtData.Namespace
 		fc.Spec.AllowUntrustedCA = txtData.AllowUntrustedCA
 		fc.Spec.DiscoveryType = discoveryType
+		setTxtInfo(&fc.Spec, txtData)
 		if fc.Status.Outgoing.CaDataRef != nil {
 			err := discovery.crdClient.Client().CoreV1().Secrets(fc.Status.Outgoing.CaDataRef.Namespace).Delete(context.TODO(), fc.Status.Outgoing.CaDataRef.Name, metav1.DeleteOptions{})
 			if err != nil {
@@ -217,5 +221,36 @@ func (discovery *DiscoveryCtrl) CheckUpdate(txtData *TxtData, fc *v1.ForeignClus
 		}
 		return fc, nil
 	}
+	if !isTxtInfoUpdated(&fc.Spec, txtData) {
+		// the descriptive data changed, e.g. the foreign cluster has been upgraded, the peering is kept
+		setTxtInfo(&fc.Spec, txtData)
+		tmp, err := discovery.crdClient.Resource("foreignclusters").Update(fc.Name, fc, metav1.UpdateOptions{})
+		if err != nil {
+			klog.Error(err, err.Error())
+			return nil, err
+		}
+		fc, ok := tmp.(*v1.ForeignCluster)
+		if !ok {
+			err = errors.New("retrieved object is not a ForeignCluster")
+			klog.Error(err, err.Error())
+			return nil, err
+		}
+		return fc, nil
+	}
 	return fc, nil
 }
+
+// the data advertised by the versioned TXT records, the ones of the clusters using the first format are left empty
+func setTxtInfo(spec *v1.ForeignClusterSpec, txtData *TxtData) {
+	spec.ClusterName = txtData.ClusterName
+	spec.LiqoVersion = txtData.LiqoVersion
+	spec.NetworkProtocols = txtData.NetworkProtocols
+	spec.CaFingerprint = txtData.CaFingerprint
+	spec.Capabilities = txtData.Capabilities
+}
+
+func isTxtInfoUpdated(spec *v1.ForeignClusterSpec, txtData *TxtData) bool {
+	return spec.ClusterName == txtData.ClusterName && spec.LiqoVersion == txtData.LiqoVersion &&
+		reflect.DeepEqual(spec.NetworkProtocols, txtData.NetworkProtocols) && spec.CaFingerprint == txtData.CaFingerprint &&
+		reflect.DeepEqual(spec.Capabilities, txtData.Capabilities)
+}
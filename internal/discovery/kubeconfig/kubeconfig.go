@@ -24,18 +24,36 @@ func CreateKubeConfig(clientset kubernetes.Interface, serviceAccountName string,
 		return "", err
 	}
 
+	address, port, err := GetApiServerAddress(clientset)
+	if err != nil {
+		return "", err
+	}
+
+	token := string(secret.Data["token"])
+	server := "https://" + address + ":" + port
+
+	cnf := kubeconfigutil.CreateWithToken(server, "service-cluster", serviceAccountName, secret.Data["ca.crt"], token)
+	r, err := runtime.Encode(clientcmdlatest.Codec, cnf)
+	if err != nil {
+		return "", err
+	}
+	return string(r), nil
+}
+
+// this function returns the address and the port the API server is reachable at from the other clusters
+func GetApiServerAddress(clientset kubernetes.Interface) (string, string, error) {
 	address, ok := os.LookupEnv("APISERVER")
 	if !ok || address == "" {
 		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), v1.ListOptions{
 			LabelSelector: "node-role.kubernetes.io/master",
 		})
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		if len(nodes.Items) == 0 || len(nodes.Items[0].Status.Addresses) == 0 {
 			err = errors.New("no APISERVER env variable found and no master node found, one of the two values must be present")
 			klog.Error(err, err.Error())
-			return "", err
+			return "", "", err
 		}
 		address = nodes.Items[0].Status.Addresses[0].Address
 	}
@@ -44,14 +62,5 @@ func CreateKubeConfig(clientset kubernetes.Interface, serviceAccountName string,
 	if !ok {
 		port = "6443"
 	}
-
-	token := string(secret.Data["token"])
-	server := "https://" + address + ":" + port
-
-	cnf := kubeconfigutil.CreateWithToken(server, "service-cluster", serviceAccountName, secret.Data["ca.crt"], token)
-	r, err := runtime.Encode(clientcmdlatest.Codec, cnf)
-	if err != nil {
-		return "", err
-	}
-	return string(r), nil
+	return address, port, nil
 }
@@ -1,23 +1,76 @@
 package discovery
 
 import (
+	"context"
 	"errors"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	"github.com/liqoTech/liqo/pkg/liqonet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 )
 
+// TxtVersion is the version of the format of the TXT records. The records without version are the ones of the first
+// format, carrying only id, namespace and untrusted-ca. A new version only adds keys, the unknown ones are ignored
+const TxtVersion = 2
+
+const (
+	// the cluster negotiates the network parameters through the NetworkConfigs
+	CapabilityNetworkConfig = "network-config"
+	// the cluster routes toward the clusters it is peered with
+	CapabilityTransitRoutes = "transit-routes"
+)
+
+// the optional features supported by the local cluster, advertised to the other clusters
+var localCapabilities = []string{CapabilityNetworkConfig, CapabilityTransitRoutes}
+
 type TxtData struct {
 	ID               string
 	Namespace        string
 	AllowUntrustedCA bool
 	ApiUrl           string
+	// the version of the format the data has been decoded from
+	Version          int
+	ClusterName      string
+	LiqoVersion      string
+	NetworkProtocols []string
+	CaFingerprint    string
+	Capabilities     []string
 }
 
 func (txtData TxtData) Encode() ([]string, error) {
 	res := []string{
+		"txtvers=" + strconv.Itoa(TxtVersion),
 		"id=" + txtData.ID,
 		"namespace=" + txtData.Namespace,
 		"untrusted-ca=" + txtData.GetAllowUntrustedCA(),
 	}
+	// the optional keys are left out when empty
+	optional := []struct {
+		key   string
+		value string
+	}{
+		{"name", txtData.ClusterName},
+		{"version", txtData.LiqoVersion},
+		{"api-url", txtData.ApiUrl},
+		{"protocols", strings.Join(txtData.NetworkProtocols, ",")},
+		{"ca-fingerprint", txtData.CaFingerprint},
+		{"capabilities", strings.Join(txtData.Capabilities, ",")},
+	}
+	for _, item := range optional {
+		if item.value == "" {
+			continue
+		}
+		entry := item.key + "=" + item.value
+		// each string of a TXT record is limited to 255 bytes
+		if len(entry) > 255 {
+			return nil, errors.New("TXT entry " + item.key + " exceeds 255 bytes")
+		}
+		res = append(res, entry)
+	}
 	return res, nil
 }
 
@@ -29,28 +82,106 @@ func (txtData *TxtData) GetAllowUntrustedCA() string {
 	}
 }
 
+// Decode reads the TXT data of a cluster resolved at the given address and port, which give its API URL when no
+// explicit one is advertised
 func Decode(address string, port string, data []string) (*TxtData, error) {
-	var res = TxtData{}
+	var res = TxtData{
+		Version: 1,
+	}
 	for _, d := range data {
-		if strings.HasPrefix(d, "id=") {
-			res.ID = d[len("id="):]
-		} else if strings.HasPrefix(d, "namespace=") {
-			res.Namespace = d[len("namespace="):]
-		} else if strings.HasPrefix(d, "untrusted-ca=") {
-			res.AllowUntrustedCA = d[len("untrusted-ca="):] == "true"
+		kv := strings.SplitN(d, "=", 2)
+		if len(kv) != 2 {
+			continue
 		}
+		// keys are case insensitive
+		key, value := strings.ToLower(kv[0]), kv[1]
+		switch key {
+		case "txtvers":
+			if version, err := strconv.Atoi(value); err == nil && version > 0 {
+				res.Version = version
+			}
+		case "id":
+			res.ID = value
+		case "namespace":
+			res.Namespace = value
+		case "untrusted-ca":
+			res.AllowUntrustedCA = value == "true"
+		case "name":
+			res.ClusterName = value
+		case "version":
+			res.LiqoVersion = value
+		case "api-url":
+			if u, err := url.Parse(value); err == nil && u.Scheme == "https" && u.Host != "" {
+				res.ApiUrl = value
+			} else {
+				klog.Warning("invalid api-url " + value + " in TXT data, the resolved address is used")
+			}
+		case "protocols":
+			res.NetworkProtocols = splitTxtList(value)
+		case "ca-fingerprint":
+			res.CaFingerprint = discoveryv1.NormalizeCaFingerprint(value)
+		case "capabilities":
+			res.Capabilities = splitTxtList(value)
+		}
+	}
+	if res.ApiUrl == "" {
+		res.ApiUrl = "https://" + address + ":" + port
 	}
-	res.ApiUrl = "https://" + address + ":" + port
 	if res.ID == "" || res.Namespace == "" || res.ApiUrl == "" {
 		return nil, errors.New("TxtData missing required field")
 	}
 	return &res, nil
 }
 
+func splitTxtList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
 func (discovery *DiscoveryCtrl) GetTxtData() TxtData {
 	return TxtData{
 		ID:               discovery.ClusterId.GetClusterID(),
 		Namespace:        discovery.Namespace,
 		AllowUntrustedCA: discovery.Config.AllowUntrustedCA,
+		ApiUrl:           discovery.Config.ApiUrl,
+		Version:          TxtVersion,
+		ClusterName:      discovery.Config.Name,
+		LiqoVersion:      os.Getenv("LIQO_VERSION"),
+		NetworkProtocols: discovery.getNetworkProtocols(),
+		CaFingerprint:    discovery.getCaFingerprint(),
+		Capabilities:     localCapabilities,
+	}
+}
+
+// the protocols published by the active gateway, none if they are not known yet
+func (discovery *DiscoveryCtrl) getNetworkProtocols() []string {
+	node, err := liqonet.GetActiveGateway(discovery.crdClient.Client())
+	if err != nil {
+		klog.V(4).Info("network protocols not advertised: " + err.Error())
+		return nil
+	}
+	return splitTxtList(node.Annotations[liqonet.TunnelProtocolsAnnotation])
+}
+
+// the fingerprint of the CA of the cluster, read from the service account tokens
+func (discovery *DiscoveryCtrl) getCaFingerprint() string {
+	secrets, err := discovery.crdClient.Client().CoreV1().Secrets(discovery.Namespace).List(context.TODO(), metav1.ListOptions{
+		Limit:         1,
+		FieldSelector: "type=kubernetes.io/service-account-token",
+	})
+	if err != nil || len(secrets.Items) == 0 {
+		klog.Warning("CA fingerprint not advertised: no service account token found")
+		return ""
+	}
+	fingerprint, err := discoveryv1.GetCaFingerprint(secrets.Items[0].Data["ca.crt"])
+	if err != nil {
+		klog.Warning("CA fingerprint not advertised: " + err.Error())
+		return ""
 	}
+	return fingerprint
 }
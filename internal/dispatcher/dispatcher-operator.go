@@ -18,11 +18,18 @@ import (
 	"time"
 )
 
+//OriginClusterLabel is set on the resources owned by the cluster they have been created in, e.g. the NetworkConfigs.
+//They are replicated only by that cluster, and only to the cluster set in their spec.clusterID when it is set, hence
+//their replicas are never sent back to the cluster they come from
+const OriginClusterLabel = "liqonet.liqo.io/origin-cluster-id"
+
 // +kubebuilder:rbac:groups=discovery.liqo.io,resources=foreignclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=discovery.liqo.io,resources=foreignclusters/status,verbs=get;update;patch
 
 type DispatcherReconciler struct {
 	Scheme *runtime.Scheme
+	//the ID of the local cluster, the resources labeled with another origin cluster are not replicated
+	LocalClusterID string
 	//for each remote cluster we save dynamic client connected to its API server
 	RemoteDynClients map[string]dynamic.Interface
 	//dynamic client pointing to the local API server
@@ -247,8 +254,31 @@ func (d *DispatcherReconciler) GetResource(client dynamic.Interface, gvr schema.
 	}
 }
 
-func (d *DispatcherReconciler) AddedHandler(obj *unstructured.Unstructured, gvr schema.GroupVersionResource) {
+//returns the remote clusters the resource is replicated to
+func (d *DispatcherReconciler) getDestinationClusters(obj *unstructured.Unstructured) []string {
+	origin, ok := obj.GetLabels()[OriginClusterLabel]
+	if ok && origin != d.LocalClusterID {
+		//it is the replica of a resource owned by another cluster
+		return nil
+	}
+	if ok {
+		destination, found, err := unstructured.NestedString(obj.Object, "spec", "clusterID")
+		if err == nil && found && destination != "" {
+			if _, ok := d.RemoteDynClients[destination]; !ok {
+				return nil
+			}
+			return []string{destination}
+		}
+	}
+	clusters := make([]string, 0, len(d.RemoteDynClients))
 	for cluster := range d.RemoteDynClients {
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+func (d *DispatcherReconciler) AddedHandler(obj *unstructured.Unstructured, gvr schema.GroupVersionResource) {
+	for _, cluster := range d.getDestinationClusters(obj) {
 		err := d.CreateResource(d.RemoteDynClients[cluster], gvr, obj, cluster)
 		if err != nil {
 			klog.Error(err)
@@ -257,7 +287,7 @@ func (d *DispatcherReconciler) AddedHandler(obj *unstructured.Unstructured, gvr
 }
 
 func (d *DispatcherReconciler) ModifiedHandler(obj *unstructured.Unstructured, gvr schema.GroupVersionResource) {
-	for cluster := range d.RemoteDynClients {
+	for _, cluster := range d.getDestinationClusters(obj) {
 		name := obj.GetName()
 		namespace := obj.GetNamespace()
 		client := d.RemoteDynClients[cluster]
@@ -287,7 +317,7 @@ func (d *DispatcherReconciler) ModifiedHandler(obj *unstructured.Unstructured, g
 }
 
 func (d *DispatcherReconciler) DeletedHandler(obj *unstructured.Unstructured, gvr schema.GroupVersionResource) {
-	for cluster := range d.RemoteDynClients {
+	for _, cluster := range d.getDestinationClusters(obj) {
 		name := obj.GetName()
 		namespace := obj.GetNamespace()
 		client := d.RemoteDynClients[cluster]
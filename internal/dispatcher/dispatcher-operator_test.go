@@ -382,3 +382,27 @@ func TestGetStatus(t *testing.T) {
 	assert.Nil(t, err, "error should be nil")
 	assert.Nil(t, objStatus, "the spec should be nil")
 }
+
+func TestDispatcherReconciler_GetDestinationClusters(t *testing.T) {
+	d := DispatcherReconciler{
+		LocalClusterID: "cluster-a",
+		RemoteDynClients: map[string]dynamic.Interface{
+			"cluster-b": dynClient,
+			"cluster-c": dynClient,
+		},
+	}
+	//test 1
+	//the resource without the origin label is replicated on all the clusters
+	networkConfig := getObj()
+	assert.ElementsMatch(t, []string{"cluster-b", "cluster-c"}, d.getDestinationClusters(networkConfig))
+	//test 2
+	//the resource created by the local cluster is replicated only on the cluster it is destined to
+	networkConfig.SetLabels(map[string]string{OriginClusterLabel: "cluster-a"})
+	assert.Nil(t, unstructured.SetNestedField(networkConfig.Object, "cluster-b", "spec", "clusterID"))
+	assert.Equal(t, []string{"cluster-b"}, d.getDestinationClusters(networkConfig))
+	//test 3
+	//the replica of a resource created by another cluster is not sent back
+	networkConfig.SetLabels(map[string]string{OriginClusterLabel: "cluster-b"})
+	assert.Nil(t, unstructured.SetNestedField(networkConfig.Object, "cluster-a", "spec", "clusterID"))
+	assert.Empty(t, d.getDestinationClusters(networkConfig))
+}
@@ -0,0 +1,226 @@
+package garbage_collector
+
+import (
+	"context"
+	"errors"
+	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPeriod is the default interval between two collections
+	DefaultPeriod = 5 * time.Minute
+	// DefaultGracePeriod is the default time a resource has to be orphaned before being deleted
+	DefaultGracePeriod = 10 * time.Minute
+)
+
+// resourceCollector lists and deletes a kind of resources created on behalf of a remote cluster
+type resourceCollector interface {
+	// kind returns a human readable name of the collected resources
+	kind() string
+	// list returns the collected resources, indexed by name, with the id of the cluster owning them
+	list() (map[string]string, error)
+	delete(name string) error
+}
+
+// GarbageCollector periodically deletes the resources created on behalf of clusters with which
+// a peering does not exist anymore, e.g. after a crash of the virtual kubelet or an abrupt unpeering
+type GarbageCollector struct {
+	// activeClusters returns the ids of the clusters with which a peering currently exists
+	activeClusters func() (map[string]bool, error)
+	collectors     []resourceCollector
+	gracePeriod    time.Duration
+
+	// orphans contains, for each orphaned resource, the first time it has been found orphaned
+	orphans map[string]time.Time
+}
+
+// NewHomeGarbageCollector returns the collector to be run on the home side of the peerings: it deletes the
+// NamespaceNattingTables of the foreign clusters which do not send an Advertisement anymore
+func NewHomeGarbageCollector(advClient, nattingClient *crdClient.CRDClient, gracePeriod time.Duration) *GarbageCollector {
+	return &GarbageCollector{
+		activeClusters: func() (map[string]bool, error) {
+			tmp, err := advClient.Resource("advertisements").List(metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			advList, ok := tmp.(*protocolv1.AdvertisementList)
+			if !ok {
+				return nil, errors.New("retrieved object is not an AdvertisementList")
+			}
+			clusters := make(map[string]bool, len(advList.Items))
+			for _, adv := range advList.Items {
+				clusters[adv.Spec.ClusterId] = true
+			}
+			return clusters, nil
+		},
+		collectors: []resourceCollector{
+			&nattingTableCollector{client: nattingClient},
+		},
+		gracePeriod: gracePeriod,
+		orphans:     make(map[string]time.Time),
+	}
+}
+
+// NewProviderGarbageCollector returns the collector to be run on the provider side of the peerings: it deletes the
+// natted namespaces, with all the reflected objects and pods, of the home clusters which have no PeeringRequest anymore
+func NewProviderGarbageCollector(discoveryClient *crdClient.CRDClient, gracePeriod time.Duration) *GarbageCollector {
+	return &GarbageCollector{
+		activeClusters: func() (map[string]bool, error) {
+			tmp, err := discoveryClient.Resource("peeringrequests").List(metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			prList, ok := tmp.(*discoveryv1.PeeringRequestList)
+			if !ok {
+				return nil, errors.New("retrieved object is not a PeeringRequestList")
+			}
+			clusters := make(map[string]bool, len(prList.Items))
+			for _, pr := range prList.Items {
+				clusters[pr.Name] = true
+			}
+			return clusters, nil
+		},
+		collectors: []resourceCollector{
+			&namespaceCollector{client: discoveryClient.Client()},
+		},
+		gracePeriod: gracePeriod,
+		orphans:     make(map[string]time.Time),
+	}
+}
+
+// Start runs a collection every period, until the stop channel is closed
+func (gc *GarbageCollector) Start(period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		gc.Collect()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect deletes the resources which have been orphaned for more than the grace period
+func (gc *GarbageCollector) Collect() {
+	active, err := gc.activeClusters()
+	if err != nil {
+		// never delete anything without knowing the active peerings
+		klog.Errorf("garbage collection skipped, cannot get the active peerings - %v", err)
+		return
+	}
+
+	now := time.Now()
+	found := make(map[string]bool)
+
+	for _, c := range gc.collectors {
+		resources, err := c.list()
+		if err != nil {
+			klog.Errorf("cannot list the %v to collect - %v", c.kind(), err)
+			continue
+		}
+
+		for name, clusterID := range resources {
+			if active[clusterID] {
+				continue
+			}
+
+			key := strings.Join([]string{c.kind(), name}, "/")
+			found[key] = true
+			firstSeen, ok := gc.orphans[key]
+			if !ok {
+				klog.V(3).Infof("%v %v of cluster %v is orphaned", c.kind(), name, clusterID)
+				gc.orphans[key] = now
+				firstSeen = now
+			}
+			if now.Sub(firstSeen) < gc.gracePeriod {
+				continue
+			}
+
+			if err := c.delete(name); err != nil && !kerrors.IsNotFound(err) {
+				klog.Errorf("cannot delete orphaned %v %v - %v", c.kind(), name, err)
+				continue
+			}
+			klog.Infof("orphaned %v %v of cluster %v deleted", c.kind(), name, clusterID)
+			delete(gc.orphans, key)
+		}
+	}
+
+	// forget the resources which have been deleted or adopted again in the meanwhile
+	for key := range gc.orphans {
+		if !found[key] {
+			delete(gc.orphans, key)
+		}
+	}
+}
+
+// namespaceCollector collects the namespaces created by the virtual kubelets of remote clusters,
+// the deletion of a namespace deletes all the objects reflected in it
+type namespaceCollector struct {
+	client kubernetes.Interface
+}
+
+func (c *namespaceCollector) kind() string {
+	return "namespace"
+}
+
+func (c *namespaceCollector) list() (map[string]string, error) {
+	namespaces, err := c.client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: nattingv1.HomeClusterIDLabel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make(map[string]string, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		resources[ns.Name] = ns.Labels[nattingv1.HomeClusterIDLabel]
+	}
+	return resources, nil
+}
+
+func (c *namespaceCollector) delete(name string) error {
+	return c.client.CoreV1().Namespaces().Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
+
+// nattingTableCollector collects the NamespaceNattingTables created by the local virtual kubelets
+type nattingTableCollector struct {
+	client *crdClient.CRDClient
+}
+
+func (c *nattingTableCollector) kind() string {
+	return "namespacenattingtable"
+}
+
+func (c *nattingTableCollector) list() (map[string]string, error) {
+	tmp, err := c.client.Resource("namespacenattingtables").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ntList, ok := tmp.(*nattingv1.NamespaceNattingTableList)
+	if !ok {
+		return nil, errors.New("retrieved object is not a NamespaceNattingTableList")
+	}
+
+	resources := make(map[string]string, len(ntList.Items))
+	for _, nt := range ntList.Items {
+		resources[nt.Name] = nt.Spec.ClusterId
+	}
+	return resources, nil
+}
+
+func (c *nattingTableCollector) delete(name string) error {
+	return c.client.Resource("namespacenattingtables").Delete(name, metav1.DeleteOptions{})
+}
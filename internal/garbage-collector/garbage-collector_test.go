@@ -0,0 +1,80 @@
+package garbage_collector
+
+import (
+	"context"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func newNamespace(name, clusterID string) *v1.Namespace {
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if clusterID != "" {
+		ns.Labels = map[string]string{nattingv1.HomeClusterIDLabel: clusterID}
+	}
+	return ns
+}
+
+func TestGarbageCollector(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newNamespace("test-active", "active"),
+		newNamespace("test-orphan", "orphan"),
+		newNamespace("local", ""),
+	)
+
+	gc := &GarbageCollector{
+		activeClusters: func() (map[string]bool, error) {
+			return map[string]bool{"active": true}, nil
+		},
+		collectors:  []resourceCollector{&namespaceCollector{client: client}},
+		gracePeriod: 100 * time.Millisecond,
+		orphans:     make(map[string]time.Time),
+	}
+
+	// the orphaned namespace is not deleted before the grace period
+	gc.Collect()
+	_, err := client.CoreV1().Namespaces().Get(context.TODO(), "test-orphan", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, gc.orphans, 1)
+
+	time.Sleep(200 * time.Millisecond)
+	gc.Collect()
+
+	_, err = client.CoreV1().Namespaces().Get(context.TODO(), "test-orphan", metav1.GetOptions{})
+	assert.Error(t, err)
+	_, err = client.CoreV1().Namespaces().Get(context.TODO(), "test-active", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.CoreV1().Namespaces().Get(context.TODO(), "local", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, gc.orphans, 0)
+}
+
+func TestGarbageCollectorReadoption(t *testing.T) {
+	client := fake.NewSimpleClientset(newNamespace("test-peer", "peer"))
+	active := map[string]bool{}
+
+	gc := &GarbageCollector{
+		activeClusters: func() (map[string]bool, error) {
+			return active, nil
+		},
+		collectors:  []resourceCollector{&namespaceCollector{client: client}},
+		gracePeriod: 100 * time.Millisecond,
+		orphans:     make(map[string]time.Time),
+	}
+
+	gc.Collect()
+	assert.Len(t, gc.orphans, 1)
+
+	// the peering is established again before the end of the grace period
+	active["peer"] = true
+	time.Sleep(200 * time.Millisecond)
+	gc.Collect()
+
+	_, err := client.CoreV1().Namespaces().Get(context.TODO(), "test-peer", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, gc.orphans, 0)
+}
@@ -58,16 +58,13 @@ func (p *KubernetesProvider) createConfigMap(cm *corev1.ConfigMap, namespace str
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        cm.Name,
 			Namespace:   namespace,
-			Labels:      cm.Labels,
+			Labels:      p.foreignLabels(cm.Labels),
 			Annotations: nil,
 		},
 		Data:       cm.Data,
 		BinaryData: cm.BinaryData,
 	}
 
-	if cmRemote.Labels == nil {
-		cmRemote.Labels = make(map[string]string)
-	}
 	cmRemote.Labels["liqo/reflection"] = "reflected"
 
 	_, err := p.foreignClient.Client().CoreV1().ConfigMaps(namespace).Create(context.TODO(), &cmRemote, metav1.CreateOptions{})
@@ -85,6 +82,7 @@ func (p *KubernetesProvider) updateConfigMap(cm *corev1.ConfigMap, namespace str
 	cm2.SetNamespace(namespace)
 	cm2.SetResourceVersion(cmOld.ResourceVersion)
 	cm2.SetUID(cmOld.UID)
+	cm2.SetLabels(p.foreignLabels(cm.Labels))
 	_, err = p.foreignClient.Client().CoreV1().ConfigMaps(namespace).Update(context.TODO(), cm2, metav1.UpdateOptions{})
 
 	return err
@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"context"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -52,6 +53,7 @@ func (p *KubernetesProvider) manageEpEvent(endpoints *corev1.Endpoints) error {
 	if foreignEps.Labels == nil {
 		foreignEps.Labels = make(map[string]string)
 	}
+	foreignEps.Labels[nattingv1.HomeClusterIDLabel] = p.homeClusterID
 	foreignEps.Namespace = nattedNS
 	_, err = p.foreignClient.Client().CoreV1().Endpoints(nattedNS).Update(context.TODO(), foreignEps, metav1.UpdateOptions{})
 	if err != nil {
@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
 	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
 	"github.com/liqoTech/liqo/internal/node"
 	"github.com/liqoTech/liqo/pkg/crdClient"
@@ -24,6 +25,7 @@ type KubernetesProvider struct { // nolint:golint]
 	nodeUpdateClient   *crdClient.CRDClient
 	foreignClient      *crdClient.CRDClient
 	homeClient         *crdClient.CRDClient
+	tunEndpointClient  *crdClient.CRDClient
 	nodeName           string
 	operatingSystem    string
 	internalIP         string
@@ -37,6 +39,8 @@ type KubernetesProvider struct { // nolint:golint]
 	providerKubeconfig string
 	restConfig         *rest.Config
 	RemappedPodCidr    string
+	advertisedQuota    v1.ResourceList
+	unjoining          bool
 
 	foreignPodWatcherStop chan struct{}
 	nodeUpdateStop        chan struct{}
@@ -61,6 +65,11 @@ func NewKubernetesProvider(nodeName, clusterId, homeClusterId, operatingSystem s
 		return nil, err
 	}
 
+	tunEndpointClient, err := liqonetv1.CreateTunnelEndpointClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
 	restConfig, err := crdClient.NewKubeconfig(remoteKubeConfig, &schema.GroupVersion{})
 	if err != nil {
 		return nil, err
@@ -90,6 +99,7 @@ func NewKubernetesProvider(nodeName, clusterId, homeClusterId, operatingSystem s
 		restConfig:            restConfig,
 		foreignClient:         foreignClient,
 		nodeUpdateClient:      advClient,
+		tunEndpointClient:     tunEndpointClient,
 	}
 
 	return &provider, nil
@@ -2,9 +2,12 @@ package kubernetes
 
 import (
 	"fmt"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	"github.com/liqoTech/liqo/pkg/liqonet"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"net"
 	"strings"
 	"time"
 )
@@ -12,7 +15,7 @@ import (
 func F2HTranslate(podForeignIn *v1.Pod, newCidr, namespace string) (podHomeOut *v1.Pod) {
 	podHomeOut = podForeignIn.DeepCopy()
 	podHomeOut.SetNamespace(namespace)
-	podHomeOut.SetUID(types.UID(podForeignIn.Annotations["home_uuid"]))
+	podHomeOut.SetUID(types.UID(podForeignIn.Annotations[homeUIDAnnotation]))
 	podHomeOut.SetResourceVersion(podForeignIn.Annotations["home_resourceVersion"])
 	t, err := time.Parse("2006-01-02 15:04:05 -0700 MST", podForeignIn.Annotations["home_creationTimestamp"])
 	if err != nil {
@@ -31,8 +34,9 @@ func F2HTranslate(podForeignIn *v1.Pod, newCidr, namespace string) (podHomeOut *
 	podHomeOut.Spec.NodeName = podForeignIn.Annotations["home_nodename"]
 	delete(podHomeOut.Annotations, "home_creationTimestamp")
 	delete(podHomeOut.Annotations, "home_resourceVersion")
-	delete(podHomeOut.Annotations, "home_uuid")
+	delete(podHomeOut.Annotations, homeUIDAnnotation)
 	delete(podHomeOut.Annotations, "home_nodename")
+	delete(podHomeOut.Labels, nattingv1.HomeClusterIDLabel)
 	return podHomeOut
 }
 
@@ -97,7 +101,7 @@ func H2FTranslate(pod *v1.Pod, nattedNS string) *v1.Pod {
 
 	metav1.SetMetaDataAnnotation(&objectMeta, "home_nodename", pod.Spec.NodeName)
 	metav1.SetMetaDataAnnotation(&objectMeta, "home_resourceVersion", pod.ResourceVersion)
-	metav1.SetMetaDataAnnotation(&objectMeta, "home_uuid", string(pod.UID))
+	metav1.SetMetaDataAnnotation(&objectMeta, homeUIDAnnotation, string(pod.UID))
 	metav1.SetMetaDataAnnotation(&objectMeta, "home_creationTimestamp", pod.CreationTimestamp.String())
 
 	return &v1.Pod{
@@ -136,6 +140,18 @@ func FilterVolumeMounts(volumes []v1.Volume, volumeMountsIn []v1.VolumeMount) []
 }
 
 func ChangePodIp(newPodCidr string, oldPodIp string) (newPodIp string) {
+	//the IPv6 addresses keep the host part of the old address in the new pod cidr
+	if liqonet.IsIPv6String(oldPodIp) {
+		_, network, err := net.ParseCIDR(newPodCidr)
+		if err != nil {
+			return oldPodIp
+		}
+		ip, err := liqonet.ReplaceNetworkPrefix(network, net.ParseIP(oldPodIp))
+		if err != nil {
+			return oldPodIp
+		}
+		return ip.String()
+	}
 	//the last two slices are the suffix of the newPodIp
 	oldPodIpTokenized := strings.Split(oldPodIp, ".")
 	newPodCidrTokenized := strings.Split(newPodCidr, "/")
@@ -86,35 +86,103 @@ func (p *KubernetesProvider) NatNamespace(namespace string, create bool) (string
 	}
 
 	if !ok && create {
-		nattedNS = strings.Join([]string{namespace, p.homeClusterID}, "-")
+		nattingTable = nattingTable.DeepCopy()
+
+		nattedNS, err = p.natNewNamespace(nattingTable, namespace)
+		if err != nil {
+			nattingTable.Status.SetNamespaceStatus(nattingv1.NamespaceNattingStatus{
+				Namespace: namespace,
+				Phase:     nattingv1.NamespaceNattingPhaseError,
+				Message:   err.Error(),
+			})
+			if _, updateErr := p.homeClient.Resource("namespacenattingtables").Update(nattingTable.Name, nattingTable, metav1.UpdateOptions{}); updateErr != nil {
+				klog.Errorf("cannot update the natting status of namespace %v - %v", namespace, updateErr)
+			}
+			return "", err
+		}
+
 		if nattingTable.Spec.NattingTable == nil {
 			nattingTable.Spec.NattingTable = make(map[string]string)
+		}
+		if nattingTable.Spec.DeNattingTable == nil {
 			nattingTable.Spec.DeNattingTable = make(map[string]string)
 		}
 
 		nattingTable.Spec.NattingTable[namespace] = nattedNS
 		nattingTable.Spec.DeNattingTable[nattedNS] = namespace
+		nattingTable.Status.SetNamespaceStatus(nattingv1.NamespaceNattingStatus{
+			Namespace:       namespace,
+			NattedNamespace: nattedNS,
+			Phase:           nattingv1.NamespaceNattingPhaseNatted,
+		})
 
 		_, err := p.homeClient.Resource("namespacenattingtables").Update(nattingTable.Name, nattingTable, metav1.UpdateOptions{})
 		if err != nil {
 			return "", err
 		}
 
-		ns := &v1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: nattedNS,
-			},
+		if err = p.createForeignNamespace(namespace, nattedNS); err != nil {
+			return "", err
 		}
+	}
+
+	return nattedNS, nil
+}
+
+// natNewNamespace computes the natted name of a namespace not yet in the natting table, by means of
+// the strategy configured in the table, and checks it against the table and the foreign namespaces
+func (p *KubernetesProvider) natNewNamespace(nt *nattingv1.NamespaceNattingTable, namespace string) (string, error) {
+	natter, err := newNamespaceNatter(nt.Spec, p.homeClusterID)
+	if err != nil {
+		return "", err
+	}
+
+	nattedNS, err := natter.natNamespace(namespace)
+	if err != nil {
+		return "", err
+	}
 
-		_, err = p.foreignClient.Client().CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
-		if err != nil && !kerror.IsAlreadyExists(err) {
+	if err = validateNattedNamespace(nt, namespace, nattedNS); err != nil {
+		return "", err
+	}
+
+	ns, err := p.foreignClient.Client().CoreV1().Namespaces().Get(context.TODO(), nattedNS, metav1.GetOptions{})
+	if err == nil {
+		// the namespace created by this cluster for the same home namespace, e.g. before the natting
+		// table has been reset, is reused
+		if err = p.checkForeignNamespaceCollision(ns, namespace); err != nil {
 			return "", err
 		}
+	} else if !kerror.IsNotFound(err) {
+		return "", err
 	}
 
 	return nattedNS, nil
 }
 
+// createForeignNamespace creates the foreign namespace reflecting the given home namespace, labelled
+// with the home cluster id
+func (p *KubernetesProvider) createForeignNamespace(namespace, nattedNS string) error {
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nattedNS,
+			Labels: map[string]string{
+				nattingv1.HomeClusterIDLabel: p.homeClusterID,
+			},
+			Annotations: map[string]string{
+				nattingv1.HomeNamespaceAnnotation: namespace,
+			},
+		},
+	}
+
+	_, err := p.foreignClient.Client().CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	if err != nil && !kerror.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
 func (p *KubernetesProvider) DeNatNamespace(namespace string) (string, error) {
 	nt, exists, err := p.ntCache.Store.GetByKey(p.foreignClusterId)
 	if err != nil {
@@ -180,15 +248,7 @@ func (p *KubernetesProvider) manageReflections(oldObj interface{}, newObj interf
 
 	for k, v := range nt {
 		if _, ok := p.reflectedNamespaces.ns[k]; !ok {
-
-			ns := &v1.Namespace{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: v,
-				},
-			}
-
-			_, err := p.foreignClient.Client().CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
-			if err != nil && !kerror.IsAlreadyExists(err) {
+			if err := p.createForeignNamespace(k, v); err != nil {
 				klog.Error(err, "error in namespace creation")
 				continue
 			}
@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"strings"
+)
+
+const (
+	// nattingHashLength is the number of hex digits of the hash appended by the Hash strategy
+	nattingHashLength = 10
+)
+
+// namespaceNatter computes the name of the foreign namespace in which a home namespace is reflected
+type namespaceNatter interface {
+	natNamespace(namespace string) (string, error)
+}
+
+// newNamespaceNatter returns the namespaceNatter implementing the strategy configured in the natting table
+func newNamespaceNatter(spec nattingv1.NamespaceNattingTableSpec, homeClusterID string) (namespaceNatter, error) {
+	switch spec.NattingStrategy {
+	case nattingv1.NattingStrategySuffix:
+		return &suffixNatter{homeClusterID: homeClusterID}, nil
+	case nattingv1.NattingStrategyPrefix:
+		return &prefixNatter{homeClusterID: homeClusterID}, nil
+	case nattingv1.NattingStrategyHash, "":
+		return &hashNatter{homeClusterID: homeClusterID}, nil
+	case nattingv1.NattingStrategyMapping:
+		return &mappingNatter{mapping: spec.NamespaceMapping}, nil
+	default:
+		return nil, fmt.Errorf("unknown natting strategy %v", spec.NattingStrategy)
+	}
+}
+
+type suffixNatter struct {
+	homeClusterID string
+}
+
+func (n *suffixNatter) natNamespace(namespace string) (string, error) {
+	return strings.Join([]string{namespace, n.homeClusterID}, "-"), nil
+}
+
+type prefixNatter struct {
+	homeClusterID string
+}
+
+func (n *prefixNatter) natNamespace(namespace string) (string, error) {
+	return strings.Join([]string{n.homeClusterID, namespace}, "-"), nil
+}
+
+// hashNatter uses the suffix format when it fits in a DNS-1123 label, otherwise it truncates the
+// home namespace and appends a hash of the home namespace and cluster id, so that the result is still unique
+type hashNatter struct {
+	homeClusterID string
+}
+
+func (n *hashNatter) natNamespace(namespace string) (string, error) {
+	nattedNS := strings.Join([]string{namespace, n.homeClusterID}, "-")
+	if len(nattedNS) <= validation.DNS1123LabelMaxLength {
+		return nattedNS, nil
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{namespace, n.homeClusterID}, "/")))
+	hash := hex.EncodeToString(sum[:])[:nattingHashLength]
+
+	prefix := namespace
+	if maxLen := validation.DNS1123LabelMaxLength - nattingHashLength - 1; len(prefix) > maxLen {
+		prefix = prefix[:maxLen]
+	}
+	prefix = strings.TrimRight(prefix, "-")
+
+	return strings.Join([]string{prefix, hash}, "-"), nil
+}
+
+type mappingNatter struct {
+	mapping map[string]string
+}
+
+func (n *mappingNatter) natNamespace(namespace string) (string, error) {
+	nattedNS, ok := n.mapping[namespace]
+	if !ok {
+		return "", fmt.Errorf("no mapping defined for namespace %v", namespace)
+	}
+	return nattedNS, nil
+}
+
+// validateNattedNamespace checks that the natted namespace is a valid namespace name, and that it does
+// not collide with a different home namespace in the natting table
+func validateNattedNamespace(nt *nattingv1.NamespaceNattingTable, namespace, nattedNS string) error {
+	if errs := validation.IsDNS1123Label(nattedNS); len(errs) > 0 {
+		return fmt.Errorf("invalid natted namespace %v: %v", nattedNS, strings.Join(errs, ", "))
+	}
+
+	if other, ok := nt.Spec.DeNattingTable[nattedNS]; ok && other != namespace {
+		return fmt.Errorf("natted namespace %v is already used by namespace %v", nattedNS, other)
+	}
+
+	return nil
+}
+
+// checkForeignNamespaceCollision checks that an already existing foreign namespace has been
+// created by this home cluster to reflect the given namespace
+func (p *KubernetesProvider) checkForeignNamespaceCollision(ns *v1.Namespace, namespace string) error {
+	if ns.Labels[nattingv1.HomeClusterIDLabel] != p.homeClusterID || ns.Annotations[nattingv1.HomeNamespaceAnnotation] != namespace {
+		return fmt.Errorf("namespace %v already exists in the foreign cluster and is not owned by namespace %v", ns.Name, namespace)
+	}
+	return nil
+}
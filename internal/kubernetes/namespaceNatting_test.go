@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"context"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	"github.com/liqoTech/liqo/internal/kubernetes/test"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	"strings"
+	"testing"
+)
+
+func TestNamespaceNatters(t *testing.T) {
+	uuid := "8f4b3a6e-2c1d-4e5f-9a8b-7c6d5e4f3a2b"
+	longNamespace := strings.Repeat("a", 40)
+
+	cases := []struct {
+		strategy nattingv1.NattingStrategy
+		mapping  map[string]string
+		ns       string
+		expected string
+		valid    bool
+	}{
+		{nattingv1.NattingStrategySuffix, nil, test.Namespace, test.NattedNamespace, true},
+		{nattingv1.NattingStrategyPrefix, nil, test.Namespace, test.HomeClusterId + "-" + test.Namespace, true},
+		{nattingv1.NattingStrategyHash, nil, test.Namespace, test.NattedNamespace, true},
+		{"", nil, test.Namespace, test.NattedNamespace, true},
+		{nattingv1.NattingStrategyMapping, map[string]string{test.Namespace: "mapped"}, test.Namespace, "mapped", true},
+		{nattingv1.NattingStrategySuffix, nil, longNamespace, longNamespace + "-" + test.HomeClusterId, true},
+	}
+
+	for _, c := range cases {
+		natter, err := newNamespaceNatter(nattingv1.NamespaceNattingTableSpec{
+			NattingStrategy:  c.strategy,
+			NamespaceMapping: c.mapping,
+		}, test.HomeClusterId)
+		assert.NoError(t, err)
+
+		nattedNS, err := natter.natNamespace(c.ns)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, nattedNS)
+	}
+
+	// with a UUID as cluster id the suffix strategy exceeds the namespace length limit
+	suffix := &suffixNatter{homeClusterID: uuid}
+	nattedNS, _ := suffix.natNamespace(longNamespace)
+	assert.Error(t, validateNattedNamespace(&nattingv1.NamespaceNattingTable{}, longNamespace, nattedNS))
+
+	// while the hash strategy truncates the name and keeps it unique
+	hash := &hashNatter{homeClusterID: uuid}
+	nattedNS, _ = hash.natNamespace(longNamespace)
+	assert.NoError(t, validateNattedNamespace(&nattingv1.NamespaceNattingTable{}, longNamespace, nattedNS))
+	assert.LessOrEqual(t, len(nattedNS), validation.DNS1123LabelMaxLength)
+	otherNattedNS, _ := hash.natNamespace(longNamespace + "b")
+	assert.NotEqual(t, nattedNS, otherNattedNS)
+
+	// the mapping strategy fails for namespaces without a mapping
+	mapping := &mappingNatter{}
+	_, err := mapping.natNamespace(test.Namespace)
+	assert.Error(t, err)
+
+	_, err = newNamespaceNatter(nattingv1.NamespaceNattingTableSpec{NattingStrategy: "unknown"}, test.HomeClusterId)
+	assert.Error(t, err)
+}
+
+func TestNamespaceNattingCollisions(t *testing.T) {
+	nt := &nattingv1.NamespaceNattingTable{
+		Spec: nattingv1.NamespaceNattingTableSpec{
+			DeNattingTable: map[string]string{
+				test.NattedNamespace: "other",
+			},
+		},
+	}
+	assert.Error(t, validateNattedNamespace(nt, test.Namespace, test.NattedNamespace))
+	assert.NoError(t, validateNattedNamespace(nt, test.Namespace, "free"))
+
+	p := &KubernetesProvider{homeClusterID: test.HomeClusterId}
+
+	owned := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        test.NattedNamespace,
+		Labels:      map[string]string{nattingv1.HomeClusterIDLabel: test.HomeClusterId},
+		Annotations: map[string]string{nattingv1.HomeNamespaceAnnotation: test.Namespace},
+	}}
+	assert.NoError(t, p.checkForeignNamespaceCollision(owned, test.Namespace))
+	assert.Error(t, p.checkForeignNamespaceCollision(owned, "other"))
+
+	foreign := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: test.NattedNamespace}}
+	assert.Error(t, p.checkForeignNamespaceCollision(foreign, test.Namespace))
+}
+
+func TestNatNamespaceOwnedForeignNamespace(t *testing.T) {
+	// set the client in fake mode
+	crdClient.Fake = true
+
+	homeClient, err := nattingv1.CreateClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreignClient, err := nattingv1.CreateClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the natting table is updated through the same fake store of the cache
+	homeClient.Store, homeClient.Stop, err = crdClient.WatchfakeResources("namespacenattingtables", cache.ResourceEventHandlerFuncs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &KubernetesProvider{
+		ntCache:          &namespaceNTCache{nattingTableName: test.ForeignClusterId, Store: homeClient.Store},
+		foreignClient:    foreignClient,
+		homeClient:       homeClient,
+		foreignClusterId: test.ForeignClusterId,
+		homeClusterID:    test.HomeClusterId,
+	}
+	// the natting table has no entry for the namespace, e.g. because it has been reset
+	nt := &nattingv1.NamespaceNattingTable{
+		ObjectMeta: metav1.ObjectMeta{Name: test.ForeignClusterId},
+		Spec: nattingv1.NamespaceNattingTableSpec{
+			ClusterId:        test.ForeignClusterId,
+			NattingStrategy:  nattingv1.NattingStrategyMapping,
+			NamespaceMapping: map[string]string{test.Namespace: "mapped"},
+		},
+	}
+	if err := p.ntCache.Store.Add(nt); err != nil {
+		t.Fatal(err)
+	}
+
+	// while the foreign namespace created by this cluster for the same home namespace still exists
+	owned := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "mapped",
+		Labels:      map[string]string{nattingv1.HomeClusterIDLabel: test.HomeClusterId},
+		Annotations: map[string]string{nattingv1.HomeNamespaceAnnotation: test.Namespace},
+	}}
+	if _, err := foreignClient.Client().CoreV1().Namespaces().Create(context.TODO(), owned, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	nattedNS, err := p.NatNamespace(test.Namespace, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "mapped", nattedNS, "the owned foreign namespace should be reused")
+
+	updated, err := homeClient.Resource("namespacenattingtables").Get(test.ForeignClusterId, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "mapped", updated.(*nattingv1.NamespaceNattingTable).Spec.NattingTable[test.Namespace])
+	assert.Equal(t, test.Namespace, updated.(*nattingv1.NamespaceNattingTable).Spec.DeNattingTable["mapped"])
+}
@@ -2,6 +2,9 @@ package kubernetes
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
 	"go.opencensus.io/trace"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -26,53 +29,82 @@ func (p *KubernetesProvider) ConfigureNode(ctx context.Context, n *v1.Node) {
 	n.Labels["type"] = "virtual-node"
 }
 
-// NodeConditions returns a list of conditions (Ready, OutOfDisk, etc), for updates to the node status
-// within Kubernetes.
+// NodeConditions returns a list of conditions (Ready, MemoryPressure, etc), for updates to the node status
+// within Kubernetes. The conditions are computed from the current state of the foreign cluster.
 func (p *KubernetesProvider) nodeConditions() []v1.NodeCondition {
-	// TODO: Make this configurable
-	return []v1.NodeCondition{
-		{
-			Type:               "Ready",
-			Status:             v1.ConditionTrue,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletReady",
-			Message:            "kubelet is ready.",
-		},
-		{
-			Type:               "OutOfDisk",
-			Status:             v1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletHasSufficientDisk",
-			Message:            "kubelet has sufficient disk space available",
-		},
-		{
-			Type:               "MemoryPressure",
-			Status:             v1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletHasSufficientMemory",
-			Message:            "kubelet has sufficient memory available",
-		},
-		{
-			Type:               "DiskPressure",
-			Status:             v1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "KubeletHasNoDiskPressure",
-			Message:            "kubelet has no disk pressure",
-		},
-		{
-			Type:               "NetworkUnavailable",
-			Status:             v1.ConditionFalse,
-			LastHeartbeatTime:  metav1.Now(),
-			LastTransitionTime: metav1.Now(),
-			Reason:             "RouteCreated",
-			Message:            "RouteController created a route",
-		},
+	return computeNodeConditions(p.foreignClusterState(), nil, metav1.Now())
+}
+
+// foreignClusterState collects the data the conditions of the virtual node are computed from
+func (p *KubernetesProvider) foreignClusterState() *foreignClusterState {
+	state := &foreignClusterState{unjoining: p.unjoining}
+
+	if p.foreignClient == nil {
+		state.peerErr = errors.New("foreign cluster client not configured")
+		state.nodesErr = state.peerErr
+	} else {
+		state.peerErr = p.probeForeignCluster()
+		if nodes, err := p.foreignClient.Client().CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{}); err != nil {
+			state.nodesErr = err
+		} else {
+			state.nodes = nodes.Items
+		}
 	}
 
+	state.tunnel, state.tunnelErr = p.getTunnelEndpoint()
+	return state
+}
+
+// probeForeignCluster checks the health of the API server of the foreign cluster
+func (p *KubernetesProvider) probeForeignCluster() error {
+	ctx, cancel := context.WithTimeout(context.Background(), peerProbeTimeout)
+	defer cancel()
+
+	body, err := p.foreignClient.Client().Discovery().RESTClient().Get().AbsPath("/healthz").DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+	if string(body) != "ok" {
+		return fmt.Errorf("foreign API server is not healthy: %v", string(body))
+	}
+	return nil
+}
+
+// getTunnelEndpoint returns the TunnelEndpoint of the foreign cluster, or nil if it does not exist yet
+func (p *KubernetesProvider) getTunnelEndpoint() (*liqonetv1.TunnelEndpoint, error) {
+	if p.tunEndpointClient == nil {
+		return nil, errors.New("tunnelEndpoint client not configured")
+	}
+
+	tmp, err := p.tunEndpointClient.Resource("tunnelendpoints").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	tepList, ok := tmp.(*liqonetv1.TunnelEndpointList)
+	if !ok {
+		return nil, errors.New("retrieved object is not a TunnelEndpointList")
+	}
+	for i := range tepList.Items {
+		if tepList.Items[i].Spec.ClusterID == p.foreignClusterId {
+			return &tepList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// refreshNodeStatus updates the conditions and the allocatable resources of the virtual node
+// according to the current state of the foreign cluster
+func (p *KubernetesProvider) refreshNodeStatus() error {
+	no, err := p.homeClient.Client().CoreV1().Nodes().Get(context.TODO(), p.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	no.Status.Conditions = computeNodeConditions(p.foreignClusterState(), no.Status.Conditions, metav1.Now())
+	if p.advertisedQuota != nil {
+		no.Status.Allocatable = p.nodeAllocatable(p.advertisedQuota)
+	}
+	return p.nodeController.UpdateNodeFromOutside(false, no)
 }
 
 // NodeAddresses returns a list of addresses for the node status
@@ -0,0 +1,173 @@
+package kubernetes
+
+import (
+	"fmt"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+const (
+	// nodeStatusPeriod is the interval between two refreshes of the virtual node conditions and allocatable resources
+	nodeStatusPeriod = 10 * time.Second
+	// peerProbeTimeout is the maximum time to wait for the foreign API server health probe
+	peerProbeTimeout = 5 * time.Second
+
+	// tunnelReadyPhase is the phase of a TunnelEndpoint whose tunnel has been installed by the tunnel-operator
+	tunnelReadyPhase = "Ready"
+)
+
+// foreignClusterState is the live data the conditions of the virtual node are computed from
+type foreignClusterState struct {
+	// peerErr is the result of the health probe of the foreign API server
+	peerErr error
+	// tunnel is the TunnelEndpoint of the foreign cluster, nil if it does not exist
+	tunnel    *liqonetv1.TunnelEndpoint
+	tunnelErr error
+	// nodes are the nodes of the foreign cluster
+	nodes    []v1.Node
+	nodesErr error
+	// unjoining is true when the peering is being torn down
+	unjoining bool
+}
+
+// computeNodeConditions returns the conditions of the virtual node: it is Ready only if the foreign cluster is
+// reachable and the tunnel is up, while the pressure conditions aggregate the ones of the foreign nodes. The
+// transition times of the old conditions are kept if their status has not changed.
+func computeNodeConditions(state *foreignClusterState, old []v1.NodeCondition, now metav1.Time) []v1.NodeCondition {
+	conditions := []v1.NodeCondition{
+		readyCondition(state),
+		pressureCondition(state, v1.NodeMemoryPressure, "memory"),
+		pressureCondition(state, v1.NodeDiskPressure, "disk"),
+		pressureCondition(state, v1.NodePIDPressure, "PID"),
+		networkCondition(state),
+	}
+
+	for i := range conditions {
+		conditions[i].LastHeartbeatTime = now
+		conditions[i].LastTransitionTime = now
+		for j := range old {
+			if old[j].Type == conditions[i].Type && old[j].Status == conditions[i].Status {
+				conditions[i].LastTransitionTime = old[j].LastTransitionTime
+				break
+			}
+		}
+	}
+	return conditions
+}
+
+func readyCondition(state *foreignClusterState) v1.NodeCondition {
+	condition := v1.NodeCondition{
+		Type:    v1.NodeReady,
+		Status:  v1.ConditionFalse,
+		Reason:  "KubeletReady",
+		Message: "kubelet is ready.",
+	}
+
+	tunnelReady, tunnelMessage := tunnelState(state)
+	switch {
+	case state.unjoining:
+		condition.Reason = "PeeringTerminating"
+		condition.Message = "the peering with the foreign cluster is being torn down"
+	case state.peerErr != nil:
+		condition.Reason = "ForeignClusterUnreachable"
+		condition.Message = fmt.Sprintf("the foreign cluster is not reachable: %v", state.peerErr)
+	case !tunnelReady:
+		condition.Reason = "TunnelNotReady"
+		condition.Message = tunnelMessage
+	default:
+		condition.Status = v1.ConditionTrue
+	}
+	return condition
+}
+
+func networkCondition(state *foreignClusterState) v1.NodeCondition {
+	if state.tunnelErr != nil {
+		return v1.NodeCondition{
+			Type:    v1.NodeNetworkUnavailable,
+			Status:  v1.ConditionUnknown,
+			Reason:  "TunnelStateUnknown",
+			Message: fmt.Sprintf("cannot get the tunnel state: %v", state.tunnelErr),
+		}
+	}
+
+	if ready, message := tunnelState(state); !ready {
+		return v1.NodeCondition{
+			Type:    v1.NodeNetworkUnavailable,
+			Status:  v1.ConditionTrue,
+			Reason:  "TunnelNotReady",
+			Message: message,
+		}
+	}
+
+	return v1.NodeCondition{
+		Type:    v1.NodeNetworkUnavailable,
+		Status:  v1.ConditionFalse,
+		Reason:  "TunnelEstablished",
+		Message: fmt.Sprintf("tunnel %v to the foreign cluster is established", state.tunnel.Status.TunnelIFaceName),
+	}
+}
+
+// tunnelState returns whether the tunnel to the foreign cluster is up and, if not, the reason why
+func tunnelState(state *foreignClusterState) (bool, string) {
+	switch {
+	case state.tunnelErr != nil:
+		return false, fmt.Sprintf("cannot get the tunnel state: %v", state.tunnelErr)
+	case state.tunnel == nil:
+		return false, "the tunnel to the foreign cluster has not been created yet"
+	case state.tunnel.Status.Phase != tunnelReadyPhase:
+		return false, fmt.Sprintf("the tunnel to the foreign cluster is in phase %q", state.tunnel.Status.Phase)
+	default:
+		return true, ""
+	}
+}
+
+// pressureCondition aggregates a pressure condition of the foreign nodes: the virtual node is under pressure
+// when all the foreign nodes able to run pods are, since the foreign scheduler can still use the other ones
+func pressureCondition(state *foreignClusterState, conditionType v1.NodeConditionType, resource string) v1.NodeCondition {
+	condition := v1.NodeCondition{Type: conditionType}
+
+	if state.nodesErr != nil {
+		condition.Status = v1.ConditionUnknown
+		condition.Reason = "ForeignNodesUnknown"
+		condition.Message = fmt.Sprintf("cannot get the foreign nodes: %v", state.nodesErr)
+		return condition
+	}
+
+	var available, underPressure int
+	for i := range state.nodes {
+		if state.nodes[i].Spec.Unschedulable || getNodeConditionStatus(&state.nodes[i], v1.NodeReady) != v1.ConditionTrue {
+			continue
+		}
+		available++
+		if getNodeConditionStatus(&state.nodes[i], conditionType) == v1.ConditionTrue {
+			underPressure++
+		}
+	}
+
+	switch {
+	case available == 0:
+		condition.Status = v1.ConditionTrue
+		condition.Reason = "NoForeignNodeAvailable"
+		condition.Message = "no foreign node is ready to run pods"
+	case underPressure == available:
+		condition.Status = v1.ConditionTrue
+		condition.Reason = "ForeignNodesUnderPressure"
+		condition.Message = fmt.Sprintf("all the %d foreign nodes are under %v pressure", available, resource)
+	default:
+		condition.Status = v1.ConditionFalse
+		condition.Reason = "ForeignNodesHaveNoPressure"
+		condition.Message = fmt.Sprintf("%d of %d foreign nodes are under %v pressure", underPressure, available, resource)
+	}
+	return condition
+}
+
+func getNodeConditionStatus(node *v1.Node, conditionType v1.NodeConditionType) v1.ConditionStatus {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status
+		}
+	}
+	return v1.ConditionUnknown
+}
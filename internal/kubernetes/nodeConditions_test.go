@@ -0,0 +1,119 @@
+package kubernetes
+
+import (
+	"errors"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func newForeignNode(ready, memoryPressure bool) v1.Node {
+	status := func(b bool) v1.ConditionStatus {
+		if b {
+			return v1.ConditionTrue
+		}
+		return v1.ConditionFalse
+	}
+	return v1.Node{Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+		{Type: v1.NodeReady, Status: status(ready)},
+		{Type: v1.NodeMemoryPressure, Status: status(memoryPressure)},
+		{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+	}}}
+}
+
+func getCondition(conditions []v1.NodeCondition, conditionType v1.NodeConditionType) v1.NodeCondition {
+	for _, c := range conditions {
+		if c.Type == conditionType {
+			return c
+		}
+	}
+	return v1.NodeCondition{}
+}
+
+func TestComputeNodeConditions(t *testing.T) {
+	readyTunnel := &liqonetv1.TunnelEndpoint{Status: liqonetv1.TunnelEndpointStatus{Phase: tunnelReadyPhase, TunnelIFaceName: "gretun_0"}}
+	now := metav1.Now()
+
+	cases := []struct {
+		name               string
+		state              foreignClusterState
+		ready              v1.ConditionStatus
+		networkUnavailable v1.ConditionStatus
+		memoryPressure     v1.ConditionStatus
+	}{
+		{
+			name:               "healthy",
+			state:              foreignClusterState{tunnel: readyTunnel, nodes: []v1.Node{newForeignNode(true, false), newForeignNode(true, true)}},
+			ready:              v1.ConditionTrue,
+			networkUnavailable: v1.ConditionFalse,
+			memoryPressure:     v1.ConditionFalse,
+		},
+		{
+			name:               "broken tunnel",
+			state:              foreignClusterState{tunnel: &liqonetv1.TunnelEndpoint{Status: liqonetv1.TunnelEndpointStatus{Phase: "Processed"}}},
+			ready:              v1.ConditionFalse,
+			networkUnavailable: v1.ConditionTrue,
+			memoryPressure:     v1.ConditionTrue,
+		},
+		{
+			name:               "unknown tunnel",
+			state:              foreignClusterState{tunnelErr: errors.New("error"), nodesErr: errors.New("error")},
+			ready:              v1.ConditionFalse,
+			networkUnavailable: v1.ConditionUnknown,
+			memoryPressure:     v1.ConditionUnknown,
+		},
+		{
+			name:               "unreachable peer",
+			state:              foreignClusterState{peerErr: errors.New("timeout"), tunnel: readyTunnel},
+			ready:              v1.ConditionFalse,
+			networkUnavailable: v1.ConditionFalse,
+			memoryPressure:     v1.ConditionTrue,
+		},
+		{
+			name: "all nodes under pressure",
+			state: foreignClusterState{tunnel: readyTunnel, nodes: []v1.Node{newForeignNode(true, true),
+				newForeignNode(false, false)}},
+			ready:              v1.ConditionTrue,
+			networkUnavailable: v1.ConditionFalse,
+			memoryPressure:     v1.ConditionTrue,
+		},
+		{
+			name:               "unjoining",
+			state:              foreignClusterState{tunnel: readyTunnel, unjoining: true},
+			ready:              v1.ConditionFalse,
+			networkUnavailable: v1.ConditionFalse,
+			memoryPressure:     v1.ConditionTrue,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conditions := computeNodeConditions(&c.state, nil, now)
+			assert.Equal(t, v1.NodeReady, conditions[0].Type)
+			assert.Equal(t, c.ready, getCondition(conditions, v1.NodeReady).Status)
+			assert.Equal(t, c.networkUnavailable, getCondition(conditions, v1.NodeNetworkUnavailable).Status)
+			assert.Equal(t, c.memoryPressure, getCondition(conditions, v1.NodeMemoryPressure).Status)
+		})
+	}
+}
+
+func TestNodeConditionsTransitionTime(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	now := metav1.Now()
+	state := &foreignClusterState{tunnel: &liqonetv1.TunnelEndpoint{Status: liqonetv1.TunnelEndpointStatus{Phase: tunnelReadyPhase}}}
+
+	old := computeNodeConditions(state, nil, past)
+	conditions := computeNodeConditions(state, old, now)
+	ready := getCondition(conditions, v1.NodeReady)
+	assert.Equal(t, past, ready.LastTransitionTime)
+	assert.Equal(t, now, ready.LastHeartbeatTime)
+
+	// the transition time changes only for the conditions whose status changed
+	state.tunnel.Status.Phase = "Processed"
+	conditions = computeNodeConditions(state, old, now)
+	assert.Equal(t, now, getCondition(conditions, v1.NodeReady).LastTransitionTime)
+	assert.Equal(t, past, getCondition(conditions, v1.NodeMemoryPressure).LastTransitionTime)
+}
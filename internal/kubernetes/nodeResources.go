@@ -0,0 +1,191 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	resourcehelper "k8s.io/kubectl/pkg/util/resource"
+)
+
+// foreignUsage is the live usage of the natted namespaces in the foreign cluster
+type foreignUsage struct {
+	// tracked are the resources requested by the foreign pods of the home pods bound to the virtual node,
+	// which are already accounted by the home scheduler
+	tracked v1.ResourceList
+	// untracked are the resources requested by the other pods in the natted namespaces
+	untracked v1.ResourceList
+	// headroom contains, for each resource limited by a ResourceQuota in all the natted namespaces,
+	// the amount that can still be requested before hitting the quotas
+	headroom v1.ResourceList
+}
+
+// nodeAllocatable returns the allocatable resources of the virtual node: if the usage of the foreign cluster
+// cannot be retrieved, the advertised quota is used as is
+func (p *KubernetesProvider) nodeAllocatable(quota v1.ResourceList) v1.ResourceList {
+	usage, err := p.getForeignUsage()
+	if err != nil {
+		klog.Errorf("cannot get the usage of the foreign cluster, using the advertised quota as allocatable - %v", err)
+		return quota.DeepCopy()
+	}
+	return computeAllocatable(quota, usage)
+}
+
+// computeAllocatable returns the advertised quota minus the resources used in the natted namespaces by the pods the
+// home scheduler does not know about, capped by the headroom left by the foreign ResourceQuotas. The resources of the
+// pods bound to the virtual node are not subtracted, since the home scheduler already does it.
+func computeAllocatable(quota v1.ResourceList, usage *foreignUsage) v1.ResourceList {
+	allocatable := v1.ResourceList{}
+	for name, q := range quota {
+		value := q.DeepCopy()
+		if used, ok := usage.untracked[name]; ok {
+			value.Sub(used)
+		}
+
+		if headroom, ok := usage.headroom[name]; ok {
+			limit := headroom.DeepCopy()
+			if tracked, ok := usage.tracked[name]; ok {
+				limit.Add(tracked)
+			}
+			if limit.Cmp(value) < 0 {
+				value = limit
+			}
+		}
+
+		if value.Sign() < 0 {
+			value = *resource.NewQuantity(0, q.Format)
+		}
+		allocatable[name] = value
+	}
+	return allocatable
+}
+
+// getForeignUsage computes the usage of the natted namespaces from the foreign pods and ResourceQuotas
+func (p *KubernetesProvider) getForeignUsage() (*foreignUsage, error) {
+	if p.foreignClient == nil || p.ntCache == nil {
+		return nil, errors.New("foreign cluster client not configured")
+	}
+
+	nt, err := p.ntCache.getNattingTable(p.foreignClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	homePods, err := p.listBoundHomePods(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	var tracked, untracked []*v1.Pod
+	var quotas [][]v1.ResourceQuota
+	if nt != nil {
+		for _, nattedNS := range nt.Spec.NattingTable {
+			pods, err := p.foreignClient.Client().CoreV1().Pods(nattedNS).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("cannot list the foreign pods in namespace %v - %v", nattedNS, err)
+			}
+			for i := range pods.Items {
+				pod := &pods.Items[i]
+				if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+					continue
+				}
+				if _, ok := homePods[types.UID(pod.Annotations[homeUIDAnnotation])]; ok {
+					tracked = append(tracked, pod)
+				} else {
+					untracked = append(untracked, pod)
+				}
+			}
+
+			rqs, err := p.foreignClient.Client().CoreV1().ResourceQuotas(nattedNS).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("cannot list the resource quotas in namespace %v - %v", nattedNS, err)
+			}
+			quotas = append(quotas, rqs.Items)
+		}
+	}
+
+	return &foreignUsage{
+		tracked:   podsRequests(tracked),
+		untracked: podsRequests(untracked),
+		headroom:  quotasHeadroom(quotas),
+	}, nil
+}
+
+// podsRequests returns the sum of the requests of the pods, the pods resource counts the pods themselves
+func podsRequests(pods []*v1.Pod) v1.ResourceList {
+	requests := v1.ResourceList{
+		v1.ResourcePods: *resource.NewQuantity(int64(len(pods)), resource.DecimalSI),
+	}
+	for _, pod := range pods {
+		podRequests, _ := resourcehelper.PodRequestsAndLimits(pod)
+		for name, q := range podRequests {
+			value := requests[name]
+			value.Add(q)
+			requests[name] = value
+		}
+	}
+	return requests
+}
+
+// quotaResourceNames maps the node resources to the names they can be limited with in a ResourceQuota
+var quotaResourceNames = map[v1.ResourceName][]v1.ResourceName{
+	v1.ResourceCPU:    {v1.ResourceCPU, v1.ResourceRequestsCPU},
+	v1.ResourceMemory: {v1.ResourceMemory, v1.ResourceRequestsMemory},
+	v1.ResourcePods:   {v1.ResourcePods},
+}
+
+// quotasHeadroom returns, for each node resource, the sum over the natted namespaces of the amount still available
+// according to their ResourceQuotas; a resource is not limited if at least one namespace has no quota on it
+func quotasHeadroom(quotasPerNamespace [][]v1.ResourceQuota) v1.ResourceList {
+	headroom := v1.ResourceList{}
+	if len(quotasPerNamespace) == 0 {
+		return headroom
+	}
+
+	for name, quotaNames := range quotaResourceNames {
+		total := resource.Quantity{}
+		limited := true
+		for _, quotas := range quotasPerNamespace {
+			nsHeadroom, ok := namespaceHeadroom(quotas, quotaNames)
+			if !ok {
+				limited = false
+				break
+			}
+			total.Add(nsHeadroom)
+		}
+		if limited {
+			headroom[name] = total
+		}
+	}
+	return headroom
+}
+
+// namespaceHeadroom returns the minimum amount still available among the quotas of a namespace limiting a resource
+func namespaceHeadroom(quotas []v1.ResourceQuota, quotaNames []v1.ResourceName) (resource.Quantity, bool) {
+	var min resource.Quantity
+	found := false
+	for i := range quotas {
+		for _, name := range quotaNames {
+			hard, ok := quotas[i].Status.Hard[name]
+			if !ok {
+				continue
+			}
+			available := hard.DeepCopy()
+			if used, ok := quotas[i].Status.Used[name]; ok {
+				available.Sub(used)
+			}
+			if available.Sign() < 0 {
+				available = resource.Quantity{}
+			}
+			if !found || available.Cmp(min) < 0 {
+				min = available
+				found = true
+			}
+		}
+	}
+	return min, found
+}
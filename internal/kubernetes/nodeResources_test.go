@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+)
+
+func newResourceQuota(hard, used v1.ResourceList) v1.ResourceQuota {
+	return v1.ResourceQuota{Status: v1.ResourceQuotaStatus{Hard: hard, Used: used}}
+}
+
+func newRequestingPod(cpu, memory string) *v1.Pod {
+	return &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpu),
+			v1.ResourceMemory: resource.MustParse(memory),
+		}},
+	}}}}
+}
+
+func TestComputeAllocatable(t *testing.T) {
+	quota := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("4"),
+		v1.ResourceMemory: resource.MustParse("4Gi"),
+		v1.ResourcePods:   resource.MustParse("10"),
+	}
+
+	// only the pods unknown to the home scheduler are subtracted
+	usage := &foreignUsage{
+		tracked:   podsRequests([]*v1.Pod{newRequestingPod("1", "1Gi")}),
+		untracked: podsRequests([]*v1.Pod{newRequestingPod("500m", "1Gi"), newRequestingPod("500m", "1Gi")}),
+		headroom:  v1.ResourceList{},
+	}
+	allocatable := computeAllocatable(quota, usage)
+	assert.True(t, resource.MustParse("3").Equal(allocatable[v1.ResourceCPU]))
+	assert.True(t, resource.MustParse("2Gi").Equal(allocatable[v1.ResourceMemory]))
+	assert.True(t, resource.MustParse("8").Equal(allocatable[v1.ResourcePods]))
+
+	// the quota headroom caps the allocatable resources, the tracked pods are added back
+	usage.headroom = v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}
+	allocatable = computeAllocatable(quota, usage)
+	assert.True(t, resource.MustParse("2").Equal(allocatable[v1.ResourceCPU]))
+	assert.True(t, resource.MustParse("2Gi").Equal(allocatable[v1.ResourceMemory]))
+
+	// the allocatable resources are never negative
+	usage.untracked = v1.ResourceList{v1.ResourceCPU: resource.MustParse("5")}
+	allocatable = computeAllocatable(quota, usage)
+	assert.Equal(t, int64(0), allocatable.Cpu().MilliValue())
+}
+
+func TestQuotasHeadroom(t *testing.T) {
+	limited := []v1.ResourceQuota{
+		newResourceQuota(
+			v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("2"), v1.ResourcePods: resource.MustParse("5")},
+			v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("500m"), v1.ResourcePods: resource.MustParse("1")}),
+		newResourceQuota(
+			v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}),
+	}
+	otherLimited := []v1.ResourceQuota{
+		newResourceQuota(
+			v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+			v1.ResourceList{}),
+	}
+
+	// the most restrictive quota of each namespace is summed
+	headroom := quotasHeadroom([][]v1.ResourceQuota{limited, otherLimited})
+	assert.True(t, resource.MustParse("1500m").Equal(headroom[v1.ResourceCPU]))
+	// a resource limited only in some namespaces is not limited
+	_, ok := headroom[v1.ResourceMemory]
+	assert.False(t, ok)
+	_, ok = headroom[v1.ResourcePods]
+	assert.False(t, ok)
+
+	headroom = quotasHeadroom([][]v1.ResourceQuota{limited})
+	assert.True(t, resource.MustParse("4").Equal(headroom[v1.ResourcePods]))
+
+	assert.Len(t, quotasHeadroom(nil), 0)
+}
@@ -49,6 +49,7 @@ func (p *KubernetesProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
 	}
 
 	podTranslated := H2FTranslate(pod, nattedNS)
+	podTranslated.SetLabels(p.foreignLabels(podTranslated.Labels))
 
 	podServer, err := p.foreignClient.Client().CoreV1().Pods(podTranslated.Namespace).Create(context.TODO(), podTranslated, metav1.CreateOptions{})
 	if err != nil {
@@ -0,0 +1,180 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	v1 "k8s.io/api/core/v1"
+	kerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+	"time"
+)
+
+const (
+	// homeUIDAnnotation is set by H2FTranslate on each foreign pod, with the uid of its home pod
+	homeUIDAnnotation = "home_uuid"
+
+	// remotePodDeletionTimeout is the maximum time to wait for an orphaned foreign pod to be deleted,
+	// before creating the pod replacing it with the same name
+	remotePodDeletionTimeout = 2 * time.Minute
+	remotePodDeletionPeriod  = time.Second
+)
+
+// ReconcileRemotePods aligns the foreign pods with the home pods bound to the virtual node, and it is meant to
+// be called when the virtual kubelet starts, before the pod controller. The foreign pods are matched to the home
+// pods by the home_uuid annotation: the matching pairs are adopted, the foreign pods without a home pod are deleted
+// and the home pods without a foreign pod are created again, so that a restart does not duplicate nor lose workloads.
+// The home pods already terminated are not created again, and the creations waiting for the deletion of a previous
+// foreign pod with the same name are completed in background, so that the pod controller is not delayed.
+func (p *KubernetesProvider) ReconcileRemotePods(ctx context.Context) error {
+	nt, err := p.ntCache.getNattingTable(p.foreignClusterId)
+	if err != nil {
+		return err
+	}
+
+	homePods, err := p.listBoundHomePods(ctx)
+	if err != nil {
+		return err
+	}
+
+	adopted := make(map[types.UID]bool)
+	var errs []error
+
+	if nt != nil {
+		for homeNS, nattedNS := range nt.Spec.NattingTable {
+			if err := p.reconcileRemoteNamespace(ctx, homeNS, nattedNS, homePods, adopted); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for uid, pod := range homePods {
+		if adopted[uid] || pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		klog.Infof("foreign pod for %v/%v not found, creating it again", pod.Namespace, pod.Name)
+		err := p.CreatePod(ctx, pod)
+		switch {
+		case err == nil:
+		case kerror.IsAlreadyExists(err):
+			go p.recreateRemotePod(ctx, pod)
+		default:
+			errs = append(errs, fmt.Errorf("cannot create again the foreign pod for %v/%v - %v", pod.Namespace, pod.Name, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// listBoundHomePods returns the home pods scheduled on the virtual node, indexed by uid
+func (p *KubernetesProvider) listBoundHomePods(ctx context.Context) (map[types.UID]*v1.Pod, error) {
+	podList, err := p.homeClient.Client().CoreV1().Pods(v1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", p.nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make(map[types.UID]*v1.Pod, len(podList.Items))
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Spec.NodeName != p.nodeName {
+			continue
+		}
+		pods[pod.UID] = pod
+	}
+	return pods, nil
+}
+
+// reconcileRemoteNamespace adopts or deletes the foreign pods of a natted namespace
+func (p *KubernetesProvider) reconcileRemoteNamespace(ctx context.Context, homeNS, nattedNS string,
+	homePods map[types.UID]*v1.Pod, adopted map[types.UID]bool) error {
+	remotePods, err := p.foreignClient.Client().CoreV1().Pods(nattedNS).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if kerror.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot list the foreign pods in namespace %v - %v", nattedNS, err)
+	}
+
+	var errs []error
+	for i := range remotePods.Items {
+		remotePod := &remotePods.Items[i]
+		uid, ok := remotePod.Annotations[homeUIDAnnotation]
+		if !ok {
+			// not created by a virtual kubelet
+			continue
+		}
+
+		homePod, ok := homePods[types.UID(uid)]
+		if ok && homePod.DeletionTimestamp == nil && homePod.Namespace == homeNS && homePod.Name == remotePod.Name {
+			if err := p.adoptRemotePod(ctx, remotePod); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			adopted[homePod.UID] = true
+			continue
+		}
+
+		if remotePod.DeletionTimestamp != nil {
+			continue
+		}
+		klog.Infof("foreign pod %v/%v has no home pod, deleting it", remotePod.Namespace, remotePod.Name)
+		err := p.foreignClient.Client().CoreV1().Pods(nattedNS).Delete(ctx, remotePod.Name, metav1.DeleteOptions{})
+		if err != nil && !kerror.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("cannot delete the orphaned foreign pod %v/%v - %v", nattedNS, remotePod.Name, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// adoptRemotePod marks as owned by this home cluster a foreign pod with a matching home pod,
+// the pods created before the introduction of the ownership label are labelled as well
+func (p *KubernetesProvider) adoptRemotePod(ctx context.Context, remotePod *v1.Pod) error {
+	if remotePod.Labels[nattingv1.HomeClusterIDLabel] == p.homeClusterID {
+		klog.V(3).Infof("foreign pod %v/%v adopted", remotePod.Namespace, remotePod.Name)
+		return nil
+	}
+
+	remotePod = remotePod.DeepCopy()
+	remotePod.SetLabels(p.foreignLabels(remotePod.Labels))
+	if _, err := p.foreignClient.Client().CoreV1().Pods(remotePod.Namespace).Update(ctx, remotePod, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("cannot adopt the foreign pod %v/%v - %v", remotePod.Namespace, remotePod.Name, err)
+	}
+	klog.V(3).Infof("foreign pod %v/%v adopted", remotePod.Namespace, remotePod.Name)
+	return nil
+}
+
+// recreateRemotePod creates the foreign pod of a home pod whose name is still used by another foreign pod, as it
+// happens when the orphaned pod of a previous home pod is terminating: it waits for its deletion before retrying,
+// and it stops if the foreign pod has been created meanwhile, e.g. by the pod controller
+func (p *KubernetesProvider) recreateRemotePod(ctx context.Context, pod *v1.Pod) {
+	timeout, cancel := context.WithTimeout(ctx, remotePodDeletionTimeout)
+	defer cancel()
+
+	err := wait.PollUntil(remotePodDeletionPeriod, func() (bool, error) {
+		err := p.CreatePod(ctx, pod)
+		if err == nil || !kerror.IsAlreadyExists(err) {
+			return err == nil, err
+		}
+		nattedNS, err := p.NatNamespace(pod.Namespace, false)
+		if err != nil {
+			return false, err
+		}
+		remotePod, err := p.foreignClient.Client().CoreV1().Pods(nattedNS).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err == nil && remotePod.Annotations[homeUIDAnnotation] == string(pod.UID) {
+			return true, nil
+		}
+		klog.V(3).Infof("waiting for the deletion of the previous foreign pod %v", pod.Name)
+		return false, nil
+	}, timeout.Done())
+	if err != nil {
+		klog.Errorf("cannot create again the foreign pod for %v/%v - %v", pod.Namespace, pod.Name, err)
+	}
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"context"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	"github.com/liqoTech/liqo/internal/kubernetes/test"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	kerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"testing"
+	"time"
+)
+
+func newHomePod(name, uid string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: test.Namespace,
+			UID:       types.UID(uid),
+		},
+		Spec: v1.PodSpec{
+			NodeName:   test.NodeName,
+			Containers: []v1.Container{{Name: "test", Image: "nginx"}},
+		},
+	}
+}
+
+func TestReconcileRemotePods(t *testing.T) {
+	// set the client in fake mode
+	crdClient.Fake = true
+
+	homeClient, err := nattingv1.CreateClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreignClient, err := nattingv1.CreateClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &KubernetesProvider{
+		Reflector:        &Reflector{started: false},
+		ntCache:          &namespaceNTCache{nattingTableName: test.ForeignClusterId, Store: cache.NewStore(cache.MetaNamespaceKeyFunc)},
+		foreignPodCaches: make(map[string]*podCache),
+		foreignClient:    foreignClient,
+		homeClient:       homeClient,
+		nodeName:         test.NodeName,
+		foreignClusterId: test.ForeignClusterId,
+		homeClusterID:    test.HomeClusterId,
+	}
+	if err := p.ntCache.Store.Add(test.CreateNamespaceNattingTable()); err != nil {
+		t.Fatal(err)
+	}
+
+	adopted := newHomePod("adopted", "uid-adopted")
+	missing := newHomePod("missing", "uid-missing")
+	// recreated has been deleted and created again in the home cluster while the virtual kubelet was down
+	recreated := newHomePod("recreated", "uid-recreated")
+	// waiting has been recreated as well, but the previous foreign pod is still terminating
+	waiting := newHomePod("waiting", "uid-waiting")
+	completed := newHomePod("completed", "uid-completed")
+	completed.Status.Phase = v1.PodSucceeded
+	for _, pod := range []*v1.Pod{adopted, missing, recreated, waiting, completed} {
+		if _, err := homeClient.Client().CoreV1().Pods(test.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orphan := newHomePod("orphan", "uid-orphan")
+	stale := newHomePod("recreated", "uid-stale")
+	terminating := H2FTranslate(newHomePod("waiting", "uid-terminating"), test.NattedNamespace)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	unmanaged := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: test.NattedNamespace}}
+	for _, pod := range []*v1.Pod{H2FTranslate(adopted, test.NattedNamespace), H2FTranslate(orphan, test.NattedNamespace),
+		H2FTranslate(stale, test.NattedNamespace), terminating, unmanaged} {
+		if _, err := foreignClient.Client().CoreV1().Pods(test.NattedNamespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the reconciliation does not wait for the deletion of the terminating pod
+	start := time.Now()
+	assert.NoError(t, p.ReconcileRemotePods(context.TODO()))
+	assert.Less(t, int64(time.Since(start)), int64(remotePodDeletionPeriod))
+
+	remotePods := foreignClient.Client().CoreV1().Pods(test.NattedNamespace)
+
+	// the matching pod is kept and labelled as owned by the home cluster
+	pod, err := remotePods.Get(context.TODO(), "adopted", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, test.HomeClusterId, pod.Labels[nattingv1.HomeClusterIDLabel])
+
+	// the pods without a home pod are deleted, the ones not created by a virtual kubelet are ignored
+	_, err = remotePods.Get(context.TODO(), "orphan", metav1.GetOptions{})
+	assert.True(t, kerror.IsNotFound(err))
+	_, err = remotePods.Get(context.TODO(), "unmanaged", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// the missing pods are created, replacing the stale ones with the same name
+	for _, homePod := range []*v1.Pod{missing, recreated} {
+		pod, err = remotePods.Get(context.TODO(), homePod.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, string(homePod.UID), pod.Annotations[homeUIDAnnotation])
+	}
+
+	// the terminated pods are not created again
+	_, err = remotePods.Get(context.TODO(), "completed", metav1.GetOptions{})
+	assert.True(t, kerror.IsNotFound(err))
+
+	// the pod is created in background once the terminating one is deleted
+	assert.NoError(t, remotePods.Delete(context.TODO(), "waiting", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		pod, err := remotePods.Get(context.TODO(), "waiting", metav1.GetOptions{})
+		return err == nil && pod.Annotations[homeUIDAnnotation] == string(waiting.UID)
+	}, 5*remotePodDeletionPeriod, remotePodDeletionPeriod/10)
+}
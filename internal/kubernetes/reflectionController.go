@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"context"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
@@ -111,6 +112,18 @@ func (p *KubernetesProvider) controlLoop() {
 	}
 }
 
+// foreignLabels returns a copy of the given labels, completed with the label identifying
+// the home cluster as the owner of the foreign object
+func (p *KubernetesProvider) foreignLabels(labels map[string]string) map[string]string {
+	foreignLabels := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		foreignLabels[k] = v
+	}
+	foreignLabels[nattingv1.HomeClusterIDLabel] = p.homeClusterID
+
+	return foreignLabels
+}
+
 func (p *KubernetesProvider) cleanupNamespace(ns string) error {
 
 	pods, err := p.foreignClient.Client().CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{})
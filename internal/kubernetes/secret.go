@@ -58,7 +58,7 @@ func (p *KubernetesProvider) createSecret(sec *corev1.Secret, namespace string)
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        sec.Name,
 			Namespace:   namespace,
-			Labels:      sec.Labels,
+			Labels:      p.foreignLabels(sec.Labels),
 			Annotations: nil,
 		},
 		Data:       sec.Data,
@@ -66,9 +66,6 @@ func (p *KubernetesProvider) createSecret(sec *corev1.Secret, namespace string)
 		Type:       sec.Type,
 	}
 
-	if secRemote.Labels == nil {
-		secRemote.Labels = make(map[string]string)
-	}
 	secRemote.Labels["liqo/reflection"] = "reflected"
 
 	_, err := p.foreignClient.Client().CoreV1().Secrets(namespace).Create(context.TODO(), &secRemote, metav1.CreateOptions{})
@@ -86,6 +83,7 @@ func (p *KubernetesProvider) updateSecret(sec *corev1.Secret, namespace string)
 	sec2.SetNamespace(namespace)
 	sec2.SetResourceVersion(secOld.ResourceVersion)
 	sec2.SetUID(secOld.UID)
+	sec2.SetLabels(p.foreignLabels(sec.Labels))
 	_, err = p.foreignClient.Client().CoreV1().Secrets(namespace).Update(context.TODO(), sec2, metav1.UpdateOptions{})
 
 	return err
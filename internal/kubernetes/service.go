@@ -59,7 +59,7 @@ func (p *KubernetesProvider) createService(svc *corev1.Service, namespace string
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        svc.Name,
 			Namespace:   namespace,
-			Labels:      svc.Labels,
+			Labels:      p.foreignLabels(svc.Labels),
 			Annotations: nil,
 		},
 		Spec: corev1.ServiceSpec{
@@ -69,9 +69,6 @@ func (p *KubernetesProvider) createService(svc *corev1.Service, namespace string
 		},
 	}
 
-	if svcRemote.Labels == nil {
-		svcRemote.Labels = make(map[string]string)
-	}
 	svcRemote.Labels["liqo/reflection"] = "reflected"
 
 	_, err := p.foreignClient.Client().CoreV1().Services(namespace).Create(context.TODO(), &svcRemote, metav1.CreateOptions{})
@@ -89,6 +86,7 @@ func (p *KubernetesProvider) updateService(svc *corev1.Service, namespace string
 	svc2.SetNamespace(namespace)
 	svc2.SetResourceVersion(serviceOld.ResourceVersion)
 	svc2.SetUID(serviceOld.UID)
+	svc2.SetLabels(p.foreignLabels(svc.Labels))
 	_, err = p.foreignClient.Client().CoreV1().Services(namespace).Update(context.TODO(), svc2, metav1.UpdateOptions{})
 
 	return err
@@ -10,6 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog"
 	"strings"
+	"time"
 )
 
 func (p *KubernetesProvider) StartNodeUpdater(nodeRunner *node.NodeController) (chan struct{}, chan struct{}, error) {
@@ -28,10 +29,19 @@ func (p *KubernetesProvider) StartNodeUpdater(nodeRunner *node.NodeController) (
 
 	go func() {
 		<-ready
+		ticker := time.NewTicker(nodeStatusPeriod)
+		defer ticker.Stop()
 		for {
 			select {
 			case ev := <-c.ResultChan():
 				p.ReconcileNodeFromAdv(ev)
+			case <-ticker.C:
+				if p.unjoining {
+					break
+				}
+				if err := p.refreshNodeStatus(); err != nil {
+					klog.Errorf("cannot refresh the virtual node status - %v", err)
+				}
 			case <-stop:
 				c.Stop()
 				return
@@ -58,6 +68,7 @@ func (p *KubernetesProvider) ReconcileNodeFromAdv(event watch.Event) {
 	}
 
 	if adv.Status.AdvertisementStatus == advertisement_operator.AdvertisementDeleting {
+		p.unjoining = true
 		for retry := 0; retry < 3; retry++ {
 			klog.Infof("advertisement %v is going to be deleted... set node status not ready", adv.Name)
 			no, err := p.nodeUpdateClient.Client().CoreV1().Nodes().Get(context.TODO(), p.nodeName, metav1.GetOptions{})
@@ -132,13 +143,11 @@ func (p *KubernetesProvider) updateFromAdv(adv advv1.Advertisement) error {
 	if no.Status.Capacity == nil {
 		no.Status.Capacity = v1.ResourceList{}
 	}
-	if no.Status.Allocatable == nil {
-		no.Status.Allocatable = v1.ResourceList{}
-	}
 	for k, v := range adv.Spec.ResourceQuota.Hard {
 		no.Status.Capacity[k] = v
-		no.Status.Allocatable[k] = v
 	}
+	p.advertisedQuota = adv.Spec.ResourceQuota.Hard.DeepCopy()
+	no.Status.Allocatable = p.nodeAllocatable(p.advertisedQuota)
 
 	no.Status.Images = []v1.ContainerImage{}
 	no.Status.Images = append(no.Status.Images, adv.Spec.Images...)
@@ -0,0 +1,512 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	netv1alpha1 "github.com/liqoTech/liqo/api/liqonet/v1alpha1"
+	advertisementOperator "github.com/liqoTech/liqo/internal/advertisement-operator"
+	"github.com/liqoTech/liqo/internal/dispatcher"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	"reflect"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	networkConfigNameSuffix = "-netconfig"
+	//the label set on the NetworkConfigs with the ID of the cluster which created them, it is kept by the replicas
+	//written on the peering clusters
+	networkConfigOriginLabel = dispatcher.OriginClusterLabel
+	networkConfigKind        = "NetworkConfig"
+)
+
+//NetworkConfigController negotiates the network parameters with the peering clusters without the advertisements.
+//For each peering cluster it creates a NetworkConfig with the parameters of the local cluster, replicates it on the
+//peering cluster through the kubeconfig received during the peering, and reads the one the peering cluster replicated
+//on the local cluster. Each cluster remaps the pod CIDR of the other one if it overlaps with its subnets, and publishes
+//the result in the status of its own NetworkConfig, so that the NAT is negotiated in both directions. The
+//TunnelEndpoint of the peering cluster is created from the two NetworkConfigs. The IPAM is shared with the
+//TunnelEndpointCreator
+type NetworkConfigController struct {
+	*TunnelEndpointCreator
+	//the pod CIDR of the local cluster
+	PodCIDR string
+	//the other pod CIDRs of the local cluster, advertised without being remapped
+	AdditionalPodCIDRs []string
+	//the clients of the API servers of the peering clusters, keyed by cluster ID
+	remoteClients map[string]remoteClient
+	//builds the client of the API server of a peering cluster, replaced by the tests
+	newRemoteClient func(fc *discoveryv1.ForeignCluster) (client.Client, error)
+}
+
+//the client of a peering cluster is rebuilt when the secret holding its kubeconfig changes
+type remoteClient struct {
+	client.Client
+	secretVersion string
+}
+
+// +kubebuilder:rbac:groups=liqonet.liqo.io,resources=networkconfigs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=liqonet.liqo.io,resources=networkconfigs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=discovery.liqo.io,resources=foreignclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=discovery.liqo.io,resources=peeringrequests,verbs=get
+// +kubebuilder:rbac:groups=protocol.liqo.io,resources=advertisements,verbs=get
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+
+func (r *NetworkConfigController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	//wait for the configuration to be completed
+	r.waitConfiguration()
+	ctx := context.Background()
+	log := r.Log.WithValues("networkConfig-controller", req.Name)
+	localClusterID := r.ClusterID.GetClusterID()
+	if localClusterID == "" {
+		log.Info("the ID of the local cluster is not available yet")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
+	}
+	var fc discoveryv1.ForeignCluster
+	if err := r.Get(ctx, req.NamespacedName, &fc); err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "unable to get the foreign cluster")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	} else if err != nil || !isPeered(&fc) {
+		//the network is torn down when the clusters are not peered anymore, the replica on the remote cluster is
+		//removed as long as the foreign cluster exists
+		peer := &fc
+		if err != nil {
+			peer = nil
+		}
+		if err := r.deleteNetworkConfig(localClusterID, req.Name, peer); err != nil {
+			log.Error(err, "unable to remove the network of the cluster")
+			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	remoteClusterID := fc.Spec.ClusterID
+	localNetConfig, err := r.createOrUpdateLocalNetworkConfig(localClusterID, remoteClusterID)
+	if err != nil {
+		log.Error(err, "unable to create the network config for the cluster")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	remoteNetConfig, err := r.getRemoteNetworkConfig(localClusterID, remoteClusterID)
+	if err != nil {
+		log.Error(err, "unable to get the network config of the cluster")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	if remoteNetConfig != nil {
+		if err := r.setRemotePodCIDRNAT(localNetConfig, remoteNetConfig); err != nil {
+			log.Error(err, "unable to remap the pod CIDR of the cluster")
+			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+		}
+	}
+	if err := r.replicateNetworkConfig(&fc, localNetConfig); err != nil {
+		log.Error(err, "unable to replicate the network config on the cluster")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	if remoteNetConfig == nil {
+		log.Info("waiting for the network config of the cluster")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
+	}
+	if err := r.createOrUpdateTunEndpointFromNetworkConfigs(localNetConfig, remoteNetConfig); err != nil {
+		log.Error(err, "error while creating endpoint")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
+}
+
+//the changes of the NetworkConfigs, both the local ones and the ones replicated by the peering clusters, trigger the
+//reconciliation of the foreign cluster they refer to
+func (r *NetworkConfigController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&discoveryv1.ForeignCluster{}).
+		Watches(&source.Kind{Type: &netv1alpha1.NetworkConfig{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.getForeignClusterOfNetworkConfig),
+		}).
+		Complete(r)
+}
+
+func (r *NetworkConfigController) getForeignClusterOfNetworkConfig(obj handler.MapObject) []reconcile.Request {
+	localClusterID := r.ClusterID.GetClusterID()
+	netConfig, ok := obj.Object.(*netv1alpha1.NetworkConfig)
+	if !ok || localClusterID == "" {
+		return nil
+	}
+	origin := netConfig.GetLabels()[networkConfigOriginLabel]
+	switch {
+	case origin == localClusterID:
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: netConfig.Spec.ClusterID}}}
+	case netConfig.Spec.ClusterID == localClusterID && origin != "":
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: origin}}}
+	}
+	//the NetworkConfigs exchanged by other clusters are ignored
+	return nil
+}
+
+//the network is set up toward the clusters peered in any direction
+func isPeered(fc *discoveryv1.ForeignCluster) bool {
+	return fc.ObjectMeta.DeletionTimestamp.IsZero() && (fc.Status.Outgoing.Joined || fc.Status.Incoming.Joined)
+}
+
+//the name of the NetworkConfig created by a cluster for one of its peering clusters
+func getNetworkConfigName(originClusterID, destinationClusterID string) string {
+	return originClusterID + "-" + destinationClusterID + networkConfigNameSuffix
+}
+
+//returns the network parameters of the local cluster: the gateway is the one published to the peering clusters, the
+//service CIDR is set only if it is exposed to them, the neighbors are the clusters the remote one can reach through the
+//local cluster
+func (r *NetworkConfigController) getLocalNetworkConfigSpec(remoteClusterID string) (netv1alpha1.NetworkConfigSpec, error) {
+	ctx := context.Background()
+	var configurations policyv1.ClusterConfigList
+	if err := r.List(ctx, &configurations); err != nil {
+		return netv1alpha1.NetworkConfigSpec{}, fmt.Errorf("unable to get the cluster configuration: %v", err)
+	}
+	if len(configurations.Items) == 0 {
+		return netv1alpha1.NetworkConfigSpec{}, fmt.Errorf("the cluster configuration does not exist")
+	}
+	liqonetConfig := configurations.Items[0].Spec.LiqonetConfig
+	selector, err := labels.Parse("type != virtual-node")
+	if err != nil {
+		return netv1alpha1.NetworkConfigSpec{}, err
+	}
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return netv1alpha1.NetworkConfigSpec{}, fmt.Errorf("unable to list the nodes: %v", err)
+	}
+	if len(nodes.Items) == 0 {
+		return netv1alpha1.NetworkConfigSpec{}, fmt.Errorf("no physical nodes found")
+	}
+	supportedProtocols, tunnelPublicKey := advertisementOperator.GetTunnelProtocols(nodes.Items)
+	var tunEndList liqonetv1.TunnelEndpointList
+	if err := r.List(ctx, &tunEndList); err != nil {
+		return netv1alpha1.NetworkConfigSpec{}, fmt.Errorf("unable to list the tunnel endpoints: %v", err)
+	}
+	//each pair of clusters gets its own tunnel private IPs, derived from the IDs of the two clusters
+	tunnelPrivateIP, _ := liqonetOperator.GetTunnelPrivateIPs(r.ClusterID.GetClusterID(), remoteClusterID, liqonetOperator.IsIPv6String(r.PodCIDR))
+	return netv1alpha1.NetworkConfigSpec{
+		ClusterID:          remoteClusterID,
+		PodCIDR:            r.PodCIDR,
+		AdditionalPodCIDRs: r.AdditionalPodCIDRs,
+		TunnelPublicIP:     advertisementOperator.GetGateway(nodes.Items),
+		TunnelPrivateIP:    tunnelPrivateIP,
+		SupportedProtocols: supportedProtocols,
+		TunnelPublicKey:    tunnelPublicKey,
+		TunnelPublicPort:   advertisementOperator.GetGatewayPort(nodes.Items),
+		ServiceCIDR:        liqonetConfig.ServiceCIDR,
+		Neighbors:          liqonetOperator.GetNeighborNetworks(tunEndList.Items, remoteClusterID),
+	}, nil
+}
+
+//creates the NetworkConfig with the parameters of the local cluster for the remote cluster, or updates it when they
+//change, e.g. when a new gateway becomes the active one
+func (r *NetworkConfigController) createOrUpdateLocalNetworkConfig(localClusterID, remoteClusterID string) (*netv1alpha1.NetworkConfig, error) {
+	ctx := context.Background()
+	spec, err := r.getLocalNetworkConfigSpec(remoteClusterID)
+	if err != nil {
+		return nil, err
+	}
+	var netConfig netv1alpha1.NetworkConfig
+	err = r.Get(ctx, types.NamespacedName{Name: getNetworkConfigName(localClusterID, remoteClusterID)}, &netConfig)
+	if apierrors.IsNotFound(err) {
+		netConfig = netv1alpha1.NetworkConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   getNetworkConfigName(localClusterID, remoteClusterID),
+				Labels: map[string]string{networkConfigOriginLabel: localClusterID},
+			},
+			Spec: spec,
+		}
+		if err := r.Create(ctx, &netConfig); err != nil {
+			return nil, err
+		}
+		r.Log.Info("created the network config", "name", netConfig.Name, "clusterId", remoteClusterID, "podCIDR", spec.PodCIDR, "gatewayPublicIP", spec.TunnelPublicIP, "tunnelPrivateIP", spec.TunnelPrivateIP)
+		return &netConfig, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(netConfig.Spec, spec) {
+		netConfig.Spec = spec
+		if err := r.Update(ctx, &netConfig); err != nil {
+			return nil, err
+		}
+	}
+	return &netConfig, nil
+}
+
+//returns the kubeconfig the remote cluster provided during the peering: the one referenced by the Advertisement it sent
+//to the local cluster, or the one referenced by its PeeringRequest. Both the secrets are stored in the local cluster
+func (r *NetworkConfigController) getRemoteKubeconfig(fc *discoveryv1.ForeignCluster) (*corev1.Secret, error) {
+	ctx := context.Background()
+	var ref types.NamespacedName
+	switch {
+	case fc.Status.Outgoing.Advertisement != nil:
+		var adv protocolv1.Advertisement
+		if err := r.Get(ctx, types.NamespacedName{Name: fc.Status.Outgoing.Advertisement.Name}, &adv); err != nil {
+			return nil, err
+		}
+		ref = types.NamespacedName{Namespace: adv.Spec.KubeConfigRef.Namespace, Name: adv.Spec.KubeConfigRef.Name}
+	case fc.Status.Incoming.PeeringRequest != nil:
+		var pr discoveryv1.PeeringRequest
+		if err := r.Get(ctx, types.NamespacedName{Name: fc.Status.Incoming.PeeringRequest.Name}, &pr); err != nil {
+			return nil, err
+		}
+		if pr.Spec.KubeConfigRef == nil {
+			return nil, fmt.Errorf("the peering request %s has no kubeconfig", pr.Name)
+		}
+		ref = types.NamespacedName{Namespace: pr.Spec.KubeConfigRef.Namespace, Name: pr.Spec.KubeConfigRef.Name}
+	default:
+		return nil, fmt.Errorf("no kubeconfig received from cluster %s", fc.Spec.ClusterID)
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, ref, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+//returns the client of the API server of the remote cluster, built from the kubeconfig it provided during the peering
+func (r *NetworkConfigController) getRemoteClient(fc *discoveryv1.ForeignCluster) (client.Client, error) {
+	if r.newRemoteClient != nil {
+		return r.newRemoteClient(fc)
+	}
+	secret, err := r.getRemoteKubeconfig(fc)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.remoteClients[fc.Spec.ClusterID]; ok && c.secretVersion == secret.ResourceVersion {
+		return c.Client, nil
+	}
+	config, err := crdClient.NewKubeconfigFromSecret(secret, &netv1alpha1.GroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.New(config, client.Options{Scheme: r.Scheme})
+	if err != nil {
+		return nil, err
+	}
+	if r.remoteClients == nil {
+		r.remoteClients = make(map[string]remoteClient)
+	}
+	r.remoteClients[fc.Spec.ClusterID] = remoteClient{Client: c, secretVersion: secret.ResourceVersion}
+	return c, nil
+}
+
+//writes the local NetworkConfig, status included, on the remote cluster, where it is read by its operator
+func (r *NetworkConfigController) replicateNetworkConfig(fc *discoveryv1.ForeignCluster, netConfig *netv1alpha1.NetworkConfig) error {
+	ctx := context.Background()
+	remote, err := r.getRemoteClient(fc)
+	if err != nil {
+		return fmt.Errorf("unable to get the client of cluster %s: %v", fc.Spec.ClusterID, err)
+	}
+	var replica netv1alpha1.NetworkConfig
+	err = remote.Get(ctx, types.NamespacedName{Name: netConfig.Name}, &replica)
+	if apierrors.IsNotFound(err) {
+		replica = netv1alpha1.NetworkConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   netConfig.Name,
+				Labels: netConfig.Labels,
+			},
+			Spec: netConfig.Spec,
+		}
+		if err := remote.Create(ctx, &replica); err != nil {
+			return err
+		}
+		r.Log.Info("replicated the network config", "name", netConfig.Name, "clusterId", fc.Spec.ClusterID)
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(replica.Spec, netConfig.Spec) || !reflect.DeepEqual(replica.Labels, netConfig.Labels) {
+		replica.Labels = netConfig.Labels
+		replica.Spec = netConfig.Spec
+		if err := remote.Update(ctx, &replica); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(replica.Status, netConfig.Status) {
+		replica.Status = netConfig.Status
+		return remote.Status().Update(ctx, &replica)
+	}
+	return nil
+}
+
+//removes the replica of the local NetworkConfig from the remote cluster. The peering may be already torn down on the
+//remote cluster, together with the kubeconfig, hence the replica is left to the remote operator when it is unreachable
+func (r *NetworkConfigController) deleteRemoteNetworkConfig(fc *discoveryv1.ForeignCluster, netConfig *netv1alpha1.NetworkConfig) {
+	remote, err := r.getRemoteClient(fc)
+	if err != nil {
+		r.Log.Info("unable to remove the replica of the network config", "name", netConfig.Name, "clusterId", fc.Spec.ClusterID, "error", err.Error())
+		return
+	}
+	replica := &netv1alpha1.NetworkConfig{ObjectMeta: metav1.ObjectMeta{Name: netConfig.Name}}
+	if err := remote.Delete(context.Background(), replica); err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Info("unable to remove the replica of the network config", "name", netConfig.Name, "clusterId", fc.Spec.ClusterID, "error", err.Error())
+	}
+}
+
+//returns the NetworkConfig the remote cluster created for the local cluster, nil if it has not been replicated yet
+func (r *NetworkConfigController) getRemoteNetworkConfig(localClusterID, remoteClusterID string) (*netv1alpha1.NetworkConfig, error) {
+	var netConfig netv1alpha1.NetworkConfig
+	err := r.Get(context.Background(), types.NamespacedName{Name: getNetworkConfigName(remoteClusterID, localClusterID)}, &netConfig)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if netConfig.Spec.ClusterID != localClusterID || netConfig.GetLabels()[networkConfigOriginLabel] != remoteClusterID {
+		return nil, fmt.Errorf("the network config %s has not been created by cluster %s for the local cluster", netConfig.Name, remoteClusterID)
+	}
+	return &netConfig, nil
+}
+
+//the pod CIDR of the remote cluster is remapped if it overlaps with the local subnets or with the ones of the other
+//peering clusters. The subnet is published in the status of the local NetworkConfig, so that the remote cluster
+//knows where its pods are reached at from the local cluster
+func (r *NetworkConfigController) setRemotePodCIDRNAT(localNetConfig, remoteNetConfig *netv1alpha1.NetworkConfig) error {
+	if localNetConfig.Status.PodCIDRNAT != "" {
+		return nil
+	}
+	_, subnet, err := net.ParseCIDR(remoteNetConfig.Spec.PodCIDR)
+	if err != nil {
+		return fmt.Errorf("an error occured while parsing podCidr %s from network config %s :%v", remoteNetConfig.Spec.PodCIDR, remoteNetConfig.Name, err)
+	}
+	r.Mutex.Lock()
+	subnet, err = r.IPManager.GetNewSubnetPerCluster(subnet, localNetConfig.Spec.ClusterID)
+	r.Mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if subnet != nil {
+		localNetConfig.Status.NATEnabled = true
+		localNetConfig.Status.PodCIDRNAT = subnet.String()
+	} else {
+		localNetConfig.Status.NATEnabled = false
+		localNetConfig.Status.PodCIDRNAT = defualtPodCIDRValue
+	}
+	return r.Status().Update(context.Background(), localNetConfig)
+}
+
+//the TunnelEndpoint is created from the parameters of the remote cluster, and it is processed when both the clusters
+//have published how they remap the pod CIDR of the other one. The endpoints created from the advertisements are left
+//to the TunnelEndpointCreator
+func (r *NetworkConfigController) createOrUpdateTunEndpointFromNetworkConfigs(localNetConfig, remoteNetConfig *netv1alpha1.NetworkConfig) error {
+	ctx := context.Background()
+	remoteClusterID := localNetConfig.Spec.ClusterID
+	spec := liqonetv1.TunnelEndpointSpec{
+		ClusterID:          remoteClusterID,
+		PodCIDR:            remoteNetConfig.Spec.PodCIDR,
+		TunnelPublicIP:     remoteNetConfig.Spec.TunnelPublicIP,
+		TunnelPrivateIP:    remoteNetConfig.Spec.TunnelPrivateIP,
+		SupportedProtocols: remoteNetConfig.Spec.SupportedProtocols,
+		TunnelPublicKey:    remoteNetConfig.Spec.TunnelPublicKey,
+		TunnelPublicPort:   remoteNetConfig.Spec.TunnelPublicPort,
+		ServiceCIDR:        remoteNetConfig.Spec.ServiceCIDR,
+		AdditionalPodCIDRs: remoteNetConfig.Spec.AdditionalPodCIDRs,
+		Neighbors:          remoteNetConfig.Spec.Neighbors,
+	}
+	var tunEndpoint liqonetv1.TunnelEndpoint
+	err := r.Get(ctx, types.NamespacedName{Name: remoteClusterID + tunEndpointNameSuffix}, &tunEndpoint)
+	if apierrors.IsNotFound(err) {
+		controller := true
+		tunEndpoint = liqonetv1.TunnelEndpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: remoteClusterID + tunEndpointNameSuffix,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: netv1alpha1.GroupVersion.String(),
+					Kind:       networkConfigKind,
+					Name:       localNetConfig.Name,
+					UID:        localNetConfig.UID,
+					Controller: &controller,
+				}},
+			},
+			Spec: spec,
+		}
+		if err := r.Create(ctx, &tunEndpoint); err != nil {
+			return err
+		}
+		r.Log.Info("created the custom resource", "name", tunEndpoint.Name, "clusterId", remoteClusterID, "podCIDR", spec.PodCIDR, "gatewayPublicIP", spec.TunnelPublicIP, "tunnelPrivateIP", spec.TunnelPrivateIP)
+	} else if err != nil {
+		return err
+	} else if !isTunEndpointOwnedByNetworkConfig(&tunEndpoint) {
+		return nil
+	}
+	if err := r.syncTunEndpointSpec(&tunEndpoint, spec); err != nil {
+		return err
+	}
+	if tunEndpoint.Status.Phase == "" {
+		tunEndpoint.Status.RemoteRemappedPodCIDR = localNetConfig.Status.PodCIDRNAT
+		tunEndpoint.Status.Phase = "New"
+		if err := r.Status().Update(ctx, &tunEndpoint); err != nil {
+			return err
+		}
+	}
+	if tunEndpoint.Status.Phase == "New" && remoteNetConfig.Status.PodCIDRNAT != "" {
+		tunEndpoint.Status.LocalRemappedPodCIDR = remoteNetConfig.Status.PodCIDRNAT
+		tunEndpoint.Status.Phase = "Processed"
+		if err := r.Status().Update(ctx, &tunEndpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//removes the NetworkConfig created for the remote cluster and its replica, the TunnelEndpoint created from it, the
+//subnets allocated to the remote cluster and the NetworkConfig the remote cluster replicated on the local one
+func (r *NetworkConfigController) deleteNetworkConfig(localClusterID, remoteClusterID string, fc *discoveryv1.ForeignCluster) error {
+	ctx := context.Background()
+	received := &netv1alpha1.NetworkConfig{ObjectMeta: metav1.ObjectMeta{Name: getNetworkConfigName(remoteClusterID, localClusterID)}}
+	if err := r.Delete(ctx, received); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete network config %s: %v", received.Name, err)
+	}
+	var netConfig netv1alpha1.NetworkConfig
+	err := r.Get(ctx, types.NamespacedName{Name: getNetworkConfigName(localClusterID, remoteClusterID)}, &netConfig)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var tunEndpoint liqonetv1.TunnelEndpoint
+	err = r.Get(ctx, types.NamespacedName{Name: remoteClusterID + tunEndpointNameSuffix}, &tunEndpoint)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	//the subnets are left allocated if the endpoint has been created from the advertisement
+	if err == nil && isTunEndpointOwnedByNetworkConfig(&tunEndpoint) {
+		if err := r.Delete(ctx, &tunEndpoint); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete endpoint %s: %v", tunEndpoint.Name, err)
+		}
+	}
+	if apierrors.IsNotFound(err) || isTunEndpointOwnedByNetworkConfig(&tunEndpoint) {
+		r.Mutex.Lock()
+		r.IPManager.RemoveReservedSubnet(remoteClusterID)
+		r.IPManager.RemoveReservedSubnet(remoteClusterID + serviceSubnetSuffix)
+		r.releaseSubnets(remoteClusterID+additionalPodSubnetInfix, nil)
+		r.releaseSubnets(remoteClusterID+liqonetOperator.TransitSubnetInfix, nil)
+		r.releaseRoutingTable(remoteClusterID)
+		r.Mutex.Unlock()
+	}
+	if fc != nil {
+		r.deleteRemoteNetworkConfig(fc, &netConfig)
+	}
+	if err := r.Delete(ctx, &netConfig); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete network config %s: %v", netConfig.Name, err)
+	}
+	r.Log.Info("removed the network config", "name", netConfig.Name, "clusterId", remoteClusterID)
+	return nil
+}
+
+//the endpoints created from the NetworkConfigs are controlled by the NetworkConfig of the local cluster
+func isTunEndpointOwnedByNetworkConfig(tunEndpoint *liqonetv1.TunnelEndpoint) bool {
+	owner := metav1.GetControllerOf(tunEndpoint)
+	return owner != nil && owner.Kind == networkConfigKind
+}
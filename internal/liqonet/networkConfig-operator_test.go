@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	v1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	netv1alpha1 "github.com/liqoTech/liqo/api/liqonet/v1alpha1"
+	"github.com/liqoTech/liqo/pkg/clusterID"
+	"github.com/liqoTech/liqo/pkg/liqonet"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"testing"
+)
+
+func getNetworkConfigController(t *testing.T, localClusterID, podCIDR, gatewayIP string, objs ...runtime.Object) *NetworkConfigController {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, corev1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, v1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, netv1alpha1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, discoveryv1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, protocolv1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, policyv1.AddToScheme(scheme), "error should be nil")
+	objs = append(objs, &policyv1.ClusterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "configuration"},
+		Spec:       policyv1.ClusterConfigSpec{LiqonetConfig: policyv1.LiqonetConfig{}},
+	}, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "gateway",
+			Labels:      map[string]string{liqonet.GatewayLabelKey: "true"},
+			Annotations: map[string]string{liqonet.TunnelProtocolsAnnotation: liqonet.GreProtocol},
+		},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: gatewayIP}}},
+	})
+	r := &NetworkConfigController{
+		TunnelEndpointCreator: &TunnelEndpointCreator{
+			Client:       fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:          ctrl.Log.WithName("networkConfig"),
+			Scheme:       scheme,
+			IPManager:    liqonet.IpManager{Log: ctrl.Log.WithName("IPAM")},
+			Configured:   make(chan bool, 1),
+			RetryTimeout: 0,
+			ClusterID:    clusterID.GetNewClusterID(localClusterID, nil),
+		},
+		PodCIDR: podCIDR,
+	}
+	_, localSubnet, err := net.ParseCIDR(podCIDR)
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, r.InitConfiguration(map[string]*net.IPNet{localSubnet.String(): localSubnet}, nil), "error should be nil")
+	return r
+}
+
+func getJoinedForeignCluster(clusterID string) *discoveryv1.ForeignCluster {
+	return &discoveryv1.ForeignCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterID},
+		Spec:       discoveryv1.ForeignClusterSpec{ClusterID: clusterID, Join: true},
+		Status:     discoveryv1.ForeignClusterStatus{Outgoing: discoveryv1.Outgoing{Joined: true}},
+	}
+}
+
+//connects the operators of the given clusters, each one reaching the API servers of the other ones with their clients
+func connectClusters(clusters ...*NetworkConfigController) {
+	for _, local := range clusters {
+		remotes := map[string]client.Client{}
+		for _, remote := range clusters {
+			if remote != local {
+				remotes[remote.ClusterID.GetClusterID()] = remote.Client
+			}
+		}
+		local.newRemoteClient = func(fc *discoveryv1.ForeignCluster) (client.Client, error) {
+			c, ok := remotes[fc.Spec.ClusterID]
+			if !ok {
+				return nil, fmt.Errorf("cluster %s not reachable", fc.Spec.ClusterID)
+			}
+			return c, nil
+		}
+	}
+}
+
+func getTunnelEndpoint(t *testing.T, r *NetworkConfigController, clusterID string) *v1.TunnelEndpoint {
+	var tunEndpoint v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), types.NamespacedName{Name: clusterID + tunEndpointNameSuffix}, &tunEndpoint), "error should be nil")
+	return &tunEndpoint
+}
+
+func TestNetworkConfigNegotiation(t *testing.T) {
+	//the two clusters use the same pod CIDR, hence each one has to remap the one of the other cluster. Each operator
+	//writes its NetworkConfig on the API server of the other cluster
+	a := getNetworkConfigController(t, "cluster-a", "10.100.0.0/16", "172.16.0.1", getJoinedForeignCluster("cluster-b"))
+	b := getNetworkConfigController(t, "cluster-b", "10.100.0.0/16", "172.16.0.2", getJoinedForeignCluster("cluster-a"))
+	connectClusters(a, b)
+	nameA, nameB := getNetworkConfigName("cluster-a", "cluster-b"), getNetworkConfigName("cluster-b", "cluster-a")
+
+	//cluster-a creates its NetworkConfig, replicates it on cluster-b and waits for the one of cluster-b
+	_, err := a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	var netConfig netv1alpha1.NetworkConfig
+	assert.Nil(t, a.Get(context.TODO(), types.NamespacedName{Name: nameA}, &netConfig), "error should be nil")
+	assert.Equal(t, "cluster-b", netConfig.Spec.ClusterID)
+	assert.Equal(t, "10.100.0.0/16", netConfig.Spec.PodCIDR)
+	assert.Equal(t, "172.16.0.1", netConfig.Spec.TunnelPublicIP)
+	//each cluster publishes its own address of the /31 of the pair
+	privateA, privateB := liqonet.GetTunnelPrivateIPs("cluster-a", "cluster-b", false)
+	assert.Equal(t, privateA, netConfig.Spec.TunnelPrivateIP)
+	assert.Equal(t, []string{liqonet.GreProtocol}, netConfig.Spec.SupportedProtocols)
+	assert.Equal(t, "cluster-a", netConfig.Labels[networkConfigOriginLabel])
+	assert.Equal(t, "", netConfig.Status.PodCIDRNAT, "the NAT should not be set before the peer's config is received")
+	assert.True(t, apierrors.IsNotFound(a.Get(context.TODO(), types.NamespacedName{Name: "cluster-b" + tunEndpointNameSuffix}, &v1.TunnelEndpoint{})))
+	var replica netv1alpha1.NetworkConfig
+	assert.Nil(t, b.Get(context.TODO(), types.NamespacedName{Name: nameA}, &replica), "the config should be replicated on cluster-b")
+	assert.Equal(t, netConfig.Spec, replica.Spec)
+	assert.Equal(t, "cluster-a", replica.Labels[networkConfigOriginLabel])
+
+	//cluster-b remaps the pod CIDR of cluster-a, publishes it on cluster-a and waits for the NAT chosen by cluster-a
+	_, err = b.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-a"}})
+	assert.Nil(t, err, "error should be nil")
+	tunEndpoint := getTunnelEndpoint(t, b, "cluster-a")
+	assert.Equal(t, "172.16.0.1", tunEndpoint.Spec.TunnelPublicIP)
+	assert.Equal(t, privateA, tunEndpoint.Spec.TunnelPrivateIP)
+	assert.Equal(t, 1, tunEndpoint.Status.RoutingTable, "the first remote cluster should get the first table")
+	assert.Equal(t, "10.100.0.0/16", tunEndpoint.Spec.PodCIDR)
+	assert.Equal(t, "New", tunEndpoint.Status.Phase, "the endpoint should wait for the NAT chosen by the peer")
+	var configB netv1alpha1.NetworkConfig
+	assert.Nil(t, b.Get(context.TODO(), types.NamespacedName{Name: nameB}, &configB), "error should be nil")
+	assert.Equal(t, privateB, configB.Spec.TunnelPrivateIP)
+	assert.Equal(t, "10.0.0.0/16", tunEndpoint.Status.RemoteRemappedPodCIDR)
+	replica = netv1alpha1.NetworkConfig{}
+	assert.Nil(t, a.Get(context.TODO(), types.NamespacedName{Name: nameB}, &replica), "the config should be replicated on cluster-a")
+	assert.True(t, replica.Status.NATEnabled)
+	assert.Equal(t, "10.0.0.0/16", replica.Status.PodCIDRNAT)
+
+	//each cluster completes its endpoint once received the NAT chosen by the other one
+	_, err = a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	_, err = b.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-a"}})
+	assert.Nil(t, err, "error should be nil")
+	for _, r := range []*NetworkConfigController{a, b} {
+		for _, name := range []string{nameA, nameB} {
+			netConfig = netv1alpha1.NetworkConfig{}
+			assert.Nil(t, r.Get(context.TODO(), types.NamespacedName{Name: name}, &netConfig), "error should be nil")
+			assert.Equal(t, "10.0.0.0/16", netConfig.Status.PodCIDRNAT)
+		}
+		remote := "cluster-b"
+		if r == b {
+			remote = "cluster-a"
+		}
+		tunEndpoint = getTunnelEndpoint(t, r, remote)
+		assert.Equal(t, "Processed", tunEndpoint.Status.Phase)
+		assert.Equal(t, "10.0.0.0/16", tunEndpoint.Status.RemoteRemappedPodCIDR)
+		assert.Equal(t, "10.0.0.0/16", tunEndpoint.Status.LocalRemappedPodCIDR)
+	}
+
+	//a new gateway of the peer is applied to the endpoint
+	var gateway corev1.Node
+	assert.Nil(t, b.Get(context.TODO(), types.NamespacedName{Name: "gateway"}, &gateway), "error should be nil")
+	gateway.Status.Addresses[0].Address = "172.16.0.3"
+	assert.Nil(t, b.Update(context.TODO(), &gateway), "error should be nil")
+	_, err = b.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-a"}})
+	assert.Nil(t, err, "error should be nil")
+	_, err = a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	tunEndpoint = getTunnelEndpoint(t, a, "cluster-b")
+	assert.Equal(t, "172.16.0.3", tunEndpoint.Spec.TunnelPublicIP)
+	assert.Equal(t, "Processed", tunEndpoint.Status.Phase)
+
+	//the network is removed when the clusters are not peered anymore, together with the configs on both the clusters
+	var fc discoveryv1.ForeignCluster
+	assert.Nil(t, a.Get(context.TODO(), types.NamespacedName{Name: "cluster-b"}, &fc), "error should be nil")
+	fc.Status.Outgoing.Joined = false
+	assert.Nil(t, a.Update(context.TODO(), &fc), "error should be nil")
+	_, err = a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	for _, name := range []string{nameA, nameB} {
+		assert.True(t, apierrors.IsNotFound(a.Get(context.TODO(), types.NamespacedName{Name: name}, &netv1alpha1.NetworkConfig{})))
+	}
+	assert.True(t, apierrors.IsNotFound(b.Get(context.TODO(), types.NamespacedName{Name: nameA}, &netv1alpha1.NetworkConfig{})))
+	assert.True(t, apierrors.IsNotFound(a.Get(context.TODO(), types.NamespacedName{Name: "cluster-b" + tunEndpointNameSuffix}, &v1.TunnelEndpoint{})))
+	_, ok := a.IPManager.SubnetPerCluster["cluster-b"]
+	assert.False(t, ok, "the subnet of the cluster should be released")
+}
+
+func TestNetworkConfigRemoteKubeconfig(t *testing.T) {
+	//the kubeconfig is the one referenced by the Advertisement received from the foreign cluster, or by its
+	//PeeringRequest when the foreign cluster only joined the local one
+	objs := []runtime.Object{
+		&protocolv1.Advertisement{
+			ObjectMeta: metav1.ObjectMeta{Name: "advertisement-cluster-b"},
+			Spec:       protocolv1.AdvertisementSpec{KubeConfigRef: corev1.SecretReference{Namespace: "liqo", Name: "vk-kubeconfig-secret-cluster-b"}},
+		},
+		&discoveryv1.PeeringRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-c"},
+			Spec:       discoveryv1.PeeringRequestSpec{KubeConfigRef: &corev1.ObjectReference{Namespace: "liqo", Name: "pr-cluster-c"}},
+		},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "liqo", Name: "vk-kubeconfig-secret-cluster-b"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "liqo", Name: "pr-cluster-c"}},
+	}
+	r := getNetworkConfigController(t, "cluster-a", "10.100.0.0/16", "172.16.0.1", objs...)
+	fc := getJoinedForeignCluster("cluster-b")
+	fc.Status.Outgoing.Advertisement = &corev1.ObjectReference{Name: "advertisement-cluster-b"}
+	secret, err := r.getRemoteKubeconfig(fc)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, "vk-kubeconfig-secret-cluster-b", secret.Name)
+	fc = getJoinedForeignCluster("cluster-c")
+	fc.Status = discoveryv1.ForeignClusterStatus{Incoming: discoveryv1.Incoming{Joined: true, PeeringRequest: &corev1.ObjectReference{Name: "cluster-c"}}}
+	secret, err = r.getRemoteKubeconfig(fc)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, "pr-cluster-c", secret.Name)
+	_, err = r.getRemoteKubeconfig(getJoinedForeignCluster("cluster-d"))
+	assert.NotNil(t, err, "the cluster has not provided any kubeconfig")
+}
+
+func TestNetworkConfigAdditionalPodCIDRs(t *testing.T) {
+	a := getNetworkConfigController(t, "cluster-a", "10.100.0.0/16", "172.16.0.1", getJoinedForeignCluster("cluster-b"))
+	a.AdditionalPodCIDRs = []string{"10.101.0.0/16"}
+	b := getNetworkConfigController(t, "cluster-b", "10.200.0.0/16", "172.16.0.2", getJoinedForeignCluster("cluster-a"))
+	b.AdditionalPodCIDRs = []string{"10.100.128.0/17", "10.201.0.0/16"}
+	connectClusters(a, b)
+	for i := 0; i < 2; i++ {
+		_, err := a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+		assert.Nil(t, err, "error should be nil")
+		_, err = b.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-a"}})
+		assert.Nil(t, err, "error should be nil")
+	}
+
+	//the additional pod CIDRs are reserved as they are, the one overlapping with the local pod CIDR is left out
+	tunEndpoint := getTunnelEndpoint(t, a, "cluster-b")
+	assert.Equal(t, []string{"10.100.128.0/17", "10.201.0.0/16"}, tunEndpoint.Spec.AdditionalPodCIDRs)
+	assert.Equal(t, []string{"10.201.0.0/16"}, tunEndpoint.Status.AdditionalPodCIDRs)
+	assert.Equal(t, "10.201.0.0/16", a.IPManager.SubnetPerCluster["cluster-b"+additionalPodSubnetInfix+"10.201.0.0/16"].String())
+	tunEndpoint = getTunnelEndpoint(t, b, "cluster-a")
+	assert.Equal(t, []string{"10.101.0.0/16"}, tunEndpoint.Status.AdditionalPodCIDRs)
+
+	//the pod CIDRs removed by the remote cluster are released
+	b.AdditionalPodCIDRs = []string{"10.100.128.0/17"}
+	_, err := b.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-a"}})
+	assert.Nil(t, err, "error should be nil")
+	_, err = a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	tunEndpoint = getTunnelEndpoint(t, a, "cluster-b")
+	assert.Empty(t, tunEndpoint.Status.AdditionalPodCIDRs)
+	_, ok := a.IPManager.SubnetPerCluster["cluster-b"+additionalPodSubnetInfix+"10.201.0.0/16"]
+	assert.False(t, ok, "the subnet should be released")
+}
+
+func TestNetworkConfigTransitRoutes(t *testing.T) {
+	//cluster-b is peered with cluster-c, whose pod CIDR overlaps with the one of cluster-a
+	tunEndpoint := getTunnelEndpointForCluster("cluster-c")
+	tunEndpoint.Spec.PodCIDR = "10.100.0.0/16"
+	tunEndpoint.Status = v1.TunnelEndpointStatus{Phase: "Ready", RemoteRemappedPodCIDR: "None", LocalRemappedPodCIDR: "None"}
+	a := getNetworkConfigController(t, "cluster-a", "10.100.0.0/16", "172.16.0.1", getJoinedForeignCluster("cluster-b"))
+	b := getNetworkConfigController(t, "cluster-b", "10.200.0.0/16", "172.16.0.2", getJoinedForeignCluster("cluster-a"), tunEndpoint)
+	connectClusters(a, b)
+	nameA, nameB := getNetworkConfigName("cluster-a", "cluster-b"), getNetworkConfigName("cluster-b", "cluster-a")
+	for i := 0; i < 2; i++ {
+		_, err := a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+		assert.Nil(t, err, "error should be nil")
+		_, err = b.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-a"}})
+		assert.Nil(t, err, "error should be nil")
+	}
+
+	//cluster-b advertises cluster-c to cluster-a, which reaches it through cluster-b remapping its pod CIDR
+	neighbors := []v1.NeighborNetwork{{ClusterID: "cluster-c", PodCIDR: "10.100.0.0/16", Hops: 1}}
+	var netConfig netv1alpha1.NetworkConfig
+	assert.Nil(t, b.Get(context.TODO(), types.NamespacedName{Name: nameB}, &netConfig), "error should be nil")
+	assert.Equal(t, neighbors, netConfig.Spec.Neighbors)
+	_, err := a.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	endpoint := getTunnelEndpoint(t, a, "cluster-b")
+	assert.Equal(t, neighbors, endpoint.Spec.Neighbors)
+	assert.Equal(t, 1, len(endpoint.Status.TransitRoutes))
+	route := endpoint.Status.TransitRoutes[0]
+	assert.Equal(t, "cluster-c", route.ClusterID)
+	assert.Equal(t, "10.100.0.0/16", route.PodCIDR)
+	assert.Equal(t, int32(2), route.Hops)
+	assert.NotEqual(t, "None", route.RemappedPodCIDR, "the pod CIDR of cluster-c should be remapped")
+	assert.Equal(t, route.RemappedPodCIDR, a.IPManager.SubnetPerCluster["cluster-b"+liqonet.TransitSubnetInfix+"cluster-c"].String())
+
+	//the clusters reached through cluster-b are not advertised back to it
+	netConfig = netv1alpha1.NetworkConfig{}
+	assert.Nil(t, a.Get(context.TODO(), types.NamespacedName{Name: nameA}, &netConfig), "error should be nil")
+	assert.Empty(t, netConfig.Spec.Neighbors)
+
+	//the routes toward the local cluster and the ones exceeding the maximum number of hops are ignored, and the
+	//subnets reserved for the dropped routes are released
+	endpoint.Spec.Neighbors = []v1.NeighborNetwork{
+		{ClusterID: "cluster-a", PodCIDR: "10.0.0.0/16", Hops: 1},
+		{ClusterID: "cluster-c", PodCIDR: "10.100.0.0/16", Hops: liqonet.MaxTransitHops},
+	}
+	assert.Nil(t, a.setTransitRoutes(endpoint), "error should be nil")
+	assert.Empty(t, getTunnelEndpoint(t, a, "cluster-b").Status.TransitRoutes)
+	_, ok := a.IPManager.SubnetPerCluster["cluster-b"+liqonet.TransitSubnetInfix+"cluster-c"]
+	assert.False(t, ok, "the subnet should be released")
+}
+
+func TestNetworkConfigAdvertisementEndpoint(t *testing.T) {
+	//the endpoint created from the advertisement is not changed by the NetworkConfigs
+	controller := true
+	tunEndpoint := getTunnelEndpointForCluster("cluster-b")
+	tunEndpoint.OwnerReferences = []metav1.OwnerReference{{Kind: "Advertisement", Name: "advertisement-cluster-b", Controller: &controller}}
+	remote := &netv1alpha1.NetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   getNetworkConfigName("cluster-b", "cluster-a"),
+			Labels: map[string]string{networkConfigOriginLabel: "cluster-b"},
+		},
+		Spec: netv1alpha1.NetworkConfigSpec{ClusterID: "cluster-a", PodCIDR: "10.200.0.0/16", TunnelPublicIP: "172.16.0.9", TunnelPrivateIP: "192.168.1.2"},
+	}
+	r := getNetworkConfigController(t, "cluster-a", "10.100.0.0/16", "172.16.0.1", getJoinedForeignCluster("cluster-b"), tunEndpoint, remote)
+	connectClusters(r, getNetworkConfigController(t, "cluster-b", "10.200.0.0/16", "172.16.0.9"))
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cluster-b"}})
+	assert.Nil(t, err, "error should be nil")
+	endpoint := getTunnelEndpoint(t, r, "cluster-b")
+	assert.Equal(t, "192.168.5.1", endpoint.Spec.TunnelPublicIP)
+	assert.False(t, isTunEndpointOwnedByNetworkConfig(endpoint))
+
+	//the requests of the NetworkConfigs are mapped to the foreign cluster they refer to
+	var local netv1alpha1.NetworkConfig
+	assert.Nil(t, r.Get(context.TODO(), types.NamespacedName{Name: getNetworkConfigName("cluster-a", "cluster-b")}, &local), "error should be nil")
+	for _, netConfig := range []*netv1alpha1.NetworkConfig{&local, remote} {
+		requests := r.getForeignClusterOfNetworkConfig(handler.MapObject{Meta: netConfig, Object: netConfig})
+		assert.Equal(t, 1, len(requests))
+		assert.Equal(t, "cluster-b", requests[0].Name)
+	}
+	other := remote.DeepCopy()
+	other.Spec.ClusterID = "cluster-c"
+	assert.Equal(t, 0, len(r.getForeignClusterOfNetworkConfig(handler.MapObject{Meta: other, Object: other})), "the configs for other clusters should be ignored")
+}
+
+func TestRoutingTableAllocation(t *testing.T) {
+	//the table allocated to cluster-c before the restart is restored, the other clusters get the lowest free ones
+	restored := &v1.TunnelEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-c" + tunEndpointNameSuffix},
+		Spec:       v1.TunnelEndpointSpec{ClusterID: "cluster-c"},
+		Status:     v1.TunnelEndpointStatus{RoutingTable: 1},
+	}
+	r := getNetworkConfigController(t, "cluster-a", "10.100.0.0/16", "172.16.0.1", restored)
+	var tables []int
+	for _, clusterID := range []string{"cluster-b", "cluster-d"} {
+		tunEndpoint := &v1.TunnelEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterID + tunEndpointNameSuffix},
+			Spec:       v1.TunnelEndpointSpec{ClusterID: clusterID},
+		}
+		assert.Nil(t, r.Create(context.TODO(), tunEndpoint), "error should be nil")
+		assert.Nil(t, r.allocateRoutingTable(tunEndpoint), "error should be nil")
+		tables = append(tables, getTunnelEndpoint(t, r, clusterID).Status.RoutingTable)
+	}
+	assert.Equal(t, []int{2, 3}, tables)
+	//the table is kept while the cluster is peered
+	tunEndpoint := getTunnelEndpoint(t, r, "cluster-b")
+	assert.Nil(t, r.allocateRoutingTable(tunEndpoint), "error should be nil")
+	assert.Equal(t, 2, tunEndpoint.Status.RoutingTable)
+	//the table of a cluster which is no more peered is allocated again
+	r.releaseRoutingTable("cluster-b")
+	tunEndpoint = &v1.TunnelEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-e" + tunEndpointNameSuffix},
+		Spec:       v1.TunnelEndpointSpec{ClusterID: "cluster-e"},
+	}
+	assert.Nil(t, r.Create(context.TODO(), tunEndpoint), "error should be nil")
+	assert.Nil(t, r.allocateRoutingTable(tunEndpoint), "error should be nil")
+	assert.Equal(t, 2, tunEndpoint.Status.RoutingTable)
+}
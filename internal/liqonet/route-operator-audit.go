@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	"net"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sort"
+	"strings"
+	"time"
+)
+
+//the kinds of state checked by the audits, and the actions taken when a drift is found
+const (
+	driftKindRoute    = "route"
+	driftKindRule     = "rule"
+	driftKindChain    = "chain"
+	driftActionAdd    = "reapplied"
+	driftActionRemove = "removed"
+)
+
+var (
+	driftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "liqonet_route_operator_drift_total",
+		Help: "Number of routes, rules and chains found different from the expected ones and repaired by the audits",
+	}, []string{"kind", "action"})
+	lastAuditTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "liqonet_route_operator_last_audit_timestamp_seconds",
+		Help: "Time of the last audit of the routes and the rules installed on the node",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(driftTotal, lastAuditTimestamp)
+}
+
+//AuditState checks periodically, until the stop channel is closed, that the routes and the rules installed on the node
+//are the ones expected for the TunnelEndpoints. The missing ones, e.g. flushed by other components or lost when the
+//operator has been restarted, are installed again and the stale ones are removed
+func (r *RouteController) AuditState(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.audit(); err != nil {
+			r.Log.Error(err, "unable to audit the routes and the rules")
+		} else {
+			lastAuditTimestamp.SetToCurrentTime()
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *RouteController) audit() error {
+	log := r.Log.WithName("audit")
+	var endpoints v1.TunnelEndpointList
+	if err := r.List(context.Background(), &endpoints); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	//the routes depend on the active gateway, the audit waits until it is known
+	if !r.IsGateway && r.GatewayVxlanIP == "" {
+		return nil
+	}
+	existing := make(map[string]bool)
+	var processed []*v1.TunnelEndpoint
+	for i := range endpoints.Items {
+		endpoint := &endpoints.Items[i]
+		if !endpoint.DeletionTimestamp.IsZero() {
+			continue
+		}
+		existing[endpoint.Spec.ClusterID] = true
+		if r.ToBeProcessedByRouteOperator(endpoint.GetObjectMeta()) && r.alreadyProcessedByRouteOperator(endpoint.GetObjectMeta()) {
+			processed = append(processed, endpoint)
+		}
+	}
+	//the chains are created when the first TunnelEndpoint is processed
+	if len(processed) > 0 || len(r.IPTablesChains) > 0 {
+		if err := r.auditChains(); err != nil {
+			return err
+		}
+	}
+	failed := false
+	for _, endpoint := range processed {
+		rules, routes, err := r.auditRemoteCluster(endpoint)
+		if err != nil {
+			log.Error(err, "unable to repair the state", "cluster", endpoint.Spec.ClusterID)
+			failed = true
+			continue
+		}
+		if rules+routes > 0 {
+			log.Info("drift detected", "cluster", endpoint.Spec.ClusterID, "rules", rules, "routes", routes)
+			r.recordEvent(endpoint, corev1.EventTypeWarning, "DriftDetected", fmt.Sprintf("%d rules and %d routes were missing on node %s and have been reapplied", rules, routes, r.NodeName))
+		}
+	}
+	//the state of the remote clusters whose TunnelEndpoint has been removed while the operator was not running
+	for clusterID := range r.getKnownClusters() {
+		if existing[clusterID] {
+			continue
+		}
+		log.Info("removing the stale state", "cluster", clusterID)
+		endpoint := &v1.TunnelEndpoint{Spec: v1.TunnelEndpointSpec{ClusterID: clusterID}}
+		driftTotal.WithLabelValues(driftKindRule, driftActionRemove).Add(float64(len(r.IPtablesRuleSpecsPerRemoteCluster[clusterID])))
+		driftTotal.WithLabelValues(driftKindRoute, driftActionRemove).Add(float64(len(r.RoutesPerRemoteCluster[clusterID])))
+		if err := r.deleteIPTablesRulespecForRemoteCluster(endpoint); err != nil {
+			return err
+		}
+		if err := r.deleteRoutesPerCluster(endpoint); err != nil {
+			return err
+		}
+	}
+	//the state of a cluster which has not been repaired is not complete, hence the stale entries are not known
+	if failed {
+		return fmt.Errorf("unable to repair the state of all the remote clusters")
+	}
+	if err := r.removeStaleRoutes(); err != nil {
+		return err
+	}
+	return r.removeStaleRules()
+}
+
+func (r *RouteController) recordEvent(endpoint *v1.TunnelEndpoint, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(endpoint, eventType, reason, message)
+	}
+}
+
+//returns the remote clusters routes or rules have been installed for
+func (r *RouteController) getKnownClusters() map[string]bool {
+	clusters := make(map[string]bool)
+	for clusterID := range r.IPtablesRuleSpecsPerRemoteCluster {
+		clusters[clusterID] = true
+	}
+	for clusterID := range r.RoutesPerRemoteCluster {
+		clusters[clusterID] = true
+	}
+	return clusters
+}
+
+//checks the custom chains and the rules referencing them, they are created again if something is missing
+func (r *RouteController) auditChains() error {
+	log := r.Log.WithName("audit")
+	//after a restart the chains are not known yet, they are created if they do not exist
+	if len(r.IPTablesChains) == 0 {
+		return r.createAndInsertIPTablesChains()
+	}
+	if ipt, ok := r.IPtables.(liqonetOperator.PeerIPTables); ok {
+		installed, err := ipt.CheckRules("")
+		if err != nil || installed {
+			return err
+		}
+		log.Info("the chains have been modified, installing them again")
+		driftTotal.WithLabelValues(driftKindChain, driftActionAdd).Inc()
+		return ipt.RestoreRules()
+	}
+	missing := 0
+	for _, chain := range r.IPTablesChains {
+		chains, err := r.IPtables.ListChains(chain.Table)
+		if err != nil {
+			return err
+		}
+		if !liqonetOperator.ContainsString(chains, chain.Name) {
+			missing++
+		}
+	}
+	rules := []liqonetOperator.IPtableRule{{Table: FilterTable, Chain: LiqonetInputChain, RuleSpec: r.getVxlanUdpRuleSpec()}}
+	for _, rule := range r.IPTablesRuleSpecsReferencingChains {
+		rules = append(rules, rule)
+	}
+	for _, rule := range rules {
+		exists, err := r.IPtables.Exists(rule.Table, rule.Chain, rule.RuleSpec...)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return nil
+	}
+	log.Info("the chains have been modified, installing them again", "missing", missing)
+	driftTotal.WithLabelValues(driftKindChain, driftActionAdd).Add(float64(missing))
+	return r.createAndInsertIPTablesChains()
+}
+
+//checks the rules and the routes of the remote cluster and installs again the missing ones, returning how many they were.
+//If they are not known, e.g. after a restart, they are installed without reporting a drift, since the ones already
+//in place are kept
+func (r *RouteController) auditRemoteCluster(endpoint *v1.TunnelEndpoint) (int, int, error) {
+	clusterID := endpoint.Spec.ClusterID
+	missingRules := 0
+	rules, err := r.getIPTablesRulespecsForRemoteCluster(endpoint)
+	if err != nil {
+		return 0, 0, err
+	}
+	installedRules, known := r.IPtablesRuleSpecsPerRemoteCluster[clusterID]
+	if known && reflect.DeepEqual(installedRules, rules) {
+		var err error
+		if missingRules, err = r.countMissingRules(clusterID, rules); err != nil {
+			return 0, 0, err
+		}
+	}
+	if !known || missingRules > 0 || !reflect.DeepEqual(installedRules, rules) {
+		//the outdated rules are removed before installing the ones matching the current TunnelEndpoint
+		if known && !reflect.DeepEqual(installedRules, rules) {
+			if err := r.deleteIPTablesRulespecForRemoteCluster(endpoint); err != nil {
+				return 0, 0, err
+			}
+		}
+		if err := r.addIPTablesRulespecForRemoteCluster(endpoint); err != nil {
+			return 0, 0, err
+		}
+		driftTotal.WithLabelValues(driftKindRule, driftActionAdd).Add(float64(missingRules))
+	}
+	missingRoutes := 0
+	installedRoutes, known := r.RoutesPerRemoteCluster[clusterID]
+	upToDate := known && reflect.DeepEqual(getRouteDestinations(installedRoutes), r.getRouteDestinationsForRemoteCluster(endpoint))
+	if upToDate {
+		for i := range installedRoutes {
+			exists, err := r.routeExists(installedRoutes[i])
+			if err != nil {
+				return 0, 0, err
+			}
+			if !exists {
+				missingRoutes++
+			}
+		}
+	}
+	if !upToDate || missingRoutes > 0 {
+		if known {
+			if err := r.deleteRoutesPerCluster(endpoint); err != nil {
+				return 0, 0, err
+			}
+		}
+		if err := r.InsertRoutesPerCluster(endpoint); err != nil {
+			return 0, 0, err
+		}
+		driftTotal.WithLabelValues(driftKindRoute, driftActionAdd).Add(float64(missingRoutes))
+	}
+	return missingRules, missingRoutes, nil
+}
+
+//returns how many rules of the remote cluster are not installed
+func (r *RouteController) countMissingRules(clusterID string, rules []liqonetOperator.IPtableRule) (int, error) {
+	//the backends grouping the rules per remote cluster check all of them at once
+	if ipt, ok := r.IPtables.(liqonetOperator.PeerIPTables); ok {
+		installed, err := ipt.CheckRules(clusterID)
+		if err != nil || installed {
+			return 0, err
+		}
+		return len(rules), nil
+	}
+	missing := 0
+	for _, rule := range rules {
+		exists, err := r.IPtables.Exists(rule.Table, rule.Chain, rule.RuleSpec...)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			missing++
+		}
+	}
+	return missing, nil
+}
+
+//returns the destinations of the routes installed by InsertRoutesPerCluster for the remote cluster
+func (r *RouteController) getRouteDestinationsForRemoteCluster(endpoint *v1.TunnelEndpoint) []string {
+	remotePodCIDR := endpoint.Spec.PodCIDR
+	if endpoint.Status.RemoteRemappedPodCIDR != "None" && endpoint.Status.RemoteRemappedPodCIDR != "" {
+		remotePodCIDR = endpoint.Status.RemoteRemappedPodCIDR
+	}
+	var destinations []string
+	remoteTunnelPrivateIPNet := liqonetOperator.HostCIDR(endpoint.Status.RemoteTunnelPrivateIP)
+	//on the gateway the route toward a private IP shared with another cluster is not installed
+	if _, ok := r.getClusterRoutingTo(remoteTunnelPrivateIPNet, endpoint.Spec.ClusterID); !r.IsGateway || !ok {
+		destinations = append(destinations, normalizeCIDR(remoteTunnelPrivateIPNet))
+	}
+	destinations = append(destinations, normalizeCIDR(remotePodCIDR))
+	for _, podCIDR := range endpoint.Status.AdditionalPodCIDRs {
+		destinations = append(destinations, normalizeCIDR(podCIDR))
+	}
+	//the gateway routes the services toward their original CIDR
+	if remoteServiceCIDR := getRemoteServiceCIDR(endpoint); remoteServiceCIDR != "" && r.IsGateway {
+		destinations = append(destinations, normalizeCIDR(endpoint.Spec.ServiceCIDR))
+	} else if remoteServiceCIDR != "" {
+		destinations = append(destinations, normalizeCIDR(remoteServiceCIDR))
+	}
+	//the gateway routes the clusters reached through the remote cluster toward the pod CIDR the remote cluster reaches
+	//them at
+	for _, route := range endpoint.Status.TransitRoutes {
+		if r.IsGateway {
+			destinations = append(destinations, normalizeCIDR(route.PodCIDR))
+		} else {
+			destinations = append(destinations, normalizeCIDR(liqonetOperator.GetTransitPodCIDR(route)))
+		}
+	}
+	sort.Strings(destinations)
+	return destinations
+}
+
+func getRouteDestinations(routes []netlink.Route) []string {
+	var destinations []string
+	for _, route := range routes {
+		if route.Dst != nil {
+			destinations = append(destinations, route.Dst.String())
+		}
+	}
+	sort.Strings(destinations)
+	return destinations
+}
+
+func (r *RouteController) routeExists(route netlink.Route) (bool, error) {
+	routes, err := r.NetLink.ListRoutes(route.LinkIndex)
+	if err != nil {
+		return false, err
+	}
+	for i := range routes {
+		if liqonetOperator.IsRouteConfigTheSame(&routes[i], route) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//removes the routes through a gateway installed on the interfaces used for the remote clusters which do not belong
+//to any of them, e.g. the ones of the clusters removed while the operator was not running
+func (r *RouteController) removeStaleRoutes() error {
+	log := r.Log.WithName("audit")
+	links := make(map[int]bool)
+	var installed []netlink.Route
+	for _, routes := range r.RoutesPerRemoteCluster {
+		for _, route := range routes {
+			links[route.LinkIndex] = true
+			installed = append(installed, route)
+		}
+	}
+	for linkIndex := range links {
+		routes, err := r.NetLink.ListRoutes(linkIndex)
+		if err != nil {
+			return err
+		}
+		for _, route := range routes {
+			//the routes of the interface itself, e.g. toward the vxlan network, have no gateway
+			if route.Gw == nil || route.Dst == nil || containsRoute(installed, route) {
+				continue
+			}
+			if err := r.NetLink.DelRoute(route); err != nil {
+				return err
+			}
+			log.Info("removing the stale", "route", route.String())
+			driftTotal.WithLabelValues(driftKindRoute, driftActionRemove).Inc()
+		}
+	}
+	return nil
+}
+
+func containsRoute(routes []netlink.Route, route netlink.Route) bool {
+	for i := range routes {
+		if liqonetOperator.IsRouteConfigTheSame(&routes[i], route) {
+			return true
+		}
+	}
+	return false
+}
+
+//removes from the custom chains the rules not installed for any remote cluster
+func (r *RouteController) removeStaleRules() error {
+	log := r.Log.WithName("audit")
+	if ipt, ok := r.IPtables.(liqonetOperator.PeerIPTables); ok {
+		var clusterIDs []string
+		for clusterID := range r.IPtablesRuleSpecsPerRemoteCluster {
+			clusterIDs = append(clusterIDs, clusterID)
+		}
+		removed, err := ipt.RemoveStalePeerRules(clusterIDs)
+		if removed > 0 {
+			log.Info("removed the stale rules", "clusters", removed)
+			driftTotal.WithLabelValues(driftKindRule, driftActionRemove).Add(float64(removed))
+		}
+		return err
+	}
+	expected := map[string]bool{
+		getRuleKey(LiqonetInputChain, r.getVxlanUdpRuleSpec()): true,
+	}
+	for _, rules := range r.IPtablesRuleSpecsPerRemoteCluster {
+		for _, rule := range rules {
+			expected[getRuleKey(rule.Chain, rule.RuleSpec)] = true
+		}
+	}
+	for _, chain := range r.IPTablesChains {
+		rules, err := r.IPtables.List(chain.Table, chain.Name)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			//the rules are listed in the "-A <chain> <rulespec>" format
+			fields := strings.Fields(rule)
+			if len(fields) < 3 || fields[0] != "-A" || fields[1] != chain.Name {
+				continue
+			}
+			if expected[getRuleKey(chain.Name, fields[2:])] {
+				continue
+			}
+			if err := r.IPtables.Delete(chain.Table, chain.Name, fields[2:]...); err != nil {
+				return err
+			}
+			log.Info("removing the stale", "rulespec", strings.Join(fields[2:], " "), "belonging to chain", chain.Name, "in table", chain.Table)
+			driftTotal.WithLabelValues(driftKindRule, driftActionRemove).Inc()
+		}
+	}
+	return nil
+}
+
+//returns the key identifying the rule, the addresses are written as iptables lists them
+func getRuleKey(chain string, rulespec []string) string {
+	fields := make([]string, 0, len(rulespec)+1)
+	fields = append(fields, chain)
+	for _, field := range rulespec {
+		if ip := net.ParseIP(field); ip != nil {
+			field = liqonetOperator.HostCIDR(ip.String())
+		}
+		fields = append(fields, normalizeCIDR(field))
+	}
+	return strings.Join(fields, " ")
+}
+
+//returns the network in its canonical form, the strings which are not networks are returned unchanged
+func normalizeCIDR(cidr string) string {
+	if _, network, err := net.ParseCIDR(cidr); err == nil {
+		return network.String()
+	}
+	return cidr
+}
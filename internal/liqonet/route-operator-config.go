@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+)
+
+//GetFirewallBackend returns the backend configured in the ClusterConfig, or the one used by the node if it is not set.
+//The configuration is read only at startup, since the rules can not be moved from a backend to the other one
+func GetFirewallBackend(config *rest.Config, gv *schema.GroupVersion) (string, error) {
+	liqonetConfig, err := getLiqonetConfig(config, gv)
+	if err != nil {
+		return "", err
+	}
+	backend := liqonetConfig.FirewallBackend
+	switch backend {
+	case liqonetOperator.IPTablesBackend, liqonetOperator.NFTablesBackend:
+		return backend, nil
+	case "":
+		return liqonetOperator.DetectFirewallBackend(), nil
+	}
+	return "", fmt.Errorf("the firewall backend %s is not supported", backend)
+}
+
+//IsNetworkPolicyEnforcementEnabled returns whether the NetworkPolicies have to be enforced on the traffic exchanged with
+//the peering clusters. The configuration is read only at startup
+func IsNetworkPolicyEnforcementEnabled(config *rest.Config, gv *schema.GroupVersion) (bool, error) {
+	liqonetConfig, err := getLiqonetConfig(config, gv)
+	if err != nil {
+		return false, err
+	}
+	return liqonetConfig.EnforceNetworkPolicies, nil
+}
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=list
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups=crd.projectcalico.org,resources=ippools,verbs=list
+
+//GetClusterPodCIDRs returns the pod CIDRs of the cluster: the ones configured in the ClusterConfig or, if not set, the
+//ones detected in the cluster. The POD_CIDR environment variable is used if the detection fails, so that the
+//deployments setting it keep working. The configuration is read only at startup
+func GetClusterPodCIDRs(config *rest.Config, gv *schema.GroupVersion) ([]string, error) {
+	liqonetConfig, err := getLiqonetConfig(config, gv)
+	if err != nil {
+		return nil, err
+	}
+	if len(liqonetConfig.PodCIDRs) > 0 {
+		return liqonetOperator.NormalizePodCIDRs(liqonetConfig.PodCIDRs)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	podCIDRs, detectErr := liqonetOperator.DetectPodCIDRs(clientset, dynClient)
+	if detectErr == nil {
+		return podCIDRs, nil
+	}
+	podCIDR, err := liqonetOperator.GetClusterPodCIDR()
+	if err != nil {
+		return nil, detectErr
+	}
+	klog.Warningf("%v, using the pod CIDR %s set in the environment", detectErr, podCIDR)
+	return liqonetOperator.NormalizePodCIDRs([]string{podCIDR})
+}
+
+//returns the liqonet configuration of the first ClusterConfig, an empty one if there are none
+func getLiqonetConfig(config *rest.Config, gv *schema.GroupVersion) (*policyv1.LiqonetConfig, error) {
+	config = rest.CopyConfig(config)
+	config.ContentConfig.GroupVersion = gv
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	config.UserAgent = rest.DefaultKubernetesUserAgent()
+	CRDclient, err := crdClient.NewFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := CRDclient.Resource("clusterconfigs").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the cluster configuration: %v", err)
+	}
+	configurations, ok := tmp.(*policyv1.ClusterConfigList)
+	if !ok {
+		return nil, fmt.Errorf("the received object is not a ClusterConfigList")
+	}
+	if len(configurations.Items) == 0 {
+		return &policyv1.LiqonetConfig{}, nil
+	}
+	return &configurations.Items[0].Spec.LiqonetConfig, nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	k8sApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"strings"
+	"time"
+)
+
+//UpdateGateway retrieves the active gateway node and, if it changed, configures the node accordingly
+func (r *RouteController) UpdateGateway() error {
+	node, err := liqonetOperator.GetActiveGateway(r.ClientSet)
+	if err != nil {
+		return err
+	}
+	gatewayVxlanIP, err := liqonetOperator.GetNodeVxlanIP(node, r.VxlanNetwork)
+	if err != nil {
+		return err
+	}
+	gatewayVTEP, err := liqonetOperator.GetNodeInternalIP(node)
+	if err != nil {
+		return err
+	}
+	return r.SetGateway(node.Name == r.NodeName, gatewayVxlanIP, gatewayVTEP)
+}
+
+//SetGateway is called when the active gateway changes. The routes and the rules installed for the previous gateway
+//are removed and the TunnelEndpoints are processed again, so that the traffic toward the remote clusters goes through
+//the new gateway
+func (r *RouteController) SetGateway(isGateway bool, gatewayVxlanIP, gatewayVTEP string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.IsGateway == isGateway && r.GatewayVxlanIP == gatewayVxlanIP {
+		return nil
+	}
+	log := r.Log.WithName("gateway")
+	log.Info("the active gateway changed", "isGateway", isGateway, "gatewayVxlanIP", gatewayVxlanIP, "previous gatewayVxlanIP", r.GatewayVxlanIP)
+	//the gateway could have joined the cluster after the vxlan interface has been configured
+	if !isGateway {
+		if err := r.NetLink.AddFDBEntry(r.VxlanIfaceName, gatewayVTEP); err != nil {
+			return err
+		}
+	}
+	r.deleteAllRoutes()
+	if err := r.deleteAllIPTablesRulespecs(); err != nil {
+		return err
+	}
+	//the new configuration is saved only when all the TunnelEndpoints will be processed again,
+	//otherwise the operation is retried at the next check
+	if err := r.reprocessTunnelEndpoints(); err != nil {
+		return err
+	}
+	r.IsGateway = isGateway
+	r.GatewayVxlanIP = gatewayVxlanIP
+	return nil
+}
+
+//WatchGateway checks periodically the active gateway until the stop channel is closed
+func (r *RouteController) WatchGateway(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.UpdateGateway(); err != nil {
+			r.Log.Error(err, "unable to update the active gateway")
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//removes the rules inserted for all the remote clusters, the chains are kept
+func (r *RouteController) deleteAllIPTablesRulespecs() error {
+	log := r.Log.WithName("iptables")
+	for clusterID, rules := range r.IPtablesRuleSpecsPerRemoteCluster {
+		if ipt, ok := r.IPtables.(liqonetOperator.PeerIPTables); ok {
+			if err := ipt.DeletePeerRules(clusterID); err != nil {
+				return err
+			}
+			log.Info("removing", "rules for cluster", clusterID)
+			delete(r.IPtablesRuleSpecsPerRemoteCluster, clusterID)
+			continue
+		}
+		for _, rule := range rules {
+			if err := r.IPtables.Delete(rule.Table, rule.Chain, rule.RuleSpec...); err != nil {
+				//the rules shared among the clusters have already been removed
+				e, ok := err.(*iptables.Error)
+				if ok && e.IsNotExist() {
+					continue
+				} else if !ok {
+					return err
+				}
+			} else {
+				log.Info("removing", "rulespec", strings.Join(rule.RuleSpec, " "), "belonging to chain", rule.Chain, "in table", rule.Table)
+			}
+		}
+		delete(r.IPtablesRuleSpecsPerRemoteCluster, clusterID)
+	}
+	return nil
+}
+
+//removes the label of the node from all the TunnelEndpoints, the update triggers their reconciliation
+func (r *RouteController) reprocessTunnelEndpoints() error {
+	ctx := context.Background()
+	labelKey := liqonetOperator.RouteOpLabelKey + "-" + r.NodeName
+	var endpoints v1.TunnelEndpointList
+	if err := r.List(ctx, &endpoints); err != nil {
+		return err
+	}
+	for i := range endpoints.Items {
+		endpoint := &endpoints.Items[i]
+		for {
+			if _, ok := endpoint.GetLabels()[labelKey]; !ok {
+				break
+			}
+			labels := endpoint.GetLabels()
+			delete(labels, labelKey)
+			endpoint.SetLabels(labels)
+			err := r.Update(ctx, endpoint)
+			if err == nil {
+				break
+			} else if !k8sApiErrors.IsConflict(err) {
+				return err
+			}
+			if err := r.Get(ctx, types.NamespacedName{Name: endpoint.Name, Namespace: endpoint.Namespace}, endpoint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package controllers
+
+import (
+	"context"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8sApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods;namespaces;endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=discovery.liqo.io,resources=foreignclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=virtualkubelet.liqo.io,resources=namespacenattingtables,verbs=get;list;watch
+
+//the name of the single request enqueued when one of the resources the filter rules are derived from changes
+const networkPoliciesRequestName = "network-policies"
+
+//the resources of the local cluster the filter rules are derived from, sorted to get always the same rules
+type policyState struct {
+	policies   []networkingv1.NetworkPolicy
+	pods       []corev1.Pod
+	namespaces []corev1.Namespace
+}
+
+//collects the filter rules of a remote cluster skipping the duplicated ones
+type filterRules struct {
+	rules []liqonetOperator.IPtableRule
+	seen  map[string]bool
+}
+
+func (f *filterRules) add(ruleSpec ...string) {
+	key := strings.Join(ruleSpec, " ")
+	if f.seen[key] {
+		return
+	}
+	f.seen[key] = true
+	f.rules = append(f.rules, liqonetOperator.IPtableRule{
+		Table:    FilterTable,
+		Chain:    LiqonetForwardingChain,
+		RuleSpec: ruleSpec,
+	})
+}
+
+//returns the rules filtering on the gateway the traffic exchanged with the pods of the remote cluster, according to
+//the NetworkPolicies of the local cluster and to the default set in the ForeignCluster. They have to precede the
+//rules accepting the traffic directed to the remote pods.
+//The ingress rules of the policies selecting the local pods are applied to the traffic of the remote pods, the ones
+//of the policies selecting the offloaded pods to the traffic of the local pods. The pods of the peers are the
+//offloaded ones for the local pods and vice versa
+func (r *RouteController) getFilterRulespecsForRemoteCluster(endpoint *v1.TunnelEndpoint, remotePodCIDR string) ([]liqonetOperator.IPtableRule, error) {
+	if !r.EnforceNetworkPolicies || !r.IsGateway {
+		return nil, nil
+	}
+	policyDefault, err := r.getNetworkPolicyDefault(endpoint.Spec.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	state, err := r.getPolicyState()
+	if err != nil {
+		return nil, err
+	}
+	filter := &filterRules{seen: make(map[string]bool)}
+	//the pods selected by at least one policy accept only the allowed traffic, they are saved in order with
+	//the network of their peers
+	var isolated []string
+	peersOfIsolated := make(map[string]string)
+	for i := range state.policies {
+		policy := &state.policies[i]
+		if !isIngressPolicy(policy) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err != nil {
+			r.Log.Error(err, "unable to translate the networkpolicy", "namespace", policy.Namespace, "name", policy.Name)
+			continue
+		}
+		for j := range state.pods {
+			pod := &state.pods[j]
+			if pod.Namespace != policy.Namespace || !hasPolicyIP(pod) || !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			var peerCIDR string
+			if isInCIDR(pod.Status.PodIP, r.ClusterPodCIDR) {
+				peerCIDR = remotePodCIDR
+			} else if isInCIDR(pod.Status.PodIP, remotePodCIDR) {
+				peerCIDR = r.ClusterPodCIDR
+			} else {
+				continue
+			}
+			target := liqonetOperator.HostCIDR(pod.Status.PodIP)
+			if _, ok := peersOfIsolated[target]; !ok {
+				isolated = append(isolated, target)
+				peersOfIsolated[target] = peerCIDR
+			}
+			for _, ingress := range policy.Spec.Ingress {
+				for _, source := range state.getPeerSources(policy.Namespace, ingress.From, peerCIDR) {
+					for _, ports := range r.getPortMatches(pod, ingress.Ports) {
+						filter.add(append(append([]string{"-s", source, "-d", target}, ports...), "-j", "ACCEPT")...)
+					}
+				}
+			}
+		}
+	}
+	for _, target := range isolated {
+		filter.add("-s", peersOfIsolated[target], "-d", target, "-j", "DROP")
+	}
+	switch policyDefault {
+	case discoveryv1.NetworkPolicyDenyAll:
+		filter.add("-s", remotePodCIDR, "-j", "DROP")
+	case discoveryv1.NetworkPolicyAllowReflectedServices:
+		endpoints, err := r.getReflectedEndpoints(endpoint.Spec.ClusterID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range endpoints {
+			for _, subset := range endpoints[i].Subsets {
+				for _, address := range subset.Addresses {
+					if !isInCIDR(address.IP, r.ClusterPodCIDR) {
+						continue
+					}
+					for _, port := range subset.Ports {
+						protocol := getProtocol(&port.Protocol)
+						if protocol == "" {
+							continue
+						}
+						filter.add("-s", remotePodCIDR, "-d", liqonetOperator.HostCIDR(address.IP), "-p", protocol, "-m", protocol, "--dport", strconv.Itoa(int(port.Port)), "-j", "ACCEPT")
+					}
+				}
+			}
+		}
+		filter.add("-s", remotePodCIDR, "-j", "DROP")
+	}
+	if len(filter.rules) == 0 {
+		return nil, nil
+	}
+	//the replies of the allowed connections are always accepted
+	return append([]liqonetOperator.IPtableRule{
+		{
+			Table:    FilterTable,
+			Chain:    LiqonetForwardingChain,
+			RuleSpec: []string{"-s", remotePodCIDR, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		},
+		{
+			Table:    FilterTable,
+			Chain:    LiqonetForwardingChain,
+			RuleSpec: []string{"-d", remotePodCIDR, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		},
+	}, filter.rules...), nil
+}
+
+//returns the default set in the ForeignCluster of the remote cluster, the traffic is allowed if it is not set
+func (r *RouteController) getNetworkPolicyDefault(clusterID string) (discoveryv1.NetworkPolicyDefault, error) {
+	var foreignClusters discoveryv1.ForeignClusterList
+	if err := r.List(context.Background(), &foreignClusters); err != nil {
+		return "", err
+	}
+	for i := range foreignClusters.Items {
+		if foreignClusters.Items[i].Spec.ClusterID == clusterID && foreignClusters.Items[i].Spec.NetworkPolicyDefault != "" {
+			return foreignClusters.Items[i].Spec.NetworkPolicyDefault, nil
+		}
+	}
+	return discoveryv1.NetworkPolicyAllowAll, nil
+}
+
+func (r *RouteController) getPolicyState() (*policyState, error) {
+	ctx := context.Background()
+	var policies networkingv1.NetworkPolicyList
+	if err := r.List(ctx, &policies); err != nil {
+		return nil, err
+	}
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods); err != nil {
+		return nil, err
+	}
+	var namespaces corev1.NamespaceList
+	if err := r.List(ctx, &namespaces); err != nil {
+		return nil, err
+	}
+	sort.Slice(policies.Items, func(i, j int) bool {
+		return policies.Items[i].Namespace+"/"+policies.Items[i].Name < policies.Items[j].Namespace+"/"+policies.Items[j].Name
+	})
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Namespace+"/"+pods.Items[i].Name < pods.Items[j].Namespace+"/"+pods.Items[j].Name
+	})
+	return &policyState{
+		policies:   policies.Items,
+		pods:       pods.Items,
+		namespaces: namespaces.Items,
+	}, nil
+}
+
+//returns the endpoints of the Services in the namespaces reflected in the remote cluster
+func (r *RouteController) getReflectedEndpoints(clusterID string) ([]corev1.Endpoints, error) {
+	ctx := context.Background()
+	var nattingTable nattingv1.NamespaceNattingTable
+	if err := r.Get(ctx, types.NamespacedName{Name: clusterID}, &nattingTable); err != nil {
+		if k8sApiErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var namespaces []string
+	for namespace := range nattingTable.Spec.NattingTable {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	var endpoints []corev1.Endpoints
+	for _, namespace := range namespaces {
+		var list corev1.EndpointsList
+		if err := r.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		sort.Slice(list.Items, func(i, j int) bool {
+			return list.Items[i].Name < list.Items[j].Name
+		})
+		endpoints = append(endpoints, list.Items...)
+	}
+	return endpoints, nil
+}
+
+//returns the sources allowed by the peers of an ingress rule among the ones in the network of the peers
+func (s *policyState) getPeerSources(namespace string, peers []networkingv1.NetworkPolicyPeer, peerCIDR string) []string {
+	//a rule without peers allows all the sources
+	if len(peers) == 0 {
+		return []string{peerCIDR}
+	}
+	var sources []string
+	seen := make(map[string]bool)
+	addSource := func(source string) {
+		if !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			//the exceptions are not translated, the block is ignored to not allow more than the policy does
+			if len(peer.IPBlock.Except) > 0 {
+				continue
+			}
+			if cidr := intersectCIDRs(peer.IPBlock.CIDR, peerCIDR); cidr != "" {
+				addSource(cidr)
+			}
+			continue
+		}
+		selectedNamespaces := map[string]bool{namespace: true}
+		if peer.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector)
+			if err != nil {
+				continue
+			}
+			selectedNamespaces = make(map[string]bool)
+			for i := range s.namespaces {
+				if selector.Matches(labels.Set(s.namespaces[i].Labels)) {
+					selectedNamespaces[s.namespaces[i].Name] = true
+				}
+			}
+		}
+		podSelector := labels.Everything()
+		if peer.PodSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(peer.PodSelector)
+			if err != nil {
+				continue
+			}
+			podSelector = selector
+		}
+		for i := range s.pods {
+			pod := &s.pods[i]
+			if selectedNamespaces[pod.Namespace] && hasPolicyIP(pod) && podSelector.Matches(labels.Set(pod.Labels)) && isInCIDR(pod.Status.PodIP, peerCIDR) {
+				addSource(liqonetOperator.HostCIDR(pod.Status.PodIP))
+			}
+		}
+	}
+	return sources
+}
+
+//returns the options matching the ports of an ingress rule, the named ports are resolved with the ones of the pod.
+//A rule without ports matches all the traffic
+func (r *RouteController) getPortMatches(pod *corev1.Pod, ports []networkingv1.NetworkPolicyPort) [][]string {
+	if len(ports) == 0 {
+		return [][]string{nil}
+	}
+	var matches [][]string
+	for _, port := range ports {
+		protocol := getProtocol(port.Protocol)
+		if protocol == "" {
+			r.Log.Info("the protocol of the port is not supported", "protocol", *port.Protocol, "pod", pod.Namespace+"/"+pod.Name)
+			continue
+		}
+		if port.Port == nil {
+			matches = append(matches, []string{"-p", protocol})
+			continue
+		}
+		number := port.Port.IntValue()
+		if port.Port.Type == intstr.String {
+			number = getNamedPort(pod, port.Port.StrVal, protocol)
+		}
+		if number == 0 {
+			continue
+		}
+		matches = append(matches, []string{"-p", protocol, "-m", protocol, "--dport", strconv.Itoa(number)})
+	}
+	return matches
+}
+
+//returns the protocol as written in the rules, tcp if it is not set. Only tcp and udp are supported
+func getProtocol(protocol *corev1.Protocol) string {
+	if protocol == nil || *protocol == "" {
+		return "tcp"
+	}
+	switch *protocol {
+	case corev1.ProtocolTCP, corev1.ProtocolUDP:
+		return strings.ToLower(string(*protocol))
+	default:
+		return ""
+	}
+}
+
+//returns the number of the named port of the pod, 0 if it does not exist
+func getNamedPort(pod *corev1.Pod, name, protocol string) int {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name && getProtocol(&port.Protocol) == protocol {
+				return int(port.ContainerPort)
+			}
+		}
+	}
+	return 0
+}
+
+//the policies without types are ingress ones
+func isIngressPolicy(policy *networkingv1.NetworkPolicy) bool {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return true
+	}
+	for _, policyType := range policy.Spec.PolicyTypes {
+		if policyType == networkingv1.PolicyTypeIngress {
+			return true
+		}
+	}
+	return false
+}
+
+//the pods in the host network and the terminated ones are not subject to the policies
+func hasPolicyIP(pod *corev1.Pod) bool {
+	return pod.Status.PodIP != "" && !pod.Spec.HostNetwork && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+func isInCIDR(address, cidr string) bool {
+	ip := net.ParseIP(address)
+	_, network, err := net.ParseCIDR(cidr)
+	return ip != nil && err == nil && network.Contains(ip)
+}
+
+//returns the smaller of the two networks if it is contained in the other one, otherwise an empty string
+func intersectCIDRs(a, b string) string {
+	_, networkA, err := net.ParseCIDR(a)
+	if err != nil {
+		return ""
+	}
+	_, networkB, err := net.ParseCIDR(b)
+	if err != nil {
+		return ""
+	}
+	onesA, bitsA := networkA.Mask.Size()
+	onesB, bitsB := networkB.Mask.Size()
+	if bitsA != bitsB {
+		return ""
+	}
+	if onesA <= onesB && networkA.Contains(networkB.IP) {
+		return networkB.String()
+	}
+	if onesB <= onesA && networkB.Contains(networkA.IP) {
+		return networkA.String()
+	}
+	return ""
+}
+
+//SetupNetworkPolicyWatchWithManager audits the rules as soon as one of the resources the filter rules are derived
+//from changes, instead of waiting for the periodic audit. All the changes enqueue the same request, and only on the
+//gateway, since the other nodes do not filter the traffic: the rules are added anyway when a node becomes the gateway,
+//since all the TunnelEndpoints are reprocessed
+func (r *RouteController) SetupNetworkPolicyWatchWithManager(mgr ctrl.Manager) error {
+	enqueue := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(handler.MapObject) []reconcile.Request {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: networkPoliciesRequestName}}}
+		}),
+	}
+	return ctrl.NewControllerManagedBy(mgr).Named("networkpolicy").
+		For(&networkingv1.NetworkPolicy{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, enqueue).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, enqueue).
+		Watches(&source.Kind{Type: &corev1.Endpoints{}}, enqueue).
+		Watches(&source.Kind{Type: &discoveryv1.ForeignCluster{}}, enqueue).
+		Watches(&source.Kind{Type: &nattingv1.NamespaceNattingTable{}}, enqueue).
+		WithEventFilter(predicate.NewPredicateFuncs(r.isGatewayEvent)).
+		Complete(reconcile.Func(r.reconcileNetworkPolicies))
+}
+
+//filters out the events received when the node is not the gateway
+func (r *RouteController) isGatewayEvent(metav1.Object, runtime.Object) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.IsGateway
+}
+
+//the filter rules are installed on the gateway only
+func (r *RouteController) reconcileNetworkPolicies(req ctrl.Request) (ctrl.Result, error) {
+	r.mutex.Lock()
+	isGateway := r.IsGateway
+	r.mutex.Unlock()
+	if !isGateway {
+		return ctrl.Result{}, nil
+	}
+	if err := r.audit(); err != nil {
+		r.Log.Error(err, "unable to apply the networkpolicies")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	corev1 "k8s.io/api/core/v1"
+	k8sApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=liqonet.liqo.io,resources=ipamstorages,verbs=get;create;update
+
+//SetupVTEPWatchWithManager keeps the forwarding entries of the vxlan interface in sync with the nodes of the cluster,
+//so that the nodes joining the cluster after the route-operator has been started are reachable through the overlay
+func (r *RouteController) SetupVTEPWatchWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).Named("vtep").
+		For(&corev1.Node{}).
+		Complete(reconcile.Func(r.reconcileVTEP))
+}
+
+//adds the forwarding entry toward the node when it joins the cluster, or its VTEP changes, and removes it when the
+//node leaves the cluster. The virtual nodes are not part of the overlay
+func (r *RouteController) reconcileVTEP(req ctrl.Request) (ctrl.Result, error) {
+	if req.Name == r.NodeName {
+		return ctrl.Result{}, nil
+	}
+	log := r.Log.WithName("vtep").WithValues("node", req.Name)
+	vtep, err := r.getNodeVTEP(req.Name)
+	if err != nil {
+		log.Error(err, "unable to get the VTEP of the node")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.RemoteVTEPs == nil {
+		r.RemoteVTEPs = make(map[string]string)
+	}
+	previous, ok := r.RemoteVTEPs[req.Name]
+	if ok && previous == vtep {
+		return ctrl.Result{}, nil
+	}
+	if ok {
+		if err := r.NetLink.DelFDBEntry(r.VxlanIfaceName, previous); err != nil {
+			log.Error(err, "unable to remove the forwarding entry", "vtep", previous)
+			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+		}
+		delete(r.RemoteVTEPs, req.Name)
+		log.Info("removed the forwarding entry", "vtep", previous)
+	}
+	if vtep == "" {
+		return ctrl.Result{}, nil
+	}
+	if err := r.NetLink.AddFDBEntry(r.VxlanIfaceName, vtep); err != nil {
+		log.Error(err, "unable to add the forwarding entry", "vtep", vtep)
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
+	r.RemoteVTEPs[req.Name] = vtep
+	log.Info("added the forwarding entry", "vtep", vtep)
+	return ctrl.Result{}, nil
+}
+
+//returns the VTEP of the node, of the same family of the local one, or an empty string if the node is not part of the
+//overlay: it does not exist anymore, it is being deleted, it is a virtual node or it has no internal IP yet
+func (r *RouteController) getNodeVTEP(nodeName string) (string, error) {
+	ctx := context.Background()
+	var node corev1.Node
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, &node); k8sApiErrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !node.DeletionTimestamp.IsZero() || node.Labels["type"] == "virtual-node" {
+		return "", nil
+	}
+	var localNode corev1.Node
+	if err := r.Get(ctx, types.NamespacedName{Name: r.NodeName}, &localNode); err != nil {
+		return "", err
+	}
+	localVTEP, err := liqonetOperator.GetNodeInternalIP(&localNode)
+	if err != nil {
+		return "", err
+	}
+	vtep, err := liqonetOperator.GetNodeInternalIPForFamily(&node, liqonetOperator.IsIPv6String(localVTEP))
+	if err != nil {
+		return "", nil
+	}
+	return vtep, nil
+}
@@ -22,18 +22,23 @@ import (
 	"github.com/liqoTech/liqo/api/liqonet/v1"
 	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
 	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
 	k8sApiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"os"
 	"os/signal"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -43,11 +48,16 @@ var (
 	LiqonetPreroutingChain  = "LIQONET-PREROUTING"
 	LiqonetForwardingChain  = "LIQONET-FORWARD"
 	LiqonetInputChain       = "LIQONET-INPUT"
+	LiqonetMarkChain        = "LIQONET-MARK"
 	NatTable                = "nat"
 	FilterTable             = "filter"
+	MangleTable             = "mangle"
 	shutdownSignals         = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGKILL}
 )
 
+//the marks, and the routing tables, used for the remapped services of the remote clusters start from this value
+const serviceMarkBase = 1000
+
 // RouteController reconciles a TunnelEndpoint object
 type RouteController struct {
 	client.Client
@@ -56,11 +66,15 @@ type RouteController struct {
 	clientset      kubernetes.Clientset
 	RouteOperator  bool
 	NodeName       string
-	ClientSet      *kubernetes.Clientset
-	RemoteVTEPs    []string
+	ClientSet      kubernetes.Interface
+	//the VTEPs of the other nodes, keyed by node name, which have a forwarding entry on the vxlan interface
+	RemoteVTEPs    map[string]string
 	IsGateway      bool
 	VxlanNetwork   string
 	GatewayVxlanIP string
+	//the gateway can change at run time when the active one fails, the mutex protects the gateway configuration
+	//together with the routes and the rules installed on the node
+	mutex sync.Mutex
 	VxlanIfaceName string
 	VxlanPort      int
 	IPtables       liqonetOperator.IPTables
@@ -76,12 +90,22 @@ type RouteController struct {
 	IPtablesRuleSpecsPerRemoteCluster map[string][]liqonetOperator.IPtableRule
 	//here we save routes associated to each remote cluster
 	RoutesPerRemoteCluster map[string][]netlink.Route
-	RetryTimeout           time.Duration
+	//here we save the policy routing rule used on the gateway to reach the remapped services of each remote cluster
+	ServiceRulesPerRemoteCluster map[string]netlink.Rule
+	RetryTimeout                 time.Duration
+	//when enabled the traffic of the remote pods is filtered on the gateway according to the NetworkPolicies
+	EnforceNetworkPolicies bool
+	//used to report the drift of the routes and the rules found by the audits
+	Recorder record.EventRecorder
+	//the other pod CIDRs of the local cluster, which are never remapped by the remote clusters
+	AdditionalClusterPodCIDRs []string
 }
 
 // +kubebuilder:rbac:groups=liqonet.liqo.io,resources=tunnelendpoints,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=liqonet.liqo.io,resources=tunnelendpoints/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list
+// +kubebuilder:rbac:groups=policy.liqo.io,resources=clusterconfigs,verbs=get;list
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *RouteController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -94,6 +118,8 @@ func (r *RouteController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		r.Log.Error(err, "unable to fetch endpoint")
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 
 	// examine DeletionTimestamp to determine if object is under deletion
 	if endpoint.ObjectMeta.DeletionTimestamp.IsZero() {
@@ -140,16 +166,29 @@ func (r *RouteController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
 	}
 	if !r.alreadyProcessedByRouteOperator(endpoint.GetObjectMeta()) {
+		if !r.IsGateway && r.GatewayVxlanIP == "" {
+			log.Info("the active gateway is not known yet")
+			return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
+		}
+		//the routes installed before the tunnel has been re-established could use an interface which does not exist anymore
+		if _, ok := r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID]; ok {
+			if err := r.deleteRoutesPerCluster(&endpoint); err != nil {
+				log.Error(err, "unable to delete the outdated routes")
+				return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+			}
+		}
 		if err := r.createAndInsertIPTablesChains(); err != nil {
 			r.Log.Error(err, "unable to create iptables chains")
 			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 		}
 		if err := r.addIPTablesRulespecForRemoteCluster(&endpoint); err != nil {
 			log.Error(err, "unable to insert ruleSpec")
+			r.setRoutesInstalledCondition(req.NamespacedName, err)
 			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 		}
 		if err := r.InsertRoutesPerCluster(&endpoint); err != nil {
 			log.Error(err, "unable to insert routes")
+			r.setRoutesInstalledCondition(req.NamespacedName, err)
 			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 		}
 		endpoint.ObjectMeta.SetLabels(liqonetOperator.SetLabelHandler(liqonetOperator.RouteOpLabelKey+"-"+r.NodeName, "ready", endpoint.ObjectMeta.GetLabels()))
@@ -166,15 +205,53 @@ func (r *RouteController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		if err != nil {
 			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 		}
+		r.setRoutesInstalledCondition(req.NamespacedName, nil)
 	}
 	return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
 }
 
+//reports in the status of the TunnelEndpoint whether the routes toward the remote cluster have been installed on the node
+func (r *RouteController) setRoutesInstalledCondition(key types.NamespacedName, installErr error) {
+	ctx := context.Background()
+	condition := v1.TunnelEndpointCondition{
+		Type:               v1.RoutesInstalledCondition,
+		Node:               r.NodeName,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "RoutesInstalled",
+	}
+	if installErr != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "InstallationFailed"
+		condition.Message = installErr.Error()
+	}
+	for {
+		var endpoint v1.TunnelEndpoint
+		if err := r.Get(ctx, key, &endpoint); err != nil {
+			r.Log.Error(err, "unable to fetch endpoint", "resource", key)
+			return
+		}
+		existing := endpoint.Status.GetCondition(condition.Type, condition.Node)
+		if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message {
+			return
+		}
+		endpoint.Status.SetCondition(condition)
+		err := r.Status().Update(ctx, &endpoint)
+		if err == nil {
+			return
+		} else if !k8sApiErrors.IsConflict(err) {
+			r.Log.Error(err, "unable to update the routes condition", "resource", key)
+			return
+		}
+	}
+}
+
 //this function is called at startup of the operator
 //here we:
 //create LIQONET-FORWARD in the filter table and insert it in the "FORWARD" chain
 //create LIQONET-POSTROUTING in the nat table and insert it in the "POSTROUTING" chain
 //create LIQONET-INPUT in the filter table and insert it in the input chain
+//create LIQONET-MARK in the mangle table and insert it in the "PREROUTING" chain
 //insert the rulespec which allows in input all the udp traffic incoming for the vxlan in the LIQONET-INPUT chain
 func (r *RouteController) createAndInsertIPTablesChains() error {
 	var err error
@@ -209,7 +286,7 @@ func (r *RouteController) createAndInsertIPTablesChains() error {
 	} else {
 		log.Info("created", "chain", LiqonetPreroutingChain, "in table", NatTable)
 	}
-	r.IPTablesChains[LiqonetPostroutingChain] = liqonetOperator.IPTableChain{
+	r.IPTablesChains[LiqonetPreroutingChain] = liqonetOperator.IPTableChain{
 		Table: NatTable,
 		Name:  LiqonetPreroutingChain,
 	}
@@ -270,11 +347,33 @@ func (r *RouteController) createAndInsertIPTablesChains() error {
 		Chain:    "INPUT",
 		RuleSpec: forwardToLiqonetInputSpec,
 	}
+	//creating LIQONET-MARK chain
+	if err = liqonetOperator.CreateIptablesChainsIfNotExist(ipt, MangleTable, LiqonetMarkChain); err != nil {
+		return err
+	} else {
+		log.Info("created", "chain", LiqonetMarkChain, "in table", MangleTable)
+	}
+	r.IPTablesChains[LiqonetMarkChain] = liqonetOperator.IPTableChain{
+		Table: MangleTable,
+		Name:  LiqonetMarkChain,
+	}
+	//installing rulespec which forwards all traffic to LIQONET-MARK chain
+	forwardToLiqonetMarkRuleSpec := []string{"-j", LiqonetMarkChain}
+	if err = liqonetOperator.InsertIptablesRulespecIfNotExists(ipt, MangleTable, "PREROUTING", forwardToLiqonetMarkRuleSpec); err != nil {
+		return err
+	} else {
+		log.Info("installed", "rulespec", strings.Join(forwardToLiqonetMarkRuleSpec, " "), "belonging to chain PREROUTING in table", MangleTable)
+	}
+	r.IPTablesRuleSpecsReferencingChains[strings.Join(forwardToLiqonetMarkRuleSpec, " ")] = liqonetOperator.IPtableRule{
+		Table:    MangleTable,
+		Chain:    "PREROUTING",
+		RuleSpec: forwardToLiqonetMarkRuleSpec,
+	}
 	//installing rulespec which allows udp traffic with destination port the VXLAN port
 	//we put it here because this rulespec is independent from the remote cluster.
 	//we don't save this rulespec it will be removed when the chains are flushed at exit time
 	//TODO: do we need to move this one elsewhere? maybe in a dedicate function called at startup by the route operator?
-	vxlanUdpRuleSpec := []string{"-p", "udp", "-m", "udp", "--dport", strconv.Itoa(r.VxlanPort), "-j", "ACCEPT"}
+	vxlanUdpRuleSpec := r.getVxlanUdpRuleSpec()
 	if err = ipt.AppendUnique(FilterTable, LiqonetInputChain, vxlanUdpRuleSpec...); err != nil {
 		return fmt.Errorf("unable to insert rulespec \"%s\" in %s table and %s chain: %v", vxlanUdpRuleSpec, FilterTable, LiqonetInputChain, err)
 	} else {
@@ -283,105 +382,409 @@ func (r *RouteController) createAndInsertIPTablesChains() error {
 	return nil
 }
 
+//returns the rulespec accepting the vxlan traffic in the LIQONET-INPUT chain
+func (r *RouteController) getVxlanUdpRuleSpec() []string {
+	return []string{"-p", "udp", "-m", "udp", "--dport", strconv.Itoa(r.VxlanPort), "-j", "ACCEPT"}
+}
+
 func (r *RouteController) addIPTablesRulespecForRemoteCluster(endpoint *v1.TunnelEndpoint) error {
-	var remotePodCIDR string
-	var err error
 	clusterID := endpoint.Spec.ClusterID
 	log := r.Log.WithName("iptables")
 	if endpoint.Status.RemoteRemappedPodCIDR != "None" && endpoint.Status.RemoteRemappedPodCIDR != "" {
-		remotePodCIDR = endpoint.Status.RemoteRemappedPodCIDR
 		log.Info("nat enabled", "pod cidr of cluster", clusterID, "remapped from", endpoint.Spec.PodCIDR, "to", endpoint.Status.RemoteRemappedPodCIDR)
 	} else {
-		remotePodCIDR = endpoint.Spec.PodCIDR
 		log.Info("nat disabled", "using original pod cidr", endpoint.Spec.PodCIDR, "for cluster", clusterID)
 	}
+	rules, err := r.getIPTablesRulespecsForRemoteCluster(endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to get the rules for cluster %s: %v", clusterID, err)
+	}
+	//the backends grouping the rules per remote cluster replace all of them at once
+	if ipt, ok := r.IPtables.(liqonetOperator.PeerIPTables); ok {
+		if err := ipt.SetPeerRules(clusterID, rules); err != nil {
+			return fmt.Errorf("unable to install the rules for cluster %s: %v", clusterID, err)
+		}
+		log.Info("installed", "rules", len(rules), "for cluster", clusterID)
+		r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = rules
+		return nil
+	}
 	var ruleSpecs []liqonetOperator.IPtableRule
-	ipt := r.IPtables
-	//do not nat the traffic directed to the remote pods
-	ruleSpec := []string{"-s", r.ClusterPodCIDR, "-d", remotePodCIDR, "-j", "ACCEPT"}
-	if err = ipt.AppendUnique(NatTable, LiqonetPostroutingChain, ruleSpec...); err != nil {
-		return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", ruleSpec, NatTable, LiqonetPostroutingChain, err)
-	} else {
-		log.Info("installed", "rulespec", strings.Join(ruleSpec, " "), "belonging to chain", LiqonetPostroutingChain, "in table", FilterTable)
+	for _, rule := range rules {
+		var err error
+		//the netmap and the mss clamping rules have to precede the rules accepting the same traffic, even if these have
+		//been inserted before
+		if (rule.Chain == LiqonetPostroutingChain && isNetmapRule(rule)) || isMSSClampRule(rule) {
+			err = liqonetOperator.InsertIptablesRulespecIfNotExists(r.IPtables, rule.Table, rule.Chain, rule.RuleSpec)
+		} else {
+			err = r.IPtables.AppendUnique(rule.Table, rule.Chain, rule.RuleSpec...)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", rule.RuleSpec, rule.Table, rule.Chain, err)
+		}
+		log.Info("installed", "rulespec", strings.Join(rule.RuleSpec, " "), "belonging to chain", rule.Chain, "in table", rule.Table)
+		ruleSpecs = append(ruleSpecs, rule)
+		r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
 	}
-	ruleSpecs = append(ruleSpecs, liqonetOperator.IPtableRule{
-		Table:    NatTable,
-		Chain:    LiqonetPostroutingChain,
-		RuleSpec: ruleSpec,
-	})
-	r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
-	//enable forwarding for all the traffic directed to the remote pods
-	ruleSpec = []string{"-d", remotePodCIDR, "-j", "ACCEPT"}
-	if err = ipt.AppendUnique(FilterTable, LiqonetForwardingChain, ruleSpec...); err != nil {
-		return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", ruleSpec, FilterTable, LiqonetForwardingChain, err)
-	} else {
-		log.Info("installed", "rulespec", strings.Join(ruleSpec, " "), "belonging to chain", LiqonetForwardingChain, "in table", FilterTable)
+	return nil
+}
+
+//returns the rules needed to reach the pods of the remote cluster, in the order they have in their chains
+func (r *RouteController) getIPTablesRulespecsForRemoteCluster(endpoint *v1.TunnelEndpoint) ([]liqonetOperator.IPtableRule, error) {
+	remotePodCIDR := endpoint.Spec.PodCIDR
+	if endpoint.Status.RemoteRemappedPodCIDR != "None" && endpoint.Status.RemoteRemappedPodCIDR != "" {
+		remotePodCIDR = endpoint.Status.RemoteRemappedPodCIDR
 	}
-	ruleSpecs = append(ruleSpecs, liqonetOperator.IPtableRule{
-		Table:    FilterTable,
-		Chain:    LiqonetForwardingChain,
-		RuleSpec: ruleSpec,
-	})
-	r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
-	//this rules are needed in an environment where strictly policies are applied for the input chain
-	ruleSpec = []string{"-s", r.ClusterPodCIDR, "-d", remotePodCIDR, "-j", "ACCEPT"}
-	if err = ipt.AppendUnique(FilterTable, LiqonetInputChain, ruleSpec...); err != nil {
-		return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", ruleSpec, FilterTable, LiqonetInputChain, err)
-	} else {
-		log.Info("installed", "rulespec", strings.Join(ruleSpec, " "), "belonging to chain", LiqonetInputChain, "in table", FilterTable)
+	//the traffic is filtered before being accepted
+	rules, err := r.getFilterRulespecsForRemoteCluster(endpoint, remotePodCIDR)
+	if err != nil {
+		return nil, err
 	}
-	ruleSpecs = append(ruleSpecs, liqonetOperator.IPtableRule{
-		Table:    FilterTable,
-		Chain:    LiqonetInputChain,
-		RuleSpec: ruleSpec,
-	})
-	r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
+	if r.IsGateway && endpoint.Status.TunnelIFaceName != "" {
+		//the tcp connections toward the remote cluster use segments fitting the MTU of the tunnel, which is lower than
+		//the one of the pods since the packets are encapsulated. The rule precedes the ones accepting the traffic
+		rules = append([]liqonetOperator.IPtableRule{getMSSClampRule(endpoint.Status.TunnelIFaceName)}, rules...)
+	}
+	//if we have been remapped by the remote cluster then the source ip is translated on the gateway node
+	if r.IsGateway && endpoint.Status.LocalRemappedPodCIDR != "None" {
+		rules = append(rules, liqonetOperator.IPtableRule{
+			Table:    NatTable,
+			Chain:    LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remotePodCIDR, "-j", "NETMAP", "--to", endpoint.Status.LocalRemappedPodCIDR},
+		})
+	}
+	rules = append(rules,
+		//do not nat the traffic directed to the remote pods
+		liqonetOperator.IPtableRule{
+			Table:    NatTable,
+			Chain:    LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remotePodCIDR, "-j", "ACCEPT"},
+		},
+		//enable forwarding for all the traffic directed to the remote pods
+		liqonetOperator.IPtableRule{
+			Table:    FilterTable,
+			Chain:    LiqonetForwardingChain,
+			RuleSpec: []string{"-d", remotePodCIDR, "-j", "ACCEPT"},
+		},
+		//this rules are needed in an environment where strictly policies are applied for the input chain
+		liqonetOperator.IPtableRule{
+			Table:    FilterTable,
+			Chain:    LiqonetInputChain,
+			RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remotePodCIDR, "-j", "ACCEPT"},
+		})
 	if r.IsGateway {
 		//all the traffic coming from the hosts and directed to the remote pods is natted using the LocalTunnelPrivateIP
 		//hosts use the ip of the vxlan interface as source ip when communicating with remote pods
 		//this is done on the gateway node only
-		ruleSpec = []string{"-s", r.VxlanNetwork, "-d", remotePodCIDR, "-j", "MASQUERADE"}
-		if err = ipt.AppendUnique(NatTable, LiqonetPostroutingChain, ruleSpec...); err != nil {
-			return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", ruleSpec, NatTable, LiqonetPostroutingChain, err)
-		} else {
-			log.Info("installed", "rulespec", strings.Join(ruleSpec, " "), "belonging to chain", LiqonetPostroutingChain, "in table", NatTable)
-		}
-		ruleSpecs = append(ruleSpecs, liqonetOperator.IPtableRule{
+		rules = append(rules, liqonetOperator.IPtableRule{
 			Table:    NatTable,
 			Chain:    LiqonetPostroutingChain,
-			RuleSpec: ruleSpec,
+			RuleSpec: []string{"-s", r.VxlanNetwork, "-d", remotePodCIDR, "-j", "MASQUERADE"},
 		})
-		r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
-		//if we have been remapped by the remote cluster then insert the iptables rule to masquerade the source ip
 		if endpoint.Status.LocalRemappedPodCIDR != "None" {
-			ruleSpec = []string{"-s", r.ClusterPodCIDR, "-d", remotePodCIDR, "-j", "NETMAP", "--to", endpoint.Status.LocalRemappedPodCIDR}
-			if err = liqonetOperator.InsertIptablesRulespecIfNotExists(ipt, NatTable, LiqonetPostroutingChain, ruleSpec); err != nil {
-				return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", ruleSpec, NatTable, LiqonetPostroutingChain, err)
-			} else {
-				log.Info("installed", "rulespec", strings.Join(ruleSpec, " "), "belonging to chain", LiqonetPostroutingChain, "in table", NatTable)
-			}
-			ruleSpecs = append(ruleSpecs, liqonetOperator.IPtableRule{
+			//translate all the traffic coming to the local cluster in to the right podcidr because it has been remapped by the remote cluster
+			rules = append(rules, liqonetOperator.IPtableRule{
+				Table:    NatTable,
+				Chain:    LiqonetPreroutingChain,
+				RuleSpec: []string{"-d", endpoint.Status.LocalRemappedPodCIDR, "-i", endpoint.Status.TunnelIFaceName, "-j", "NETMAP", "--to", r.ClusterPodCIDR},
+			})
+		}
+	}
+	rules = append(rules, r.getAdditionalPodRulespecsForRemoteCluster(endpoint, remotePodCIDR)...)
+	rules = append(rules, r.getServiceRulespecsForRemoteCluster(endpoint)...)
+	return append(rules, r.getTransitRulespecsForRemoteCluster(endpoint, remotePodCIDR)...), nil
+}
+
+//returns the rules needed to reach the additional pod CIDRs of the remote cluster, and the remote pods from the
+//additional pod CIDRs of the local cluster. The additional pod CIDRs are never remapped, but the local pod CIDR is
+//translated on the gateway when it has been remapped by the remote cluster
+func (r *RouteController) getAdditionalPodRulespecsForRemoteCluster(endpoint *v1.TunnelEndpoint, remotePodCIDR string) []liqonetOperator.IPtableRule {
+	var rules []liqonetOperator.IPtableRule
+	remotePodCIDRs := append([]string{remotePodCIDR}, endpoint.Status.AdditionalPodCIDRs...)
+	for _, localPodCIDR := range r.AdditionalClusterPodCIDRs {
+		for _, remoteCIDR := range remotePodCIDRs {
+			rules = append(rules,
+				liqonetOperator.IPtableRule{
+					Table:    NatTable,
+					Chain:    LiqonetPostroutingChain,
+					RuleSpec: []string{"-s", localPodCIDR, "-d", remoteCIDR, "-j", "ACCEPT"},
+				},
+				liqonetOperator.IPtableRule{
+					Table:    FilterTable,
+					Chain:    LiqonetInputChain,
+					RuleSpec: []string{"-s", localPodCIDR, "-d", remoteCIDR, "-j", "ACCEPT"},
+				})
+		}
+	}
+	for _, remoteCIDR := range endpoint.Status.AdditionalPodCIDRs {
+		if r.IsGateway && endpoint.Status.LocalRemappedPodCIDR != "None" {
+			rules = append(rules, liqonetOperator.IPtableRule{
 				Table:    NatTable,
 				Chain:    LiqonetPostroutingChain,
-				RuleSpec: ruleSpec,
+				RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remoteCIDR, "-j", "NETMAP", "--to", endpoint.Status.LocalRemappedPodCIDR},
 			})
-			r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
-			//translate all the traffic coming to the local cluster in to the right podcidr because it has been remapped by the remote cluster
-			ruleSpec = []string{"-d", endpoint.Status.LocalRemappedPodCIDR, "-i", endpoint.Status.TunnelIFaceName, "-j", "NETMAP", "--to", r.ClusterPodCIDR}
-			if err = ipt.AppendUnique(NatTable, LiqonetPreroutingChain, ruleSpec...); err != nil {
-				return fmt.Errorf("unable to insert iptable rule \"%s\" in %s table, %s chain: %v", ruleSpec, NatTable, LiqonetPreroutingChain, err)
-			} else {
-				log.Info("installed", "rulespec", strings.Join(ruleSpec, " "), "belonging to chain", LiqonetPreroutingChain, "in table", NatTable)
-			}
-			ruleSpecs = append(ruleSpecs, liqonetOperator.IPtableRule{
+		}
+		rules = append(rules,
+			liqonetOperator.IPtableRule{
+				Table:    NatTable,
+				Chain:    LiqonetPostroutingChain,
+				RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remoteCIDR, "-j", "ACCEPT"},
+			},
+			liqonetOperator.IPtableRule{
+				Table:    FilterTable,
+				Chain:    LiqonetForwardingChain,
+				RuleSpec: []string{"-d", remoteCIDR, "-j", "ACCEPT"},
+			},
+			liqonetOperator.IPtableRule{
+				Table:    FilterTable,
+				Chain:    LiqonetInputChain,
+				RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remoteCIDR, "-j", "ACCEPT"},
+			})
+		if r.IsGateway {
+			rules = append(rules, liqonetOperator.IPtableRule{
+				Table:    NatTable,
+				Chain:    LiqonetPostroutingChain,
+				RuleSpec: []string{"-s", r.VxlanNetwork, "-d", remoteCIDR, "-j", "MASQUERADE"},
+			})
+		}
+	}
+	return rules
+}
+
+//returns the rule setting the maximum segment size of the tcp connections going out of the tunnel interface to the
+//MTU of the route toward the destination, i.e. the one of the tunnel interface
+func getMSSClampRule(tunnelIFace string) liqonetOperator.IPtableRule {
+	return liqonetOperator.IPtableRule{
+		Table:    FilterTable,
+		Chain:    LiqonetForwardingChain,
+		RuleSpec: []string{"-o", tunnelIFace, "-p", "tcp", "-m", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"},
+	}
+}
+
+//returns the service CIDR of the remote cluster as reached by the local pods, the remapped one if it overlaps
+//with the local subnets. It is empty if the services are not exposed or the remapping has not been decided yet
+func getRemoteServiceCIDR(endpoint *v1.TunnelEndpoint) string {
+	if endpoint.Spec.ServiceCIDR == "" || endpoint.Status.RemoteRemappedServiceCIDR == "" {
+		return ""
+	}
+	if endpoint.Status.RemoteRemappedServiceCIDR != "None" {
+		return endpoint.Status.RemoteRemappedServiceCIDR
+	}
+	return endpoint.Spec.ServiceCIDR
+}
+
+func isServiceCIDRRemapped(endpoint *v1.TunnelEndpoint) bool {
+	return getRemoteServiceCIDR(endpoint) != "" && endpoint.Status.RemoteRemappedServiceCIDR != "None"
+}
+
+//the mark identifying on the gateway the traffic toward the remapped services of the remote cluster, it is also the
+//routing table the traffic is looked up in. The table allocated to the remote cluster makes it unique on the node
+func getServiceMark(endpoint *v1.TunnelEndpoint) int {
+	return serviceMarkBase + endpoint.Status.RoutingTable
+}
+
+func isTransitRouteRemapped(route v1.TransitRoute) bool {
+	return route.RemappedPodCIDR != "None" && route.RemappedPodCIDR != ""
+}
+
+func hasRemappedTransitRoutes(endpoint *v1.TunnelEndpoint) bool {
+	for _, route := range endpoint.Status.TransitRoutes {
+		if isTransitRouteRemapped(route) {
+			return true
+		}
+	}
+	return false
+}
+
+//the remapped services and neighbors of a remote cluster share the mark, hence the rule looking up the marked traffic
+//in the table is installed for the family of the services if they are remapped, of the first remapped neighbor otherwise
+func isMarkedTrafficIPv6(endpoint *v1.TunnelEndpoint) bool {
+	if isServiceCIDRRemapped(endpoint) {
+		return liqonetOperator.IsIPv6String(endpoint.Spec.ServiceCIDR)
+	}
+	for _, route := range endpoint.Status.TransitRoutes {
+		if isTransitRouteRemapped(route) {
+			return liqonetOperator.IsIPv6String(route.PodCIDR)
+		}
+	}
+	return false
+}
+
+//returns the rules needed to reach the services of the remote cluster
+//on the gateway the remapped service CIDR is translated back to the original one, which can overlap with the local
+//subnets: the traffic is marked before the translation and routed toward the tunnel by a dedicated routing table
+func (r *RouteController) getServiceRulespecsForRemoteCluster(endpoint *v1.TunnelEndpoint) []liqonetOperator.IPtableRule {
+	remoteServiceCIDR := getRemoteServiceCIDR(endpoint)
+	if remoteServiceCIDR == "" {
+		return nil
+	}
+	if !r.IsGateway {
+		return []liqonetOperator.IPtableRule{
+			{
+				Table:    NatTable,
+				Chain:    LiqonetPostroutingChain,
+				RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", remoteServiceCIDR, "-j", "ACCEPT"},
+			},
+			{
+				Table:    FilterTable,
+				Chain:    LiqonetForwardingChain,
+				RuleSpec: []string{"-d", remoteServiceCIDR, "-j", "ACCEPT"},
+			},
+		}
+	}
+	serviceCIDR := endpoint.Spec.ServiceCIDR
+	tunnelIFace := endpoint.Status.TunnelIFaceName
+	var rules []liqonetOperator.IPtableRule
+	if endpoint.Status.LocalRemappedPodCIDR != "None" {
+		rules = append(rules, liqonetOperator.IPtableRule{
+			Table:    NatTable,
+			Chain:    LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", serviceCIDR, "-o", tunnelIFace, "-j", "NETMAP", "--to", endpoint.Status.LocalRemappedPodCIDR},
+		})
+	}
+	rules = append(rules,
+		liqonetOperator.IPtableRule{
+			Table:    NatTable,
+			Chain:    LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", serviceCIDR, "-o", tunnelIFace, "-j", "ACCEPT"},
+		},
+		liqonetOperator.IPtableRule{
+			Table:    FilterTable,
+			Chain:    LiqonetForwardingChain,
+			RuleSpec: []string{"-d", serviceCIDR, "-o", tunnelIFace, "-j", "ACCEPT"},
+		},
+		liqonetOperator.IPtableRule{
+			Table:    NatTable,
+			Chain:    LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", r.VxlanNetwork, "-d", serviceCIDR, "-o", tunnelIFace, "-j", "MASQUERADE"},
+		})
+	if isServiceCIDRRemapped(endpoint) {
+		rules = append(rules,
+			//the rulespec is written as iptables lists it
+			liqonetOperator.IPtableRule{
+				Table:    MangleTable,
+				Chain:    LiqonetMarkChain,
+				RuleSpec: []string{"-d", remoteServiceCIDR, "-j", "MARK", "--set-xmark", fmt.Sprintf("0x%x/0xffffffff", getServiceMark(endpoint))},
+			},
+			liqonetOperator.IPtableRule{
 				Table:    NatTable,
 				Chain:    LiqonetPreroutingChain,
-				RuleSpec: ruleSpec,
+				RuleSpec: []string{"-d", remoteServiceCIDR, "-j", "NETMAP", "--to", serviceCIDR},
 			})
-			r.IPtablesRuleSpecsPerRemoteCluster[clusterID] = ruleSpecs
+	}
+	return rules
+}
+
+//returns the rules needed to reach the clusters through the remote cluster, and to forward toward the remote cluster
+//the traffic of the clusters reaching it through the local one. On the gateway the remapped pod CIDRs of the clusters
+//reached through the remote cluster are translated back to the ones the remote cluster reaches them at, as the remapped
+//services. The traffic forwarded on behalf of the other clusters is masqueraded with the address of the tunnel
+//interface, since the remote cluster does not know where the pods of the other clusters are reached at. The pods of all
+//the local pod CIDRs reach the other clusters, but only the main one is remapped
+func (r *RouteController) getTransitRulespecsForRemoteCluster(endpoint *v1.TunnelEndpoint, remotePodCIDR string) []liqonetOperator.IPtableRule {
+	var rules []liqonetOperator.IPtableRule
+	tunnelIFace := endpoint.Status.TunnelIFaceName
+	localPodCIDRs := append([]string{r.ClusterPodCIDR}, r.AdditionalClusterPodCIDRs...)
+	destinations := []string{remotePodCIDR}
+	for _, route := range endpoint.Status.TransitRoutes {
+		podCIDR := liqonetOperator.GetTransitPodCIDR(route)
+		if !r.IsGateway {
+			for _, localPodCIDR := range localPodCIDRs {
+				rules = append(rules,
+					liqonetOperator.IPtableRule{
+						Table:    NatTable,
+						Chain:    LiqonetPostroutingChain,
+						RuleSpec: []string{"-s", localPodCIDR, "-d", podCIDR, "-j", "ACCEPT"},
+					},
+					liqonetOperator.IPtableRule{
+						Table:    FilterTable,
+						Chain:    LiqonetInputChain,
+						RuleSpec: []string{"-s", localPodCIDR, "-d", podCIDR, "-j", "ACCEPT"},
+					})
+			}
+			rules = append(rules, liqonetOperator.IPtableRule{
+				Table:    FilterTable,
+				Chain:    LiqonetForwardingChain,
+				RuleSpec: []string{"-d", podCIDR, "-j", "ACCEPT"},
+			})
+			continue
+		}
+		if endpoint.Status.LocalRemappedPodCIDR != "None" {
+			rules = append(rules, liqonetOperator.IPtableRule{
+				Table:    NatTable,
+				Chain:    LiqonetPostroutingChain,
+				RuleSpec: []string{"-s", r.ClusterPodCIDR, "-d", route.PodCIDR, "-o", tunnelIFace, "-j", "NETMAP", "--to", endpoint.Status.LocalRemappedPodCIDR},
+			})
+		}
+		for _, localPodCIDR := range localPodCIDRs {
+			rules = append(rules,
+				liqonetOperator.IPtableRule{
+					Table:    NatTable,
+					Chain:    LiqonetPostroutingChain,
+					RuleSpec: []string{"-s", localPodCIDR, "-d", route.PodCIDR, "-o", tunnelIFace, "-j", "ACCEPT"},
+				},
+				liqonetOperator.IPtableRule{
+					Table:    FilterTable,
+					Chain:    LiqonetInputChain,
+					RuleSpec: []string{"-s", localPodCIDR, "-d", podCIDR, "-j", "ACCEPT"},
+				})
 		}
+		rules = append(rules,
+			liqonetOperator.IPtableRule{
+				Table:    FilterTable,
+				Chain:    LiqonetForwardingChain,
+				RuleSpec: []string{"-d", route.PodCIDR, "-o", tunnelIFace, "-j", "ACCEPT"},
+			},
+			liqonetOperator.IPtableRule{
+				Table:    NatTable,
+				Chain:    LiqonetPostroutingChain,
+				RuleSpec: []string{"-s", r.VxlanNetwork, "-d", route.PodCIDR, "-o", tunnelIFace, "-j", "MASQUERADE"},
+			})
+		if isTransitRouteRemapped(route) {
+			rules = append(rules,
+				liqonetOperator.IPtableRule{
+					Table:    MangleTable,
+					Chain:    LiqonetMarkChain,
+					RuleSpec: []string{"-d", podCIDR, "-j", "MARK", "--set-xmark", fmt.Sprintf("0x%x/0xffffffff", getServiceMark(endpoint))},
+				},
+				liqonetOperator.IPtableRule{
+					Table:    NatTable,
+					Chain:    LiqonetPreroutingChain,
+					RuleSpec: []string{"-d", podCIDR, "-j", "NETMAP", "--to", route.PodCIDR},
+				})
+		}
+		destinations = append(destinations, route.PodCIDR)
 	}
-	return nil
+	if !r.IsGateway || tunnelIFace == "" {
+		return rules
+	}
+	//the rules follow the ones accepting the traffic of the local pods, including the additional pod CIDRs, which is not
+	//masqueraded
+	for _, destination := range destinations {
+		rules = append(rules, liqonetOperator.IPtableRule{
+			Table:    NatTable,
+			Chain:    LiqonetPostroutingChain,
+			RuleSpec: []string{"!", "-s", r.ClusterPodCIDR, "-d", destination, "-o", tunnelIFace, "-j", "MASQUERADE"},
+		})
+	}
+	return rules
+}
+
+func isNetmapRule(rule liqonetOperator.IPtableRule) bool {
+	for i := 0; i < len(rule.RuleSpec)-1; i++ {
+		if rule.RuleSpec[i] == "-j" && rule.RuleSpec[i+1] == "NETMAP" {
+			return true
+		}
+	}
+	return false
+}
+
+func isMSSClampRule(rule liqonetOperator.IPtableRule) bool {
+	for i := 0; i < len(rule.RuleSpec)-1; i++ {
+		if rule.RuleSpec[i] == "-j" && rule.RuleSpec[i+1] == "TCPMSS" {
+			return true
+		}
+	}
+	return false
 }
 
 //remove all the rules added by addIPTablesRulespecForRemoteCluster function
@@ -390,10 +793,24 @@ func (r *RouteController) deleteIPTablesRulespecForRemoteCluster(endpoint *v1.Tu
 	clusterID := endpoint.Spec.ClusterID
 	log := r.Log.WithName("iptables")
 	ipt := r.IPtables
+	//the backends grouping the rules per remote cluster remove all of them at once
+	if peerIpt, ok := ipt.(liqonetOperator.PeerIPTables); ok {
+		if err = peerIpt.DeletePeerRules(clusterID); err != nil {
+			return fmt.Errorf("unable to remove the rules for cluster %s: %v", clusterID, err)
+		}
+		log.Info("removing", "rules for cluster", clusterID)
+		delete(r.IPtablesRuleSpecsPerRemoteCluster, clusterID)
+		return nil
+	}
 	//retrive the iptables rules for the remote cluster
 	rules, ok := r.IPtablesRuleSpecsPerRemoteCluster[endpoint.Spec.ClusterID]
 	if ok {
 		for _, rule := range rules {
+			//the rules are inserted only once, so the ones needed also by other clusters are kept
+			if r.isRuleUsedByOtherClusters(rule, clusterID) {
+				log.Info("keeping", "rulespec", strings.Join(rule.RuleSpec, " "), "belonging to chain", rule.Chain, "in table", rule.Table)
+				continue
+			}
 			if err = ipt.Delete(rule.Table, rule.Chain, rule.RuleSpec...); err != nil {
 				// if the rule that we are trying to delete does not exist then we are fine and go on
 				e, ok := err.(*iptables.Error)
@@ -413,6 +830,21 @@ func (r *RouteController) deleteIPTablesRulespecForRemoteCluster(endpoint *v1.Tu
 	return nil
 }
 
+//returns true if the rule has been inserted also for a remote cluster other than the given one
+func (r *RouteController) isRuleUsedByOtherClusters(rule liqonetOperator.IPtableRule, clusterID string) bool {
+	for id, rules := range r.IPtablesRuleSpecsPerRemoteCluster {
+		if id == clusterID {
+			continue
+		}
+		for _, other := range rules {
+			if other.Table == rule.Table && other.Chain == rule.Chain && reflect.DeepEqual(other.RuleSpec, rule.RuleSpec) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 //this function is called when the route-operator program is closed
 //the errors are not checked because the function is called at exit time
 //it cleans up all the possible resources
@@ -435,6 +867,11 @@ func (r *RouteController) DeleteAllIPTablesChains() {
 		}
 	}
 	for k := range r.IPtablesRuleSpecsPerRemoteCluster {
+		if peerIpt, ok := ipt.(liqonetOperator.PeerIPTables); ok {
+			if err = peerIpt.DeletePeerRules(k); err != nil {
+				logger.Error(err, "unable to remove the rules", "for cluster", k)
+			}
+		}
 		delete(r.IPtablesRuleSpecsPerRemoteCluster, k)
 	}
 	//second we delete the references to the chains
@@ -464,7 +901,7 @@ func (r *RouteController) DeleteAllIPTablesChains() {
 func (r *RouteController) InsertRoutesPerCluster(endpoint *v1.TunnelEndpoint) error {
 	clusterID := endpoint.Spec.ClusterID
 	log := r.Log.WithName("route")
-	remoteTunnelPrivateIPNet := endpoint.Status.RemoteTunnelPrivateIP + "/32"
+	remoteTunnelPrivateIPNet := liqonetOperator.HostCIDR(endpoint.Status.RemoteTunnelPrivateIP)
 	var remotePodCIDR string
 	localTunnelPrivateIP := endpoint.Status.LocalTunnelPrivateIP
 	if endpoint.Status.RemoteRemappedPodCIDR != "None" && endpoint.Status.RemoteRemappedPodCIDR != "" {
@@ -476,21 +913,79 @@ func (r *RouteController) InsertRoutesPerCluster(endpoint *v1.TunnelEndpoint) er
 	}
 	var routes []netlink.Route
 	if r.IsGateway {
-		route, err := r.NetLink.AddRoute(remoteTunnelPrivateIPNet, localTunnelPrivateIP, endpoint.Status.TunnelIFaceName, false)
-		if err != nil {
-			return err
+		//each remote cluster has its own tunnel interface, but the kernel accepts only one route per destination:
+		//if the remote gateway has the same private IP of the gateway of another cluster the route is not installed
+		if otherClusterID, ok := r.getClusterRoutingTo(remoteTunnelPrivateIPNet, clusterID); ok {
+			log.Info("skipping the route toward the remote gateway, its private IP is used also by another cluster", "cluster", clusterID, "other cluster", otherClusterID, "private IP", endpoint.Status.RemoteTunnelPrivateIP)
 		} else {
-			log.Info("installing", "route", route.String())
+			route, err := r.NetLink.AddRoute(remoteTunnelPrivateIPNet, localTunnelPrivateIP, endpoint.Status.TunnelIFaceName, false)
+			if err != nil {
+				return err
+			} else {
+				log.Info("installing", "route", route.String())
+			}
+			routes = append(routes, route)
 		}
-		routes = append(routes, route)
-		route, err = r.NetLink.AddRoute(remotePodCIDR, endpoint.Status.RemoteTunnelPrivateIP, endpoint.Status.TunnelIFaceName, true)
+		route, err := r.NetLink.AddRoute(remotePodCIDR, endpoint.Status.RemoteTunnelPrivateIP, endpoint.Status.TunnelIFaceName, true)
 		if err != nil {
 			return err
 		} else {
 			log.Info("installing", "route", route.String())
 		}
 		routes = append(routes, route)
+		//the additional pod CIDRs of the remote cluster are never remapped
+		for _, podCIDR := range endpoint.Status.AdditionalPodCIDRs {
+			route, err := r.NetLink.AddRoute(podCIDR, endpoint.Status.RemoteTunnelPrivateIP, endpoint.Status.TunnelIFaceName, true)
+			if err != nil {
+				return err
+			}
+			log.Info("installing", "route", route.String())
+			routes = append(routes, route)
+		}
 		r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] = routes
+		if getRemoteServiceCIDR(endpoint) == "" && len(endpoint.Status.TransitRoutes) == 0 {
+			return nil
+		}
+		//the remapped services and neighbors are reached through the table the marked traffic is looked up in, since
+		//their original CIDR can overlap with the local subnets
+		markTable := 0
+		if isServiceCIDRRemapped(endpoint) || hasRemappedTransitRoutes(endpoint) {
+			rule, err := r.NetLink.AddRule(getServiceMark(endpoint), getServiceMark(endpoint), isMarkedTrafficIPv6(endpoint))
+			if err != nil {
+				return err
+			}
+			log.Info("installing", "rule", rule.String())
+			r.ServiceRulesPerRemoteCluster[clusterID] = rule
+			markTable = rule.Table
+		}
+		if getRemoteServiceCIDR(endpoint) != "" {
+			table := 0
+			if isServiceCIDRRemapped(endpoint) {
+				table = markTable
+			}
+			route, err = r.NetLink.AddRouteInTable(endpoint.Spec.ServiceCIDR, endpoint.Status.RemoteTunnelPrivateIP, endpoint.Status.TunnelIFaceName, true, table)
+			if err != nil {
+				return err
+			} else {
+				log.Info("installing", "route", route.String())
+			}
+			routes = append(routes, route)
+			r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] = routes
+		}
+		//the clusters reached through the remote cluster are routed at the pod CIDR the remote cluster reaches them at
+		for _, transitRoute := range endpoint.Status.TransitRoutes {
+			table := 0
+			if isTransitRouteRemapped(transitRoute) {
+				table = markTable
+			}
+			route, err = r.NetLink.AddRouteInTable(transitRoute.PodCIDR, endpoint.Status.RemoteTunnelPrivateIP, endpoint.Status.TunnelIFaceName, true, table)
+			if err != nil {
+				return err
+			}
+			log.Info("installing", "route", route.String(), "toward cluster", transitRoute.ClusterID)
+			routes = append(routes, route)
+			r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] = routes
+		}
 	} else {
 		route, err := r.NetLink.AddRoute(remotePodCIDR, r.GatewayVxlanIP, r.VxlanIfaceName, false)
 		if err != nil {
@@ -499,6 +994,14 @@ func (r *RouteController) InsertRoutesPerCluster(endpoint *v1.TunnelEndpoint) er
 			log.Info("installing", "route", route.String())
 		}
 		routes = append(routes, route)
+		for _, podCIDR := range endpoint.Status.AdditionalPodCIDRs {
+			route, err := r.NetLink.AddRoute(podCIDR, r.GatewayVxlanIP, r.VxlanIfaceName, false)
+			if err != nil {
+				return err
+			}
+			log.Info("installing", "route", route.String())
+			routes = append(routes, route)
+		}
 		route, err = r.NetLink.AddRoute(remoteTunnelPrivateIPNet, r.GatewayVxlanIP, r.VxlanIfaceName, false)
 		if err != nil {
 			return err
@@ -507,6 +1010,25 @@ func (r *RouteController) InsertRoutesPerCluster(endpoint *v1.TunnelEndpoint) er
 		}
 		routes = append(routes, route)
 		r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] = routes
+		if remoteServiceCIDR := getRemoteServiceCIDR(endpoint); remoteServiceCIDR != "" {
+			route, err = r.NetLink.AddRoute(remoteServiceCIDR, r.GatewayVxlanIP, r.VxlanIfaceName, false)
+			if err != nil {
+				return err
+			} else {
+				log.Info("installing", "route", route.String())
+			}
+			routes = append(routes, route)
+			r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] = routes
+		}
+		for _, transitRoute := range endpoint.Status.TransitRoutes {
+			route, err = r.NetLink.AddRoute(liqonetOperator.GetTransitPodCIDR(transitRoute), r.GatewayVxlanIP, r.VxlanIfaceName, false)
+			if err != nil {
+				return err
+			}
+			log.Info("installing", "route", route.String(), "toward cluster", transitRoute.ClusterID)
+			routes = append(routes, route)
+			r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] = routes
+		}
 	}
 	return nil
 }
@@ -517,6 +1039,11 @@ func (r *RouteController) deleteRoutesPerCluster(endpoint *v1.TunnelEndpoint) er
 	log := r.Log.WithName("route")
 	log.Info("removing all routes for", "cluster", clusterID)
 	for _, route := range r.RoutesPerRemoteCluster[endpoint.Spec.ClusterID] {
+		//the routes shared with other clusters, e.g. the ones toward the gateway, are kept
+		if r.isRouteUsedByOtherClusters(route, clusterID) {
+			log.Info("keeping", "route", route.String())
+			continue
+		}
 		err := r.NetLink.DelRoute(route)
 		if err != nil {
 			return err
@@ -524,12 +1051,49 @@ func (r *RouteController) deleteRoutesPerCluster(endpoint *v1.TunnelEndpoint) er
 			log.Info("deleting", "route", route.String())
 		}
 	}
+	if rule, ok := r.ServiceRulesPerRemoteCluster[clusterID]; ok {
+		if err := r.NetLink.DelRule(rule); err != nil {
+			return err
+		}
+		log.Info("deleting", "rule", rule.String())
+		delete(r.ServiceRulesPerRemoteCluster, clusterID)
+	}
 	//after all the routes have been removed then we delete them from the map
 	//this is safe to do even if the key does not exist
 	delete(r.RoutesPerRemoteCluster, clusterID)
 	return nil
 }
 
+//returns the remote cluster, other than the given one, a route for the destination has been installed for
+func (r *RouteController) getClusterRoutingTo(dst string, clusterID string) (string, bool) {
+	for id, routes := range r.RoutesPerRemoteCluster {
+		if id == clusterID {
+			continue
+		}
+		for _, route := range routes {
+			if route.Dst != nil && route.Dst.String() == dst {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+//returns true if the same route has been installed also for a remote cluster other than the given one
+func (r *RouteController) isRouteUsedByOtherClusters(route netlink.Route, clusterID string) bool {
+	for id, routes := range r.RoutesPerRemoteCluster {
+		if id == clusterID {
+			continue
+		}
+		for i := range routes {
+			if liqonetOperator.IsRouteConfigTheSame(&routes[i], route) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (r *RouteController) deleteAllRoutes() {
 	logger := r.Log.WithName("DeleteAllRoutes")
 	//the errors are not checked because the function is called at exit time
@@ -543,6 +1107,12 @@ func (r *RouteController) deleteAllRoutes() {
 		}
 		delete(r.RoutesPerRemoteCluster, k)
 	}
+	for k, rule := range r.ServiceRulesPerRemoteCluster {
+		if err := r.NetLink.DelRule(rule); err != nil {
+			logger.Error(err, "an error occurred while deleting", "rule", rule.String())
+		}
+		delete(r.ServiceRulesPerRemoteCluster, k)
+	}
 }
 
 //this function deletes the vxlan interface in host where the route operator is running
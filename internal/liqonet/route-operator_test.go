@@ -1,13 +1,27 @@
 package controllers
 
 import (
+	"context"
+	"fmt"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
 	v1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	nattingv1 "github.com/liqoTech/liqo/api/namespaceNattingTable/v1"
 	"github.com/liqoTech/liqo/pkg/liqonet"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
 	"testing"
 )
 
@@ -56,6 +70,7 @@ func getRouteController() *RouteController {
 		IPTablesChains:                     make(map[string]liqonet.IPTableChain),
 		IPtablesRuleSpecsPerRemoteCluster:  make(map[string][]liqonet.IPtableRule),
 		RoutesPerRemoteCluster:             make(map[string][]netlink.Route),
+		ServiceRulesPerRemoteCluster:       make(map[string]netlink.Rule),
 		RetryTimeout:                       0,
 		IPtables: &liqonet.MockIPTables{
 			Rules:  []liqonet.IPtableRule{},
@@ -80,12 +95,12 @@ func TestCreateAndInsertIPTablesChains(t *testing.T) {
 	//testing that all the tables and chains are inserted correctly
 	//the function should be idempotent
 	r := getRouteController()
-	//the function is run 3 times and we expect that the number of tables is 3 and of rules 4
+	//the function is run 3 times and we expect that the number of tables is 3 and of rules 5
 	for i := 3; i >= 0; i-- {
 		err := r.createAndInsertIPTablesChains()
 		assert.Nil(t, err, "error should be nil")
-		assert.Equal(t, 3, len(r.IPTablesChains), "there should be three new chains")
-		assert.Equal(t, 4, len(r.IPTablesRuleSpecsReferencingChains), "there should be 4 new rules")
+		assert.Equal(t, 5, len(r.IPTablesChains), "there should be five new chains")
+		assert.Equal(t, 5, len(r.IPTablesRuleSpecsReferencingChains), "there should be 5 new rules")
 	}
 }
 
@@ -124,6 +139,20 @@ func TestAddIPTablesRulespecForRemoteCluster(t *testing.T) {
 	err = r.addIPTablesRulespecForRemoteCluster(tep)
 	assert.Nil(t, err, "error should be nil")
 	assert.Equal(t, 6, len(r.IPtablesRuleSpecsPerRemoteCluster[tep.Spec.ClusterID]), "there should be 6 rules")
+
+	//test:5 the tunnel is installed and node is the gateway
+	//in this case the mss of the tcp connections going out of the tunnel is clamped before the other rules, and the
+	//traffic forwarded on behalf of the other clusters is masqueraded after them
+	r = getRouteController()
+	r.IsGateway = true
+	tep.Status.TunnelIFaceName = "gretun_test"
+	err = r.addIPTablesRulespecForRemoteCluster(tep)
+	assert.Nil(t, err, "error should be nil")
+	rules := r.IPtablesRuleSpecsPerRemoteCluster[tep.Spec.ClusterID]
+	assert.Equal(t, 8, len(rules), "there should be 8 rules")
+	assert.Equal(t, LiqonetForwardingChain, rules[0].Chain)
+	assert.Equal(t, []string{"-o", "gretun_test", "-p", "tcp", "-m", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"}, rules[0].RuleSpec)
+	assert.Equal(t, []string{"!", "-s", r.ClusterPodCIDR, "-d", tep.Status.RemoteRemappedPodCIDR, "-o", "gretun_test", "-j", "MASQUERADE"}, rules[7].RuleSpec)
 }
 
 func TestDeleteIPTablesRulespecForRemoteCluster(t *testing.T) {
@@ -188,6 +217,174 @@ func TestInsertRoutesPerCluster(t *testing.T) {
 	assert.True(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], tep.Status.RemoteTunnelPrivateIP+"/32"), "the route for the remote gateway should be present")
 }
 
+func TestServiceCIDRRulesAndRoutes(t *testing.T) {
+	//test1: the node is not the gateway, the remapped service CIDR is routed toward the gateway as the pod CIDR
+	r := getRouteController()
+	tep := GetTunnelEndpointCR()
+	tep.Spec.ServiceCIDR = "10.96.0.0/12"
+	tep.Status.RemoteRemappedServiceCIDR = "10.192.0.0/12"
+	rules, err := r.getIPTablesRulespecsForRemoteCluster(tep)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(rules), "there should be 5 rules")
+	assert.Equal(t, []string{"-d", "10.192.0.0/12", "-j", "ACCEPT"}, rules[4].RuleSpec)
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	assert.Equal(t, 3, len(r.RoutesPerRemoteCluster[tep.Spec.ClusterID]), "number of routes should be 3")
+	assert.True(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], "10.192.0.0/12"), "the route for the remapped service cidr should be present")
+
+	//test2: the node is the gateway, the remapped service CIDR is translated back to the original one and the marked
+	//traffic is routed toward the tunnel by a table of its own
+	r = getRouteController()
+	r.IsGateway = true
+	r.ClusterPodCIDR = "10.0.0.0/16"
+	r.VxlanNetwork = "172.12.0.0/16"
+	tep.Status.TunnelIFaceName = "liqo.test"
+	tep.Status.RoutingTable = 7
+	rules = r.getServiceRulespecsForRemoteCluster(tep)
+	assert.Equal(t, 5, len(rules), "there should be 5 rules")
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: MangleTable, Chain: LiqonetMarkChain,
+		RuleSpec: []string{"-d", "10.192.0.0/12", "-j", "MARK", "--set-xmark", "0x3ef/0xffffffff"}})
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPreroutingChain,
+		RuleSpec: []string{"-d", "10.192.0.0/12", "-j", "NETMAP", "--to", "10.96.0.0/12"}})
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	routes := r.RoutesPerRemoteCluster[tep.Spec.ClusterID]
+	assert.Equal(t, 3, len(routes), "number of routes should be 3")
+	assert.Equal(t, "10.96.0.0/12", routes[2].Dst.String(), "the original service cidr should be routed")
+	assert.Equal(t, 1007, routes[2].Table, "the route should be in the table of the cluster")
+	netLink := r.NetLink.(*liqonet.MockRouteManager)
+	assert.Equal(t, 1, len(netLink.RuleList), "there should be 1 rule")
+	assert.Equal(t, 1007, netLink.RuleList[0].Mark, "the rule should match the mark of the cluster")
+	assert.Nil(t, r.deleteRoutesPerCluster(tep), "error should be nil")
+	assert.Equal(t, 0, len(netLink.RuleList), "the rule should be removed")
+	assert.Equal(t, 0, len(r.ServiceRulesPerRemoteCluster), "the rule should be removed")
+
+	//test3: the service CIDR is not remapped, the gateway routes it through the main table
+	r = getRouteController()
+	r.IsGateway = true
+	tep.Status.RemoteRemappedServiceCIDR = "None"
+	assert.Equal(t, 3, len(r.getServiceRulespecsForRemoteCluster(tep)), "there should be 3 rules")
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	assert.Equal(t, 0, r.RoutesPerRemoteCluster[tep.Spec.ClusterID][2].Table, "the route should be in the main table")
+	assert.Equal(t, 0, len(r.NetLink.(*liqonet.MockRouteManager).RuleList), "there should be no rules")
+
+	//test4: the remapping has not been decided yet, nothing is installed for the services
+	r = getRouteController()
+	tep.Status.RemoteRemappedServiceCIDR = ""
+	assert.Equal(t, 0, len(r.getServiceRulespecsForRemoteCluster(tep)), "there should be no rules")
+}
+
+func TestAdditionalPodCIDRsRulesAndRoutes(t *testing.T) {
+	//test1: the node is not the gateway, the additional pod CIDRs of both the clusters are routed without NAT
+	r := getRouteController()
+	r.ClusterPodCIDR = "10.200.0.0/16"
+	r.AdditionalClusterPodCIDRs = []string{"10.201.0.0/16"}
+	tep := GetTunnelEndpointCR()
+	tep.Spec.AdditionalPodCIDRs = []string{"10.16.0.0/16", "10.200.0.0/24"}
+	tep.Status.AdditionalPodCIDRs = []string{"10.16.0.0/16"}
+	rules, err := r.getIPTablesRulespecsForRemoteCluster(tep)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(rules), "there should be 10 rules")
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+		RuleSpec: []string{"-s", "10.201.0.0/16", "-d", "10.16.0.0/16", "-j", "ACCEPT"}})
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: FilterTable, Chain: LiqonetForwardingChain,
+		RuleSpec: []string{"-d", "10.16.0.0/16", "-j", "ACCEPT"}})
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	assert.Equal(t, 3, len(r.RoutesPerRemoteCluster[tep.Spec.ClusterID]), "number of routes should be 3")
+	assert.True(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], "10.16.0.0/16"), "the route for the additional pod cidr should be present")
+	assert.False(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], "10.200.0.0/24"), "the rejected pod cidr should not be routed")
+	assert.Equal(t, getRouteDestinations(r.RoutesPerRemoteCluster[tep.Spec.ClusterID]), r.getRouteDestinationsForRemoteCluster(tep))
+
+	//test2: the node is the gateway and the local pod CIDR has been remapped by the remote cluster, it is translated
+	//also toward the additional pod CIDRs, while the local additional pod CIDRs are not
+	r = getRouteController()
+	r.IsGateway = true
+	r.ClusterPodCIDR = "10.200.0.0/16"
+	r.AdditionalClusterPodCIDRs = []string{"10.201.0.0/16"}
+	r.VxlanNetwork = "172.12.0.0/16"
+	tep.Status.LocalRemappedPodCIDR = "10.100.0.0/16"
+	rules = r.getAdditionalPodRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Equal(t, 9, len(rules), "there should be 9 rules")
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+		RuleSpec: []string{"-s", "10.200.0.0/16", "-d", "10.16.0.0/16", "-j", "NETMAP", "--to", "10.100.0.0/16"}})
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+		RuleSpec: []string{"-s", "172.12.0.0/16", "-d", "10.16.0.0/16", "-j", "MASQUERADE"}})
+	assert.NotContains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+		RuleSpec: []string{"-s", "10.201.0.0/16", "-d", "10.16.0.0/16", "-j", "NETMAP", "--to", "10.100.0.0/16"}})
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	assert.True(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], "10.16.0.0/16"), "the route for the additional pod cidr should be present")
+}
+
+func TestTransitRoutesRulesAndRoutes(t *testing.T) {
+	//test1: the node is not the gateway, the clusters reached through the remote cluster are routed toward the gateway
+	//at the pod CIDR they are reached at from the local cluster
+	r := getRouteController()
+	r.ClusterPodCIDR = "10.100.0.0/16"
+	tep := GetTunnelEndpointCR()
+	tep.Status.TransitRoutes = []v1.TransitRoute{
+		{ClusterID: "cluster-c", PodCIDR: "10.200.0.0/16", RemappedPodCIDR: "10.50.0.0/16", Hops: 2},
+		{ClusterID: "cluster-d", PodCIDR: "10.60.0.0/16", RemappedPodCIDR: "None", Hops: 3},
+	}
+	rules := r.getTransitRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Equal(t, 6, len(rules), "there should be 6 rules")
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: FilterTable, Chain: LiqonetForwardingChain,
+		RuleSpec: []string{"-d", "10.50.0.0/16", "-j", "ACCEPT"}})
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	assert.Equal(t, 4, len(r.RoutesPerRemoteCluster[tep.Spec.ClusterID]), "number of routes should be 4")
+	assert.True(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], "10.50.0.0/16"), "the route for the remapped neighbor should be present")
+	assert.True(t, routePerDestination(r.RoutesPerRemoteCluster[tep.Spec.ClusterID], "10.60.0.0/16"), "the route for the neighbor should be present")
+	assert.Equal(t, getRouteDestinations(r.RoutesPerRemoteCluster[tep.Spec.ClusterID]), r.getRouteDestinationsForRemoteCluster(tep))
+
+	//test2: the node is the gateway, the remapped pod CIDR is translated back to the one the remote cluster reaches
+	//the neighbor at and the marked traffic is routed toward the tunnel by the table of the cluster; the traffic
+	//forwarded on behalf of the other clusters is masqueraded
+	r = getRouteController()
+	r.IsGateway = true
+	r.ClusterPodCIDR = "10.100.0.0/16"
+	r.VxlanNetwork = "172.12.0.0/16"
+	tep.Status.TunnelIFaceName = "liqo.test"
+	tep.Status.RoutingTable = 7
+	rules = r.getTransitRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Equal(t, 13, len(rules), "there should be 13 rules")
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: MangleTable, Chain: LiqonetMarkChain,
+		RuleSpec: []string{"-d", "10.50.0.0/16", "-j", "MARK", "--set-xmark", "0x3ef/0xffffffff"}})
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPreroutingChain,
+		RuleSpec: []string{"-d", "10.50.0.0/16", "-j", "NETMAP", "--to", "10.200.0.0/16"}})
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+		RuleSpec: []string{"-s", "10.100.0.0/16", "-d", "10.60.0.0/16", "-o", "liqo.test", "-j", "ACCEPT"}})
+	for _, destination := range []string{tep.Spec.PodCIDR, "10.200.0.0/16", "10.60.0.0/16"} {
+		assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+			RuleSpec: []string{"!", "-s", "10.100.0.0/16", "-d", destination, "-o", "liqo.test", "-j", "MASQUERADE"}})
+	}
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	routes := r.RoutesPerRemoteCluster[tep.Spec.ClusterID]
+	assert.Equal(t, 4, len(routes), "number of routes should be 4")
+	assert.Equal(t, "10.200.0.0/16", routes[2].Dst.String(), "the pod cidr reached by the remote cluster should be routed")
+	assert.Equal(t, 1007, routes[2].Table, "the route should be in the table of the cluster")
+	assert.Equal(t, 0, routes[3].Table, "the route should be in the main table")
+	assert.Equal(t, getRouteDestinations(routes), r.getRouteDestinationsForRemoteCluster(tep))
+	netLink := r.NetLink.(*liqonet.MockRouteManager)
+	assert.Equal(t, 1, len(netLink.RuleList), "there should be 1 rule")
+	assert.Nil(t, r.deleteRoutesPerCluster(tep), "error should be nil")
+	assert.Equal(t, 0, len(netLink.RuleList), "the rule should be removed")
+
+	//test3: the pods of the additional pod CIDRs reach the other clusters too, without being remapped nor masqueraded
+	r.AdditionalClusterPodCIDRs = []string{"10.201.0.0/16"}
+	rules = r.getTransitRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Equal(t, 17, len(rules), "there should be 17 rules")
+	for _, destination := range []string{"10.200.0.0/16", "10.60.0.0/16"} {
+		assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", "10.201.0.0/16", "-d", destination, "-o", "liqo.test", "-j", "ACCEPT"}})
+		assert.NotContains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+			RuleSpec: []string{"-s", "10.201.0.0/16", "-d", destination, "-o", "liqo.test", "-j", "NETMAP", "--to", tep.Status.LocalRemappedPodCIDR}})
+	}
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: FilterTable, Chain: LiqonetInputChain,
+		RuleSpec: []string{"-s", "10.201.0.0/16", "-d", "10.50.0.0/16", "-j", "ACCEPT"}})
+	r.IsGateway = false
+	rules = r.getTransitRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Equal(t, 10, len(rules), "there should be 10 rules")
+	assert.Contains(t, rules, liqonet.IPtableRule{Table: NatTable, Chain: LiqonetPostroutingChain,
+		RuleSpec: []string{"-s", "10.201.0.0/16", "-d", "10.50.0.0/16", "-j", "ACCEPT"}})
+}
+
 func TestDeleteRoutesPerCluster(t *testing.T) {
 	//first we add routes for cluster and then we delete them and check if
 	//the results are as expected
@@ -218,3 +415,357 @@ func TestDeleteAllRoutes(t *testing.T) {
 	r.deleteAllRoutes()
 	assert.Zero(t, len(r.RoutesPerRemoteCluster), "routes for the cluster should be zero")
 }
+
+func TestRoutesForManyClusters(t *testing.T) {
+	//three remote clusters with their own tunnel interface and pod CIDR, but with the same gateway private IP
+	r := getRouteController()
+	r.IsGateway = true
+	var teps []*v1.TunnelEndpoint
+	for i := 0; i < 3; i++ {
+		tep := GetTunnelEndpointCR()
+		tep.Spec.ClusterID = fmt.Sprintf("cluster-%d", i)
+		tep.Spec.PodCIDR = fmt.Sprintf("10.%d.0.0/16", i)
+		tep.Status.TunnelIFaceName = liqonet.GetTunnelIfaceName("gretun_", tep.Spec.ClusterID)
+		teps = append(teps, tep)
+		err := r.InsertRoutesPerCluster(tep)
+		assert.Nil(t, err, "error should be nil")
+		err = r.addIPTablesRulespecForRemoteCluster(tep)
+		assert.Nil(t, err, "error should be nil")
+	}
+	//the route toward the shared gateway private IP is installed only for the first cluster
+	assert.Equal(t, 2, len(r.RoutesPerRemoteCluster["cluster-0"]), "number of routes should be 2")
+	assert.Equal(t, 1, len(r.RoutesPerRemoteCluster["cluster-1"]), "number of routes should be 1")
+	assert.Equal(t, 1, len(r.RoutesPerRemoteCluster["cluster-2"]), "number of routes should be 1")
+	assert.Equal(t, 4, len(r.NetLink.(*liqonet.MockRouteManager).RouteList), "number of routes should be 4")
+
+	//removing a cluster does not affect the routes of the other ones
+	err := r.deleteRoutesPerCluster(teps[1])
+	assert.Nil(t, err, "error should be nil")
+	routes := r.NetLink.(*liqonet.MockRouteManager).RouteList
+	assert.Equal(t, 3, len(routes), "number of routes should be 3")
+	assert.True(t, routePerDestination(routes, "10.0.0.0/16"), "the route for the pod cidr of cluster-0 should be present")
+	assert.True(t, routePerDestination(routes, "10.2.0.0/16"), "the route for the pod cidr of cluster-2 should be present")
+	assert.False(t, routePerDestination(routes, "10.1.0.0/16"), "the route for the pod cidr of cluster-1 should be removed")
+}
+
+func TestSharedRulesAndRoutes(t *testing.T) {
+	//on the non gateway nodes the route toward the remote gateways is the same for all the clusters
+	//and it has to be kept until the last cluster is removed
+	r := getRouteController()
+	tep0 := GetTunnelEndpointCR()
+	tep1 := GetTunnelEndpointCR()
+	tep1.Spec.ClusterID = "cluster-test-1"
+	tep1.Spec.PodCIDR = "10.16.0.0/12"
+	for _, tep := range []*v1.TunnelEndpoint{tep0, tep1} {
+		assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	}
+	assert.Equal(t, 3, len(r.NetLink.(*liqonet.MockRouteManager).RouteList), "number of routes should be 3")
+	assert.Nil(t, r.deleteRoutesPerCluster(tep0), "error should be nil")
+	routes := r.NetLink.(*liqonet.MockRouteManager).RouteList
+	assert.Equal(t, 2, len(routes), "number of routes should be 2")
+	assert.True(t, routePerDestination(routes, tep1.Status.RemoteTunnelPrivateIP+"/32"), "the shared route should be present")
+
+	//the same holds for the iptables rules
+	r.IsGateway = true
+	tep0.Status.LocalRemappedPodCIDR = "10.100.0.0/16"
+	tep1.Status.LocalRemappedPodCIDR = "10.100.0.0/16"
+	for _, tep := range []*v1.TunnelEndpoint{tep0, tep1} {
+		assert.Nil(t, r.addIPTablesRulespecForRemoteCluster(tep), "error should be nil")
+	}
+	rules := len(r.IPtables.(*liqonet.MockIPTables).Rules)
+	assert.Nil(t, r.deleteIPTablesRulespecForRemoteCluster(tep0), "error should be nil")
+	//the prerouting rule translating the remapped local pod CIDR is shared, since the tunnel interface is the same
+	assert.Equal(t, rules-5, len(r.IPtables.(*liqonet.MockIPTables).Rules), "only the rules of the removed cluster should be deleted")
+}
+
+func TestSetGateway(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, v1.AddToScheme(scheme), "error should be nil")
+	tep := GetTunnelEndpointCR()
+	tep.Name = tep.Spec.ClusterID + tunEndpointNameSuffix
+	tep.Labels = map[string]string{liqonet.TunOpLabelKey: "ready", liqonet.RouteOpLabelKey + "-test": "ready", liqonet.RouteOpLabelKey + "-other": "ready"}
+	r := getRouteController()
+	r.Client = fake.NewFakeClientWithScheme(scheme, tep)
+	assert.Nil(t, r.InsertRoutesPerCluster(tep), "error should be nil")
+	assert.Nil(t, r.addIPTablesRulespecForRemoteCluster(tep), "error should be nil")
+
+	//nothing changes if the gateway is the same
+	assert.Nil(t, r.SetGateway(false, r.GatewayVxlanIP, "10.0.0.1"), "error should be nil")
+	assert.Equal(t, 2, len(r.NetLink.(*liqonet.MockRouteManager).RouteList), "number of routes should be 2")
+
+	//the gateway failed over to another node
+	assert.Nil(t, r.SetGateway(false, "172.12.1.2", "10.0.0.2"), "error should be nil")
+	assert.Equal(t, "172.12.1.2", r.GatewayVxlanIP)
+	assert.Equal(t, []string{"10.0.0.2"}, r.NetLink.(*liqonet.MockRouteManager).FDBEntries, "the new gateway should be a VTEP")
+	assert.Equal(t, 0, len(r.NetLink.(*liqonet.MockRouteManager).RouteList), "the routes toward the old gateway should be removed")
+	assert.Equal(t, 0, len(r.RoutesPerRemoteCluster), "the routes toward the old gateway should be removed")
+	assert.Equal(t, 0, len(r.IPtables.(*liqonet.MockIPTables).Rules), "the rules should be removed")
+	var updated v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), types.NamespacedName{Name: tep.Name}, &updated), "error should be nil")
+	_, ok := updated.Labels[liqonet.RouteOpLabelKey+"-test"]
+	assert.False(t, ok, "the endpoint should be processed again")
+	assert.Equal(t, "ready", updated.Labels[liqonet.RouteOpLabelKey+"-other"], "the labels of the other nodes should be kept")
+
+	//the routes are installed toward the new gateway
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: tep.Name}})
+	assert.Nil(t, err, "error should be nil")
+	routes := r.NetLink.(*liqonet.MockRouteManager).RouteList
+	assert.Equal(t, 2, len(routes), "number of routes should be 2")
+	for _, route := range routes {
+		assert.Equal(t, "172.12.1.2", route.Gw.String(), "the routes should use the new gateway")
+	}
+}
+
+func TestNetworkPolicyEventFilter(t *testing.T) {
+	//the changes of the resources the filter rules are derived from are reconciled only on the gateway
+	r := getRouteController()
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+	assert.False(t, r.isGatewayEvent(pod, pod), "the events should be filtered out on the other nodes")
+	r.IsGateway = true
+	assert.True(t, r.isGatewayEvent(pod, pod), "the events should be reconciled on the gateway")
+}
+
+func TestNFTablesBackend(t *testing.T) {
+	//with the nftables backend the rules of each cluster are replaced at once in a table of their own
+	r := getRouteController()
+	runner := &liqonet.MockNFTRunner{}
+	r.IPtables = liqonet.NewNFTables(runner)
+	r.IsGateway = true
+	r.ClusterPodCIDR = "10.0.0.0/16"
+	r.VxlanNetwork = "192.168.200.0/24"
+	assert.Nil(t, r.createAndInsertIPTablesChains(), "error should be nil")
+	tep := GetTunnelEndpointCR()
+	tep.Status.LocalRemappedPodCIDR = "10.100.0.0/16"
+	scripts := len(runner.Scripts)
+	assert.Nil(t, r.addIPTablesRulespecForRemoteCluster(tep), "error should be nil")
+	assert.Equal(t, scripts+1, len(runner.Scripts), "the rules should be applied in a single transaction")
+	assert.Equal(t, 6, len(r.IPtablesRuleSpecsPerRemoteCluster[tep.Spec.ClusterID]), "there should be 6 rules")
+	script := runner.LastScript()
+	assert.True(t, strings.HasPrefix(script, "table inet liqo-"+tep.Spec.ClusterID+"\n"), "the rules should be in the table of the cluster")
+	//the source address is translated before the traffic is accepted
+	assert.True(t, strings.Index(script, "snat ip prefix to 10.100.0.0/16") < strings.Index(script, "snat ip to ip saddr"), "the netmap rule should be the first one")
+
+	assert.Nil(t, r.deleteIPTablesRulespecForRemoteCluster(tep), "error should be nil")
+	tables, err := runner.ListTables()
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, []string{"liqo"}, tables, "the table of the cluster should be removed")
+	assert.Equal(t, 0, len(r.IPtablesRuleSpecsPerRemoteCluster), "the rules should be removed")
+}
+
+func TestAuditState(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, v1.AddToScheme(scheme), "error should be nil")
+	tep := GetTunnelEndpointCR()
+	tep.Name = tep.Spec.ClusterID + tunEndpointNameSuffix
+	tep.Labels = map[string]string{liqonet.TunOpLabelKey: "ready", liqonet.RouteOpLabelKey + "-test": "ready"}
+	r := getRouteController()
+	r.ClusterPodCIDR = "10.200.0.0/16"
+	r.Client = fake.NewFakeClientWithScheme(scheme, tep)
+	r.Recorder = record.NewFakeRecorder(10)
+	ipt := r.IPtables.(*liqonet.MockIPTables)
+	netLink := r.NetLink.(*liqonet.MockRouteManager)
+
+	//after a restart the state is rebuilt from the endpoints already processed
+	assert.Nil(t, r.audit(), "error should be nil")
+	assert.Equal(t, 5, len(r.IPTablesChains), "the chains should be created")
+	assert.Equal(t, 3, len(r.IPtablesRuleSpecsPerRemoteCluster[tep.Spec.ClusterID]), "there should be 3 rules")
+	assert.Equal(t, 2, len(r.RoutesPerRemoteCluster[tep.Spec.ClusterID]), "number of routes should be 2")
+	assert.Equal(t, 0, len(r.Recorder.(*record.FakeRecorder).Events), "the rebuild should not be reported as a drift")
+	rules, routes := len(ipt.Rules), len(netLink.RouteList)
+
+	//the rules and a route have been flushed by another component
+	reapplied := testutil.ToFloat64(driftTotal.WithLabelValues(driftKindRule, driftActionAdd))
+	ipt.Rules = nil
+	netLink.RouteList = netLink.RouteList[1:]
+	assert.Nil(t, r.audit(), "error should be nil")
+	assert.Equal(t, rules, len(ipt.Rules), "the rules should be reapplied")
+	assert.Equal(t, routes, len(netLink.RouteList), "the routes should be reapplied")
+	assert.Equal(t, reapplied+3, testutil.ToFloat64(driftTotal.WithLabelValues(driftKindRule, driftActionAdd)), "the drift should be counted")
+	event := <-r.Recorder.(*record.FakeRecorder).Events
+	assert.True(t, strings.Contains(event, "DriftDetected"), "the drift should be reported")
+
+	//nothing changes when the state is the expected one
+	assert.Nil(t, r.audit(), "error should be nil")
+	assert.Equal(t, 0, len(r.Recorder.(*record.FakeRecorder).Events), "no drift should be reported")
+
+	//the stale rules, routes and clusters are removed
+	stale := GetTunnelEndpointCR()
+	stale.Spec.ClusterID = "cluster-stale"
+	stale.Spec.PodCIDR = "10.32.0.0/16"
+	stale.Status.RemoteTunnelPrivateIP = "192.168.9.2"
+	assert.Nil(t, r.addIPTablesRulespecForRemoteCluster(stale), "error should be nil")
+	assert.Nil(t, r.InsertRoutesPerCluster(stale), "error should be nil")
+	assert.Nil(t, ipt.AppendUnique(FilterTable, LiqonetForwardingChain, "-d", "10.64.0.0/16", "-j", "ACCEPT"), "error should be nil")
+	_, err := netLink.AddRoute("10.128.0.0/16", r.GatewayVxlanIP, r.VxlanIfaceName, false)
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, r.audit(), "error should be nil")
+	assert.Equal(t, rules, len(ipt.Rules), "the stale rules should be removed")
+	assert.Equal(t, routes, len(netLink.RouteList), "the stale routes should be removed")
+	assert.Equal(t, 1, len(r.IPtablesRuleSpecsPerRemoteCluster), "the stale cluster should be removed")
+	assert.Equal(t, 1, len(r.RoutesPerRemoteCluster), "the stale cluster should be removed")
+}
+
+func TestNetworkPolicyRules(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, discoveryv1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, nattingv1.AddToScheme(scheme), "error should be nil")
+	tep := GetTunnelEndpointCR()
+	newPod := func(name, ip string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "test",
+				Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+			}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+		}
+	}
+	httpPort := intstr.FromString("http")
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		newPod("server", "10.100.0.5", map[string]string{"app": "server"}),
+		newPod("client", "10.100.0.6", map[string]string{"app": "client"}),
+		//the offloaded pod has the address it has in the remote cluster
+		newPod("remote-client", "10.0.0.7", map[string]string{"app": "client"}),
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-client", Namespace: "default"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}}},
+					Ports: []networkingv1.NetworkPolicyPort{{Port: &httpPort}},
+				}},
+			},
+		},
+	}
+	r := getRouteController()
+	r.IsGateway = true
+	r.EnforceNetworkPolicies = true
+	r.ClusterPodCIDR = "10.100.0.0/16"
+	r.Client = fake.NewFakeClientWithScheme(scheme, objects...)
+	ruleSpecs := func(rules []liqonet.IPtableRule) []string {
+		var specs []string
+		for _, rule := range rules {
+			specs = append(specs, strings.Join(rule.RuleSpec, " "))
+		}
+		return specs
+	}
+
+	//test1: the server accepts from the remote cluster only the traffic of the offloaded client on the named port
+	rules, err := r.getFilterRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, []string{
+		"-s 10.0.0.0/12 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		"-d 10.0.0.0/12 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		"-s 10.0.0.7/32 -d 10.100.0.5/32 -p tcp -m tcp --dport 8080 -j ACCEPT",
+		"-s 10.0.0.0/12 -d 10.100.0.5/32 -j DROP",
+	}, ruleSpecs(rules))
+	//the filter rules precede the ones accepting the traffic
+	all, err := r.getIPTablesRulespecsForRemoteCluster(tep)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, rules, all[:len(rules)], "the filter rules should come first")
+
+	//test2: the policies selecting the offloaded pods filter the traffic of the local pods
+	assert.Nil(t, r.Create(context.Background(), &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-local", Namespace: "default"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.100.0.0/24"}}},
+			}},
+		},
+	}), "error should be nil")
+	rules, err = r.getFilterRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Nil(t, err, "error should be nil")
+	specs := ruleSpecs(rules)
+	assert.Contains(t, specs, "-s 10.100.0.0/24 -d 10.0.0.7/32 -j ACCEPT")
+	assert.Contains(t, specs, "-s 10.100.0.0/16 -d 10.0.0.7/32 -j DROP")
+	assert.Contains(t, specs, "-s 10.0.0.0/12 -d 10.100.0.6/32 -j DROP")
+	assert.Equal(t, 7, len(rules), "there should be 7 rules")
+
+	//test3: all the other traffic of the remote pods is dropped
+	fc := &discoveryv1.ForeignCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "foreign-cluster"},
+		Spec:       discoveryv1.ForeignClusterSpec{ClusterID: tep.Spec.ClusterID, NetworkPolicyDefault: discoveryv1.NetworkPolicyDenyAll},
+	}
+	assert.Nil(t, r.Create(context.Background(), fc), "error should be nil")
+	rules, err = r.getFilterRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 8, len(rules), "there should be 8 rules")
+	assert.Equal(t, []string{"-s", "10.0.0.0/12", "-j", "DROP"}, rules[7].RuleSpec)
+
+	//test4: only the endpoints of the reflected services are reachable
+	fc.Spec.NetworkPolicyDefault = discoveryv1.NetworkPolicyAllowReflectedServices
+	assert.Nil(t, r.Update(context.Background(), fc), "error should be nil")
+	assert.Nil(t, r.Create(context.Background(), &nattingv1.NamespaceNattingTable{
+		ObjectMeta: metav1.ObjectMeta{Name: tep.Spec.ClusterID},
+		Spec:       nattingv1.NamespaceNattingTableSpec{ClusterId: tep.Spec.ClusterID, NattingTable: map[string]string{"default": "default-home"}},
+	}), "error should be nil")
+	assert.Nil(t, r.Create(context.Background(), &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "server", Namespace: "default"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.100.0.5"}},
+			Ports:     []corev1.EndpointPort{{Port: 8080, Protocol: corev1.ProtocolTCP}},
+		}},
+	}), "error should be nil")
+	rules, err = r.getFilterRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 9, len(rules), "there should be 9 rules")
+	assert.Equal(t, []string{"-s", "10.0.0.0/12", "-d", "10.100.0.5/32", "-p", "tcp", "-m", "tcp", "--dport", "8080", "-j", "ACCEPT"}, rules[7].RuleSpec)
+	assert.Equal(t, []string{"-s", "10.0.0.0/12", "-j", "DROP"}, rules[8].RuleSpec)
+
+	//test5: the traffic is filtered on the gateway only
+	r.IsGateway = false
+	rules, err = r.getFilterRulespecsForRemoteCluster(tep, tep.Spec.PodCIDR)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 0, len(rules), "there should be no rules")
+}
+
+func getVTEPNode(name, internalIP string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: internalIP}},
+		},
+	}
+}
+
+func TestReconcileVTEP(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme), "error should be nil")
+	r := getRouteController()
+	//the internal IPs of the nodes end with the same byte
+	r.Client = fake.NewFakeClientWithScheme(scheme,
+		getVTEPNode("test", "10.0.0.1", nil),
+		getVTEPNode("node-1", "10.0.1.1", nil),
+		getVTEPNode("virtual", "10.0.2.1", map[string]string{"type": "virtual-node"}))
+	reconcileNode := func(name string) {
+		_, err := r.reconcileVTEP(ctrl.Request{NamespacedName: types.NamespacedName{Name: name}})
+		assert.Nil(t, err, "error should be nil")
+	}
+	for _, name := range []string{"test", "node-1", "virtual"} {
+		reconcileNode(name)
+	}
+	assert.Equal(t, []string{"10.0.1.1"}, r.NetLink.(*liqonet.MockRouteManager).FDBEntries, "only the other physical nodes should be VTEPs")
+
+	//a node joins the cluster
+	assert.Nil(t, r.Create(context.TODO(), getVTEPNode("node-2", "10.0.3.1", nil)), "error should be nil")
+	reconcileNode("node-2")
+	assert.Equal(t, []string{"10.0.1.1", "10.0.3.1"}, r.NetLink.(*liqonet.MockRouteManager).FDBEntries)
+
+	//the internal IP of a node changes
+	node := getVTEPNode("node-2", "10.0.4.1", nil)
+	var current corev1.Node
+	assert.Nil(t, r.Get(context.TODO(), types.NamespacedName{Name: "node-2"}, &current), "error should be nil")
+	node.ResourceVersion = current.ResourceVersion
+	assert.Nil(t, r.Update(context.TODO(), node), "error should be nil")
+	reconcileNode("node-2")
+	assert.Equal(t, []string{"10.0.1.1", "10.0.4.1"}, r.NetLink.(*liqonet.MockRouteManager).FDBEntries)
+
+	//a node leaves the cluster
+	assert.Nil(t, r.Delete(context.TODO(), getVTEPNode("node-1", "10.0.1.1", nil)), "error should be nil")
+	reconcileNode("node-1")
+	assert.Equal(t, []string{"10.0.4.1"}, r.NetLink.(*liqonet.MockRouteManager).FDBEntries)
+	assert.Equal(t, map[string]string{"node-2": "10.0.4.1"}, r.RemoteVTEPs)
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	"github.com/liqoTech/liqo/pkg/clusterConfig"
+	"github.com/liqoTech/liqo/pkg/crdClient"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+	"net"
+	"os"
+	"reflect"
+	"time"
+)
+
+const (
+	//the public endpoint is resolved again periodically, since the address of a load balancer or of a NAT can change
+	publicEndpointRefresh = 1 * time.Minute
+	stunTimeout           = 3 * time.Second
+)
+
+//the local port the STUN requests are sent from, the one of the tunnels, so that the NATs map it as the tunnel traffic
+var stunLocalPort = liqonetOperator.TunnelPort
+
+//WatchConfiguration keeps up to date the configuration of the public endpoint of the gateway and of the path MTU
+func (r *TunnelController) WatchConfiguration(config *rest.Config, gv *schema.GroupVersion) {
+	config.ContentConfig.GroupVersion = gv
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	config.UserAgent = rest.DefaultKubernetesUserAgent()
+	CRDclient, err := crdClient.NewFromConfig(config)
+	if err != nil {
+		klog.Error(err, err.Error())
+		os.Exit(1)
+	}
+	go clusterConfig.WatchConfiguration(func(configuration *policyv1.ClusterConfig) {
+		r.SetPublicEndpointConfig(configuration.Spec.LiqonetConfig.PublicEndpoint)
+		r.SetPathMTUConfig(configuration.Spec.LiqonetConfig.MTU)
+	}, CRDclient, "")
+}
+
+//SetPublicEndpointConfig saves the configuration and, if it changed, the public endpoint is published again
+func (r *TunnelController) SetPublicEndpointConfig(config policyv1.PublicEndpointConfig) {
+	r.publicEndpointMutex.Lock()
+	defer r.publicEndpointMutex.Unlock()
+	if reflect.DeepEqual(r.publicEndpointConfig, config) {
+		return
+	}
+	r.publicEndpointConfig = *config.DeepCopy()
+	if r.publicEndpointChanged == nil {
+		r.publicEndpointChanged = make(chan struct{}, 1)
+	}
+	select {
+	case r.publicEndpointChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (r *TunnelController) getPublicEndpointConfig() (policyv1.PublicEndpointConfig, <-chan struct{}) {
+	r.publicEndpointMutex.Lock()
+	defer r.publicEndpointMutex.Unlock()
+	if r.publicEndpointChanged == nil {
+		r.publicEndpointChanged = make(chan struct{}, 1)
+	}
+	return *r.publicEndpointConfig.DeepCopy(), r.publicEndpointChanged
+}
+
+//PublishPublicEndpoint publishes on the gateway node the endpoint the peering clusters reach it at, every time the
+//configuration changes and periodically until the stop channel is closed
+func (r *TunnelController) PublishPublicEndpoint(stop <-chan struct{}) {
+	ticker := time.NewTicker(publicEndpointRefresh)
+	defer ticker.Stop()
+	var published string
+	for {
+		config, changed := r.getPublicEndpointConfig()
+		address, port, err := r.resolvePublicEndpoint(config)
+		if err != nil {
+			r.Log.Error(err, "unable to resolve the public endpoint of the gateway")
+		} else if current := net.JoinHostPort(address, fmt.Sprint(port)); current != published {
+			if err := liqonetOperator.SetPublicEndpointAnnotation(r.ClientSet, r.NodeName, address, port); err != nil {
+				r.Log.Error(err, "unable to publish the public endpoint of the gateway", "node", r.NodeName)
+			} else {
+				r.Log.Info("public endpoint of the gateway published", "address", address, "port", port)
+				published = current
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+//returns the public endpoint given by the configuration, an empty address means that the address of the
+//gateway node is used
+func (r *TunnelController) resolvePublicEndpoint(config policyv1.PublicEndpointConfig) (string, int32, error) {
+	port := config.Port
+	if port == 0 {
+		port = liqonetOperator.TunnelPort
+	}
+	switch {
+	case config.Address != "":
+		return config.Address, port, nil
+	case config.Service != nil:
+		address, servicePort, err := r.getServiceEndpoint(config.Service)
+		if err != nil {
+			return "", 0, err
+		}
+		if config.Port == 0 {
+			port = servicePort
+		}
+		return address, port, nil
+	case len(config.StunServers) > 0:
+		//the port the tunnel port is mapped to is used, unless the public port is configured
+		for _, server := range config.StunServers {
+			address, mappedPort, err := liqonetOperator.DiscoverPublicAddress(server, stunLocalPort, stunTimeout)
+			if err != nil {
+				r.Log.Error(err, "unable to discover the public address", "server", server)
+				continue
+			}
+			if config.Port == 0 {
+				port = int32(mappedPort)
+			}
+			return address.String(), port, nil
+		}
+		return "", 0, fmt.Errorf("none of the STUN servers %v replied", config.StunServers)
+	}
+	return "", 0, nil
+}
+
+//returns the address and the port of the Service exposing the gateway: the ones of the load balancer
+//for a LoadBalancer Service, the address of the gateway node and the node port for a NodePort one
+func (r *TunnelController) getServiceEndpoint(reference *policyv1.ServiceReference) (string, int32, error) {
+	service, err := r.ClientSet.CoreV1().Services(reference.Namespace).Get(context.TODO(), reference.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(service.Spec.Ports) == 0 {
+		return "", 0, fmt.Errorf("the service %s/%s does not expose any port", reference.Namespace, reference.Name)
+	}
+	servicePort := service.Spec.Ports[0]
+	for _, p := range service.Spec.Ports {
+		if p.Protocol == corev1.ProtocolUDP {
+			servicePort = p
+			break
+		}
+	}
+	switch service.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		if len(service.Status.LoadBalancer.Ingress) == 0 {
+			return "", 0, fmt.Errorf("the load balancer of the service %s/%s has not been provisioned yet", reference.Namespace, reference.Name)
+		}
+		ingress := service.Status.LoadBalancer.Ingress[0]
+		if ingress.IP != "" {
+			return ingress.IP, servicePort.Port, nil
+		}
+		//the tunnels need an address, the name of the load balancer is resolved
+		addresses, err := net.LookupIP(ingress.Hostname)
+		if err != nil {
+			return "", 0, err
+		}
+		//the IPv4 addresses are preferred, the IPv6 ones are used by the IPv6 only load balancers
+		for _, address := range addresses {
+			if address.To4() != nil {
+				return address.String(), servicePort.Port, nil
+			}
+		}
+		if len(addresses) == 0 {
+			return "", 0, fmt.Errorf("the load balancer %s has no address", ingress.Hostname)
+		}
+		return addresses[0].String(), servicePort.Port, nil
+	case corev1.ServiceTypeNodePort:
+		node, err := r.ClientSet.CoreV1().Nodes().Get(context.TODO(), r.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", 0, err
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeExternalIP {
+				return address.Address, servicePort.NodePort, nil
+			}
+		}
+		address, err := liqonetOperator.GetNodeInternalIP(node)
+		if err != nil {
+			return "", 0, err
+		}
+		return address, servicePort.NodePort, nil
+	}
+	return "", 0, fmt.Errorf("the service %s/%s of type %s can not expose the gateway", reference.Namespace, reference.Name, service.Spec.Type)
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sync"
+	"time"
+)
+
+const (
+	//the number of probes sent to each remote cluster at each check
+	probeCount   = 3
+	probeTimeout = 1 * time.Second
+	//the RTT and the counters of the traffic of a tunnel whose state does not change are written in the status of the
+	//endpoint at most once in this interval, instead of at each check
+	statusRefreshInterval = 5 * time.Minute
+)
+
+//MonitorTunnels probes periodically the tunnels toward all the remote clusters until the stop channel is closed.
+//It is run only by the operator elected as leader, since the ones on standby have no tunnels installed
+func (r *TunnelController) MonitorTunnels(stop <-chan struct{}) error {
+	ticker := time.NewTicker(r.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			r.probeTunnels()
+		}
+	}
+}
+
+//probes the ready tunnels in parallel, so that an unreachable cluster does not delay the checks of the other ones
+func (r *TunnelController) probeTunnels() {
+	log := r.Log.WithName("monitor")
+	var endpoints v1.TunnelEndpointList
+	if err := r.List(context.Background(), &endpoints); err != nil {
+		log.Error(err, "unable to list the tunnelEndpoints")
+		return
+	}
+	var wg sync.WaitGroup
+	for i := range endpoints.Items {
+		endpoint := &endpoints.Items[i]
+		if endpoint.Status.Phase != "Ready" || !endpoint.DeletionTimestamp.IsZero() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.probeTunnel(endpoint); err != nil {
+				log.Error(err, "unable to probe the tunnel", "cluster", endpoint.Spec.ClusterID)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+//probes the remote tunnel private IP through the tunnel interface and reports the result in the status of the endpoint.
+//After FailureThreshold consecutive failed checks the tunnel is removed, then it is installed again by the reconciliation
+func (r *TunnelController) probeTunnel(endpoint *v1.TunnelEndpoint) error {
+	result, err := r.Prober.Probe(endpoint.Status.TunnelIFaceName, endpoint.Status.RemoteTunnelPrivateIP, probeCount, probeTimeout)
+	if err != nil {
+		return err
+	}
+	previous := endpoint.Status.DeepCopy()
+	now := metav1.Now()
+	connection := &endpoint.Status.Connection
+	connection.LastProbe = now
+	connection.RTT = metav1.Duration{Duration: result.RTT}
+	connection.PacketLoss = result.PacketLoss()
+	condition := v1.TunnelEndpointCondition{
+		Type:               v1.TunnelUpCondition,
+		LastTransitionTime: now,
+	}
+	if result.Received > 0 {
+		connection.ConsecutiveFailures = 0
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "ProbeSucceeded"
+	} else {
+		connection.ConsecutiveFailures++
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "ProbeFailed"
+		condition.Message = fmt.Sprintf("the remote tunnel private IP %s did not reply to %d probes", endpoint.Status.RemoteTunnelPrivateIP, result.Sent)
+	}
+	if endpoint.Status.SetCondition(condition) {
+		if condition.Status == corev1.ConditionTrue {
+			r.Recorder.Event(endpoint, corev1.EventTypeNormal, "TunnelUp", "the tunnel toward the remote cluster is up")
+		} else {
+			r.Recorder.Event(endpoint, corev1.EventTypeWarning, "TunnelDown", condition.Message)
+		}
+	}
+	if err := r.updateTraffic(endpoint); err != nil {
+		r.Log.Error(err, "unable to read the traffic of the tunnel", "cluster", endpoint.Spec.ClusterID)
+	}
+	if connection.ConsecutiveFailures >= r.FailureThreshold {
+		if err := r.removeTunnel(endpoint); err != nil {
+			return err
+		}
+		connection.ConsecutiveFailures = 0
+		r.Recorder.Eventf(endpoint, corev1.EventTypeWarning, "TunnelRecreated", "the tunnel did not work for %d consecutive checks, it is re-created", r.FailureThreshold)
+	} else if !isProbeStatusChanged(previous, &endpoint.Status) {
+		return nil
+	}
+	//the update of the status triggers the reconciliation, which installs again the removed tunnel. If the endpoint
+	//changed meanwhile the outcome of the probe is reported in its latest version
+	probed := endpoint.Status
+	key := types.NamespacedName{Namespace: endpoint.Namespace, Name: endpoint.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Status().Update(context.Background(), endpoint)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+		if err := r.Get(context.Background(), key, endpoint); err != nil {
+			return err
+		}
+		setProbeStatus(&endpoint.Status, &probed, condition)
+		return err
+	})
+}
+
+//returns whether the outcome of the probe has to be written in the status: it is when the state of the tunnel changes,
+//while the RTT and the counters of the traffic are refreshed at most once in statusRefreshInterval
+func isProbeStatusChanged(previous, current *v1.TunnelEndpointStatus) bool {
+	condition := current.GetCondition(v1.TunnelUpCondition, "")
+	previousCondition := previous.GetCondition(v1.TunnelUpCondition, "")
+	if previousCondition == nil || previousCondition.Status != condition.Status || previousCondition.Message != condition.Message {
+		return true
+	}
+	if previous.Connection.ConsecutiveFailures != current.Connection.ConsecutiveFailures ||
+		previous.Connection.PacketLoss != current.Connection.PacketLoss {
+		return true
+	}
+	previousTraffic, traffic := previous.Traffic, current.Traffic
+	previousTraffic.LastUpdate, traffic.LastUpdate = metav1.Time{}, metav1.Time{}
+	if previous.Connection.RTT == current.Connection.RTT && previousTraffic == traffic {
+		return false
+	}
+	return current.Connection.LastProbe.Sub(previous.Connection.LastProbe.Time) >= statusRefreshInterval
+}
+
+//copies the outcome of a probe in the status, the limits of the traffic are set by the reconciliation
+func setProbeStatus(status, probed *v1.TunnelEndpointStatus, condition v1.TunnelEndpointCondition) {
+	status.Connection = probed.Connection
+	status.SetCondition(condition)
+	limits := status.Traffic
+	status.Traffic = probed.Traffic
+	status.Traffic.EgressLimit = limits.EgressLimit
+	status.Traffic.IngressLimit = limits.IngressLimit
+}
+
+//removes the tunnel, since it is not known anymore by the operator it is considered as outdated
+func (r *TunnelController) removeTunnel(endpoint *v1.TunnelEndpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.Shaper != nil {
+		if err := r.Shaper.RemoveLimits(endpoint); err != nil {
+			return err
+		}
+	}
+	if driver, ok := r.getTunnelDriver(endpoint.Status.TunnelProtocol); ok {
+		if err := driver.Remove(endpoint); err != nil {
+			return err
+		}
+	}
+	delete(r.TunnelIFacesPerRemoteCluster, endpoint.Spec.ClusterID)
+	delete(r.transitNetworks, endpoint.Spec.ClusterID)
+	tunnelTraffic.remove(endpoint.Spec.ClusterID)
+	return nil
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//the timeout of each probe of the path MTU, which are sent while the tunnel is installed
+	pathMTUProbeTimeout = 500 * time.Millisecond
+)
+
+//SetPathMTUConfig saves the MTU of the network between the gateways read from the ClusterConfig, 0 if it has to be
+//discovered. The tunnels using a different MTU are installed again by the next reconciliation
+func (r *TunnelController) SetPathMTUConfig(mtu int32) {
+	atomic.StoreInt32(&r.pathMTUConfig, mtu)
+}
+
+func (r *TunnelController) getPathMTUConfig() int {
+	return int(atomic.LoadInt32(&r.pathMTUConfig))
+}
+
+//sets in the status of the endpoint the MTU of the path toward the remote gateway and the one of the tunnel, which is
+//applied by the driver when it installs the tunnel. They are not set if the path MTU is neither configured nor
+//discovered, hence the tunnel gets the MTU derived by the kernel
+func (r *TunnelController) setTunnelMTU(endpoint *v1.TunnelEndpoint, protocol string) {
+	pathMTU := r.getPathMTUConfig()
+	if pathMTU == 0 && r.MTUProber != nil {
+		var err error
+		if pathMTU, err = r.MTUProber.ProbePathMTU(endpoint.Spec.TunnelPublicIP, pathMTUProbeTimeout); err != nil {
+			r.Log.Error(err, "unable to discover the path MTU", "cluster", endpoint.Spec.ClusterID, "remoteTunnelPublicIP", endpoint.Spec.TunnelPublicIP)
+			pathMTU = 0
+		}
+	}
+	endpoint.Status.PathMTU = pathMTU
+	endpoint.Status.MTU = 0
+	if pathMTU > 0 {
+		endpoint.Status.MTU = liqonetOperator.GetTunnelMTU(pathMTU, protocol, liqonetOperator.IsIPv6String(endpoint.Spec.TunnelPublicIP))
+	}
+}
+
+//a tunnel has to be installed again if the configured path MTU is not the one it has been installed with
+func (r *TunnelController) isPathMTUOutdated(endpoint *v1.TunnelEndpoint) bool {
+	pathMTU := r.getPathMTUConfig()
+	return pathMTU > 0 && pathMTU != endpoint.Status.PathMTU
+}
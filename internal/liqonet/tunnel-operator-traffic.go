@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sync"
+)
+
+// +kubebuilder:rbac:groups=discovery.liqo.io,resources=foreignclusters,verbs=get;list;watch
+
+var (
+	tunnelBytesDesc = prometheus.NewDesc("liqonet_tunnel_bytes_total",
+		"Bytes exchanged with the remote cluster through the tunnel, the counter restarts when the tunnel is re-created",
+		[]string{"cluster_id", "direction"}, nil)
+	tunnelPacketsDesc = prometheus.NewDesc("liqonet_tunnel_packets_total",
+		"Packets exchanged with the remote cluster through the tunnel, the counter restarts when the tunnel is re-created",
+		[]string{"cluster_id", "direction"}, nil)
+	//the counters read by the last probes of the tunnels
+	tunnelTraffic = &trafficCollector{stats: make(map[string]liqonetOperator.TunnelStats)}
+)
+
+func init() {
+	metrics.Registry.MustRegister(tunnelTraffic)
+}
+
+//exports the counters of the tunnels, which are read from the kernel and then are not kept by prometheus
+type trafficCollector struct {
+	mutex sync.Mutex
+	stats map[string]liqonetOperator.TunnelStats
+}
+
+func (c *trafficCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tunnelBytesDesc
+	ch <- tunnelPacketsDesc
+}
+
+func (c *trafficCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for clusterID, stats := range c.stats {
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue, float64(stats.SentBytes), clusterID, "sent")
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue, float64(stats.ReceivedBytes), clusterID, "received")
+		ch <- prometheus.MustNewConstMetric(tunnelPacketsDesc, prometheus.CounterValue, float64(stats.SentPackets), clusterID, "sent")
+		ch <- prometheus.MustNewConstMetric(tunnelPacketsDesc, prometheus.CounterValue, float64(stats.ReceivedPackets), clusterID, "received")
+	}
+}
+
+func (c *trafficCollector) set(clusterID string, stats liqonetOperator.TunnelStats) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stats[clusterID] = stats
+}
+
+func (c *trafficCollector) remove(clusterID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.stats, clusterID)
+}
+
+//reads the counters of the tunnel, which are reported in the status of the endpoint and exported as metrics
+func (r *TunnelController) updateTraffic(endpoint *v1.TunnelEndpoint) error {
+	driver, ok := r.getTunnelDriver(endpoint.Status.TunnelProtocol)
+	if !ok {
+		return nil
+	}
+	reader, ok := driver.(liqonetOperator.TunnelStatsReader)
+	if !ok {
+		return nil
+	}
+	stats, err := reader.GetStats(endpoint)
+	if err != nil {
+		return err
+	}
+	traffic := &endpoint.Status.Traffic
+	traffic.LastUpdate = metav1.Now()
+	traffic.SentBytes = int64(stats.SentBytes)
+	traffic.ReceivedBytes = int64(stats.ReceivedBytes)
+	traffic.SentPackets = int64(stats.SentPackets)
+	traffic.ReceivedPackets = int64(stats.ReceivedPackets)
+	tunnelTraffic.set(endpoint.Spec.ClusterID, stats)
+	return nil
+}
+
+//applies to the tunnel the limits set in the ForeignCluster of the remote cluster, when they change or when the tunnel
+//has been installed again. The applied limits are reported in the status of the endpoint
+func (r *TunnelController) applyBandwidthLimits(ctx context.Context, endpoint *v1.TunnelEndpoint, installed bool) error {
+	if r.Shaper == nil {
+		return nil
+	}
+	limits, err := r.getBandwidthLimits(endpoint.Spec.ClusterID)
+	if err != nil {
+		return err
+	}
+	traffic := &endpoint.Status.Traffic
+	if !installed && traffic.EgressLimit == limits.Egress && traffic.IngressLimit == limits.Ingress {
+		return nil
+	}
+	egress, err := parseBandwidth(limits.Egress)
+	if err != nil {
+		return err
+	}
+	ingress, err := parseBandwidth(limits.Ingress)
+	if err != nil {
+		return err
+	}
+	if err := r.Shaper.SetLimits(endpoint, egress, ingress); err != nil {
+		return err
+	}
+	r.Log.Info("traffic limits applied", "cluster", endpoint.Spec.ClusterID, "egress", limits.Egress, "ingress", limits.Ingress)
+	traffic.EgressLimit = limits.Egress
+	traffic.IngressLimit = limits.Ingress
+	return r.Status().Update(ctx, endpoint)
+}
+
+//returns the limits set in the ForeignCluster of the remote cluster, none if it does not exist
+func (r *TunnelController) getBandwidthLimits(clusterID string) (discoveryv1.BandwidthLimits, error) {
+	var foreignClusters discoveryv1.ForeignClusterList
+	if err := r.List(context.Background(), &foreignClusters); err != nil {
+		return discoveryv1.BandwidthLimits{}, err
+	}
+	for i := range foreignClusters.Items {
+		if foreignClusters.Items[i].Spec.ClusterID == clusterID {
+			return foreignClusters.Items[i].Spec.Bandwidth, nil
+		}
+	}
+	return discoveryv1.BandwidthLimits{}, nil
+}
+
+//returns the rate in bits per second, 0 if it is not set
+func parseBandwidth(rate string) (int64, error) {
+	if rate == "" {
+		return 0, nil
+	}
+	quantity, err := resource.ParseQuantity(rate)
+	if err != nil {
+		return 0, fmt.Errorf("the bandwidth %s is not valid: %v", rate, err)
+	}
+	if quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("the bandwidth %s has to be positive", rate)
+	}
+	return quantity.Value(), nil
+}
+
+//the changes of a ForeignCluster are reconciled on the endpoint of the same cluster
+func getEndpointOfForeignCluster() handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(object handler.MapObject) []reconcile.Request {
+			foreignCluster, ok := object.Object.(*discoveryv1.ForeignCluster)
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: foreignCluster.Spec.ClusterID + tunEndpointNameSuffix}}}
+		}),
+	}
+}
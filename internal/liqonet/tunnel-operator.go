@@ -17,14 +17,21 @@ package controllers
 import (
 	"context"
 	"github.com/go-logr/logr"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
 	"github.com/liqoTech/liqo/api/liqonet/v1"
 	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
 	"github.com/vishvananda/netlink"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"os"
 	"os/signal"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,10 +42,38 @@ type TunnelController struct {
 	Scheme                       *runtime.Scheme
 	TunnelIFacesPerRemoteCluster map[string]int
 	RetryTimeout                 time.Duration
+	//the drivers of the tunnel protocols supported by the gateway
+	TunnelDrivers map[string]liqonetOperator.TunnelDriver
+	//the node the operator runs on, it becomes the active gateway when the operator is elected as leader
+	NodeName  string
+	ClientSet kubernetes.Interface
+	//the tunnels are probed every ProbeInterval, and re-created after FailureThreshold consecutive failed checks
+	Prober           liqonetOperator.TunnelProber
+	ProbeInterval    time.Duration
+	FailureThreshold int
+	Recorder         record.EventRecorder
+	//limits the traffic exchanged with each remote cluster according to its ForeignCluster
+	Shaper liqonetOperator.TrafficShaper
+	//discovers the MTU of the path toward each remote gateway, when it is not configured in the ClusterConfig
+	MTUProber     liqonetOperator.PathMTUProber
+	pathMTUConfig int32
+	//the tunnels can be removed also by the monitor
+	mutex sync.Mutex
+	//the configuration of the public endpoint, read from the ClusterConfig
+	publicEndpointConfig  policyv1.PublicEndpointConfig
+	publicEndpointMutex   sync.Mutex
+	publicEndpointChanged chan struct{}
+	//the pod CIDRs of the clusters reached through each remote cluster when its tunnel has been installed
+	transitNetworks map[string]string
 }
 
 // +kubebuilder:rbac:groups=liqonet.liqo.io,resources=tunnelendpoints,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=liqonet.liqo.io,resources=tunnelendpoints/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;patch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get
+// +kubebuilder:rbac:groups=policy.liqo.io,resources=clusterconfigs,verbs=get;list;watch;create
 
 func (r *TunnelController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -51,6 +86,8 @@ func (r *TunnelController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		log.Error(err, "unable to fetch endpoint, probably it has been deleted")
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	//if the endpoint CR is not processed then return
 	if endpoint.Status.Phase != "Processed" && endpoint.Status.Phase != "Ready" {
 		log.Info("tunnelEndpoint is not ready ", "name", endpoint.Name, "phase", endpoint.Status.Phase)
@@ -71,11 +108,21 @@ func (r *TunnelController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	} else {
 		//the object is being deleted
 		if liqonetOperator.ContainsString(endpoint.Finalizers, tunnelEndpointFinalizer) {
-			if err := liqonetOperator.RemoveGreTunnel(&endpoint); err != nil {
-				return ctrl.Result{}, err
+			//the limits are removed before the tunnel, since its interface can be shared with other remote clusters
+			if r.Shaper != nil {
+				if err := r.Shaper.RemoveLimits(&endpoint); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			if driver, ok := r.getTunnelDriver(endpoint.Status.TunnelProtocol); ok {
+				if err := driver.Remove(&endpoint); err != nil {
+					return ctrl.Result{}, err
+				}
 			}
 			//safe to do, even if the key does not exist in the map
 			delete(r.TunnelIFacesPerRemoteCluster, endpoint.Spec.ClusterID)
+			delete(r.transitNetworks, endpoint.Spec.ClusterID)
+			tunnelTraffic.remove(endpoint.Spec.ClusterID)
 			log.Info("tunnel iface removed")
 			//remove the finalizer from the list and update it.
 			endpoint.Finalizers = liqonetOperator.RemoveString(endpoint.Finalizers, tunnelEndpointFinalizer)
@@ -88,37 +135,58 @@ func (r *TunnelController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	//update the status of the endpoint custom resource
 	//and install the tunnel only
-	//check if the CR is newly created
-	if endpoint.Status.Phase == "Processed" {
-		iFaceIndex, iFaceName, err := liqonetOperator.InstallGreTunnel(&endpoint)
+	//check if the CR is newly created or if the tunnel has to be re-established
+	installed := endpoint.Status.Phase == "Processed" || r.isTunnelOutdated(&endpoint)
+	if installed {
+		reinstall := endpoint.Status.Phase == "Ready"
+		//the protocol is chosen among the ones supported by both the gateways
+		protocol, err := liqonetOperator.SelectTunnelProtocol(liqonetOperator.GetSupportedProtocols(r.TunnelDrivers), endpoint.Spec.SupportedProtocols)
+		if err != nil {
+			log.Error(err, "unable to select the tunnel protocol")
+			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+		}
+		r.setTunnelMTU(&endpoint, protocol)
+		//the local tunnel private IP is the other address of the /31 of the remote one, the drivers configure it
+		localTunnelPrivateIP, err := liqonetOperator.GetPeerTunnelPrivateIP(endpoint.Spec.TunnelPrivateIP)
+		if err != nil {
+			log.Error(err, "unable to get the local tunnel private IP")
+			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+		}
+		endpoint.Status.LocalTunnelPrivateIP = localTunnelPrivateIP
+		endpoint.Status.RemoteTunnelPrivateIP = endpoint.Spec.TunnelPrivateIP
+		iFaceIndex, iFaceName, err := r.TunnelDrivers[protocol].Install(&endpoint)
 		if err != nil {
-			log.Error(err, "unable to create the gre tunnel")
+			log.Error(err, "unable to create the tunnel", "protocol", protocol)
 			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 		}
-		log.Info("gre tunnel installed", "index", iFaceIndex, "name", iFaceName)
+		log.Info("tunnel installed", "protocol", protocol, "index", iFaceIndex, "name", iFaceName, "mtu", endpoint.Status.MTU)
 		//save the IFace index in the map
 		r.TunnelIFacesPerRemoteCluster[endpoint.Spec.ClusterID] = iFaceIndex
-		log.Info("installed gretunel with index: " + iFaceName)
+		r.setTransitNetworks(&endpoint)
 		//update the status of CR
 		localTunnelPublicIP, err := liqonetOperator.GetLocalTunnelPublicIPToString()
 		if err != nil {
 			log.Error(err, "unable to get localTunnelPublicIP")
 		}
-		localTunnelPrivateIP, err := liqonetOperator.GetLocalTunnelPrivateIPToString()
-		if err != nil {
-			log.Error(err, "unable to get localTunnelPrivateIP")
-		}
 		endpoint.Status.TunnelIFaceName = iFaceName
 		endpoint.Status.TunnelIFaceIndex = iFaceIndex
-		endpoint.Status.LocalTunnelPrivateIP = localTunnelPrivateIP
+		endpoint.Status.TunnelProtocol = protocol
 		endpoint.Status.LocalTunnelPublicIP = localTunnelPublicIP
-		endpoint.Status.RemoteTunnelPrivateIP = endpoint.Spec.TunnelPrivateIP
 		endpoint.Status.RemoteTunnelPublicIP = endpoint.Spec.TunnelPublicIP
+		endpoint.Status.RemoteTunnelPublicPort = endpoint.Spec.TunnelPublicPort
 		endpoint.Status.Phase = "Ready"
 		err = r.Client.Status().Update(ctx, &endpoint)
 		if err != nil {
 			return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 		}
+		if reinstall {
+			//the route-operators have to install again the routes toward the new tunnel
+			log.Info("tunnel re-established", "localTunnelPublicIP", localTunnelPublicIP, "remoteTunnelPublicIP", endpoint.Spec.TunnelPublicIP)
+			endpoint.ObjectMeta.SetLabels(liqonetOperator.RemoveRouteOperatorLabels(endpoint.ObjectMeta.GetLabels()))
+			if err := r.Client.Update(ctx, &endpoint); err != nil {
+				return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+			}
+		}
 	} else if endpoint.Status.Phase == "Ready" {
 		//set the label that the resource have been processed by tunnel-operator
 		endpoint.ObjectMeta.SetLabels(liqonetOperator.SetLabelHandler(liqonetOperator.TunOpLabelKey, "ready", endpoint.ObjectMeta.GetLabels()))
@@ -130,6 +198,10 @@ func (r *TunnelController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	} else {
 		return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
 	}
+	if err := r.applyBandwidthLimits(ctx, &endpoint, installed); err != nil {
+		log.Error(err, "unable to limit the traffic of the tunnel")
+		return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
+	}
 	//save the IFace index in the map
 	//we come here only if the tunnel is installed and the CR status has been updated
 	r.TunnelIFacesPerRemoteCluster[endpoint.Spec.ClusterID] = endpoint.Status.TunnelIFaceIndex
@@ -137,12 +209,79 @@ func (r *TunnelController) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
 }
 
+//a ready tunnel has to be installed again if it has not been installed by this operator, e.g. the gateway failed over
+//to this node, if the remote cluster advertised a new gateway or a new public endpoint, if the path MTU changed or
+//if the clusters reached through the remote one changed
+func (r *TunnelController) isTunnelOutdated(endpoint *v1.TunnelEndpoint) bool {
+	if endpoint.Status.Phase != "Ready" {
+		return false
+	}
+	if _, ok := r.TunnelIFacesPerRemoteCluster[endpoint.Spec.ClusterID]; !ok {
+		return true
+	}
+	return endpoint.Status.RemoteTunnelPublicIP != endpoint.Spec.TunnelPublicIP || endpoint.Status.RemoteTunnelPublicPort != endpoint.Spec.TunnelPublicPort ||
+		r.isPathMTUOutdated(endpoint) || r.transitNetworks[endpoint.Spec.ClusterID] != getTransitNetworks(endpoint)
+}
+
+//the transit networks are allowed through the tunnel by some drivers, e.g. wireguard, which have to be configured
+//again when they change
+func (r *TunnelController) setTransitNetworks(endpoint *v1.TunnelEndpoint) {
+	if r.transitNetworks == nil {
+		r.transitNetworks = make(map[string]string)
+	}
+	r.transitNetworks[endpoint.Spec.ClusterID] = getTransitNetworks(endpoint)
+}
+
+func getTransitNetworks(endpoint *v1.TunnelEndpoint) string {
+	var networks []string
+	for _, route := range endpoint.Status.TransitRoutes {
+		networks = append(networks, route.PodCIDR)
+	}
+	return strings.Join(networks, ",")
+}
+
+//ActivateGateway marks the node as the active gateway and publishes its public endpoint until the stop channel
+//is closed. It is run only by the operator elected as leader, which then installs again the tunnels toward all the
+//remote clusters
+func (r *TunnelController) ActivateGateway(stop <-chan struct{}) error {
+	for {
+		err := liqonetOperator.SetActiveGateway(r.ClientSet, r.NodeName)
+		if err == nil {
+			break
+		}
+		r.Log.Error(err, "unable to set the node as the active gateway", "node", r.NodeName)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(r.RetryTimeout):
+		}
+	}
+	r.PublishPublicEndpoint(stop)
+	return nil
+}
+
+//returns the driver of the protocol the tunnel has been installed with, the tunnels installed
+//before the protocol was recorded in the status are gre tunnels
+func (r *TunnelController) getTunnelDriver(protocol string) (liqonetOperator.TunnelDriver, bool) {
+	if protocol == "" {
+		protocol = liqonetOperator.GreProtocol
+	}
+	driver, ok := r.TunnelDrivers[protocol]
+	return driver, ok
+}
+
 //used to remove all the tunnel interfaces when the controller is closed
 //it does not return an error, but just logs them, cause we can not recover from
 //them at exit time
 func (r *TunnelController) RemoveAllTunnels() {
 	logger := r.Log.WithName("RemoveAllTunnels")
+	removed := make(map[int]bool)
 	for _, ifaceIndex := range r.TunnelIFacesPerRemoteCluster {
+		//the interfaces can be shared among the remote clusters
+		if removed[ifaceIndex] {
+			continue
+		}
+		removed[ifaceIndex] = true
 		existingIface, err := netlink.LinkByIndex(ifaceIndex)
 		if err == nil {
 			//Remove the existing gre interface
@@ -175,5 +314,6 @@ func (r *TunnelController) SetupSignalHandlerForTunnelOperator() (stopCh <-chan
 func (r *TunnelController) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1.TunnelEndpoint{}).
+		Watches(&source.Kind{Type: &discoveryv1.ForeignCluster{}}, getEndpointOfForeignCluster()).
 		Complete(r)
 }
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
+	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	v1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/liqoTech/liqo/pkg/liqonet"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"net"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func getTunnelEndpointForCluster(clusterID string) *v1.TunnelEndpoint {
+	return &v1.TunnelEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterID + tunEndpointNameSuffix},
+		Spec: v1.TunnelEndpointSpec{
+			ClusterID:       clusterID,
+			PodCIDR:         "10.0.0.0/16",
+			TunnelPublicIP:  "192.168.5.1",
+			TunnelPrivateIP: "169.254.64.1",
+		},
+		Status: v1.TunnelEndpointStatus{Phase: "Processed"},
+	}
+}
+
+func getTunnelController(t *testing.T, endpoints ...runtime.Object) (*TunnelController, *liqonet.MockTunnelDriver) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, v1.AddToScheme(scheme), "error should be nil")
+	assert.Nil(t, discoveryv1.AddToScheme(scheme), "error should be nil")
+	driver := &liqonet.MockTunnelDriver{}
+	return &TunnelController{
+		Client:                       fake.NewFakeClientWithScheme(scheme, endpoints...),
+		Log:                          ctrl.Log.WithName("tunnel-operator"),
+		Scheme:                       scheme,
+		TunnelIFacesPerRemoteCluster: make(map[string]int),
+		TunnelDrivers:                map[string]liqonet.TunnelDriver{liqonet.GreProtocol: driver},
+		Prober:                       &liqonet.MockTunnelProber{Results: make(map[string]liqonet.ProbeResult)},
+		FailureThreshold:             3,
+		Recorder:                     record.NewFakeRecorder(10),
+	}, driver
+}
+
+func TestGetTunnelIfaceName(t *testing.T) {
+	name := liqonet.GetTunnelIfaceName("gretun_", "2e1e4a5c-0b55-4d0b-a6f6-5cbb1d14b6f9")
+	assert.Equal(t, 15, len(name), "the name should fit the kernel limit")
+	assert.Equal(t, name, liqonet.GetTunnelIfaceName("gretun_", "2e1e4a5c-0b55-4d0b-a6f6-5cbb1d14b6f9"), "the name should be stable")
+	assert.NotEqual(t, name, liqonet.GetTunnelIfaceName("gretun_", "8a3f5b0e-7c1d-4f2a-9e6b-1d2c3b4a5f60"), "the names should be unique")
+	assert.Equal(t, 15, len(liqonet.GetTunnelIfaceName("a-very-long-prefix_", "cluster")), "the prefix should be truncated")
+}
+
+func TestTunnelControllerManyPeers(t *testing.T) {
+	//three remote clusters are peered at the same time, each one should have its own tunnel interface
+	var endpoints []runtime.Object
+	for i := 0; i < 3; i++ {
+		endpoints = append(endpoints, getTunnelEndpointForCluster(fmt.Sprintf("cluster-%d", i)))
+	}
+	r, driver := getTunnelController(t, endpoints...)
+	for _, obj := range endpoints {
+		endpoint := obj.(*v1.TunnelEndpoint)
+		_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: endpoint.Name}})
+		assert.Nil(t, err, "error should be nil")
+	}
+	assert.Equal(t, 3, len(driver.Tunnels), "there should be 3 tunnels")
+	assert.Equal(t, 3, len(r.TunnelIFacesPerRemoteCluster), "there should be 3 tunnel interfaces")
+
+	names := make(map[string]bool)
+	for _, obj := range endpoints {
+		var endpoint v1.TunnelEndpoint
+		err := r.Get(context.TODO(), types.NamespacedName{Name: obj.(*v1.TunnelEndpoint).Name}, &endpoint)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, "Ready", endpoint.Status.Phase)
+		assert.Equal(t, liqonet.GreProtocol, endpoint.Status.TunnelProtocol)
+		assert.Equal(t, r.TunnelIFacesPerRemoteCluster[endpoint.Spec.ClusterID], endpoint.Status.TunnelIFaceIndex)
+		names[endpoint.Status.TunnelIFaceName] = true
+	}
+	assert.Equal(t, 3, len(names), "the tunnel interfaces should have different names")
+
+	//removing a peer does not affect the other ones
+	var endpoint v1.TunnelEndpoint
+	err := r.Get(context.TODO(), types.NamespacedName{Name: "cluster-1" + tunEndpointNameSuffix}, &endpoint)
+	assert.Nil(t, err, "error should be nil")
+	now := metav1.Now()
+	endpoint.DeletionTimestamp = &now
+	assert.Nil(t, r.Update(context.TODO(), &endpoint), "error should be nil")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: endpoint.Name}})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 2, len(driver.Tunnels), "there should be 2 tunnels")
+	_, ok := driver.Tunnels["cluster-1"]
+	assert.False(t, ok, "the tunnel of the removed cluster should not exist")
+	assert.Equal(t, 2, len(r.TunnelIFacesPerRemoteCluster), "there should be 2 tunnel interfaces")
+}
+
+func TestTunnelControllerFailover(t *testing.T) {
+	//the tunnel has been installed by the previous gateway, hence it is not known by this operator
+	endpoint := getTunnelEndpointForCluster("cluster-1")
+	endpoint.Labels = map[string]string{liqonet.TunOpLabelKey: "ready", liqonet.RouteOpLabelKey + "-node-1": "ready"}
+	endpoint.Status = v1.TunnelEndpointStatus{
+		Phase:                "Ready",
+		TunnelProtocol:       liqonet.GreProtocol,
+		RemoteTunnelPublicIP: endpoint.Spec.TunnelPublicIP,
+	}
+	r, driver := getTunnelController(t, endpoint)
+	key := types.NamespacedName{Name: endpoint.Name}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 1, len(driver.Tunnels), "the tunnel should be installed again")
+	var updated v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, "Ready", updated.Status.Phase)
+	assert.Equal(t, r.TunnelIFacesPerRemoteCluster["cluster-1"], updated.Status.TunnelIFaceIndex)
+	_, ok := updated.Labels[liqonet.RouteOpLabelKey+"-node-1"]
+	assert.False(t, ok, "the route-operators should process again the endpoint")
+	assert.Equal(t, "ready", updated.Labels[liqonet.TunOpLabelKey])
+
+	//the remote cluster advertises a new gateway
+	delete(driver.Tunnels, "cluster-1")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 0, len(driver.Tunnels), "the tunnel is up to date, it should not be installed again")
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	updated.Spec.TunnelPublicIP = "192.168.6.1"
+	assert.Nil(t, r.Update(context.TODO(), &updated), "error should be nil")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 1, len(driver.Tunnels), "the tunnel should be re-established toward the new gateway")
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, "192.168.6.1", updated.Status.RemoteTunnelPublicIP)
+
+	//a cluster is reached through the remote one, the tunnel has to allow its traffic
+	delete(driver.Tunnels, "cluster-1")
+	updated.Status.TransitRoutes = []v1.TransitRoute{{ClusterID: "cluster-2", PodCIDR: "10.3.0.0/16", RemappedPodCIDR: "None", Hops: 2}}
+	assert.Nil(t, r.Status().Update(context.TODO(), &updated), "error should be nil")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 1, len(driver.Tunnels), "the tunnel should be configured again with the transit networks")
+}
+
+func TestTunnelControllerMonitor(t *testing.T) {
+	endpoint := getTunnelEndpointForCluster("cluster-1")
+	r, driver := getTunnelController(t, endpoint)
+	key := types.NamespacedName{Name: endpoint.Name}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	var updated v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, "Ready", updated.Status.Phase)
+
+	//the tunnel works
+	r.probeTunnels()
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	condition := updated.Status.GetCondition(v1.TunnelUpCondition, "")
+	assert.NotNil(t, condition, "the condition should be set")
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, 0, updated.Status.Connection.PacketLoss)
+	assert.False(t, updated.Status.Connection.LastProbe.IsZero(), "the probe time should be set")
+
+	//the remote cluster does not reply anymore
+	prober := r.Prober.(*liqonet.MockTunnelProber)
+	prober.Results[updated.Status.RemoteTunnelPrivateIP] = liqonet.ProbeResult{Sent: 3}
+	for i := 1; i < r.FailureThreshold; i++ {
+		r.probeTunnels()
+	}
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, corev1.ConditionFalse, updated.Status.GetCondition(v1.TunnelUpCondition, "").Status)
+	assert.Equal(t, 100, updated.Status.Connection.PacketLoss)
+	assert.Equal(t, r.FailureThreshold-1, updated.Status.Connection.ConsecutiveFailures)
+	assert.Equal(t, 1, len(driver.Tunnels), "the tunnel should not be removed yet")
+
+	//the threshold is reached, the tunnel is removed and installed again by the reconciliation
+	r.probeTunnels()
+	assert.Equal(t, 0, len(driver.Tunnels), "the tunnel should be removed")
+	var recreated v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &recreated), "error should be nil")
+	assert.Equal(t, 0, recreated.Status.Connection.ConsecutiveFailures)
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 1, len(driver.Tunnels), "the tunnel should be installed again")
+
+	events := r.Recorder.(*record.FakeRecorder).Events
+	var reasons []string
+	for len(events) > 0 {
+		reasons = append(reasons, <-events)
+	}
+	assert.Equal(t, 3, len(reasons))
+	assert.Contains(t, reasons[0], "TunnelUp")
+	assert.Contains(t, reasons[1], "TunnelDown")
+	assert.Contains(t, reasons[2], "TunnelRecreated")
+
+	//the endpoint changed after it has been listed, the outcome of the probe is reported in its latest version
+	var stale v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &stale), "error should be nil")
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	updated.Status.Traffic.EgressLimit = "10M"
+	assert.Nil(t, r.Status().Update(context.TODO(), &updated), "error should be nil")
+	delete(prober.Results, updated.Status.RemoteTunnelPrivateIP)
+	assert.Nil(t, r.probeTunnel(&stale), "error should be nil")
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, "10M", updated.Status.Traffic.EgressLimit, "the changes of the endpoint should be kept")
+	assert.Equal(t, corev1.ConditionTrue, updated.Status.GetCondition(v1.TunnelUpCondition, "").Status)
+
+	//the probes are sent through the tunnel interface, a local address replying does not make the tunnel up
+	stale = updated
+	stale.Status.TunnelIFaceName = ""
+	assert.Nil(t, r.probeTunnel(&stale), "error should be nil")
+	assert.Equal(t, corev1.ConditionFalse, stale.Status.GetCondition(v1.TunnelUpCondition, "").Status)
+}
+
+func TestTunnelControllerTraffic(t *testing.T) {
+	endpoint := getTunnelEndpointForCluster("cluster-1")
+	foreignCluster := &discoveryv1.ForeignCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "foreign-cluster-1"},
+		Spec: discoveryv1.ForeignClusterSpec{
+			ClusterID: "cluster-1",
+			Bandwidth: discoveryv1.BandwidthLimits{Egress: "10M", Ingress: "5M"},
+		},
+	}
+	r, driver := getTunnelController(t, endpoint, foreignCluster)
+	shaper := &liqonet.MockTrafficShaper{}
+	r.Shaper = shaper
+	key := types.NamespacedName{Name: endpoint.Name}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, [2]int64{10000000, 5000000}, shaper.Limits["cluster-1"])
+	var updated v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, "10M", updated.Status.Traffic.EgressLimit)
+	assert.Equal(t, "5M", updated.Status.Traffic.IngressLimit)
+
+	//the limits are changed in the ForeignCluster
+	assert.Nil(t, r.Get(context.TODO(), types.NamespacedName{Name: foreignCluster.Name}, foreignCluster), "error should be nil")
+	foreignCluster.Spec.Bandwidth = discoveryv1.BandwidthLimits{Egress: "1G"}
+	assert.Nil(t, r.Update(context.TODO(), foreignCluster), "error should be nil")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, [2]int64{1000000000, 0}, shaper.Limits["cluster-1"])
+	var changed v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &changed), "error should be nil")
+	assert.Equal(t, "1G", changed.Status.Traffic.EgressLimit)
+	assert.Equal(t, "", changed.Status.Traffic.IngressLimit)
+
+	//an invalid limit is not applied
+	foreignCluster.Spec.Bandwidth = discoveryv1.BandwidthLimits{Egress: "-1M"}
+	assert.Nil(t, r.Update(context.TODO(), foreignCluster), "error should be nil")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.NotNil(t, err, "error should not be nil")
+	assert.Equal(t, [2]int64{1000000000, 0}, shaper.Limits["cluster-1"])
+
+	//the limits are removed
+	foreignCluster.Spec.Bandwidth = discoveryv1.BandwidthLimits{}
+	assert.Nil(t, r.Update(context.TODO(), foreignCluster), "error should be nil")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	_, ok := shaper.Limits["cluster-1"]
+	assert.False(t, ok, "the limits should be removed")
+
+	//the counters of the tunnel are reported by the probes
+	driver.Stats = map[string]liqonet.TunnelStats{"cluster-1": {SentBytes: 2048, ReceivedBytes: 1024, SentPackets: 4, ReceivedPackets: 2}}
+	r.probeTunnels()
+	updated = v1.TunnelEndpoint{}
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, int64(2048), updated.Status.Traffic.SentBytes)
+	assert.Equal(t, int64(1024), updated.Status.Traffic.ReceivedBytes)
+	assert.Equal(t, int64(4), updated.Status.Traffic.SentPackets)
+	assert.Equal(t, int64(2), updated.Status.Traffic.ReceivedPackets)
+	assert.False(t, updated.Status.Traffic.LastUpdate.IsZero(), "the update time should be set")
+	assert.Equal(t, liqonet.TunnelStats{SentBytes: 2048, ReceivedBytes: 1024, SentPackets: 4, ReceivedPackets: 2}, tunnelTraffic.stats["cluster-1"])
+
+	//the status is not written again when the state of the tunnel does not change, the counters are exported anyway
+	driver.Stats["cluster-1"] = liqonet.TunnelStats{SentBytes: 4096, ReceivedBytes: 2048, SentPackets: 8, ReceivedPackets: 4}
+	r.probeTunnels()
+	var unchanged v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &unchanged), "error should be nil")
+	assert.Equal(t, updated.ResourceVersion, unchanged.ResourceVersion, "the status should not be updated")
+	assert.Equal(t, liqonet.TunnelStats{SentBytes: 4096, ReceivedBytes: 2048, SentPackets: 8, ReceivedPackets: 4}, tunnelTraffic.stats["cluster-1"])
+
+	//the counters are refreshed once the status is older than the refresh interval
+	unchanged.Status.Connection.LastProbe = metav1.NewTime(time.Now().Add(-statusRefreshInterval))
+	assert.Nil(t, r.Status().Update(context.TODO(), &unchanged), "error should be nil")
+	r.probeTunnels()
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, int64(4096), updated.Status.Traffic.SentBytes)
+}
+
+func TestTunnelControllerMTU(t *testing.T) {
+	endpoint := getTunnelEndpointForCluster("cluster-1")
+	r, driver := getTunnelController(t, endpoint)
+	r.MTUProber = &liqonet.MockPathMTUProber{MTUs: map[string]int{"192.168.5.1": 1400}}
+	key := types.NamespacedName{Name: endpoint.Name}
+	//the path MTU is discovered probing the remote gateway
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	var updated v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &updated), "error should be nil")
+	assert.Equal(t, 1400, updated.Status.PathMTU)
+	assert.Equal(t, 1400-liqonet.GetTunnelOverhead(liqonet.GreProtocol, false), updated.Status.MTU)
+	assert.Equal(t, updated.Status.MTU, driver.MTUs["cluster-1"], "the tunnel should be installed with the MTU")
+
+	//the tunnel is installed again when the configured path MTU changes
+	r.SetPathMTUConfig(9000)
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	var reinstalled v1.TunnelEndpoint
+	assert.Nil(t, r.Get(context.TODO(), key, &reinstalled), "error should be nil")
+	assert.Equal(t, 9000, reinstalled.Status.PathMTU)
+	assert.Equal(t, 9000-liqonet.GetTunnelOverhead(liqonet.GreProtocol, false), reinstalled.Status.MTU)
+	assert.Equal(t, reinstalled.Status.MTU, driver.MTUs["cluster-1"], "the tunnel should be installed again")
+	delete(driver.MTUs, "cluster-1")
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err, "error should be nil")
+	_, ok := driver.MTUs["cluster-1"]
+	assert.False(t, ok, "the tunnel should not be installed again")
+}
+
+func TestResolvePublicEndpoint(t *testing.T) {
+	loadBalancer := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-lb", Namespace: "liqo"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolUDP, Port: 5871, NodePort: 31820}},
+		},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}}},
+	}
+	nodePort := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-np", Namespace: "liqo"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{{Protocol: corev1.ProtocolUDP, Port: 51820, NodePort: 31820}},
+		},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			{Type: corev1.NodeExternalIP, Address: "198.51.100.1"},
+		}},
+	}
+	r := &TunnelController{NodeName: "node-1", ClientSet: k8sfake.NewSimpleClientset(loadBalancer, nodePort, node)}
+	tests := []struct {
+		config  policyv1.PublicEndpointConfig
+		address string
+		port    int32
+	}{
+		//without configuration the address of the node is used
+		{policyv1.PublicEndpointConfig{}, "", 0},
+		{policyv1.PublicEndpointConfig{Address: "203.0.113.7"}, "203.0.113.7", liqonet.TunnelPort},
+		{policyv1.PublicEndpointConfig{Address: "203.0.113.7", Port: 4500}, "203.0.113.7", 4500},
+		{policyv1.PublicEndpointConfig{Service: &policyv1.ServiceReference{Namespace: "liqo", Name: "gateway-lb"}}, "203.0.113.10", 5871},
+		{policyv1.PublicEndpointConfig{Service: &policyv1.ServiceReference{Namespace: "liqo", Name: "gateway-np"}}, "198.51.100.1", 31820},
+	}
+	for _, test := range tests {
+		address, port, err := r.resolvePublicEndpoint(test.config)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, test.address, address)
+		assert.Equal(t, test.port, port)
+	}
+	_, _, err := r.resolvePublicEndpoint(policyv1.PublicEndpointConfig{Service: &policyv1.ServiceReference{Namespace: "liqo", Name: "missing"}})
+	assert.NotNil(t, err, "error should not be nil, the service does not exist")
+}
+
+func TestResolvePublicEndpointStun(t *testing.T) {
+	//the STUN server replies with the port the NAT maps the local port to, which differs from it
+	server, err := liqonet.NewMockStunServer(net.ParseIP("203.0.113.7"), 40000)
+	assert.Nil(t, err, "error should be nil")
+	defer server.Close()
+	free, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err, "error should be nil")
+	localPort := stunLocalPort
+	defer func() { stunLocalPort = localPort }()
+	stunLocalPort = free.LocalAddr().(*net.UDPAddr).Port
+	assert.Nil(t, free.Close(), "error should be nil")
+
+	r := &TunnelController{Log: ctrl.Log.WithName("test")}
+	address, port, err := r.resolvePublicEndpoint(policyv1.PublicEndpointConfig{StunServers: []string{server.LocalAddr().String()}})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, "203.0.113.7", address)
+	assert.Equal(t, int32(40000), port, "the mapped port should be published")
+	assert.Equal(t, stunLocalPort, <-server.Sources, "the request should be sent from the tunnel port")
+
+	//the configured port takes precedence
+	_, port, err = r.resolvePublicEndpoint(policyv1.PublicEndpointConfig{StunServers: []string{server.LocalAddr().String()}, Port: 4500})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, int32(4500), port)
+}
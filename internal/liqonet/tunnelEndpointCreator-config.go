@@ -38,9 +38,33 @@ func (r *TunnelEndpointCreator) GetConfiguration(config *policyv1.ClusterConfig)
 	if !correctlyParsed {
 		return nil, fmt.Errorf("the reserved subnets list is not in the correct format")
 	}
+	//the pod CIDRs and the service CIDR of the local cluster are always reserved
+	for _, localCIDR := range append([]string{liqonetConfig.ServiceCIDR}, r.PodCIDRs...) {
+		if _, sn, err := net.ParseCIDR(localCIDR); err == nil {
+			reservedSubnets[sn.String()] = sn
+		}
+	}
 	return reservedSubnets, nil
 }
 
+//it returns the pools the subnets used to remap the foreign clusters are allocated from
+func (r *TunnelEndpointCreator) GetAddressPools(config *policyv1.ClusterConfig) ([]liqonetOperator.AddressPool, error) {
+	var pools []liqonetOperator.AddressPool
+	for _, pool := range config.Spec.LiqonetConfig.AddressPools {
+		_, network, err := net.ParseCIDR(pool.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("the address pool %s is not in the correct format: %s", pool.CIDR, err)
+		}
+		ones, bits := network.Mask.Size()
+		if int(pool.PrefixLength) < ones || int(pool.PrefixLength) > bits {
+			return nil, fmt.Errorf("the prefix length %d is not valid for the address pool %s", pool.PrefixLength, network.String())
+		}
+		klog.Infof("address pool %s with prefix length %d correctly added", network.String(), pool.PrefixLength)
+		pools = append(pools, liqonetOperator.AddressPool{Network: network, PrefixLength: int(pool.PrefixLength)})
+	}
+	return pools, nil
+}
+
 //it returns the subnets used by the foreign clusters
 //get the list of all tunnelEndpoint CR and saves the address space assigned to the
 //foreign cluster.
@@ -87,51 +111,91 @@ func (r *TunnelEndpointCreator) GetClustersSubnets() (map[string]*net.IPNet, err
 			subnets[sn.String()] = sn
 			klog.Infof("subnet %s already reserved for cluster %s", tunEnd.Spec.PodCIDR, tunEnd.Spec.ClusterID)
 		}
+		//the subnet the service CIDR of the cluster is reached at
+		serviceCIDR := tunEnd.Status.RemoteRemappedServiceCIDR
+		if serviceCIDR == defualtPodCIDRValue {
+			serviceCIDR = tunEnd.Spec.ServiceCIDR
+		}
+		if serviceCIDR != "" {
+			_, sn, err := net.ParseCIDR(serviceCIDR)
+			if err != nil {
+				klog.Errorf("an error occurred while parsing the following cidr %s: %s", serviceCIDR, err)
+				return nil, err
+			}
+			subnets[sn.String()] = sn
+			klog.Infof("subnet %s already reserved for the services of cluster %s", serviceCIDR, tunEnd.Spec.ClusterID)
+		}
+		for _, podCIDR := range tunEnd.Status.AdditionalPodCIDRs {
+			_, sn, err := net.ParseCIDR(podCIDR)
+			if err != nil {
+				klog.Errorf("an error occurred while parsing the following cidr %s: %s", podCIDR, err)
+				return nil, err
+			}
+			subnets[sn.String()] = sn
+			klog.Infof("subnet %s already reserved for the pods of cluster %s", podCIDR, tunEnd.Spec.ClusterID)
+		}
+		//the subnets the clusters reached through the cluster are reached at
+		for _, route := range tunEnd.Status.TransitRoutes {
+			podCIDR := liqonetOperator.GetTransitPodCIDR(route)
+			_, sn, err := net.ParseCIDR(podCIDR)
+			if err != nil {
+				klog.Errorf("an error occurred while parsing the following cidr %s: %s", podCIDR, err)
+				return nil, err
+			}
+			subnets[sn.String()] = sn
+			klog.Infof("subnet %s already reserved for cluster %s reached through cluster %s", podCIDR, route.ClusterID, tunEnd.Spec.ClusterID)
+		}
 	}
 	return subnets, nil
 }
 
 func (r *TunnelEndpointCreator) InitConfiguration(reservedSubnets map[string]*net.IPNet, clusterSubnets map[string]*net.IPNet) error {
-	var isError = false
+	//here we acquire the lock of the mutex
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+	//the IPAM is initialized first, in order to restore the subnets allocated before a restart
+	if err := r.IPManager.Init(); err != nil {
+		klog.Errorf("an error occurred while initializing the IP manager -> %s", err)
+		return err
+	}
+	usedSubnets := make(map[string]*net.IPNet)
+	for _, value := range clusterSubnets {
+		usedSubnets[value.String()] = value
+	}
+	for _, value := range r.IPManager.SubnetPerCluster {
+		usedSubnets[value.String()] = value
+	}
 	//here we check that there are no conflicts between the configuration and the already used subnets
-	for _, usedSubnet := range clusterSubnets {
+	var isError = false
+	for _, usedSubnet := range usedSubnets {
 		if liqonetOperator.VerifyNoOverlap(reservedSubnets, usedSubnet) {
 			klog.Infof("there is a conflict between a reserved subnet given by the configuration and subnet used by another cluster. Please consider to remove the one of the conflicting subnets")
 			isError = true
 		}
 	}
-	//if no conflicts or errors occurred then we start the IPAM
-	if !isError {
-		//here we acquire the lock of the mutex
-		r.Mutex.Lock()
-		defer r.Mutex.Unlock()
-		if err := r.IPManager.Init(); err != nil {
-			klog.Errorf("an error occurred while initializing the IP manager -> err")
-			return err
-		}
-		//here we populate the used subnets with the reserved subnets and the subnets used by clusters
-		for _, value := range reservedSubnets {
-			r.IPManager.UsedSubnets[value.String()] = value
-		}
+	if isError {
+		return fmt.Errorf("there are conflicts between the reserved subnets given in the configuration and the already used subnets in the tunnelEndpoint CRs")
+	}
+	//if no conflicts or errors occurred then we populate the used subnets with the reserved subnets and the subnets used by clusters
+	for _, value := range reservedSubnets {
+		r.IPManager.UsedSubnets[value.String()] = value
+	}
 
-		for _, value := range clusterSubnets {
-			r.IPManager.UsedSubnets[value.String()] = value
-		}
+	for _, value := range usedSubnets {
+		r.IPManager.UsedSubnets[value.String()] = value
+	}
 
-		//we remove all the free subnets that have conflicts with the used subnets
-		for _, subnet := range r.IPManager.FreeSubnets {
-			if ovelaps := liqonetOperator.VerifyNoOverlap(r.IPManager.UsedSubnets, subnet); ovelaps {
-				delete(r.IPManager.FreeSubnets, subnet.String())
-				//we add it to a new map, if the reserved ip is removed from the config then the conflicting subnets can be inserted in the free pool of subnets
-				r.IPManager.ConflictingSubnets[subnet.String()] = subnet
-				klog.Infof("removing subnet %s from the free pool", subnet.String())
-			}
+	//we remove all the free subnets that have conflicts with the used subnets
+	for _, subnet := range r.IPManager.FreeSubnets {
+		if ovelaps := liqonetOperator.VerifyNoOverlap(r.IPManager.UsedSubnets, subnet); ovelaps {
+			delete(r.IPManager.FreeSubnets, subnet.String())
+			//we add it to a new map, if the reserved ip is removed from the config then the conflicting subnets can be inserted in the free pool of subnets
+			r.IPManager.ConflictingSubnets[subnet.String()] = subnet
+			klog.Infof("removing subnet %s from the free pool", subnet.String())
 		}
-		r.IsConfigured = true
-		r.ReservedSubnets = reservedSubnets
-	} else {
-		return fmt.Errorf("there are conflicts between the reserved subnets given in the configuration and the already used subnets in the tunnelEndpoint CRs")
 	}
+	r.IsConfigured = true
+	r.ReservedSubnets = reservedSubnets
 	return nil
 }
 
@@ -235,6 +299,13 @@ func (r *TunnelEndpointCreator) WatchConfiguration(config *rest.Config, gv *sche
 				klog.Error(err)
 				return
 			}
+			//get the pools the subnets are allocated from
+			pools, err := r.GetAddressPools(configuration)
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			r.IPManager.Pools = pools
 			//get subnets used by foreign clusters
 			clusterSubnets, err := r.GetClustersSubnets()
 			if err != nil {
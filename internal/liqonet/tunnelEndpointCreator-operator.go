@@ -19,12 +19,15 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/liqoTech/liqo/pkg/clusterID"
 	liqonetOperator "github.com/liqoTech/liqo/pkg/liqonet"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog"
 	"net"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,6 +42,10 @@ import (
 const (
 	tunEndpointNameSuffix = "-tunendpoint"
 	defualtPodCIDRValue   = "None"
+	//the subnet used to remap the service CIDR of a cluster is reserved with the clusterID plus this suffix as key
+	serviceSubnetSuffix = "-services"
+	//the additional pod CIDRs of a cluster are reserved with the clusterID plus this infix plus the CIDR as key
+	additionalPodSubnetInfix = "-pods-"
 )
 
 // AdvertisementReconciler reconciles a Advertisement object
@@ -52,6 +59,13 @@ type TunnelEndpointCreator struct {
 	IsConfigured    bool
 	Configured      chan bool
 	RetryTimeout    time.Duration
+	//the pod CIDRs of the local cluster, reserved so that the ones of the peering clusters overlapping with them
+	//are remapped
+	PodCIDRs []string
+	//the ID of the local cluster, the routes toward it advertised by the peering clusters are ignored
+	ClusterID *clusterID.ClusterID
+	//the routing table allocated to each remote cluster
+	routingTables map[string]int
 }
 
 // +kubebuilder:rbac:groups=protocol.liqo.io,resources=advertisements,verbs=get;list;watch;create;update;patch;delete
@@ -60,13 +74,11 @@ type TunnelEndpointCreator struct {
 //rbac for the liqonet.liqo.io api
 // +kubebuilder:rbac:groups=liqonet.liqo.io,resources=tunnelendpoints,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=liqonet.liqo.io,resources=tunnelendpoints/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=liqonet.liqo.io,resources=ipamstorages,verbs=get;list;watch;create;update
 
 func (r *TunnelEndpointCreator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	//wait for the configuration to be completed
-	if !r.IsConfigured {
-		<-r.Configured
-		klog.Info("from reconciler configured")
-	}
+	r.waitConfiguration()
 	ctx := context.Background()
 	log := r.Log.WithValues("tunnelEndpointCreator-controller", req.NamespacedName)
 	tunnelEndpointCreatorFinalizer := "tunnelEndpointCreator-Finalizer.liqonet.liqo.io"
@@ -117,8 +129,14 @@ func (r *TunnelEndpointCreator) Reconcile(req ctrl.Request) (ctrl.Result, error)
 				return ctrl.Result{RequeueAfter: r.RetryTimeout}, err
 			}
 		}
-		//remove the reserved ip for the cluster
-		r.IPManager.RemoveReservedSubnet(adv.Spec.ClusterId)
+		//remove the reserved ip for the cluster, unless its network has been negotiated through the NetworkConfigs
+		if tunEndpoint, err := r.GetTunEndPerADV(&adv); err != nil || !isTunEndpointOwnedByNetworkConfig(&tunEndpoint) {
+			r.IPManager.RemoveReservedSubnet(adv.Spec.ClusterId)
+			r.IPManager.RemoveReservedSubnet(adv.Spec.ClusterId + serviceSubnetSuffix)
+			r.releaseSubnets(adv.Spec.ClusterId+additionalPodSubnetInfix, nil)
+			r.releaseSubnets(adv.Spec.ClusterId+liqonetOperator.TransitSubnetInfix, nil)
+			r.releaseRoutingTable(adv.Spec.ClusterId)
+		}
 		return ctrl.Result{RequeueAfter: r.RetryTimeout}, nil
 	}
 
@@ -152,16 +170,33 @@ func (r *TunnelEndpointCreator) GetTunEndPerADV(adv *protocolv1.Advertisement) (
 }
 
 func (r *TunnelEndpointCreator) isTunEndpointUpdated(adv *protocolv1.Advertisement, tunEndpoint *liqonetv1.TunnelEndpoint) bool {
-	if adv.Spec.ClusterId == tunEndpoint.Spec.ClusterID && adv.Spec.Network.PodCIDR == tunEndpoint.Spec.PodCIDR && adv.Spec.Network.GatewayIP == tunEndpoint.Spec.TunnelPublicIP && adv.Spec.Network.GatewayPrivateIP == tunEndpoint.Spec.TunnelPrivateIP {
+	if adv.Spec.ClusterId == tunEndpoint.Spec.ClusterID && adv.Spec.Network.PodCIDR == tunEndpoint.Spec.PodCIDR && adv.Spec.Network.GatewayIP == tunEndpoint.Spec.TunnelPublicIP && adv.Spec.Network.GatewayPrivateIP == tunEndpoint.Spec.TunnelPrivateIP &&
+		reflect.DeepEqual(adv.Spec.Network.SupportedProtocols, tunEndpoint.Spec.SupportedProtocols) && adv.Spec.Network.TunnelPublicKey == tunEndpoint.Spec.TunnelPublicKey &&
+		adv.Spec.Network.GatewayPort == tunEndpoint.Spec.TunnelPublicPort && adv.Spec.Network.ServiceCIDR == tunEndpoint.Spec.ServiceCIDR &&
+		reflect.DeepEqual(adv.Spec.Network.AdditionalPodCIDRs, tunEndpoint.Spec.AdditionalPodCIDRs) &&
+		reflect.DeepEqual(adv.Spec.Network.Neighbors, tunEndpoint.Spec.Neighbors) {
 		return true
 	} else {
 		return false
 	}
 }
 
+//waits for the IPAM to be configured, the signal is sent again for the other controllers sharing it
+func (r *TunnelEndpointCreator) waitConfiguration() {
+	if !r.IsConfigured {
+		configured := <-r.Configured
+		r.Configured <- configured
+		klog.Info("from reconciler configured")
+	}
+}
+
 func (r *TunnelEndpointCreator) createOrUpdateTunEndpoint(adv *protocolv1.Advertisement) error {
-	_, err := r.GetTunEndPerADV(adv)
+	tunEndpoint, err := r.GetTunEndPerADV(adv)
 	if err == nil {
+		//the endpoint has been created from the NetworkConfigs exchanged with the cluster, which drive its updates
+		if isTunEndpointOwnedByNetworkConfig(&tunEndpoint) {
+			return nil
+		}
 		err := r.updateTunEndpoint(adv)
 		if err == nil {
 			return nil
@@ -199,6 +234,17 @@ func (r *TunnelEndpointCreator) updateTunEndpoint(adv *protocolv1.Advertisement)
 	if err != nil {
 		return err
 	}
+	if err := r.syncTunEndpointSpec(&tunEndpoint, liqonetv1.TunnelEndpointSpec{
+		TunnelPublicIP:     adv.Spec.Network.GatewayIP,
+		TunnelPublicPort:   adv.Spec.Network.GatewayPort,
+		TunnelPublicKey:    adv.Spec.Network.TunnelPublicKey,
+		SupportedProtocols: adv.Spec.Network.SupportedProtocols,
+		ServiceCIDR:        adv.Spec.Network.ServiceCIDR,
+		AdditionalPodCIDRs: adv.Spec.Network.AdditionalPodCIDRs,
+		Neighbors:          adv.Spec.Network.Neighbors,
+	}); err != nil {
+		return err
+	}
 
 	if tunEndpoint.Status.Phase == "" {
 		//check if the PodCidr of the remote cluster overlaps with any of the subnets on the local cluster
@@ -260,6 +306,290 @@ func (r *TunnelEndpointCreator) updateTunEndpoint(adv *protocolv1.Advertisement)
 	}
 }
 
+//updates the endpoint of the remote gateway, the service CIDR, the additional pod CIDRs and the neighbors of the remote
+//cluster, which can change while the clusters are peered, remaps the service CIDR if needed, reserves the additional
+//pod CIDRs and chooses the clusters reached through the remote cluster
+func (r *TunnelEndpointCreator) syncTunEndpointSpec(tunEndpoint *liqonetv1.TunnelEndpoint, spec liqonetv1.TunnelEndpointSpec) error {
+	ctx := context.Background()
+	//the remote gateway can change, e.g. when the active one fails, the tunnel-operator re-establishes
+	//the tunnel when the new endpoint is set in the spec
+	if spec.TunnelPublicIP != tunEndpoint.Spec.TunnelPublicIP || spec.TunnelPublicKey != tunEndpoint.Spec.TunnelPublicKey ||
+		!reflect.DeepEqual(spec.SupportedProtocols, tunEndpoint.Spec.SupportedProtocols) ||
+		spec.TunnelPublicPort != tunEndpoint.Spec.TunnelPublicPort {
+		tunEndpoint.Spec.TunnelPublicIP = spec.TunnelPublicIP
+		tunEndpoint.Spec.TunnelPublicPort = spec.TunnelPublicPort
+		tunEndpoint.Spec.TunnelPublicKey = spec.TunnelPublicKey
+		tunEndpoint.Spec.SupportedProtocols = spec.SupportedProtocols
+		if err := r.Update(ctx, tunEndpoint); err != nil {
+			return err
+		}
+	}
+	//the table is allocated before the remapped networks are routed through it
+	if err := r.allocateRoutingTable(tunEndpoint); err != nil {
+		return err
+	}
+	//the remote cluster can start or stop exposing its services, or change their CIDR
+	if spec.ServiceCIDR != tunEndpoint.Spec.ServiceCIDR {
+		tunEndpoint.Spec.ServiceCIDR = spec.ServiceCIDR
+		if err := r.Update(ctx, tunEndpoint); err != nil {
+			return err
+		}
+		if tunEndpoint.Status.RemoteRemappedServiceCIDR != "" {
+			r.Mutex.Lock()
+			r.IPManager.RemoveReservedSubnet(tunEndpoint.Spec.ClusterID + serviceSubnetSuffix)
+			r.Mutex.Unlock()
+			tunEndpoint.Status.RemoteRemappedServiceCIDR = ""
+			if err := r.Status().Update(ctx, tunEndpoint); err != nil {
+				return err
+			}
+		}
+		if err := r.remapServiceCIDR(tunEndpoint); err != nil {
+			return err
+		}
+		//the route-operators have to install again the routes toward the services
+		tunEndpoint.ObjectMeta.SetLabels(liqonetOperator.RemoveRouteOperatorLabels(tunEndpoint.ObjectMeta.GetLabels()))
+		if err := r.Update(ctx, tunEndpoint); err != nil {
+			return err
+		}
+	}
+	//the remote cluster can add or remove pod CIDRs, e.g. when a new IP pool is created
+	if !reflect.DeepEqual(spec.AdditionalPodCIDRs, tunEndpoint.Spec.AdditionalPodCIDRs) {
+		tunEndpoint.Spec.AdditionalPodCIDRs = spec.AdditionalPodCIDRs
+		if err := r.Update(ctx, tunEndpoint); err != nil {
+			return err
+		}
+	}
+	//the clusters reached by the remote cluster change as it peers with other clusters
+	if !reflect.DeepEqual(spec.Neighbors, tunEndpoint.Spec.Neighbors) {
+		tunEndpoint.Spec.Neighbors = spec.Neighbors
+		if err := r.Update(ctx, tunEndpoint); err != nil {
+			return err
+		}
+	}
+	if err := r.remapServiceCIDR(tunEndpoint); err != nil {
+		return err
+	}
+	if err := r.reserveAdditionalPodCIDRs(tunEndpoint); err != nil {
+		return err
+	}
+	return r.setTransitRoutes(tunEndpoint)
+}
+
+//each remote cluster gets the lowest routing table not used by the other ones, the mark of the traffic toward its
+//remapped networks is derived from it. The tables allocated before a restart are restored from the endpoints
+func (r *TunnelEndpointCreator) allocateRoutingTable(tunEndpoint *liqonetv1.TunnelEndpoint) error {
+	ctx := context.Background()
+	clusterID := tunEndpoint.Spec.ClusterID
+	r.Mutex.Lock()
+	if r.routingTables == nil {
+		var tunEndList liqonetv1.TunnelEndpointList
+		if err := r.List(ctx, &tunEndList); err != nil {
+			r.Mutex.Unlock()
+			return fmt.Errorf("unable to list the tunnel endpoints: %v", err)
+		}
+		r.routingTables = make(map[string]int)
+		for _, tep := range tunEndList.Items {
+			if tep.Status.RoutingTable != 0 {
+				r.routingTables[tep.Spec.ClusterID] = tep.Status.RoutingTable
+			}
+		}
+	}
+	table, ok := r.routingTables[clusterID]
+	if !ok {
+		used := make(map[int]bool)
+		for _, t := range r.routingTables {
+			used[t] = true
+		}
+		table = 1
+		for used[table] {
+			table++
+		}
+		r.routingTables[clusterID] = table
+	}
+	r.Mutex.Unlock()
+	if tunEndpoint.Status.RoutingTable == table {
+		return nil
+	}
+	tunEndpoint.Status.RoutingTable = table
+	return r.Status().Update(ctx, tunEndpoint)
+}
+
+//releases the routing table of the remote cluster. The caller has to hold the mutex
+func (r *TunnelEndpointCreator) releaseRoutingTable(clusterID string) {
+	delete(r.routingTables, clusterID)
+}
+
+//the service CIDR of the remote cluster, if exposed, is remapped as its pod CIDR when it overlaps with the local subnets
+//or with the ones of the other peering clusters
+func (r *TunnelEndpointCreator) remapServiceCIDR(tunEndpoint *liqonetv1.TunnelEndpoint) error {
+	if tunEndpoint.Spec.ServiceCIDR == "" || tunEndpoint.Status.RemoteRemappedServiceCIDR != "" {
+		return nil
+	}
+	_, subnet, err := net.ParseCIDR(tunEndpoint.Spec.ServiceCIDR)
+	if err != nil {
+		return fmt.Errorf("an error occured while parsing serviceCidr %s from tunnelEndpoint %s :%v", tunEndpoint.Spec.ServiceCIDR, tunEndpoint.Name, err)
+	}
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+	subnet, err = r.IPManager.GetNewSubnetPerCluster(subnet, tunEndpoint.Spec.ClusterID+serviceSubnetSuffix)
+	if err != nil {
+		return err
+	}
+	if subnet != nil {
+		tunEndpoint.Status.RemoteRemappedServiceCIDR = subnet.String()
+	} else {
+		tunEndpoint.Status.RemoteRemappedServiceCIDR = defualtPodCIDRValue
+	}
+	return r.Status().Update(context.Background(), tunEndpoint)
+}
+
+//the additional pod CIDRs of the remote cluster are not remapped: they are reserved as they are, and the ones
+//overlapping with the local subnets or with the ones of the other peering clusters are left out. The accepted ones are
+//published in the status of the endpoint, and the route-operators install the routes toward them
+func (r *TunnelEndpointCreator) reserveAdditionalPodCIDRs(tunEndpoint *liqonetv1.TunnelEndpoint) error {
+	ctx := context.Background()
+	clusterID := tunEndpoint.Spec.ClusterID
+	keys := make(map[string]bool)
+	var accepted, rejected []string
+	r.Mutex.Lock()
+	for _, cidr := range tunEndpoint.Spec.AdditionalPodCIDRs {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			rejected = append(rejected, cidr)
+			continue
+		}
+		key := clusterID + additionalPodSubnetInfix + subnet.String()
+		keys[key] = true
+		if err := r.IPManager.ReserveSubnetPerCluster(subnet, key); err != nil {
+			rejected = append(rejected, cidr)
+			continue
+		}
+		accepted = append(accepted, subnet.String())
+	}
+	r.releaseSubnets(clusterID+additionalPodSubnetInfix, keys)
+	r.Mutex.Unlock()
+	if reflect.DeepEqual(accepted, tunEndpoint.Status.AdditionalPodCIDRs) {
+		return nil
+	}
+	if len(rejected) > 0 {
+		r.Log.Info("the additional pod CIDRs overlapping with the subnets in use are not routed", "clusterId", clusterID, "podCIDRs", rejected)
+	}
+	tunEndpoint.Status.AdditionalPodCIDRs = accepted
+	if err := r.Status().Update(ctx, tunEndpoint); err != nil {
+		return err
+	}
+	//the route-operators have to install again the routes toward the pods
+	tunEndpoint.ObjectMeta.SetLabels(liqonetOperator.RemoveRouteOperatorLabels(tunEndpoint.ObjectMeta.GetLabels()))
+	return r.Update(ctx, tunEndpoint)
+}
+
+//releases the subnets reserved with a key starting with the prefix, except the ones whose key is kept. The caller has
+//to hold the mutex
+func (r *TunnelEndpointCreator) releaseSubnets(prefix string, kept map[string]bool) {
+	for key := range r.IPManager.SubnetPerCluster {
+		if strings.HasPrefix(key, prefix) && !kept[key] {
+			r.IPManager.RemoveReservedSubnet(key)
+		}
+	}
+}
+
+//the clusters advertised as neighbors by the remote cluster are reached through it, unless they are directly peered
+//with the local cluster or too far. When several peering clusters reach the same cluster the one with fewer hops is
+//chosen, the one with the lower clusterID in case of a tie, so that the choice does not depend on the order the
+//endpoints are processed in. The pod CIDRs of the reached clusters are remapped as the ones of the peering clusters
+//when they overlap with the local subnets; the routes are published in the status of the endpoint, and the
+//route-operators install them
+func (r *TunnelEndpointCreator) setTransitRoutes(tunEndpoint *liqonetv1.TunnelEndpoint) error {
+	ctx := context.Background()
+	clusterID := tunEndpoint.Spec.ClusterID
+	var tunEndList liqonetv1.TunnelEndpointList
+	if err := r.List(ctx, &tunEndList); err != nil {
+		return fmt.Errorf("unable to get the list of tunnelEndpoint custom resources: %v", err)
+	}
+	peered := make(map[string]bool, len(tunEndList.Items))
+	for _, tep := range tunEndList.Items {
+		peered[tep.Spec.ClusterID] = true
+	}
+	previous := make(map[string]liqonetv1.TransitRoute, len(tunEndpoint.Status.TransitRoutes))
+	for _, route := range tunEndpoint.Status.TransitRoutes {
+		previous[route.ClusterID] = route
+	}
+	localClusterID := r.getLocalClusterID()
+	keys := make(map[string]bool)
+	var routes []liqonetv1.TransitRoute
+	r.Mutex.Lock()
+	for _, neighbor := range tunEndpoint.Spec.Neighbors {
+		if neighbor.ClusterID == localClusterID || peered[neighbor.ClusterID] || neighbor.Hops < 1 ||
+			neighbor.Hops+1 > liqonetOperator.MaxTransitHops || !isBestNextHop(clusterID, neighbor, tunEndList.Items) {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(neighbor.PodCIDR)
+		if err != nil {
+			r.Log.Info("the pod CIDR of the neighbor is not valid", "clusterId", clusterID, "neighbor", neighbor.ClusterID, "podCIDR", neighbor.PodCIDR)
+			continue
+		}
+		key := clusterID + liqonetOperator.TransitSubnetInfix + neighbor.ClusterID
+		//the subnet reserved for the previous pod CIDR of the neighbor is not valid anymore
+		if route, ok := previous[neighbor.ClusterID]; ok && route.PodCIDR != subnet.String() {
+			r.IPManager.RemoveReservedSubnet(key)
+		}
+		remapped, err := r.IPManager.GetNewSubnetPerCluster(subnet, key)
+		if err != nil {
+			r.Log.Error(err, "unable to reserve a subnet for the neighbor", "clusterId", clusterID, "neighbor", neighbor.ClusterID)
+			continue
+		}
+		keys[key] = true
+		route := liqonetv1.TransitRoute{
+			ClusterID:       neighbor.ClusterID,
+			PodCIDR:         subnet.String(),
+			RemappedPodCIDR: defualtPodCIDRValue,
+			Hops:            neighbor.Hops + 1,
+		}
+		if remapped != nil {
+			route.RemappedPodCIDR = remapped.String()
+		}
+		routes = append(routes, route)
+	}
+	r.releaseSubnets(clusterID+liqonetOperator.TransitSubnetInfix, keys)
+	r.Mutex.Unlock()
+	if reflect.DeepEqual(routes, tunEndpoint.Status.TransitRoutes) {
+		return nil
+	}
+	r.Log.Info("clusters reached through the remote cluster changed", "clusterId", clusterID, "routes", routes)
+	tunEndpoint.Status.TransitRoutes = routes
+	if err := r.Status().Update(ctx, tunEndpoint); err != nil {
+		return err
+	}
+	//the route-operators have to install again the routes toward the neighbors
+	tunEndpoint.ObjectMeta.SetLabels(liqonetOperator.RemoveRouteOperatorLabels(tunEndpoint.ObjectMeta.GetLabels()))
+	return r.Update(ctx, tunEndpoint)
+}
+
+//returns true if no other peering cluster reaches the neighbor with fewer hops, or with the same hops and a lower
+//clusterID
+func isBestNextHop(clusterID string, neighbor liqonetv1.NeighborNetwork, tunEndpoints []liqonetv1.TunnelEndpoint) bool {
+	for _, tep := range tunEndpoints {
+		if tep.Spec.ClusterID == clusterID {
+			continue
+		}
+		for _, other := range tep.Spec.Neighbors {
+			if other.ClusterID == neighbor.ClusterID && other.Hops >= 1 &&
+				(other.Hops < neighbor.Hops || (other.Hops == neighbor.Hops && tep.Spec.ClusterID < clusterID)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//returns the ID of the local cluster, empty if it is not known yet
+func (r *TunnelEndpointCreator) getLocalClusterID() string {
+	if r.ClusterID == nil {
+		return ""
+	}
+	return r.ClusterID.GetClusterID()
+}
+
 //we do not support updates to the ADV CR by the user, at least not yet
 //we assume that the ADV is created by the Remote Server and is the only one who can remove or update it
 //if the ADV has to be updated first we remove it and then recreate the it with new values
@@ -296,6 +626,13 @@ func (r *TunnelEndpointCreator) CreateTunEndpoint(adv *protocolv1.Advertisement)
 				PodCIDR:         adv.Spec.Network.PodCIDR,
 				TunnelPublicIP:  adv.Spec.Network.GatewayIP,
 				TunnelPrivateIP: adv.Spec.Network.GatewayPrivateIP,
+				//the tunnel protocol is chosen by the tunnel-operator among the ones supported by the remote gateway
+				SupportedProtocols: adv.Spec.Network.SupportedProtocols,
+				TunnelPublicKey:    adv.Spec.Network.TunnelPublicKey,
+				TunnelPublicPort:   adv.Spec.Network.GatewayPort,
+				ServiceCIDR:        adv.Spec.Network.ServiceCIDR,
+				AdditionalPodCIDRs: adv.Spec.Network.AdditionalPodCIDRs,
+				Neighbors:          adv.Spec.Network.Neighbors,
 			},
 			Status: liqonetv1.TunnelEndpointStatus{},
 		}
@@ -332,6 +669,9 @@ func (r *TunnelEndpointCreator) deleteTunEndpoint(adv *protocolv1.Advertisement)
 	err := r.Get(ctx, tunEndKey, &tunEndpoint)
 	//if the CR exist then do nothing and return
 	if err == nil {
+		if isTunEndpointOwnedByNetworkConfig(&tunEndpoint) {
+			return nil
+		}
 		err := r.Delete(ctx, &tunEndpoint)
 		if err != nil {
 			return fmt.Errorf("unable to delete endpoint %s in namespace %s : %v", tunEndpoint.Name, tunEndpoint.Namespace, err)
@@ -24,14 +24,12 @@ func (r *PeeringRequestReconciler) BroadcasterExists(request *discoveryv1.Peerin
 	return true, nil
 }
 
-func GetBroadcasterDeployment(request *discoveryv1.PeeringRequest, nameSA string, namespace string, image string, clusterId string, gatewayPrivateIP string) appsv1.Deployment {
+func GetBroadcasterDeployment(request *discoveryv1.PeeringRequest, nameSA string, namespace string, image string, clusterId string) appsv1.Deployment {
 	args := []string{
 		"--peering-request",
 		request.Name,
 		"--cluster-id",
 		clusterId,
-		"--gateway-private-ip",
-		gatewayPrivateIP,
 		"--service-account",
 		nameSA, //TODO: using this SA, we pass to the foreign cluster a kubeconfig with the same permissions of the broadcaster deployment; if we want to pass a different one we have to forge it
 	}
@@ -2,6 +2,7 @@ package peering_request_operator
 
 import (
 	discoveryv1 "github.com/liqoTech/liqo/api/discovery/v1"
+	garbage_collector "github.com/liqoTech/liqo/internal/garbage-collector"
 	"github.com/liqoTech/liqo/pkg/clusterID"
 	"github.com/liqoTech/liqo/pkg/crdClient"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -65,7 +66,11 @@ func StartOperator(namespace string, configMapName string, broadcasterImage stri
 	}
 	// +kubebuilder:scaffold:builder
 
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	stop := ctrl.SetupSignalHandler()
+	gc := garbage_collector.NewProviderGarbageCollector(client, garbage_collector.DefaultGracePeriod)
+	go gc.Start(garbage_collector.DefaultPeriod, stop)
+
+	if err := mgr.Start(stop); err != nil {
 		klog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,93 @@
+package liqonet
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"net"
+	"strings"
+)
+
+//IsIPv6 returns true if the address is an IPv6 address, the IPv4 addresses in the IPv6 form are IPv4 addresses
+func IsIPv6(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil
+}
+
+//IsIPv6String returns true if the string is an IPv6 address or an IPv6 network in CIDR notation
+func IsIPv6String(address string) bool {
+	if ip, _, err := net.ParseCIDR(address); err == nil {
+		return IsIPv6(ip)
+	}
+	return IsIPv6(net.ParseIP(address))
+}
+
+//GetFamily returns the netlink family of the address
+func GetFamily(ip net.IP) int {
+	if IsIPv6(ip) {
+		return netlink.FAMILY_V6
+	}
+	return netlink.FAMILY_V4
+}
+
+//HostMask returns the mask of a network containing only the given address: /32 for IPv4, /128 for IPv6
+func HostMask(ip net.IP) net.IPMask {
+	if IsIPv6(ip) {
+		return net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)
+	}
+	return net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)
+}
+
+//HostCIDR returns the network in CIDR notation containing only the given address
+func HostCIDR(address string) string {
+	ones, _ := HostMask(net.ParseIP(address)).Size()
+	return fmt.Sprintf("%s/%d", address, ones)
+}
+
+//ReplaceNetworkPrefix returns the address in the network with the host part of the given address, e.g. 10.1.2.3
+//in 192.168.200.0/24 becomes 192.168.200.3. When the families differ the last bytes of the address are used
+func ReplaceNetworkPrefix(network *net.IPNet, ip net.IP) (net.IP, error) {
+	prefix := network.IP
+	if v4 := prefix.To4(); v4 != nil && len(network.Mask) == net.IPv4len {
+		prefix = v4
+	}
+	if len(prefix) != len(network.Mask) {
+		return nil, fmt.Errorf("the network %s is not valid", network.String())
+	}
+	host := ip.To4()
+	if host == nil {
+		host = ip.To16()
+	}
+	if host == nil {
+		return nil, fmt.Errorf("the address %s is not valid", ip.String())
+	}
+	//the address is aligned to the end of the network
+	offset := len(prefix) - len(host)
+	result := make(net.IP, len(prefix))
+	for i := range prefix {
+		var hostByte byte
+		if i-offset >= 0 && i-offset < len(host) {
+			hostByte = host[i-offset]
+		}
+		result[i] = prefix[i]&network.Mask[i] | hostByte&^network.Mask[i]
+	}
+	return result, nil
+}
+
+//getAddressesFamily returns whether the addresses in the list, in CIDR notation or not, are IPv6 addresses.
+//It returns an error if the list contains addresses of both the families, and false if it contains no addresses
+func getAddressesFamily(addresses []string) (ipv6, found bool, err error) {
+	for _, address := range addresses {
+		address = strings.TrimPrefix(address, "!")
+		ip := net.ParseIP(address)
+		if i, _, err := net.ParseCIDR(address); err == nil {
+			ip = i
+		}
+		if ip == nil {
+			continue
+		}
+		if found && IsIPv6(ip) != ipv6 {
+			return false, false, fmt.Errorf("the addresses %v belong to different families", addresses)
+		}
+		ipv6, found = IsIPv6(ip), true
+	}
+	return ipv6, found, nil
+}
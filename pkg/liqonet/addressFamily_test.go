@@ -0,0 +1,61 @@
+package liqonet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestReplaceNetworkPrefix(t *testing.T) {
+	tests := []struct {
+		network  string
+		ip       string
+		expected string
+	}{
+		{"192.168.200.0/24", "10.1.2.3", "192.168.200.3"},
+		{"10.96.0.0/16", "10.0.20.35", "10.96.20.35"},
+		{"fd00:10:1::/48", "fd00:20::1:2", "fd00:10:1::1:2"},
+		{"fd00:200::/64", "10.1.2.3", "fd00:200::a01:203"},
+	}
+	for _, test := range tests {
+		_, network, err := net.ParseCIDR(test.network)
+		assert.Nil(t, err, "should be nil")
+		ip, err := ReplaceNetworkPrefix(network, net.ParseIP(test.ip))
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, test.expected, ip.String(), "the host part of %s should be kept in %s", test.ip, test.network)
+	}
+	_, err := ReplaceNetworkPrefix(&net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(64, 128)}, net.ParseIP("10.0.0.1"))
+	assert.NotNil(t, err, "should not be nil, the network is not valid")
+}
+
+func TestHostCIDR(t *testing.T) {
+	assert.Equal(t, "10.0.0.1/32", HostCIDR("10.0.0.1"))
+	assert.Equal(t, "fd00::1/128", HostCIDR("fd00::1"))
+	assert.True(t, IsIPv6String("fd00::/64"))
+	assert.False(t, IsIPv6String("::ffff:10.0.0.1"), "the IPv4 addresses in the IPv6 form are IPv4 addresses")
+}
+
+func TestGetAddressesFamily(t *testing.T) {
+	ipv6, found, err := getAddressesFamily([]string{"-s", "10.0.0.0/16", "-d", "!10.1.0.0/16", "-j", "ACCEPT"})
+	assert.Nil(t, err, "should be nil")
+	assert.True(t, found)
+	assert.False(t, ipv6)
+	ipv6, found, err = getAddressesFamily([]string{"-d", "fd00::/64", "-j", "ACCEPT"})
+	assert.Nil(t, err, "should be nil")
+	assert.True(t, found)
+	assert.True(t, ipv6)
+	_, found, err = getAddressesFamily([]string{"-j", "ACCEPT"})
+	assert.Nil(t, err, "should be nil")
+	assert.False(t, found, "the rule does not contain addresses")
+	_, _, err = getAddressesFamily([]string{"-s", "10.0.0.0/16", "-d", "fd00::/64"})
+	assert.NotNil(t, err, "should not be nil, the addresses belong to different families")
+}
+
+func TestVerifyNoOverlapFamilies(t *testing.T) {
+	_, ipv4Net, _ := net.ParseCIDR("10.0.0.0/8")
+	_, ipv6Net, _ := net.ParseCIDR("::/0")
+	subnets := map[string]*net.IPNet{ipv4Net.String(): ipv4Net}
+	assert.False(t, VerifyNoOverlap(subnets, ipv6Net), "the networks of different families never overlap")
+	_, overlapping, _ := net.ParseCIDR("10.1.0.0/16")
+	assert.True(t, VerifyNoOverlap(subnets, overlapping))
+}
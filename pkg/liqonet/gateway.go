@@ -0,0 +1,108 @@
+package liqonet
+
+import (
+	"context"
+	"fmt"
+	"github.com/liqoTech/liqo/internal/errdefs"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"net"
+	"strings"
+)
+
+const (
+	//the nodes which can act as gateway, a tunnel-operator runs on each one of them
+	GatewayLabelKey = "liqonet.liqo.io/gateway"
+	//the gateway node where the tunnel-operator elected as leader runs, only one node at a time has it
+	ActiveGatewayLabelKey = "liqonet.liqo.io/gateway-active"
+)
+
+//GetActiveGateway returns the node currently acting as gateway. If no node has been marked as the active one, e.g.
+//the tunnel-operator has not been elected yet, the gateway node is returned only if it is the only one
+func GetActiveGateway(clientset kubernetes.Interface) (*corev1.Node, error) {
+	nodesList, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: ActiveGatewayLabelKey + "=true"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list nodes with label '%s=true': %v", ActiveGatewayLabelKey, err)
+	}
+	if len(nodesList.Items) > 1 {
+		return nil, fmt.Errorf("%d nodes are labeled as the active gateway", len(nodesList.Items))
+	} else if len(nodesList.Items) == 1 {
+		return &nodesList.Items[0], nil
+	}
+	nodesList, err = clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: GatewayLabelKey + "=true"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list nodes with label '%s=true': %v", GatewayLabelKey, err)
+	}
+	if len(nodesList.Items) != 1 {
+		klog.V(4).Infof("number of gateway nodes found: %d", len(nodesList.Items))
+		return nil, errdefs.NotFound("no active gateway node has been found")
+	}
+	return &nodesList.Items[0], nil
+}
+
+//SetActiveGateway marks the given node as the active gateway. The label is first removed from the other nodes, so that
+//the previous gateway, which could be unreachable, is not used anymore
+func SetActiveGateway(clientset kubernetes.Interface, nodeName string) error {
+	nodesList, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: ActiveGatewayLabelKey + "=true"})
+	if err != nil {
+		return fmt.Errorf("unable to list nodes with label '%s=true': %v", ActiveGatewayLabelKey, err)
+	}
+	for _, node := range nodesList.Items {
+		if node.Name == nodeName {
+			continue
+		}
+		patch := fmt.Sprintf(`{"metadata":{"labels":{%q:null}}}`, ActiveGatewayLabelKey)
+		if _, err := clientset.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("unable to remove the active gateway label from node %s: %v", node.Name, err)
+		}
+		klog.Infof("node %s is not the active gateway anymore", node.Name)
+	}
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:"true"}}}`, ActiveGatewayLabelKey)
+	if _, err := clientset.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("unable to set the active gateway label on node %s: %v", nodeName, err)
+	}
+	klog.Infof("node %s is the active gateway", nodeName)
+	return nil
+}
+
+//GetNodeVxlanIP returns the IP of the vxlan interface of the node, published in its annotations by the route-operator
+//running on the node once it has been allocated
+func GetNodeVxlanIP(node *corev1.Node, vxlanNetwork string) (string, error) {
+	_, vxlanNet, err := net.ParseCIDR(vxlanNetwork)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse the vxlan network %s: %v", vxlanNetwork, err)
+	}
+	vxlanIP, ok := node.Annotations[VxlanIPAnnotationKey]
+	if !ok {
+		return "", fmt.Errorf("the vxlan address of node %s has not been allocated yet", node.Name)
+	}
+	//the annotation could have been set with a previous configuration of the vxlan network
+	if ip := net.ParseIP(vxlanIP); ip == nil || !vxlanNet.Contains(ip) {
+		return "", fmt.Errorf("the vxlan address %s of node %s is not in the vxlan network %s", vxlanIP, node.Name, vxlanNetwork)
+	}
+	return vxlanIP, nil
+}
+
+//GetNodeInternalIP returns the internal IP of the node, used as its VTEP
+func GetNodeInternalIP(node *corev1.Node) (string, error) {
+	return getInternalIPOfNode(*node)
+}
+
+//GetNodeInternalIPForFamily returns the internal IP of the node of the given family if the node is dual-stack,
+//the VTEPs of the nodes have to belong to the same family
+func GetNodeInternalIPForFamily(node *corev1.Node, ipv6 bool) (string, error) {
+	return getInternalIPOfNodeForFamily(*node, ipv6)
+}
+
+//RemoveRouteOperatorLabels removes the labels set by the route-operators, so that all of them process again the resource
+func RemoveRouteOperatorLabels(labels map[string]string) map[string]string {
+	for key := range labels {
+		if strings.HasPrefix(key, RouteOpLabelKey+"-") {
+			delete(labels, key)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,79 @@
+package liqonet
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func getGatewayNode(name, internalIP string, active bool) *corev1.Node {
+	labels := map[string]string{GatewayLabelKey: "true"}
+	if active {
+		labels[ActiveGatewayLabelKey] = "true"
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: internalIP}},
+		},
+	}
+}
+
+func TestGetActiveGateway(t *testing.T) {
+	//a single gateway node is used even if it has not been marked as the active one yet
+	clientset := fake.NewSimpleClientset(getGatewayNode("node-1", "10.0.0.1", false))
+	node, err := GetActiveGateway(clientset)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "node-1", node.Name)
+
+	//with many gateway nodes the active one has to be elected
+	clientset = fake.NewSimpleClientset(getGatewayNode("node-1", "10.0.0.1", false), getGatewayNode("node-2", "10.0.0.2", false))
+	_, err = GetActiveGateway(clientset)
+	assert.NotNil(t, err, "should not be nil, no gateway is active")
+
+	clientset = fake.NewSimpleClientset(getGatewayNode("node-1", "10.0.0.1", false), getGatewayNode("node-2", "10.0.0.2", true))
+	node, err = GetActiveGateway(clientset)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "node-2", node.Name)
+}
+
+func TestSetActiveGateway(t *testing.T) {
+	objects := []runtime.Object{getGatewayNode("node-1", "10.0.0.1", true), getGatewayNode("node-2", "10.0.0.2", false)}
+	clientset := fake.NewSimpleClientset(objects...)
+	//the standby gateway takes over
+	assert.Nil(t, SetActiveGateway(clientset, "node-2"), "should be nil")
+	node, err := GetActiveGateway(clientset)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "node-2", node.Name)
+	previous, err := clientset.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	assert.Nil(t, err, "should be nil")
+	_, ok := previous.Labels[ActiveGatewayLabelKey]
+	assert.False(t, ok, "the previous gateway should not be active")
+	assert.Equal(t, "true", previous.Labels[GatewayLabelKey], "the previous gateway should still be a gateway node")
+	//it is idempotent
+	assert.Nil(t, SetActiveGateway(clientset, "node-2"), "should be nil")
+	node, err = GetActiveGateway(clientset)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "node-2", node.Name)
+}
+
+func TestGetNodeVxlanIP(t *testing.T) {
+	node := getGatewayNode("node-1", "10.0.0.21", true)
+	node.Annotations = map[string]string{VxlanIPAnnotationKey: "192.168.200.3"}
+	ip, err := GetNodeVxlanIP(node, "192.168.200.0/24")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "192.168.200.3", ip, "the address should not depend on the internal IP of the node")
+	_, err = GetNodeVxlanIP(node, "192.168.100.0/24")
+	assert.NotNil(t, err, "should not be nil, the address has been allocated in another vxlan network")
+	_, err = GetNodeVxlanIP(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}, "192.168.200.0/24")
+	assert.NotNil(t, err, "should not be nil, the address of the node has not been allocated")
+}
+
+func TestRemoveRouteOperatorLabels(t *testing.T) {
+	labels := map[string]string{TunOpLabelKey: "ready", RouteOpLabelKey + "-node-1": "ready", RouteOpLabelKey + "-node-2": "ready"}
+	assert.Equal(t, map[string]string{TunOpLabelKey: "ready"}, RemoveRouteOperatorLabels(labels))
+}
@@ -0,0 +1,57 @@
+package liqonet
+
+import (
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog"
+	"syscall"
+)
+
+const (
+	greUdpNamePrefix = "greudp_"
+	//the value of the TUNNEL_ENCAP_FOU encapsulation type of the kernel
+	tunnelEncapFou = 1
+)
+
+//GreUdpDriver sets up a gre tunnel encapsulated in UDP toward each remote cluster, so that the tunnel crosses the NATs
+//in front of the gateways: the packets are sent from and received on the tunnel port
+type GreUdpDriver struct {
+	Port int
+}
+
+//NewGreUdpDriver opens the port the encapsulated packets are received on, it fails if the node does not support
+//the foo-over-udp encapsulation
+func NewGreUdpDriver(port int) (*GreUdpDriver, error) {
+	fou := netlink.Fou{
+		Family:    netlink.FAMILY_V4,
+		Port:      port,
+		Protocol:  syscall.IPPROTO_GRE,
+		EncapType: netlink.FOU_ENCAP_DIRECT,
+	}
+	if err := netlink.FouAdd(fou); err != nil && err != syscall.EEXIST {
+		return nil, fmt.Errorf("unable to open the foo-over-udp port %d: %v", port, err)
+	}
+	//the IPv6 port is opened only on the nodes supporting IPv6
+	fou.Family = netlink.FAMILY_V6
+	if err := netlink.FouAdd(fou); err != nil && err != syscall.EEXIST {
+		klog.Infof("the IPv6 foo-over-udp port %d is not available: %v", port, err)
+	}
+	return &GreUdpDriver{Port: port}, nil
+}
+
+func (d *GreUdpDriver) Install(endpoint *v1.TunnelEndpoint) (int, string, error) {
+	return installGreTunnel(endpoint, gretunAttributes{
+		name:       GetTunnelIfaceName(greUdpNamePrefix, endpoint.Spec.ClusterID),
+		encapSport: uint16(d.Port),
+		encapDport: uint16(GetRemoteTunnelPort(endpoint)),
+	})
+}
+
+func (d *GreUdpDriver) Remove(endpoint *v1.TunnelEndpoint) error {
+	return RemoveGreTunnel(endpoint)
+}
+
+func (d *GreUdpDriver) GetStats(endpoint *v1.TunnelEndpoint) (TunnelStats, error) {
+	return getLinkStats(endpoint.Status.TunnelIFaceName)
+}
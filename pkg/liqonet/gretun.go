@@ -13,6 +13,13 @@ type gretunAttributes struct {
 	local  net.IP
 	remote net.IP
 	ttl    uint8
+	//the UDP ports of the encapsulation, the packets are not encapsulated if the destination port is not set
+	encapSport uint16
+	encapDport uint16
+	//the MTU of the interface, the one derived by the kernel from the underlying interface is used if not set
+	mtu int
+	//the index of the interface the encapsulated packets are sent through, chosen by the routes if not set
+	link int
 }
 
 type gretunIface struct {
@@ -47,11 +54,18 @@ func newGretunInterface(attributes *gretunAttributes) (*gretunIface, error) {
 	iface := &netlink.Gretun{
 		LinkAttrs: netlink.LinkAttrs{
 			Name: attributes.name,
+			MTU:  attributes.mtu,
 		},
+		Link:   uint32(attributes.link),
 		Local:  attributes.local,
 		Remote: attributes.remote,
 		Ttl:    attributes.ttl,
 	}
+	if attributes.encapDport != 0 {
+		iface.EncapType = tunnelEncapFou
+		iface.EncapSport = attributes.encapSport
+		iface.EncapDport = attributes.encapDport
+	}
 	//assigning to the gretun interface the parameters
 	gretunIface := &gretunIface{link: iface}
 	//create the gretun interface
@@ -94,3 +108,21 @@ func (iface *gretunIface) setUp() error {
 	}
 	return nil
 }
+
+//returns the counters of the tunnel interface, which is used by a single remote cluster
+func getLinkStats(name string) (TunnelStats, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return TunnelStats{}, fmt.Errorf("failed to retrieve the tunnel interface %s: %v", name, err)
+	}
+	stats := link.Attrs().Statistics
+	if stats == nil {
+		return TunnelStats{}, fmt.Errorf("the tunnel interface %s has no statistics", name)
+	}
+	return TunnelStats{
+		SentBytes:       stats.TxBytes,
+		ReceivedBytes:   stats.RxBytes,
+		SentPackets:     stats.TxPackets,
+		ReceivedPackets: stats.RxPackets,
+	}, nil
+}
@@ -7,98 +7,275 @@ import (
 	"net"
 )
 
+const (
+	//the pools used when no pools are configured: 10.0.0.0/8 split in /16 subnets for the IPv4 clusters,
+	//fd00:10::/40 split in /48 subnets for the IPv6 ones
+	defaultPoolCIDR             = "10.0.0.0/8"
+	defaultPoolPrefixLength     = 16
+	defaultIPv6PoolCIDR         = "fd00:10::/40"
+	defaultIPv6PoolPrefixLength = 48
+	//a pool can be split in at most 2^maxPoolSplitBits subnets
+	maxPoolSplitBits = 16
+)
+
 type Ipam interface {
 	Init() error
 	GetNewSubnetPerCluster(network *net.IPNet, clusterID string) (*net.IPNet, error)
+	ReserveSubnetPerCluster(network *net.IPNet, clusterID string) error
 	RemoveReservedSubnet(clusterID string)
 }
 
+// a block of addresses from which subnets with the given prefix length are allocated
+type AddressPool struct {
+	Network      *net.IPNet
+	PrefixLength int
+}
+
+// IpamStorage persists, for each peered cluster, the subnet allocated to it
+type IpamStorage interface {
+	Load() (map[string]string, error)
+	Save(clusterSubnets map[string]string) error
+}
+
 type IpManager struct {
 	UsedSubnets        map[string]*net.IPNet
 	FreeSubnets        map[string]*net.IPNet
 	ConflictingSubnets map[string]*net.IPNet
 	SubnetPerCluster   map[string]*net.IPNet
-	Log                logr.Logger
+	//the pools the subnets are allocated from, if empty the default pool is used
+	Pools []AddressPool
+	//if not nil the allocated subnets survive the restarts of the operator
+	Storage IpamStorage
+	Log     logr.Logger
+
+	//all the subnets of the pools, in allocation order
+	poolSubnets []*net.IPNet
 }
 
-func (ip IpManager) Init() error {
-	//TODO: remove the hardcoded value of the CIDRBlock
-	CIDRBlock := "10.0.0.0/16"
-	//the first /16 subnet in 10/8 cidr block
-	_, subnet, err := net.ParseCIDR("10.0.0.0/16")
+// reset the state, split the pools in subnets and restore the subnets allocated before a restart
+func (ip *IpManager) Init() error {
+	pools := ip.Pools
+	if len(pools) == 0 {
+		_, network, err := net.ParseCIDR(defaultPoolCIDR)
+		if err != nil {
+			return err
+		}
+		_, ipv6Network, err := net.ParseCIDR(defaultIPv6PoolCIDR)
+		if err != nil {
+			return err
+		}
+		pools = []AddressPool{
+			{Network: network, PrefixLength: defaultPoolPrefixLength},
+			{Network: ipv6Network, PrefixLength: defaultIPv6PoolPrefixLength},
+		}
+	}
+
+	ip.UsedSubnets = make(map[string]*net.IPNet)
+	ip.FreeSubnets = make(map[string]*net.IPNet)
+	ip.ConflictingSubnets = make(map[string]*net.IPNet)
+	ip.SubnetPerCluster = make(map[string]*net.IPNet)
+	ip.poolSubnets = nil
+	for _, pool := range pools {
+		subnets, err := splitPool(pool)
+		if err != nil {
+			return err
+		}
+		for _, subnet := range subnets {
+			if _, ok := ip.FreeSubnets[subnet.String()]; ok {
+				//overlapping pools
+				continue
+			}
+			ip.FreeSubnets[subnet.String()] = subnet
+			ip.poolSubnets = append(ip.poolSubnets, subnet)
+		}
+	}
+
+	if ip.Storage == nil {
+		return nil
+	}
+	clusterSubnets, err := ip.Storage.Load()
 	if err != nil {
-		ip.Log.Error(err, "unable to parse the first subnet %s :%v", CIDRBlock, err)
-		return err
+		return fmt.Errorf("unable to load the allocated subnets: %v", err)
 	}
-	//The first subnet /16 is added to the FreeSubnets
-	ip.FreeSubnets[subnet.String()] = subnet
-	//here we divide the CIDRBlock 10.0.0.0/8 in 256 /16 subnets
-	for i := 0; i < 255; i++ {
-		subnet, _ = cidr.NextSubnet(subnet, 16)
-		ip.FreeSubnets[subnet.String()] = subnet
+	for clusterID, subnet := range clusterSubnets {
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return fmt.Errorf("unable to parse the subnet %s allocated to cluster %s: %v", subnet, clusterID, err)
+		}
+		ip.reserveSubnet(network, clusterID)
+		ip.logInfo("Restored: ", "subnet", network.String(), "for cluster", clusterID)
 	}
 	return nil
 }
 
-//for a given cluster it returns an error if no subnets are available
-//a new subnet if the original pod Cidr of the cluster has conflicts
-//the existing subnet allocated to the cluster if already called this function
-//nil for the new subnet if no conflicts are present.
-func (ip IpManager) GetNewSubnetPerCluster(network *net.IPNet, clusterID string) (*net.IPNet, error) {
+// returns all the subnets with the given prefix length contained in the pool
+func splitPool(pool AddressPool) ([]*net.IPNet, error) {
+	poolLength, bits := pool.Network.Mask.Size()
+	if pool.PrefixLength < poolLength || pool.PrefixLength > bits {
+		return nil, fmt.Errorf("the prefix length %d is not valid for pool %s", pool.PrefixLength, pool.Network.String())
+	}
+	if pool.PrefixLength-poolLength > maxPoolSplitBits {
+		return nil, fmt.Errorf("pool %s can not be split in more than %d subnets", pool.Network.String(), 1<<maxPoolSplitBits)
+	}
+
+	count := 1 << uint(pool.PrefixLength-poolLength)
+	subnets := make([]*net.IPNet, 0, count)
+	for i := 0; i < count; i++ {
+		subnet, err := cidr.Subnet(pool.Network, pool.PrefixLength-poolLength, i)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// for a given cluster it returns an error if no subnets are available
+// a new subnet if the original pod Cidr of the cluster has conflicts
+// the existing subnet allocated to the cluster if already called this function
+// nil for the new subnet if no conflicts are present.
+func (ip *IpManager) GetNewSubnetPerCluster(network *net.IPNet, clusterID string) (*net.IPNet, error) {
 	//first check if we already have assigned a subnet to the cluster
-	if _, ok := ip.SubnetPerCluster[clusterID]; ok {
-		return ip.SubnetPerCluster[clusterID], nil
+	if subnet, ok := ip.SubnetPerCluster[clusterID]; ok {
+		if subnet.String() == network.String() {
+			return nil, nil
+		}
+		return subnet, nil
 	}
 	//check if the given network has conflicts with any of the used subnets
 	if flag := VerifyNoOverlap(ip.UsedSubnets, network); flag {
-		//if there are conflicts then get a free subnet from the pool and return it
-		//return also a "true" value for the bool
-		if subnet, err := ip.getNextSubnet(); err != nil {
+		//if there are conflicts then get a free subnet of the same family from the pool and return it
+		subnet, err := ip.getNextSubnet(IsIPv6(network.IP))
+		if err != nil {
+			return nil, err
+		}
+		if err := ip.allocate(subnet, clusterID); err != nil {
 			return nil, err
-		} else {
-			ip.reserveSubnet(subnet, clusterID)
-			ip.Log.Info("Reserved: ", "subnet", subnet.String(), "for cluster", clusterID)
-			return subnet, nil
 		}
+		ip.logInfo("Reserved: ", "subnet", subnet.String(), "for cluster", clusterID)
+		return subnet, nil
+	}
+	//the network is reserved as well, so that the clusters peered later with the same pod CIDR are remapped
+	if err := ip.allocate(network, clusterID); err != nil {
+		return nil, err
 	}
-	ip.SubnetPerCluster[clusterID] = network
 	return nil, nil
 }
 
-func (ip *IpManager) getNextSubnet() (*net.IPNet, error) {
-	if len(ip.FreeSubnets) == 0 {
-		return nil, fmt.Errorf("no more available subnets to allocate")
+// reserves the network as it is, without remapping it, for the given key: it returns an error if the network overlaps
+// with the used subnets, or if another subnet has already been reserved for the key
+func (ip *IpManager) ReserveSubnetPerCluster(network *net.IPNet, clusterID string) error {
+	if subnet, ok := ip.SubnetPerCluster[clusterID]; ok {
+		if subnet.String() == network.String() {
+			return nil
+		}
+		return fmt.Errorf("the subnet %s is already reserved for cluster %s", subnet.String(), clusterID)
 	}
-	var availableSubnet *net.IPNet
-	for _, subnet := range ip.FreeSubnets {
-		availableSubnet = subnet
-		break
+	if VerifyNoOverlap(ip.UsedSubnets, network) {
+		return fmt.Errorf("the subnet %s overlaps with the subnets already in use", network.String())
+	}
+	if err := ip.allocate(network, clusterID); err != nil {
+		return err
 	}
-	return availableSubnet, nil
+	ip.logInfo("Reserved: ", "subnet", network.String(), "for cluster", clusterID)
+	return nil
 }
 
-//add the network to the UsedSubnets and remove of the subnets in free subnets that overlap with the network
-func (ip IpManager) reserveSubnet(network *net.IPNet, clusterID string) {
-	ip.UsedSubnets[network.String()] = network
-	for _, net := range ip.FreeSubnets {
-		if bool := VerifyNoOverlap(ip.UsedSubnets, net); bool {
-			if _, ok := ip.UsedSubnets[net.String()]; !ok {
-				ip.UsedSubnets[net.String()] = net
-				delete(ip.FreeSubnets, net.String())
-			} else {
-				delete(ip.FreeSubnets, net.String())
-			}
+// returns the first free subnet of the family, following the order of the pools, so that the allocation is deterministic
+func (ip *IpManager) getNextSubnet(ipv6 bool) (*net.IPNet, error) {
+	for _, subnet := range ip.poolSubnets {
+		if IsIPv6(subnet.IP) != ipv6 {
+			continue
+		}
+		if _, ok := ip.FreeSubnets[subnet.String()]; ok {
+			return subnet, nil
 		}
 	}
-	ip.SubnetPerCluster[clusterID] = network
+	return nil, fmt.Errorf("no more available subnets to allocate")
 }
 
-func (ip IpManager) RemoveReservedSubnet(clusterID string) {
+// reserves the subnet for the cluster and persists the allocation, which is rolled back if it cannot be saved
+func (ip *IpManager) allocate(network *net.IPNet, clusterID string) error {
+	ip.reserveSubnet(network, clusterID)
+	if err := ip.save(); err != nil {
+		ip.releaseSubnet(clusterID)
+		return fmt.Errorf("unable to save the subnet %s allocated to cluster %s: %v", network.String(), clusterID, err)
+	}
+	return nil
+}
 
-	subnet := ip.SubnetPerCluster[clusterID]
+// add the network to the UsedSubnets and move the free subnets overlapping with it to the conflicting ones
+func (ip *IpManager) reserveSubnet(network *net.IPNet, clusterID string) {
+	ip.UsedSubnets[network.String()] = network
+	delete(ip.FreeSubnets, network.String())
+	for _, subnet := range ip.FreeSubnets {
+		if VerifyNoOverlap(ip.UsedSubnets, subnet) {
+			delete(ip.FreeSubnets, subnet.String())
+			ip.ConflictingSubnets[subnet.String()] = subnet
+		}
+	}
+	ip.SubnetPerCluster[clusterID] = network
+}
 
-	ip.FreeSubnets[subnet.String()] = subnet
+// remove the subnet of the cluster from the used ones and move back to the free subnets the ones not conflicting anymore
+func (ip *IpManager) releaseSubnet(clusterID string) *net.IPNet {
+	subnet, ok := ip.SubnetPerCluster[clusterID]
+	if !ok {
+		return nil
+	}
 	delete(ip.UsedSubnets, subnet.String())
 	delete(ip.SubnetPerCluster, clusterID)
-	ip.Log.Info("Removing", "subnet", subnet.String(), "reserved to cluster", clusterID)
+	if ip.isPoolSubnet(subnet) && !VerifyNoOverlap(ip.UsedSubnets, subnet) {
+		ip.FreeSubnets[subnet.String()] = subnet
+	}
+	for _, conflicting := range ip.ConflictingSubnets {
+		if !VerifyNoOverlap(ip.UsedSubnets, conflicting) {
+			delete(ip.ConflictingSubnets, conflicting.String())
+			ip.FreeSubnets[conflicting.String()] = conflicting
+		}
+	}
+	return subnet
+}
+
+func (ip *IpManager) isPoolSubnet(network *net.IPNet) bool {
+	for _, subnet := range ip.poolSubnets {
+		if subnet.String() == network.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (ip *IpManager) RemoveReservedSubnet(clusterID string) {
+	subnet := ip.releaseSubnet(clusterID)
+	if subnet == nil {
+		return
+	}
+	if err := ip.save(); err != nil {
+		ip.logError(err, "unable to save the release of the subnet", "subnet", subnet.String(), "cluster", clusterID)
+	}
+	ip.logInfo("Removing", "subnet", subnet.String(), "reserved to cluster", clusterID)
+}
+
+func (ip *IpManager) save() error {
+	if ip.Storage == nil {
+		return nil
+	}
+	clusterSubnets := make(map[string]string, len(ip.SubnetPerCluster))
+	for clusterID, subnet := range ip.SubnetPerCluster {
+		clusterSubnets[clusterID] = subnet.String()
+	}
+	return ip.Storage.Save(clusterSubnets)
+}
+
+func (ip *IpManager) logInfo(msg string, keysAndValues ...interface{}) {
+	if ip.Log != nil {
+		ip.Log.Info(msg, keysAndValues...)
+	}
+}
+
+func (ip *IpManager) logError(err error, msg string, keysAndValues ...interface{}) {
+	if ip.Log != nil {
+		ip.Log.Error(err, msg, keysAndValues...)
+	}
 }
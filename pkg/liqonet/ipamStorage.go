@@ -0,0 +1,51 @@
+package liqonet
+
+import (
+	"context"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the name of the IpamStorage resource holding the state of the IPAM
+const ipamStorageName = "ipamstorage"
+
+// IpamCRDStorage persists the subnets allocated by the IPAM in a cluster scoped IpamStorage resource
+type IpamCRDStorage struct {
+	//the client has to read directly from the API server, the allocations are loaded before the caches are started
+	Client client.Client
+}
+
+func NewIpamCRDStorage(c client.Client) *IpamCRDStorage {
+	return &IpamCRDStorage{Client: c}
+}
+
+// returns the allocated subnets, an empty map if they have never been saved
+func (s *IpamCRDStorage) Load() (map[string]string, error) {
+	storage := &liqonetv1.IpamStorage{}
+	err := s.Client.Get(context.TODO(), types.NamespacedName{Name: ipamStorageName}, storage)
+	if k8serrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if storage.Spec.ClusterSubnets == nil {
+		return map[string]string{}, nil
+	}
+	return storage.Spec.ClusterSubnets, nil
+}
+
+func (s *IpamCRDStorage) Save(clusterSubnets map[string]string) error {
+	storage := &liqonetv1.IpamStorage{}
+	err := s.Client.Get(context.TODO(), types.NamespacedName{Name: ipamStorageName}, storage)
+	if k8serrors.IsNotFound(err) {
+		storage.Name = ipamStorageName
+		storage.Spec.ClusterSubnets = clusterSubnets
+		return s.Client.Create(context.TODO(), storage)
+	} else if err != nil {
+		return err
+	}
+	storage.Spec.ClusterSubnets = clusterSubnets
+	return s.Client.Update(context.TODO(), storage)
+}
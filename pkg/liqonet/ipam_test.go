@@ -0,0 +1,175 @@
+package liqonet
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+type memoryIpamStorage struct {
+	clusterSubnets map[string]string
+	fail           bool
+}
+
+func (s *memoryIpamStorage) Load() (map[string]string, error) {
+	clusterSubnets := make(map[string]string)
+	for k, v := range s.clusterSubnets {
+		clusterSubnets[k] = v
+	}
+	return clusterSubnets, nil
+}
+
+func (s *memoryIpamStorage) Save(clusterSubnets map[string]string) error {
+	if s.fail {
+		return errors.New("storage not available")
+	}
+	s.clusterSubnets = clusterSubnets
+	return nil
+}
+
+func parseCIDR(t *testing.T, subnet string) *net.IPNet {
+	_, network, err := net.ParseCIDR(subnet)
+	assert.Nil(t, err, "should be nil, otherwise check the subnets provided as a test")
+	return network
+}
+
+func getIpManager(t *testing.T, storage IpamStorage, pools ...string) *IpManager {
+	ip := &IpManager{Storage: storage}
+	for _, pool := range pools {
+		ip.Pools = append(ip.Pools, AddressPool{Network: parseCIDR(t, pool), PrefixLength: 24})
+	}
+	assert.Nil(t, ip.Init(), "should be nil")
+	return ip
+}
+
+func TestIpamDefaultPool(t *testing.T) {
+	ip := getIpManager(t, nil)
+	assert.Equal(t, 512, len(ip.FreeSubnets), "the default IPv4 and IPv6 pools should be split in 256 subnets each")
+}
+
+func TestIpamDeterministicAllocation(t *testing.T) {
+	ip := getIpManager(t, nil, "172.16.0.0/23", "192.168.10.0/24")
+	ip.UsedSubnets["10.0.0.0/16"] = parseCIDR(t, "10.0.0.0/16")
+
+	//the subnets are allocated following the order of the pools
+	expected := []string{"172.16.0.0/24", "172.16.1.0/24", "192.168.10.0/24"}
+	for i, e := range expected {
+		subnet, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), string(rune('a'+i)))
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, e, subnet.String())
+	}
+	//the pools are exhausted
+	_, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), "d")
+	assert.NotNil(t, err, "should not be nil, no more subnets are available")
+
+	//the released subnet goes back to the free ones and it is allocated again
+	ip.RemoveReservedSubnet("b")
+	subnet, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), "d")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "172.16.1.0/24", subnet.String())
+}
+
+func TestIpamRemapConflicts(t *testing.T) {
+	ip := getIpManager(t, nil, "10.0.0.0/22")
+
+	//the first cluster does not need to be remapped, but its pod CIDR is reserved
+	subnet, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/23"), "a")
+	assert.Nil(t, err, "should be nil")
+	assert.Nil(t, subnet, "the cluster should not be remapped")
+	assert.Equal(t, 2, len(ip.ConflictingSubnets))
+
+	//the second cluster has the same pod CIDR, hence it is remapped
+	subnet, err = ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/23"), "b")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "10.0.2.0/24", subnet.String())
+
+	//the same subnet is returned to the cluster
+	again, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/23"), "b")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, subnet, again)
+
+	//the conflicting subnets are freed when the first cluster is removed
+	ip.RemoveReservedSubnet("a")
+	assert.Equal(t, 0, len(ip.ConflictingSubnets))
+	assert.Equal(t, 3, len(ip.FreeSubnets))
+}
+
+func TestIpamReserveSubnet(t *testing.T) {
+	ip := getIpManager(t, nil, "10.0.0.0/22")
+
+	//the subnet is reserved as it is, and the pool subnets overlapping with it are not allocated anymore
+	assert.Nil(t, ip.ReserveSubnetPerCluster(parseCIDR(t, "10.0.1.0/24"), "a-pods-10.0.1.0/24"))
+	assert.Nil(t, ip.ReserveSubnetPerCluster(parseCIDR(t, "10.0.1.0/24"), "a-pods-10.0.1.0/24"), "reserving the same subnet again should succeed")
+	assert.Equal(t, 3, len(ip.FreeSubnets))
+
+	//the overlapping subnets are not reserved
+	assert.NotNil(t, ip.ReserveSubnetPerCluster(parseCIDR(t, "10.0.0.0/23"), "b-pods-10.0.0.0/23"))
+	_, ok := ip.SubnetPerCluster["b-pods-10.0.0.0/23"]
+	assert.False(t, ok, "the overlapping subnet should not be reserved")
+
+	//a cluster with the same pod CIDR is remapped
+	subnet, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.1.0/24"), "b")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "10.0.0.0/24", subnet.String())
+
+	ip.RemoveReservedSubnet("a-pods-10.0.1.0/24")
+	assert.Equal(t, 3, len(ip.FreeSubnets))
+}
+
+func TestIpamPersistence(t *testing.T) {
+	storage := &memoryIpamStorage{}
+	ip := getIpManager(t, storage, "172.16.0.0/22")
+	ip.UsedSubnets["10.0.0.0/16"] = parseCIDR(t, "10.0.0.0/16")
+	remapped, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), "a")
+	assert.Nil(t, err, "should be nil")
+	_, err = ip.GetNewSubnetPerCluster(parseCIDR(t, "192.168.0.0/16"), "b")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, map[string]string{"a": remapped.String(), "b": "192.168.0.0/16"}, storage.clusterSubnets)
+
+	//after a restart the allocations are restored
+	restarted := getIpManager(t, storage, "172.16.0.0/22")
+	subnet, err := restarted.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), "a")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, remapped.String(), subnet.String())
+	subnet, err = restarted.GetNewSubnetPerCluster(parseCIDR(t, "192.168.0.0/16"), "b")
+	assert.Nil(t, err, "should be nil")
+	assert.Nil(t, subnet, "the cluster should not be remapped")
+	_, ok := restarted.FreeSubnets[remapped.String()]
+	assert.False(t, ok, "the restored subnet should not be free")
+
+	//an allocation which cannot be saved is rolled back
+	storage.fail = true
+	_, err = restarted.GetNewSubnetPerCluster(parseCIDR(t, "172.16.0.0/16"), "c")
+	assert.NotNil(t, err, "should not be nil")
+	_, ok = restarted.SubnetPerCluster["c"]
+	assert.False(t, ok, "the allocation should have been rolled back")
+	assert.Equal(t, 3, len(restarted.FreeSubnets))
+}
+
+func TestIpamInvalidPool(t *testing.T) {
+	ip := &IpManager{Pools: []AddressPool{{Network: parseCIDR(t, "10.0.0.0/16"), PrefixLength: 8}}}
+	assert.NotNil(t, ip.Init(), "should not be nil, the prefix length is shorter than the pool one")
+	ip = &IpManager{Pools: []AddressPool{{Network: parseCIDR(t, "10.0.0.0/8"), PrefixLength: 30}}}
+	assert.NotNil(t, ip.Init(), "should not be nil, the pool is split in too many subnets")
+}
+
+func TestIpamIPv6Remap(t *testing.T) {
+	ip := getIpManager(t, nil)
+
+	//the IPv6 networks are remapped in subnets of the IPv6 pool
+	subnet, err := ip.GetNewSubnetPerCluster(parseCIDR(t, "fd00:10::/48"), "a")
+	assert.Nil(t, err, "should be nil")
+	assert.Nil(t, subnet, "the cluster should not be remapped")
+	subnet, err = ip.GetNewSubnetPerCluster(parseCIDR(t, "fd00:10::/48"), "b")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "fd00:10:1::/48", subnet.String())
+
+	//the IPv4 ones in subnets of the IPv4 pool
+	subnet, err = ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), "c")
+	assert.Nil(t, err, "should be nil")
+	assert.Nil(t, subnet, "the cluster should not be remapped")
+	subnet, err = ip.GetNewSubnetPerCluster(parseCIDR(t, "10.0.0.0/16"), "d")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "10.1.0.0/16", subnet.String())
+}
@@ -33,6 +33,15 @@ type IPTables interface {
 //LIQONET-POSTROUTING is created in the nat table
 //LIQONET-FORWARD is created in the filter table
 func CreateIptablesChainsIfNotExist(ipt IPTables, table string, newChain string) error {
+	//the chain is created in each family
+	if dualStack, ok := ipt.(*DualStackIPTables); ok {
+		for _, family := range dualStack.families() {
+			if err := CreateIptablesChainsIfNotExist(family, table, newChain); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	//get existing chains
 	chains_list, err := ipt.ListChains(table)
 	if err != nil {
@@ -56,6 +65,19 @@ func CreateIptablesChainsIfNotExist(ipt IPTables, table string, newChain string)
 //it takes care that the rule is present only once and at the same time it inserts it at the first position
 //TODO: a go routine which periodically checks if the rules inserted with this function in position one in the chain where belong
 func InsertIptablesRulespecIfNotExists(ipt IPTables, table string, chain string, ruleSpec []string) error {
+	//the position of the rule is checked in each family
+	if dualStack, ok := ipt.(*DualStackIPTables); ok {
+		families, err := dualStack.familiesOf(ruleSpec)
+		if err != nil {
+			return err
+		}
+		for _, family := range families {
+			if err := InsertIptablesRulespecIfNotExists(family, table, chain, ruleSpec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	//get the list of rulespecs for the specified chain
 	rulesList, err := ipt.List(table, chain)
 	if err != nil {
@@ -98,3 +120,156 @@ func InsertIptablesRulespecIfNotExists(ipt IPTables, table string, chain string,
 	}
 	return nil
 }
+
+//DualStackIPTables applies the rules matching IPv4 addresses through iptables and the ones matching IPv6 addresses
+//through ip6tables, while the chains and the rules without addresses are handled by both. If one of the two is nil
+//only the other family is handled
+type DualStackIPTables struct {
+	IPv4 IPTables
+	IPv6 IPTables
+}
+
+func (d *DualStackIPTables) families() []IPTables {
+	var families []IPTables
+	if d.IPv4 != nil {
+		families = append(families, d.IPv4)
+	}
+	if d.IPv6 != nil {
+		families = append(families, d.IPv6)
+	}
+	return families
+}
+
+//returns the families the rule has to be applied to, according to the addresses it matches
+func (d *DualStackIPTables) familiesOf(rulespec []string) ([]IPTables, error) {
+	ipv6, found, err := getAddressesFamily(rulespec)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return d.families(), nil
+	}
+	family := d.IPv4
+	if ipv6 {
+		family = d.IPv6
+	}
+	if family == nil {
+		return nil, fmt.Errorf("the address family of the rule \"%s\" is not supported", strings.Join(rulespec, " "))
+	}
+	return []IPTables{family}, nil
+}
+
+//applies the operation to all the families of the rule, the first error is returned
+func (d *DualStackIPTables) forEachFamily(rulespec []string, operation func(IPTables) error) error {
+	families, err := d.familiesOf(rulespec)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, family := range families {
+		if err := operation(family); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (d *DualStackIPTables) Insert(table string, chain string, pos int, rulespec ...string) error {
+	return d.forEachFamily(rulespec, func(ipt IPTables) error {
+		return ipt.Insert(table, chain, pos, rulespec...)
+	})
+}
+
+func (d *DualStackIPTables) Delete(table string, chain string, rulespec ...string) error {
+	return d.forEachFamily(rulespec, func(ipt IPTables) error {
+		return ipt.Delete(table, chain, rulespec...)
+	})
+}
+
+func (d *DualStackIPTables) AppendUnique(table string, chain string, rulespec ...string) error {
+	return d.forEachFamily(rulespec, func(ipt IPTables) error {
+		return ipt.AppendUnique(table, chain, rulespec...)
+	})
+}
+
+//a rule exists if it exists in all its families
+func (d *DualStackIPTables) Exists(table string, chain string, rulespec ...string) (bool, error) {
+	exists := true
+	err := d.forEachFamily(rulespec, func(ipt IPTables) error {
+		ok, err := ipt.Exists(table, chain, rulespec...)
+		exists = exists && ok
+		return err
+	})
+	return exists && err == nil, err
+}
+
+//returns the chains existing in all the families
+func (d *DualStackIPTables) ListChains(table string) ([]string, error) {
+	var result []string
+	for i, family := range d.families() {
+		chains, err := family.ListChains(table)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			result = chains
+			continue
+		}
+		var common []string
+		for _, chain := range result {
+			if ContainsString(chains, chain) {
+				common = append(common, chain)
+			}
+		}
+		result = common
+	}
+	return result, nil
+}
+
+//creates the chain in the families where it does not exist
+func (d *DualStackIPTables) NewChain(table string, chain string) error {
+	for _, family := range d.families() {
+		chains, err := family.ListChains(table)
+		if err != nil {
+			return err
+		}
+		if ContainsString(chains, chain) {
+			continue
+		}
+		if err := family.NewChain(table, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//returns the rules of the IPv4 family followed by the ones of the IPv6 family
+func (d *DualStackIPTables) List(table, chain string) ([]string, error) {
+	var rules []string
+	for _, family := range d.families() {
+		familyRules, err := family.List(table, chain)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, familyRules...)
+	}
+	return rules, nil
+}
+
+func (d *DualStackIPTables) ClearChain(table, chain string) error {
+	for _, family := range d.families() {
+		if err := family.ClearChain(table, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DualStackIPTables) DeleteChain(table, chain string) error {
+	for _, family := range d.families() {
+		if err := family.DeleteChain(table, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
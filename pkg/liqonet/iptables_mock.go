@@ -12,7 +12,7 @@ type MockIPTables struct {
 
 func (m *MockIPTables) Exists(table string, chain string, rulespec ...string) (bool, error) {
 	for _, rule := range m.Rules {
-		if rule.Table == table && rule.Chain == chain && strings.Join(rule.RuleSpec, " ") == strings.Join(rulespec, "") {
+		if rule.Table == table && rule.Chain == chain && strings.Join(rule.RuleSpec, " ") == strings.Join(rulespec, " ") {
 			return true, nil
 		}
 	}
@@ -112,11 +112,12 @@ func (m *MockIPTables) Insert(table string, chain string, pos int, rulespec ...s
 	return nil
 }
 
+//as iptables, the rules are listed in the "-A <chain> <rulespec>" format
 func (m *MockIPTables) List(table, chain string) ([]string, error) {
 	var rules []string
 	for _, rule := range m.Rules {
-		if rule.Table == table {
-			rules = append(rules, strings.Join(rule.RuleSpec, " "))
+		if rule.Table == table && rule.Chain == chain {
+			rules = append(rules, "-A "+chain+" "+strings.Join(rule.RuleSpec, " "))
 		}
 	}
 	return rules, nil
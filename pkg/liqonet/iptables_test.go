@@ -98,3 +98,38 @@ func TestInsertIptablesRulespecIfNotExists(t *testing.T) {
 	assert.Equal(t, r, m.Rules[0], "the new added rule should be the first one in the chain")
 	assert.Equal(t, 2, len(m.Rules), "only two rules should be present in the chain")
 }
+
+func TestDualStackIPTables(t *testing.T) {
+	ipv4 := &MockIPTables{Rules: []IPtableRule{}, Chains: []IPTableChain{}}
+	ipv6 := &MockIPTables{Rules: []IPtableRule{}, Chains: []IPTableChain{}}
+	ipt := &DualStackIPTables{IPv4: ipv4, IPv6: ipv6}
+
+	//the chains are created in both the families
+	err := CreateIptablesChainsIfNotExist(ipt, "nat", "testchain")
+	assert.Nil(t, err, "should be nil")
+	assert.True(t, ipv4.containsChain(IPTableChain{Table: "nat", Name: "testchain"}), "the IPv4 chain should have been added")
+	assert.True(t, ipv6.containsChain(IPTableChain{Table: "nat", Name: "testchain"}), "the IPv6 chain should have been added")
+
+	//the rules are installed only in the family of their addresses
+	err = ipt.AppendUnique("nat", "testchain", "-d", "fd00::/64", "-j", "ACCEPT")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 0, len(ipv4.Rules), "the IPv6 rule should not be installed in the IPv4 table")
+	assert.Equal(t, 1, len(ipv6.Rules), "the IPv6 rule should be installed in the IPv6 table")
+	err = ipt.AppendUnique("nat", "testchain", "-d", "10.0.0.0/16", "-j", "ACCEPT")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 1, len(ipv4.Rules), "the IPv4 rule should be installed in the IPv4 table")
+	assert.Equal(t, 1, len(ipv6.Rules), "the IPv4 rule should not be installed in the IPv6 table")
+	//the rules without addresses are installed in both the families
+	err = ipt.AppendUnique("nat", "testchain", "-j", "ACCEPT")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 2, len(ipv4.Rules))
+	assert.Equal(t, 2, len(ipv6.Rules))
+	//the rules mixing the families are refused
+	err = ipt.AppendUnique("nat", "testchain", "-s", "10.0.0.0/16", "-d", "fd00::/64", "-j", "ACCEPT")
+	assert.NotNil(t, err, "should not be nil, the addresses belong to different families")
+
+	//an IPv4 only node has no IPv6 table
+	ipt = &DualStackIPTables{IPv4: ipv4}
+	err = ipt.AppendUnique("nat", "testchain", "-d", "fd00:1::/64", "-j", "ACCEPT")
+	assert.NotNil(t, err, "should not be nil, the IPv6 table is not available")
+}
@@ -0,0 +1,198 @@
+package liqonet
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"k8s.io/klog"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	ipv4HeaderLength = 20
+	ipv6HeaderLength = 40
+	udpHeaderLength  = 8
+	icmpHeaderLength = 8
+	greHeaderLength  = 4
+	//the ip6gre tunnels add the tunnel encapsulation limit option to the outer header
+	ip6greEncapLimitLength = 8
+	//the vxlan header and the inner ethernet header
+	vxlanHeaderLength = 8 + 14
+	//the wireguard data message header and the authentication tag
+	wireGuardHeaderLength = 16 + 16
+
+	//the minimum MTU of the links, the IPv6 one is required by the RFC 8200
+	minIPv4MTU = 576
+	minIPv6MTU = 1280
+)
+
+//GetTunnelOverhead returns the bytes added to each packet by the encapsulation of the tunnel protocol, which depend on
+//the family of the addresses of the gateways
+func GetTunnelOverhead(protocol string, ipv6 bool) int {
+	overhead := ipv4HeaderLength
+	if ipv6 {
+		overhead = ipv6HeaderLength
+	}
+	switch protocol {
+	case WireGuardProtocol:
+		//the gre tunnel toward the remote cluster is encapsulated in the wireguard one
+		return overhead + udpHeaderLength + wireGuardHeaderLength + GetTunnelOverhead(GreProtocol, ipv6)
+	case GreUdpProtocol:
+		overhead += udpHeaderLength
+	}
+	if ipv6 {
+		overhead += ip6greEncapLimitLength
+	}
+	return overhead + greHeaderLength
+}
+
+//GetVxlanOverhead returns the bytes added to each packet by the vxlan encapsulation
+func GetVxlanOverhead(ipv6 bool) int {
+	if ipv6 {
+		return ipv6HeaderLength + udpHeaderLength + vxlanHeaderLength
+	}
+	return ipv4HeaderLength + udpHeaderLength + vxlanHeaderLength
+}
+
+//GetTunnelMTU returns the MTU of the tunnel interface, so that the encapsulated packets fit the MTU of the path
+//between the gateways. It is never lower than the minimum MTU of the family
+func GetTunnelMTU(pathMTU int, protocol string, ipv6 bool) int {
+	return maxInt(pathMTU-GetTunnelOverhead(protocol, ipv6), getMinMTU(ipv6))
+}
+
+func getMinMTU(ipv6 bool) int {
+	if ipv6 {
+		return minIPv6MTU
+	}
+	return minIPv4MTU
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//PathMTUProber discovers the MTU of the path toward a remote gateway
+type PathMTUProber interface {
+	ProbePathMTU(destination string, timeout time.Duration) (int, error)
+}
+
+//ICMPPathMTUProber sends ICMP echo requests which can not be fragmented, searching the largest one which gets a reply.
+//The MTU of the local interface toward the destination is the upper bound, and it is returned if the destination
+//does not reply to any request, e.g. because the ICMP traffic is filtered
+type ICMPPathMTUProber struct{}
+
+func (p *ICMPPathMTUProber) ProbePathMTU(destination string, timeout time.Duration) (int, error) {
+	dst := net.ParseIP(destination)
+	if dst == nil {
+		return 0, fmt.Errorf("unable to parse the probe destination %s", destination)
+	}
+	maxMTU, err := getRouteMTU(dst)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := listenDontFragment(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	//the largest size is tried first, since the path usually does not reduce the MTU
+	ipv6 := IsIPv6(dst)
+	id := rand.Intn(0xffff)
+	if probeSize(conn, dst, id, 1, maxMTU, timeout) {
+		return maxMTU, nil
+	}
+	low, high := getMinMTU(ipv6), maxMTU-1
+	if !probeSize(conn, dst, id, 2, low, timeout) {
+		klog.Infof("%s does not reply to the ICMP echo requests, the path MTU is assumed to be %d", destination, maxMTU)
+		return maxMTU, nil
+	}
+	//binary search of the largest size getting a reply in (low, high]
+	for seq := 3; low < high; seq++ {
+		size := (low + high + 1) / 2
+		if probeSize(conn, dst, id, seq, size, timeout) {
+			low = size
+		} else {
+			high = size - 1
+		}
+	}
+	return low, nil
+}
+
+//returns the MTU of the route toward the destination, which is the one of its interface if not set
+func getRouteMTU(dst net.IP) (int, error) {
+	routes, err := netlink.RouteGet(dst)
+	if err != nil || len(routes) == 0 {
+		return 0, fmt.Errorf("unable to get the route toward %s: %v", dst, err)
+	}
+	if routes[0].MTU > 0 {
+		return routes[0].MTU, nil
+	}
+	link, err := netlink.LinkByIndex(routes[0].LinkIndex)
+	if err != nil {
+		return 0, fmt.Errorf("unable to retrieve link with index %d :%v", routes[0].LinkIndex, err)
+	}
+	return link.Attrs().MTU, nil
+}
+
+//opens a raw icmp socket setting the don't fragment flag on the packets. The path MTU cached by the kernel is ignored,
+//so that the sizes larger than the one currently known can be probed
+func listenDontFragment(dst net.IP) (net.PacketConn, error) {
+	network, level, option, value := "ip4:icmp", syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE
+	if IsIPv6(dst) {
+		network, level, option, value = "ip6:ipv6-icmp", syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the icmp socket: %v", err)
+	}
+	rawConn, err := conn.(*net.IPConn).SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), level, option, value)
+	})
+	if err == nil {
+		err = sockErr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to set the don't fragment flag on the icmp socket: %v", err)
+	}
+	return conn, nil
+}
+
+//sends an echo request of the given size, including the IP header, returning whether the reply has been received
+func probeSize(conn net.PacketConn, dst net.IP, id, seq, size int, timeout time.Duration) bool {
+	protocol, headerLength := icmpProtocolNumber, ipv4HeaderLength
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if IsIPv6(dst) {
+		protocol, headerLength = icmpv6ProtocolNumber, ipv6HeaderLength
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	request := icmp.Message{
+		Type: requestType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, size-headerLength-icmpHeaderLength)},
+	}
+	data, err := request.Marshal(nil)
+	if err != nil {
+		return false
+	}
+	start := time.Now()
+	//the packets larger than the MTU of the local interface are not sent
+	if _, err := conn.WriteTo(data, &net.IPAddr{IP: dst}); err != nil {
+		return false
+	}
+	_, ok := waitEchoReply(conn, protocol, replyType, dst, id, seq, start, timeout)
+	return ok
+}
@@ -0,0 +1,67 @@
+package liqonet
+
+import (
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	"sort"
+)
+
+const (
+	//MaxTransitHops is the maximum number of tunnels crossed to reach a cluster through the neighbors, the routes
+	//exceeding it are neither installed nor advertised, which bounds the lifetime of the stale ones
+	MaxTransitHops = 3
+	//the clusters reached through a peering cluster are reserved with the clusterID of the peering cluster plus this
+	//infix plus the clusterID of the reached cluster as key
+	TransitSubnetInfix = "-via-"
+)
+
+//GetNeighborNetworks returns the clusters the local cluster advertises as its neighbors to the given peering cluster:
+//the ones with an established tunnel, at the pod CIDR they are reached at from the local cluster, and the ones reached
+//through them. The peering cluster and the clusters reached through it are left out, so that the routes do not loop
+//back to it, as well as the ones the peering cluster would reach crossing more than MaxTransitHops tunnels
+func GetNeighborNetworks(tunEndpoints []liqonetv1.TunnelEndpoint, peerClusterID string) []liqonetv1.NeighborNetwork {
+	var neighbors []liqonetv1.NeighborNetwork
+	for i := range tunEndpoints {
+		tep := &tunEndpoints[i]
+		if tep.Spec.ClusterID == peerClusterID || tep.Status.Phase != "Ready" {
+			continue
+		}
+		neighbors = append(neighbors, liqonetv1.NeighborNetwork{
+			ClusterID: tep.Spec.ClusterID,
+			PodCIDR:   GetRemotePodCIDR(tep),
+			Hops:      1,
+		})
+		for _, route := range tep.Status.TransitRoutes {
+			if route.ClusterID == peerClusterID || route.Hops+1 > MaxTransitHops {
+				continue
+			}
+			neighbors = append(neighbors, liqonetv1.NeighborNetwork{
+				ClusterID: route.ClusterID,
+				PodCIDR:   GetTransitPodCIDR(route),
+				Hops:      route.Hops,
+			})
+		}
+	}
+	//the order is stable, so that the neighbors are not updated when nothing changes
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].ClusterID < neighbors[j].ClusterID
+	})
+	return neighbors
+}
+
+//GetRemotePodCIDR returns the pod CIDR of the remote cluster as reached from the local cluster, the remapped one if it
+//overlaps with the local subnets
+func GetRemotePodCIDR(tep *liqonetv1.TunnelEndpoint) string {
+	if tep.Status.RemoteRemappedPodCIDR != "None" && tep.Status.RemoteRemappedPodCIDR != "" {
+		return tep.Status.RemoteRemappedPodCIDR
+	}
+	return tep.Spec.PodCIDR
+}
+
+//GetTransitPodCIDR returns the pod CIDR of the cluster reached through a peering cluster as reached from the local
+//cluster, the remapped one if it overlaps with the local subnets
+func GetTransitPodCIDR(route liqonetv1.TransitRoute) string {
+	if route.RemappedPodCIDR != "None" && route.RemappedPodCIDR != "" {
+		return route.RemappedPodCIDR
+	}
+	return route.PodCIDR
+}
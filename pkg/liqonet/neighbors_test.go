@@ -0,0 +1,44 @@
+package liqonet
+
+import (
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getNeighborTunnelEndpoint(clusterID, podCIDR, remappedPodCIDR, phase string, routes ...liqonetv1.TransitRoute) liqonetv1.TunnelEndpoint {
+	return liqonetv1.TunnelEndpoint{
+		Spec: liqonetv1.TunnelEndpointSpec{ClusterID: clusterID, PodCIDR: podCIDR},
+		Status: liqonetv1.TunnelEndpointStatus{
+			Phase:                 phase,
+			RemoteRemappedPodCIDR: remappedPodCIDR,
+			TransitRoutes:         routes,
+		},
+	}
+}
+
+func TestGetNeighborNetworks(t *testing.T) {
+	tunEndpoints := []liqonetv1.TunnelEndpoint{
+		getNeighborTunnelEndpoint("cluster-c", "10.100.0.0/16", "10.50.0.0/16", "Ready",
+			liqonetv1.TransitRoute{ClusterID: "cluster-d", PodCIDR: "10.200.0.0/16", RemappedPodCIDR: "None", Hops: 2},
+			liqonetv1.TransitRoute{ClusterID: "cluster-e", PodCIDR: "10.100.0.0/16", RemappedPodCIDR: "10.51.0.0/16", Hops: 2},
+			liqonetv1.TransitRoute{ClusterID: "cluster-f", PodCIDR: "10.201.0.0/16", RemappedPodCIDR: "None", Hops: MaxTransitHops},
+			liqonetv1.TransitRoute{ClusterID: "cluster-b", PodCIDR: "10.202.0.0/16", RemappedPodCIDR: "None", Hops: 2}),
+		getNeighborTunnelEndpoint("cluster-b", "10.0.0.0/16", "None", "Ready",
+			liqonetv1.TransitRoute{ClusterID: "cluster-g", PodCIDR: "10.203.0.0/16", RemappedPodCIDR: "None", Hops: 2}),
+		getNeighborTunnelEndpoint("cluster-h", "10.1.0.0/16", "None", "Processed"),
+	}
+	//the peering cluster, the clusters reached through it, the ones too far and the ones without an established
+	//tunnel are not advertised; the others are advertised at the pod CIDR they are reached at from the local cluster
+	neighbors := GetNeighborNetworks(tunEndpoints, "cluster-b")
+	assert.Equal(t, []liqonetv1.NeighborNetwork{
+		{ClusterID: "cluster-c", PodCIDR: "10.50.0.0/16", Hops: 1},
+		{ClusterID: "cluster-d", PodCIDR: "10.200.0.0/16", Hops: 2},
+		{ClusterID: "cluster-e", PodCIDR: "10.51.0.0/16", Hops: 2},
+	}, neighbors)
+	neighbors = GetNeighborNetworks(tunEndpoints, "cluster-c")
+	assert.Equal(t, []liqonetv1.NeighborNetwork{
+		{ClusterID: "cluster-b", PodCIDR: "10.0.0.0/16", Hops: 1},
+		{ClusterID: "cluster-g", PodCIDR: "10.203.0.0/16", Hops: 2},
+	}, neighbors)
+}
@@ -0,0 +1,921 @@
+package liqonet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	//the backends the rules of the route operator are applied through
+	IPTablesBackend = "iptables"
+	NFTablesBackend = "nftables"
+	//the table containing the chains and the rules not related to a remote cluster
+	nftMainTable = "liqo"
+	//the prefix of the tables containing the rules of a remote cluster, followed by its cluster ID
+	nftPeerTablePrefix = "liqo-"
+	//the base chains are evaluated before the ones with the same hook of the other tables, e.g. the ones of iptables-nft
+	nftPriorityOffset = -10
+	//the flavors of iptables, i.e. the kernel interface the rules are applied through. The binaries of each flavor
+	//are named after it, e.g. iptables-legacy and ip6tables-nft
+	IPTablesLegacyFlavor = "legacy"
+	IPTablesNFTFlavor    = "nft"
+)
+
+//the iptables commands go-iptables runs, which are linked to the ones of the flavor of the node
+var iptablesCommands = []string{"iptables", "ip6tables"}
+
+//the files listing the tables in use through the legacy iptables, they exist only if the modules are loaded
+var legacyIPTablesNamesPaths = []string{"/proc/net/ip_tables_names", "/proc/net/ip6_tables_names"}
+
+//the names of the tables of iptables-nft, i.e. of the iptables tables created through nftables
+var iptablesNFTTables = []string{"filter", "nat", "mangle", "raw", "security"}
+
+//the characters not allowed in the name of a chain or of a table
+var nftInvalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+type nftHook struct {
+	chainType string
+	hook      string
+	priority  int
+}
+
+//the base chains corresponding to the built-in chains of iptables
+var nftBuiltinChains = map[IPTableChain]nftHook{
+	{Table: "mangle", Name: "PREROUTING"}: {chainType: "filter", hook: "prerouting", priority: -150},
+	{Table: "nat", Name: "PREROUTING"}:    {chainType: "nat", hook: "prerouting", priority: -100},
+	{Table: "nat", Name: "INPUT"}:         {chainType: "nat", hook: "input", priority: 100},
+	{Table: "nat", Name: "OUTPUT"}:        {chainType: "nat", hook: "output", priority: -100},
+	{Table: "nat", Name: "POSTROUTING"}:   {chainType: "nat", hook: "postrouting", priority: 100},
+	{Table: "filter", Name: "INPUT"}:      {chainType: "filter", hook: "input", priority: 0},
+	{Table: "filter", Name: "FORWARD"}:    {chainType: "filter", hook: "forward", priority: 0},
+	{Table: "filter", Name: "OUTPUT"}:     {chainType: "filter", hook: "output", priority: 0},
+}
+
+//the built-in chains in the order they are listed
+var nftBuiltinChainNames = []string{"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"}
+
+//PeerIPTables is implemented by the backends grouping the rules of each remote cluster, which are replaced at once
+type PeerIPTables interface {
+	IPTables
+	//SetPeerRules replaces the rules of the remote cluster, in the order they have in their chains
+	SetPeerRules(clusterID string, rules []IPtableRule) error
+	DeletePeerRules(clusterID string) error
+	//CheckRules returns whether the rules installed in the kernel for the remote cluster are the expected ones, the
+	//empty clusterID refers to the chains and the rules not related to a remote cluster
+	CheckRules(clusterID string) (bool, error)
+	//RestoreRules installs again the chains and the rules not related to a remote cluster
+	RestoreRules() error
+	//RemoveStalePeerRules removes the rules of the remote clusters not in the list, returning how many they were
+	RemoveStalePeerRules(clusterIDs []string) (int, error)
+}
+
+//NFTRunner applies a script of nftables commands in a single transaction and lists the tables of the inet family
+type NFTRunner interface {
+	Run(script string) error
+	//returns the content of the table, empty if it does not exist
+	List(table string) (string, error)
+	ListTables() ([]string, error)
+}
+
+//lists the tables of all the families, in the "table <family> <name>" format, it is replaced in the tests
+var listAllNFTTables = func() (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("nft", "list", "tables")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("unable to list the nftables tables: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+//NFTCommand applies the scripts through the nft binary
+type NFTCommand struct{}
+
+func (c *NFTCommand) Run(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("unable to apply the nftables rules: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (c *NFTCommand) List(table string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("nft", "list", "table", "inet", table)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "No such file or directory") {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to list the nftables table %s: %v: %s", table, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (c *NFTCommand) ListTables() ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("nft", "list", "tables", "inet")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("unable to list the nftables tables: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	//each line has the "table inet <name>" format
+	var tables []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "table" {
+			tables = append(tables, fields[2])
+		}
+	}
+	return tables, nil
+}
+
+//DetectFirewallBackend returns the backend used by the node: iptables if the iptables tables are in use, through the
+//flavor returned by DetectIPTablesFlavor, since an accept in another table does not override their drops, e.g. the
+//drop policy of the FORWARD chain, while the rules added through the same flavor are evaluated in their chains. On the
+//nodes using iptables-nft the rules are then kept in nftables as well. nftables otherwise, if the nft binary is available
+func DetectFirewallBackend() string {
+	if DetectIPTablesFlavor() != "" {
+		return IPTablesBackend
+	}
+	if _, err := exec.LookPath("nft"); err != nil {
+		return IPTablesBackend
+	}
+	return NFTablesBackend
+}
+
+//DetectIPTablesFlavor returns the flavor of the iptables tables in use on the node, e.g. the ones of kube-proxy, or an
+//empty string if there are none. The legacy tables take precedence, since the rules of the nft flavor would be
+//evaluated independently of theirs
+func DetectIPTablesFlavor() string {
+	for _, path := range legacyIPTablesNamesPaths {
+		if data, err := ioutil.ReadFile(path); err == nil && len(bytes.TrimSpace(data)) > 0 {
+			return IPTablesLegacyFlavor
+		}
+	}
+	if IPTablesNFTInUse() {
+		return IPTablesNFTFlavor
+	}
+	return ""
+}
+
+//UseIPTablesFlavor makes the iptables and ip6tables commands run the binaries of the flavor, since the one they default
+//to in the image can differ from the one of the node. The commands are linked in the directory, which is prepended to
+//the PATH, and are resolved when the iptables clients are created
+func UseIPTablesFlavor(flavor, dir string) error {
+	for _, command := range iptablesCommands {
+		binary, err := exec.LookPath(command + "-" + flavor)
+		if err != nil {
+			return fmt.Errorf("the %s flavor of %s is not available: %v", flavor, command, err)
+		}
+		link := filepath.Join(dir, command)
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		//the multi-call binaries select the command through the name they are run with, hence the link to the
+		//binary of the flavor is named after the generic command
+		if err := os.Symlink(binary, link); err != nil {
+			return err
+		}
+	}
+	return os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+//IPTablesNFTInUse returns whether the node has tables created through iptables-nft, whose drops can not be overridden
+//by the rules of the nftables backend. It returns false if the tables can not be listed
+func IPTablesNFTInUse() bool {
+	listing, err := listAllNFTTables()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "table" || (fields[1] != "ip" && fields[1] != "ip6") {
+			continue
+		}
+		if ContainsString(iptablesNFTTables, fields[2]) {
+			return true
+		}
+	}
+	return false
+}
+
+//NFTables implements the IPTables interface through nftables. The chains and the rules are kept in the "liqo" table of
+//the inet family, which handles both IPv4 and IPv6, and the rules of each remote cluster, set through the PeerIPTables
+//interface, in a table of its own, e.g. liqo-<clusterID>. Each change replaces a single table in a single transaction,
+//hence the rules of a remote cluster which can not be applied do not affect the other clusters.
+//The base chains of the table of a remote cluster contain the jumps of the built-in chains toward the chains it has
+//rules in, so that its rules are evaluated under the same conditions of the iptables ones. Since the verdicts of
+//different tables are independent, a drop of a remote cluster is final while its accepts do not override the drops
+//of the other tables; the first translation of a nat chain is instead final, since the connection is bound to it
+type NFTables struct {
+	Runner NFTRunner
+	mutex  sync.Mutex
+	//the custom chains of the main table, in the order they have been created
+	chains []IPTableChain
+	//the rules of the chains of the main table, the built-in ones included
+	rules map[IPTableChain][][]string
+	//the rules of the remote clusters
+	peers map[string][]IPtableRule
+}
+
+func NewNFTables(runner NFTRunner) *NFTables {
+	return &NFTables{
+		Runner: runner,
+		rules:  make(map[IPTableChain][][]string),
+		peers:  make(map[string][]IPtableRule),
+	}
+}
+
+func (n *NFTables) Insert(table string, chain string, pos int, rulespec ...string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	if !n.chainExists(key) {
+		return fmt.Errorf("the chain %s does not exist in table %s", chain, table)
+	}
+	rules := n.rules[key]
+	index := pos - 1
+	if index < 0 || index > len(rules) {
+		return fmt.Errorf("the position %d is not valid for chain %s in table %s", pos, chain, table)
+	}
+	updated := make([][]string, 0, len(rules)+1)
+	updated = append(updated, rules[:index]...)
+	updated = append(updated, rulespec)
+	updated = append(updated, rules[index:]...)
+	return n.updateRules(key, updated)
+}
+
+func (n *NFTables) Delete(table string, chain string, rulespec ...string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	rules := n.rules[key]
+	index := indexOfRuleSpec(rules, rulespec)
+	//as for the other operations of the backend the deletion is idempotent
+	if index == -1 {
+		return nil
+	}
+	updated := make([][]string, 0, len(rules)-1)
+	updated = append(updated, rules[:index]...)
+	updated = append(updated, rules[index+1:]...)
+	return n.updateRules(key, updated)
+}
+
+func (n *NFTables) Exists(table string, chain string, rulespec ...string) (bool, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return indexOfRuleSpec(n.rules[IPTableChain{Table: table, Name: chain}], rulespec) != -1, nil
+}
+
+func (n *NFTables) ListChains(table string) ([]string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	var chains []string
+	for _, name := range nftBuiltinChainNames {
+		if _, ok := nftBuiltinChains[IPTableChain{Table: table, Name: name}]; ok {
+			chains = append(chains, name)
+		}
+	}
+	for _, chain := range n.chains {
+		if chain.Table == table {
+			chains = append(chains, chain.Name)
+		}
+	}
+	return chains, nil
+}
+
+func (n *NFTables) NewChain(table string, chain string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	if n.chainExists(key) {
+		return fmt.Errorf("the chain %s already exists in table %s", chain, table)
+	}
+	n.chains = append(n.chains, key)
+	if err := n.commit(); err != nil {
+		n.chains = n.chains[:len(n.chains)-1]
+		return err
+	}
+	return nil
+}
+
+//List returns the rules of the chain in the format of iptables-save, as go-iptables does
+func (n *NFTables) List(table, chain string) ([]string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	if !n.chainExists(key) {
+		return nil, fmt.Errorf("the chain %s does not exist in table %s", chain, table)
+	}
+	var rules []string
+	if _, ok := nftBuiltinChains[key]; ok {
+		rules = append(rules, fmt.Sprintf("-P %s ACCEPT", chain))
+	} else {
+		rules = append(rules, fmt.Sprintf("-N %s", chain))
+	}
+	for _, rulespec := range n.rules[key] {
+		rules = append(rules, fmt.Sprintf("-A %s %s", chain, strings.Join(rulespec, " ")))
+	}
+	return rules, nil
+}
+
+func (n *NFTables) AppendUnique(table string, chain string, rulespec ...string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	if !n.chainExists(key) {
+		return fmt.Errorf("the chain %s does not exist in table %s", chain, table)
+	}
+	rules := n.rules[key]
+	if indexOfRuleSpec(rules, rulespec) != -1 {
+		return nil
+	}
+	updated := make([][]string, 0, len(rules)+1)
+	updated = append(updated, rules...)
+	return n.updateRules(key, append(updated, rulespec))
+}
+
+//ClearChain removes the rules of the chain, which is created if it does not exist, as go-iptables does.
+//The rules of the remote clusters are removed only through the PeerIPTables interface
+func (n *NFTables) ClearChain(table, chain string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	if !n.chainExists(key) {
+		n.chains = append(n.chains, key)
+		if err := n.commit(); err != nil {
+			n.chains = n.chains[:len(n.chains)-1]
+			return err
+		}
+		return nil
+	}
+	return n.updateRules(key, nil)
+}
+
+func (n *NFTables) DeleteChain(table, chain string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := IPTableChain{Table: table, Name: chain}
+	if _, ok := nftBuiltinChains[key]; ok {
+		return fmt.Errorf("the built-in chain %s can not be deleted", chain)
+	}
+	if len(n.rules[key]) > 0 {
+		return fmt.Errorf("the chain %s in table %s is not empty", chain, table)
+	}
+	for i, existing := range n.chains {
+		if existing == key {
+			chains := n.chains
+			n.chains = append(append([]IPTableChain{}, chains[:i]...), chains[i+1:]...)
+			if err := n.commit(); err != nil {
+				n.chains = chains
+				return err
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func (n *NFTables) SetPeerRules(clusterID string, rules []IPtableRule) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	chains, err := n.getPeerChains(rules)
+	if err != nil {
+		return err
+	}
+	if err := n.Runner.Run(renderNFTable(getPeerTableName(clusterID), chains)); err != nil {
+		return err
+	}
+	n.peers[clusterID] = append([]IPtableRule{}, rules...)
+	return nil
+}
+
+func (n *NFTables) DeletePeerRules(clusterID string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if _, existed := n.peers[clusterID]; !existed {
+		return nil
+	}
+	if err := n.Runner.Run(renderNFTable(getPeerTableName(clusterID), nil)); err != nil {
+		return err
+	}
+	delete(n.peers, clusterID)
+	return nil
+}
+
+func (n *NFTables) CheckRules(clusterID string) (bool, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	var chains []nftChain
+	var err error
+	table := nftMainTable
+	if clusterID == "" {
+		chains, err = n.getMainChains()
+	} else {
+		table = getPeerTableName(clusterID)
+		chains, err = n.getPeerChains(n.peers[clusterID])
+	}
+	if err != nil {
+		return false, err
+	}
+	listing, err := n.Runner.List(table)
+	if err != nil {
+		return false, err
+	}
+	if len(chains) == 0 {
+		return listing == "", nil
+	}
+	//the rules are listed in the format of nft, hence only their number is compared
+	installed := countNFTRules(listing)
+	for _, chain := range chains {
+		if count, ok := installed[chain.name]; !ok || count != len(chain.rules) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (n *NFTables) RestoreRules() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.commit()
+}
+
+//RemoveStalePeerRules removes the tables of the remote clusters not in the list, the ones installed before a restart
+//included
+func (n *NFTables) RemoveStalePeerRules(clusterIDs []string) (int, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	expected := make(map[string]bool)
+	for _, clusterID := range clusterIDs {
+		expected[getPeerTableName(clusterID)] = true
+	}
+	for clusterID := range n.peers {
+		if !expected[getPeerTableName(clusterID)] {
+			delete(n.peers, clusterID)
+		}
+	}
+	tables, err := n.Runner.ListTables()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, table := range tables {
+		if !strings.HasPrefix(table, nftPeerTablePrefix) || expected[table] {
+			continue
+		}
+		if err := n.Runner.Run(renderNFTable(table, nil)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+//returns the number of rules of each chain in the listing of a table, i.e. the lines of the chain which are not
+//declarations
+func countNFTRules(listing string) map[string]int {
+	rules := make(map[string]int)
+	chain := ""
+	for _, line := range strings.Split(listing, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "chain "):
+			chain = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "chain "), "{"))
+			rules[chain] = 0
+		case line == "}":
+			chain = ""
+		case chain != "" && line != "" && !strings.HasPrefix(line, "type ") && !strings.HasPrefix(line, "policy "):
+			rules[chain]++
+		}
+	}
+	return rules
+}
+
+func (n *NFTables) chainExists(key IPTableChain) bool {
+	if _, ok := nftBuiltinChains[key]; ok {
+		return true
+	}
+	for _, chain := range n.chains {
+		if chain == key {
+			return true
+		}
+	}
+	return false
+}
+
+//replaces the rules of the chain, the previous ones are restored if they can not be applied
+func (n *NFTables) updateRules(key IPTableChain, rules [][]string) error {
+	previous, existed := n.rules[key]
+	n.rules[key] = rules
+	if err := n.commit(); err != nil {
+		if existed {
+			n.rules[key] = previous
+		} else {
+			delete(n.rules, key)
+		}
+		return err
+	}
+	return nil
+}
+
+//applies the main table, which is removed if it contains no rules and no chains
+func (n *NFTables) commit() error {
+	chains, err := n.getMainChains()
+	if err != nil {
+		return err
+	}
+	return n.Runner.Run(renderNFTable(nftMainTable, chains))
+}
+
+//returns the chains not related to a remote cluster, the base chains are created only if they have rules
+func (n *NFTables) getMainChains() ([]nftChain, error) {
+	var chains []nftChain
+	for _, key := range getBuiltinChainKeys() {
+		if len(n.rules[key]) == 0 {
+			continue
+		}
+		chain, err := n.getChain(key, n.rules[key])
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	for _, key := range n.chains {
+		chain, err := n.getChain(key, n.rules[key])
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+//returns the chains of the table of a remote cluster: the base chains, containing its rules of the built-in chains and
+//the jumps toward the other chains it has rules in, followed by these chains
+func (n *NFTables) getPeerChains(rules []IPtableRule) ([]nftChain, error) {
+	rulesPerChain := make(map[IPTableChain][][]string)
+	for _, rule := range rules {
+		key := IPTableChain{Table: rule.Table, Name: rule.Chain}
+		rulesPerChain[key] = append(rulesPerChain[key], rule.RuleSpec)
+	}
+	var regular []IPTableChain
+	for _, key := range getPeerChainKeys(rules) {
+		if !n.chainExists(key) {
+			return nil, fmt.Errorf("the chain %s does not exist in table %s", key.Name, key.Table)
+		}
+		if _, ok := nftBuiltinChains[key]; ok {
+			continue
+		}
+		regular = append(regular, key)
+		//the jumps are evaluated before the rules of the cluster in the built-in chains, if any
+		jumps := n.getJumpsTo(key)
+		if len(jumps) == 0 {
+			return nil, fmt.Errorf("the chain %s in table %s is not referenced by a built-in chain", key.Name, key.Table)
+		}
+		for builtin, rulespecs := range jumps {
+			rulesPerChain[builtin] = append(rulespecs, rulesPerChain[builtin]...)
+		}
+	}
+	var chains []nftChain
+	for _, key := range getBuiltinChainKeys() {
+		if len(rulesPerChain[key]) == 0 {
+			continue
+		}
+		chain, err := n.getChain(key, rulesPerChain[key])
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	for _, key := range regular {
+		chain, err := n.getChain(key, rulesPerChain[key])
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+//returns the rules of the built-in chains jumping to the chain, keyed by the built-in chain
+func (n *NFTables) getJumpsTo(key IPTableChain) map[IPTableChain][][]string {
+	jumps := make(map[IPTableChain][][]string)
+	for _, builtin := range getBuiltinChainKeys() {
+		if builtin.Table != key.Table {
+			continue
+		}
+		for _, rulespec := range n.rules[builtin] {
+			if getRuleSpecTarget(rulespec) == key.Name {
+				jumps[builtin] = append(jumps[builtin], rulespec)
+			}
+		}
+	}
+	return jumps
+}
+
+//returns the hook the rules of the chain are evaluated at, i.e. the one of the built-in chain jumping to it
+func (n *NFTables) getChainHook(key IPTableChain) (nftHook, error) {
+	if hook, ok := nftBuiltinChains[key]; ok {
+		return hook, nil
+	}
+	jumps := n.getJumpsTo(key)
+	for _, builtin := range getBuiltinChainKeys() {
+		if _, ok := jumps[builtin]; ok {
+			return nftBuiltinChains[builtin], nil
+		}
+	}
+	return nftHook{}, fmt.Errorf("the chain %s in table %s is not referenced by a built-in chain", key.Name, key.Table)
+}
+
+type nftChain struct {
+	name string
+	//the declaration of the base chains, empty for the regular ones
+	declaration string
+	rules       []string
+}
+
+//returns the chain with the given rules, the built-in chains are declared as base chains
+func (n *NFTables) getChain(key IPTableChain, rulespecs [][]string) (nftChain, error) {
+	chain := nftChain{name: getNFTChainName(key)}
+	if hook, ok := nftBuiltinChains[key]; ok {
+		chain.declaration = fmt.Sprintf("type %s hook %s priority %d; policy accept;", hook.chainType, hook.hook, hook.priority+nftPriorityOffset)
+	}
+	translationHook, err := n.getChainHook(key)
+	if err != nil {
+		//the chains not referenced yet have no nat rules, which are the only ones depending on the hook
+		translationHook = nftHook{chainType: key.Table}
+	}
+	for _, rulespec := range rulespecs {
+		rule, err := translateRule(key.Table, translationHook, rulespec)
+		if err != nil {
+			return nftChain{}, err
+		}
+		chain.rules = append(chain.rules, rule)
+	}
+	return chain, nil
+}
+
+//returns the script replacing the table with the given chains, the table is only removed if there are no chains.
+//The table is declared before being deleted, so that the deletion does not fail if it does not exist
+func renderNFTable(name string, chains []nftChain) string {
+	var script strings.Builder
+	fmt.Fprintf(&script, "table inet %s\n", name)
+	fmt.Fprintf(&script, "delete table inet %s\n", name)
+	if len(chains) == 0 {
+		return script.String()
+	}
+	fmt.Fprintf(&script, "table inet %s {\n", name)
+	for _, chain := range chains {
+		fmt.Fprintf(&script, "\tchain %s {\n", chain.name)
+		if chain.declaration != "" {
+			fmt.Fprintf(&script, "\t\t%s\n", chain.declaration)
+		}
+		for _, rule := range chain.rules {
+			fmt.Fprintf(&script, "\t\t%s\n", rule)
+		}
+		script.WriteString("\t}\n")
+	}
+	script.WriteString("}\n")
+	return script.String()
+}
+
+//translates the value/mask of the --set-xmark option, which zeroes the bits of the mask and then xors the value
+func translateSetMark(mark string) (string, error) {
+	if mark == "" {
+		return "", fmt.Errorf("the --set-xmark option is required")
+	}
+	parts := strings.SplitN(mark, "/", 2)
+	value, err := strconv.ParseUint(parts[0], 0, 32)
+	if err != nil {
+		return "", err
+	}
+	mask := uint64(0xffffffff)
+	if len(parts) == 2 {
+		if mask, err = strconv.ParseUint(parts[1], 0, 32); err != nil {
+			return "", err
+		}
+	}
+	if mask == 0xffffffff {
+		return fmt.Sprintf("meta mark set 0x%x", value), nil
+	}
+	return fmt.Sprintf("meta mark set meta mark and 0x%x xor 0x%x", ^mask&0xffffffff, value), nil
+}
+
+//returns the chains the rules of a remote cluster belong to, in the order they first appear
+func getPeerChainKeys(rules []IPtableRule) []IPTableChain {
+	var keys []IPTableChain
+	seen := make(map[IPTableChain]bool)
+	for _, rule := range rules {
+		key := IPTableChain{Table: rule.Table, Name: rule.Chain}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+//returns the table of the remote cluster, the characters not allowed in a name are replaced
+func getPeerTableName(clusterID string) string {
+	return nftPeerTablePrefix + nftInvalidNameChars.ReplaceAllString(clusterID, "_")
+}
+
+//returns the built-in chains in the order they are evaluated in a table
+func getBuiltinChainKeys() []IPTableChain {
+	var keys []IPTableChain
+	for _, name := range nftBuiltinChainNames {
+		for _, table := range []string{"mangle", "nat", "filter"} {
+			key := IPTableChain{Table: table, Name: name}
+			if _, ok := nftBuiltinChains[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+//the chains of the nat and of the filter tables are in the same nftables table, hence their names are prefixed
+func getNFTChainName(key IPTableChain) string {
+	return key.Table + "-" + key.Name
+}
+
+func getRuleSpecTarget(rulespec []string) string {
+	for i := 0; i < len(rulespec)-1; i++ {
+		if rulespec[i] == "-j" || rulespec[i] == "--jump" {
+			return rulespec[i+1]
+		}
+	}
+	return ""
+}
+
+//translates the rulespec in a rule of nftables
+func translateRule(table string, hook nftHook, rulespec []string) (string, error) {
+	matches, statement, err := translateRuleSpec(table, hook, rulespec)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append(matches, statement), " "), nil
+}
+
+func indexOfRuleSpec(rules [][]string, rulespec []string) int {
+	for i, rule := range rules {
+		if strings.Join(rule, " ") == strings.Join(rulespec, " ") {
+			return i
+		}
+	}
+	return -1
+}
+
+//translates the iptables rulespec in the matches and in the statement of the equivalent nftables rule.
+//Only the options used by liqonet are supported
+func translateRuleSpec(table string, hook nftHook, rulespec []string) ([]string, string, error) {
+	ipv6, _, err := getAddressesFamily(rulespec)
+	if err != nil {
+		return nil, "", err
+	}
+	family := "ip"
+	if ipv6 {
+		family = "ip6"
+	}
+	var matches []string
+	var protocol, target, netmapTo, mark, mss, comment string
+	negated, clampMSS := false, false
+	for i := 0; i < len(rulespec); i++ {
+		option := rulespec[i]
+		if option == "!" {
+			negated = true
+			continue
+		}
+		//the options without a value
+		if option == "--clamp-mss-to-pmtu" {
+			clampMSS = true
+			continue
+		}
+		if i+1 >= len(rulespec) {
+			return nil, "", fmt.Errorf("the option %s of the rule \"%s\" has no value", option, strings.Join(rulespec, " "))
+		}
+		i++
+		value := rulespec[i]
+		operator := ""
+		if negated {
+			operator = "!= "
+			negated = false
+		}
+		switch option {
+		case "-s", "--source":
+			matches = append(matches, fmt.Sprintf("%s saddr %s%s", family, operator, value))
+		case "-d", "--destination":
+			matches = append(matches, fmt.Sprintf("%s daddr %s%s", family, operator, value))
+		case "-i", "--in-interface":
+			matches = append(matches, fmt.Sprintf("iifname %s%q", operator, value))
+		case "-o", "--out-interface":
+			matches = append(matches, fmt.Sprintf("oifname %s%q", operator, value))
+		case "-p", "--protocol":
+			protocol = value
+			matches = append(matches, fmt.Sprintf("meta l4proto %s%s", operator, value))
+		case "-m", "--match":
+			//the modules need no translation, their options are translated below
+			switch value {
+			case "tcp", "udp", "comment", "conntrack":
+			default:
+				return nil, "", fmt.Errorf("the match %s of the rule \"%s\" is not supported", value, strings.Join(rulespec, " "))
+			}
+		case "--sport", "--dport":
+			if protocol != "tcp" && protocol != "udp" {
+				return nil, "", fmt.Errorf("the option %s of the rule \"%s\" requires the tcp or the udp protocol", option, strings.Join(rulespec, " "))
+			}
+			matches = append(matches, fmt.Sprintf("%s %s %s%s", protocol, strings.TrimPrefix(option, "--"), operator, value))
+		case "--tcp-flags":
+			//the flags to examine are followed by the ones which have to be set
+			if protocol != "tcp" || i+1 >= len(rulespec) {
+				return nil, "", fmt.Errorf("the option %s of the rule \"%s\" requires the tcp protocol and two values", option, strings.Join(rulespec, " "))
+			}
+			i++
+			if operator == "" {
+				operator = "== "
+			}
+			mask := strings.ToLower(strings.ReplaceAll(value, ",", " | "))
+			matches = append(matches, fmt.Sprintf("tcp flags & (%s) %s%s", mask, operator, strings.ToLower(strings.ReplaceAll(rulespec[i], ",", " | "))))
+		case "--ctstate":
+			matches = append(matches, fmt.Sprintf("ct state %s%s", operator, strings.ToLower(value)))
+		case "--comment":
+			comment = value
+		case "-j", "--jump":
+			target = value
+		case "--to":
+			netmapTo = value
+		case "--set-xmark":
+			mark = value
+		case "--set-mss":
+			mss = value
+		default:
+			return nil, "", fmt.Errorf("the option %s of the rule \"%s\" is not supported", option, strings.Join(rulespec, " "))
+		}
+	}
+	//the source nat is applied after the routing decision, the destination one before
+	nat := "dnat"
+	natAddress := "daddr"
+	if hook.hook == "postrouting" || hook.hook == "input" {
+		nat = "snat"
+		natAddress = "saddr"
+	}
+	var statement string
+	switch target {
+	case "":
+		statement = "counter"
+	case "ACCEPT":
+		statement = "accept"
+		if table == "nat" {
+			//the traffic accepted in a nat chain would be translated anyway by the nat chains of the other tables,
+			//hence the address is translated to itself, since the first translation of a connection is the only one
+			statement = fmt.Sprintf("%s %s to %s %s", nat, family, family, natAddress)
+		}
+	case "DROP":
+		statement = "drop"
+	case "REJECT":
+		statement = "reject"
+	case "RETURN":
+		statement = "return"
+	case "MASQUERADE":
+		statement = "masquerade"
+	case "NETMAP":
+		if netmapTo == "" {
+			return nil, "", fmt.Errorf("the NETMAP target of the rule \"%s\" requires the --to option", strings.Join(rulespec, " "))
+		}
+		statement = fmt.Sprintf("%s %s prefix to %s", nat, family, netmapTo)
+	case "TCPMSS":
+		switch {
+		case clampMSS:
+			statement = "tcp option maxseg size set rt mtu"
+		case mss != "":
+			statement = "tcp option maxseg size set " + mss
+		default:
+			return nil, "", fmt.Errorf("the TCPMSS target of the rule \"%s\" requires the --set-mss or the --clamp-mss-to-pmtu option", strings.Join(rulespec, " "))
+		}
+	case "MARK":
+		if statement, err = translateSetMark(mark); err != nil {
+			return nil, "", fmt.Errorf("the MARK target of the rule \"%s\" is not valid: %v", strings.Join(rulespec, " "), err)
+		}
+	default:
+		statement = "jump " + getNFTChainName(IPTableChain{Table: table, Name: target})
+	}
+	if comment != "" {
+		statement += fmt.Sprintf(" comment %q", comment)
+	}
+	return matches, statement, nil
+}
@@ -0,0 +1,52 @@
+package liqonet
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+//MockNFTRunner records the scripts instead of applying them, and keeps the tables as they have been rendered
+type MockNFTRunner struct {
+	Scripts []string
+	Tables  map[string]string
+	Fail    bool
+}
+
+func (m *MockNFTRunner) Run(script string) error {
+	if m.Fail {
+		return errors.New("unable to apply the nftables rules")
+	}
+	m.Scripts = append(m.Scripts, script)
+	if m.Tables == nil {
+		m.Tables = make(map[string]string)
+	}
+	//the scripts start by declaring and deleting the table, followed by its new content if any
+	lines := strings.SplitN(script, "\n", 3)
+	name := strings.TrimPrefix(lines[0], "table inet ")
+	delete(m.Tables, name)
+	if len(lines) == 3 && lines[2] != "" {
+		m.Tables[name] = lines[2]
+	}
+	return nil
+}
+
+func (m *MockNFTRunner) List(table string) (string, error) {
+	return m.Tables[table], nil
+}
+
+func (m *MockNFTRunner) ListTables() ([]string, error) {
+	var tables []string
+	for table := range m.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+func (m *MockNFTRunner) LastScript() string {
+	if len(m.Scripts) == 0 {
+		return ""
+	}
+	return m.Scripts[len(m.Scripts)-1]
+}
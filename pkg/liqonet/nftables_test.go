@@ -0,0 +1,457 @@
+package liqonet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func getNFTables(t *testing.T) (*NFTables, *MockNFTRunner) {
+	runner := &MockNFTRunner{}
+	n := NewNFTables(runner)
+	assert.Nil(t, CreateIptablesChainsIfNotExist(n, "nat", "LIQONET-POSTROUTING"), "should be nil")
+	assert.Nil(t, InsertIptablesRulespecIfNotExists(n, "nat", "POSTROUTING", []string{"-j", "LIQONET-POSTROUTING"}), "should be nil")
+	assert.Nil(t, CreateIptablesChainsIfNotExist(n, "filter", "LIQONET-INPUT"), "should be nil")
+	assert.Nil(t, InsertIptablesRulespecIfNotExists(n, "filter", "INPUT", []string{"-p", "udp", "-m", "udp", "-j", "LIQONET-INPUT"}), "should be nil")
+	return n, runner
+}
+
+func TestNFTablesMainTable(t *testing.T) {
+	n, runner := getNFTables(t)
+	assert.Nil(t, n.AppendUnique("filter", "LIQONET-INPUT", "-p", "udp", "-m", "udp", "--dport", "4789", "-j", "ACCEPT"), "should be nil")
+	expected := `table inet liqo
+delete table inet liqo
+table inet liqo {
+	chain filter-INPUT {
+		type filter hook input priority -10; policy accept;
+		meta l4proto udp jump filter-LIQONET-INPUT
+	}
+	chain nat-POSTROUTING {
+		type nat hook postrouting priority 90; policy accept;
+		jump nat-LIQONET-POSTROUTING
+	}
+	chain nat-LIQONET-POSTROUTING {
+	}
+	chain filter-LIQONET-INPUT {
+		meta l4proto udp udp dport 4789 accept
+	}
+}
+`
+	assert.Equal(t, expected, runner.LastScript(), "the whole table should be replaced")
+	//the rule is not appended twice
+	scripts := len(runner.Scripts)
+	assert.Nil(t, n.AppendUnique("filter", "LIQONET-INPUT", "-p", "udp", "-m", "udp", "--dport", "4789", "-j", "ACCEPT"), "should be nil")
+	assert.Equal(t, scripts, len(runner.Scripts), "nothing should be applied")
+
+	//the rules which can not be applied are not saved
+	runner.Fail = true
+	assert.NotNil(t, n.AppendUnique("filter", "LIQONET-INPUT", "-s", "10.0.0.0/16", "-j", "ACCEPT"), "should not be nil")
+	exists, err := n.Exists("filter", "LIQONET-INPUT", "-s", "10.0.0.0/16", "-j", "ACCEPT")
+	assert.Nil(t, err, "should be nil")
+	assert.False(t, exists, "the rule should have been rolled back")
+	runner.Fail = false
+
+	//the table is removed with the last rule and chain
+	assert.Nil(t, n.ClearChain("filter", "LIQONET-INPUT"), "should be nil")
+	assert.Nil(t, n.Delete("nat", "POSTROUTING", "-j", "LIQONET-POSTROUTING"), "should be nil")
+	assert.Nil(t, n.Delete("filter", "INPUT", "-p", "udp", "-m", "udp", "-j", "LIQONET-INPUT"), "should be nil")
+	assert.Nil(t, n.DeleteChain("nat", "LIQONET-POSTROUTING"), "should be nil")
+	assert.Nil(t, n.DeleteChain("filter", "LIQONET-INPUT"), "should be nil")
+	assert.Equal(t, "table inet liqo\ndelete table inet liqo\n", runner.LastScript())
+}
+
+func TestNFTablesPeerRules(t *testing.T) {
+	n, runner := getNFTables(t)
+	main := runner.Tables["liqo"]
+	rules := []IPtableRule{
+		{Table: "nat", Chain: "LIQONET-POSTROUTING", RuleSpec: []string{"-s", "10.0.0.0/16", "-d", "10.1.0.0/16", "-j", "NETMAP", "--to", "10.100.0.0/16"}},
+		{Table: "nat", Chain: "LIQONET-POSTROUTING", RuleSpec: []string{"-s", "10.0.0.0/16", "-d", "10.1.0.0/16", "-j", "ACCEPT"}},
+		{Table: "filter", Chain: "LIQONET-INPUT", RuleSpec: []string{"-s", "fd00::/64", "-d", "fd00:1::/64", "-j", "ACCEPT"}},
+	}
+	assert.Nil(t, n.SetPeerRules("cluster-1", rules), "should be nil")
+	expected := `table inet liqo-cluster-1
+delete table inet liqo-cluster-1
+table inet liqo-cluster-1 {
+	chain filter-INPUT {
+		type filter hook input priority -10; policy accept;
+		meta l4proto udp jump filter-LIQONET-INPUT
+	}
+	chain nat-POSTROUTING {
+		type nat hook postrouting priority 90; policy accept;
+		jump nat-LIQONET-POSTROUTING
+	}
+	chain nat-LIQONET-POSTROUTING {
+		ip saddr 10.0.0.0/16 ip daddr 10.1.0.0/16 snat ip prefix to 10.100.0.0/16
+		ip saddr 10.0.0.0/16 ip daddr 10.1.0.0/16 snat ip to ip saddr
+	}
+	chain filter-LIQONET-INPUT {
+		ip6 saddr fd00::/64 ip6 daddr fd00:1::/64 accept
+	}
+}
+`
+	assert.Equal(t, expected, runner.LastScript(), "the rules of the cluster should be in a table of their own, jumped to as in the main table")
+	assert.Equal(t, main, runner.Tables["liqo"], "the main table should be untouched")
+
+	//the chains which do not exist can not be used
+	err := n.SetPeerRules("cluster-2", []IPtableRule{{Table: "filter", Chain: "LIQONET-FORWARD", RuleSpec: []string{"-d", "10.2.0.0/16", "-j", "ACCEPT"}}})
+	assert.NotNil(t, err, "should not be nil, the chain does not exist")
+	_, ok := n.peers["cluster-2"]
+	assert.False(t, ok, "the rules should not be saved")
+
+	//the rules which can not be applied are not saved, and do not affect the other clusters
+	assert.Nil(t, n.SetPeerRules("cluster-3", rules[:1]), "should be nil")
+	scripts := len(runner.Scripts)
+	err = n.SetPeerRules("cluster-3", []IPtableRule{{Table: "nat", Chain: "LIQONET-POSTROUTING", RuleSpec: []string{"-j", "NETMAP"}}})
+	assert.NotNil(t, err, "should not be nil, the rule can not be translated")
+	assert.Equal(t, scripts, len(runner.Scripts), "no table should be replaced")
+	runner.Fail = true
+	assert.NotNil(t, n.SetPeerRules("cluster-1", rules[:1]), "should not be nil")
+	assert.Equal(t, 3, len(n.peers["cluster-1"]), "the previous rules should be kept")
+	runner.Fail = false
+
+	assert.Nil(t, n.DeletePeerRules("cluster-1"), "should be nil")
+	assert.Equal(t, "table inet liqo-cluster-1\ndelete table inet liqo-cluster-1\n", runner.LastScript(), "the table of the cluster should be removed")
+	tables, err := runner.ListTables()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"liqo", "liqo-cluster-3"}, tables)
+	assert.Equal(t, 1, len(n.peers))
+}
+
+func TestNFTablesCheckRules(t *testing.T) {
+	n, runner := getNFTables(t)
+	rules := []IPtableRule{
+		{Table: "nat", Chain: "LIQONET-POSTROUTING", RuleSpec: []string{"-s", "10.0.0.0/16", "-d", "10.1.0.0/16", "-j", "ACCEPT"}},
+	}
+	assert.Nil(t, n.SetPeerRules("cluster-1", rules), "should be nil")
+	assert.Nil(t, n.SetPeerRules("cluster-2", rules), "should be nil")
+	for _, clusterID := range []string{"", "cluster-1", "cluster-2", "cluster-3"} {
+		installed, err := n.CheckRules(clusterID)
+		assert.Nil(t, err, "should be nil")
+		assert.True(t, installed, "the rules of %q should be installed", clusterID)
+	}
+
+	//the chains flushed by another component are detected
+	runner.Tables["liqo-cluster-1"] = strings.Replace(runner.Tables["liqo-cluster-1"], "\t\tip saddr 10.0.0.0/16 ip daddr 10.1.0.0/16 snat ip to ip saddr\n", "", 1)
+	installed, err := n.CheckRules("")
+	assert.Nil(t, err, "should be nil")
+	assert.True(t, installed, "the chains not related to a cluster should be untouched")
+	installed, err = n.CheckRules("cluster-1")
+	assert.Nil(t, err, "should be nil")
+	assert.False(t, installed, "the rule of the cluster should be missing")
+	assert.Nil(t, n.SetPeerRules("cluster-1", rules), "should be nil")
+	runner.Tables["liqo"] = "table inet liqo {\n}\n"
+	installed, err = n.CheckRules("")
+	assert.Nil(t, err, "should be nil")
+	assert.False(t, installed, "the table should be modified")
+	assert.Nil(t, n.RestoreRules(), "should be nil")
+	for _, clusterID := range []string{"", "cluster-1", "cluster-2"} {
+		installed, err = n.CheckRules(clusterID)
+		assert.Nil(t, err, "should be nil")
+		assert.True(t, installed, "the rules of %q should be restored", clusterID)
+	}
+
+	//the tables of the clusters not in the list are removed
+	runner.Tables["liqo-cluster-3"] = "table inet liqo-cluster-3 {\n}\n"
+	runner.Tables["firewalld"] = "table inet firewalld {\n}\n"
+	removed, err := n.RemoveStalePeerRules([]string{"cluster-1"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 2, removed)
+	tables, err := runner.ListTables()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"firewalld", "liqo", "liqo-cluster-1"}, tables)
+	_, ok := n.peers["cluster-2"]
+	assert.False(t, ok, "the rules of the stale cluster should be forgotten")
+
+	//the tables installed before a restart are removed as well
+	restarted, _ := getNFTables(t)
+	restarted.Runner = runner
+	removed, err = restarted.RemoveStalePeerRules(nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 1, removed)
+	tables, err = runner.ListTables()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"firewalld", "liqo"}, tables)
+}
+
+func TestCountNFTRules(t *testing.T) {
+	listing := `table inet liqo {
+	chain nat-LIQONET-POSTROUTING.cluster-1 {
+		ip saddr 10.0.0.0/16 ip daddr 10.1.0.0/16 snat ip prefix to 10.100.0.0/16
+		ip saddr 10.0.0.0/16 ip daddr 10.1.0.0/16 snat ip to ip saddr
+	}
+	chain nat-POSTROUTING {
+		type nat hook postrouting priority srcnat - 10; policy accept;
+	}
+}
+`
+	assert.Equal(t, map[string]int{"nat-LIQONET-POSTROUTING.cluster-1": 2, "nat-POSTROUTING": 0}, countNFTRules(listing))
+	assert.Equal(t, 0, len(countNFTRules("")))
+}
+
+//a chain parsed by parseNFTRuleset, with the hook of the base chains
+type simNFTChain struct {
+	chainType string
+	hook      string
+	priority  int
+	policy    string
+	rules     []string
+}
+
+type simNFTPacket struct {
+	saddr   string
+	daddr   string
+	oifname string
+}
+
+//parses the tables of a ruleset in the format of nft, the chains are keyed by "<table>/<chain>"
+func parseNFTRuleset(t *testing.T, ruleset string) map[string]*simNFTChain {
+	chains := make(map[string]*simNFTChain)
+	var table string
+	var chain *simNFTChain
+	for _, line := range strings.Split(ruleset, "\n") {
+		fields := strings.Fields(strings.NewReplacer(";", " ", "{", " ").Replace(line))
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "table":
+			table = fields[1] + " " + fields[2]
+		case fields[0] == "chain":
+			chain = &simNFTChain{}
+			chains[table+"/"+fields[1]] = chain
+		case fields[0] == "type":
+			priority, err := strconv.Atoi(fields[5])
+			assert.Nil(t, err, "should be nil")
+			chain.chainType, chain.hook, chain.priority, chain.policy = fields[1], fields[3], priority, fields[7]
+		case fields[0] == "}":
+			chain = nil
+		case chain != nil:
+			chain.rules = append(chain.rules, strings.TrimSpace(line))
+		}
+	}
+	return chains
+}
+
+//evaluates the packet through the base chains of the hook, in the order of their priorities. As in the kernel a drop
+//ends the evaluation while an accept ends only the base chain, and the first translation of a nat chain ends the
+//evaluation of the nat chains, since the connection is bound to it. Returns the last verdict or the translation
+func simulateNFTHook(t *testing.T, chains map[string]*simNFTChain, chainType, hook string, packet simNFTPacket) string {
+	var bases []string
+	for name, chain := range chains {
+		if chain.chainType == chainType && chain.hook == hook {
+			bases = append(bases, name)
+		}
+	}
+	sort.Slice(bases, func(i, j int) bool { return chains[bases[i]].priority < chains[bases[j]].priority })
+	verdict := "accept"
+	for _, name := range bases {
+		verdict = simulateNFTChain(t, chains, name, packet)
+		if verdict == "" {
+			verdict = chains[name].policy
+		}
+		if verdict == "drop" || (chainType == "nat" && verdict != "accept") {
+			return verdict
+		}
+	}
+	return verdict
+}
+
+//returns the verdict of the chain, empty if the packet reaches its end
+func simulateNFTChain(t *testing.T, chains map[string]*simNFTChain, name string, packet simNFTPacket) string {
+	table := strings.Split(name, "/")[0]
+	for _, rule := range chains[name].rules {
+		fields := strings.Fields(rule)
+		matched := true
+		for len(fields) > 0 && matched {
+			switch fields[0] {
+			case "ip", "oifname":
+				value := map[string]string{"saddr": packet.saddr, "daddr": packet.daddr, "oifname": packet.oifname}
+				key := fields[0]
+				if key == "ip" {
+					key, fields = fields[1], fields[1:]
+				}
+				negated := fields[1] == "!="
+				if negated {
+					fields = fields[1:]
+				}
+				expected := strings.Trim(fields[1], `"`)
+				if _, subnet, err := net.ParseCIDR(expected); err == nil {
+					matched = subnet.Contains(net.ParseIP(value[key])) != negated
+				} else {
+					matched = (value[key] == expected) != negated
+				}
+				fields = fields[2:]
+			case "jump":
+				if verdict := simulateNFTChain(t, chains, table+"/"+fields[1], packet); verdict != "" {
+					return verdict
+				}
+				fields = nil
+			case "counter":
+				fields = fields[1:]
+			case "accept", "drop", "masquerade", "snat", "dnat":
+				return strings.Join(fields, " ")
+			default:
+				t.Fatalf("the rule %q is not supported", rule)
+			}
+		}
+	}
+	return ""
+}
+
+func TestNFTablesAlongsideIPTablesNFT(t *testing.T) {
+	//the tables of a node where the CNI plugin masquerades the traffic of the pods leaving the node and the
+	//forwarded traffic is dropped, both through iptables-nft
+	iptablesNFT := `table ip nat {
+	chain POSTROUTING {
+		type nat hook postrouting priority 100; policy accept;
+		ip saddr 10.0.0.0/16 oifname != "cni0" masquerade
+	}
+}
+table ip filter {
+	chain FORWARD {
+		type filter hook forward priority 0; policy drop;
+		ip daddr 10.1.0.0/16 drop
+	}
+}
+`
+	runner := &MockNFTRunner{}
+	n := NewNFTables(runner)
+	for _, chain := range []IPTableChain{{Table: "nat", Name: "LIQONET-POSTROUTING"}, {Table: "filter", Name: "LIQONET-FORWARD"}} {
+		assert.Nil(t, CreateIptablesChainsIfNotExist(n, chain.Table, chain.Name), "should be nil")
+		assert.Nil(t, InsertIptablesRulespecIfNotExists(n, chain.Table, strings.TrimPrefix(chain.Name, "LIQONET-"), []string{"-j", chain.Name}), "should be nil")
+	}
+	assert.Nil(t, n.SetPeerRules("cluster-1", []IPtableRule{
+		{Table: "nat", Chain: "LIQONET-POSTROUTING", RuleSpec: []string{"-s", "10.0.0.0/16", "-d", "10.1.0.0/16", "-j", "ACCEPT"}},
+		{Table: "filter", Chain: "LIQONET-FORWARD", RuleSpec: []string{"-d", "10.1.0.0/16", "-j", "ACCEPT"}},
+	}), "should be nil")
+	assert.Nil(t, n.SetPeerRules("cluster-2", []IPtableRule{
+		{Table: "filter", Chain: "LIQONET-FORWARD", RuleSpec: []string{"-d", "10.2.0.0/16", "-j", "ACCEPT"}},
+		{Table: "filter", Chain: "LIQONET-FORWARD", RuleSpec: []string{"-s", "10.2.0.0/16", "-j", "DROP"}},
+	}), "should be nil")
+	toPeer := simNFTPacket{saddr: "10.0.0.5", daddr: "10.1.0.5", oifname: "liqo-wg"}
+	toInternet := simNFTPacket{saddr: "10.0.0.5", daddr: "8.8.8.8", oifname: "eth0"}
+	transit := simNFTPacket{saddr: "10.2.0.5", daddr: "10.1.0.5", oifname: "liqo-wg"}
+	var ruleset string
+	tables, err := runner.ListTables()
+	assert.Nil(t, err, "should be nil")
+	for _, table := range tables {
+		ruleset += runner.Tables[table]
+	}
+
+	//the accept of a cluster is not overridden by the rules of another cluster, while the drop of a cluster is final
+	//also for the traffic it sends toward another cluster
+	liqo := parseNFTRuleset(t, ruleset)
+	assert.Equal(t, "accept", simulateNFTHook(t, liqo, "filter", "forward", toPeer))
+	assert.Equal(t, "drop", simulateNFTHook(t, liqo, "filter", "forward", transit))
+
+	//the traffic exempted from the NAT is bound to its own address, hence the masquerading is skipped
+	node := parseNFTRuleset(t, iptablesNFT+ruleset)
+	assert.Equal(t, "snat ip to ip saddr", simulateNFTHook(t, node, "nat", "postrouting", toPeer))
+	assert.Equal(t, "masquerade", simulateNFTHook(t, node, "nat", "postrouting", toInternet))
+
+	//the drops of iptables-nft can not be overridden from another table, hence the iptables backend is used on the
+	//nodes using it, whose rules are evaluated in the chains of iptables-nft
+	assert.Equal(t, "drop", simulateNFTHook(t, node, "filter", "forward", toPeer))
+	list := listAllNFTTables
+	defer func() { listAllNFTTables = list }()
+	listAllNFTTables = func() (string, error) { return "table ip nat\ntable ip filter\ntable inet liqo\n", nil }
+	assert.True(t, IPTablesNFTInUse(), "the iptables-nft tables should be detected")
+	node["ip filter/FORWARD"].rules = append([]string{"jump LIQONET-FORWARD"}, node["ip filter/FORWARD"].rules...)
+	node["ip filter/LIQONET-FORWARD"] = &simNFTChain{rules: []string{"ip daddr 10.1.0.0/16 accept"}}
+	delete(node, "inet liqo-cluster-1/filter-FORWARD")
+	assert.Equal(t, "accept", simulateNFTHook(t, node, "filter", "forward", toPeer))
+
+	listAllNFTTables = func() (string, error) { return "table inet liqo\ntable inet firewalld\n", nil }
+	assert.False(t, IPTablesNFTInUse(), "no iptables-nft table should be detected")
+}
+
+func TestTranslateRuleSpec(t *testing.T) {
+	prerouting := nftBuiltinChains[IPTableChain{Table: "nat", Name: "PREROUTING"}]
+	matches, statement, err := translateRuleSpec("nat", prerouting, []string{"-d", "10.100.0.0/16", "-i", "liqo-wg", "-j", "NETMAP", "--to", "10.0.0.0/16"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, `ip daddr 10.100.0.0/16 iifname "liqo-wg" dnat ip prefix to 10.0.0.0/16`, strings.Join(append(matches, statement), " "))
+	forward := nftBuiltinChains[IPTableChain{Table: "filter", Name: "FORWARD"}]
+	matches, statement, err = translateRuleSpec("filter", forward, []string{"!", "-s", "10.0.0.0/16", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-m", "comment", "--comment", "test", "-j", "DROP"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, `ip saddr != 10.0.0.0/16 ct state established,related drop comment "test"`, strings.Join(append(matches, statement), " "))
+	mangle := nftBuiltinChains[IPTableChain{Table: "mangle", Name: "PREROUTING"}]
+	matches, statement, err = translateRuleSpec("mangle", mangle, []string{"-d", "10.200.0.0/16", "-j", "MARK", "--set-xmark", "0x3f1/0xffffffff"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, `ip daddr 10.200.0.0/16 meta mark set 0x3f1`, strings.Join(append(matches, statement), " "))
+	_, statement, err = translateRuleSpec("mangle", mangle, []string{"-j", "MARK", "--set-xmark", "0x1/0xff"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, `meta mark set meta mark and 0xffffff00 xor 0x1`, statement)
+	matches, statement, err = translateRuleSpec("filter", forward, []string{"-o", "liqo-wg", "-p", "tcp", "-m", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, `oifname "liqo-wg" meta l4proto tcp tcp flags & (syn | rst) == syn tcp option maxseg size set rt mtu`, strings.Join(append(matches, statement), " "))
+	_, statement, err = translateRuleSpec("filter", forward, []string{"-p", "tcp", "-m", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--set-mss", "1380"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, `tcp option maxseg size set 1380`, statement)
+
+	_, _, err = translateRuleSpec("filter", forward, []string{"-m", "physdev", "-j", "ACCEPT"})
+	assert.NotNil(t, err, "should not be nil, the match is not supported")
+	_, _, err = translateRuleSpec("filter", forward, []string{"--dport", "80", "-j", "ACCEPT"})
+	assert.NotNil(t, err, "should not be nil, the port requires the protocol")
+	_, _, err = translateRuleSpec("nat", prerouting, []string{"-j", "NETMAP"})
+	assert.NotNil(t, err, "should not be nil, the netmap target requires the --to option")
+	_, _, err = translateRuleSpec("mangle", mangle, []string{"-j", "MARK"})
+	assert.NotNil(t, err, "should not be nil, the mark target requires the --set-xmark option")
+	_, _, err = translateRuleSpec("filter", forward, []string{"-p", "tcp", "--tcp-flags", "SYN", "-j", "TCPMSS", "--set-mss", "1380"})
+	assert.NotNil(t, err, "should not be nil, the tcp flags option requires two values")
+}
+
+func TestDetectFirewallBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "liqonet")
+	assert.Nil(t, err, "should be nil")
+	defer os.RemoveAll(dir)
+	paths := legacyIPTablesNamesPaths
+	defer func() { legacyIPTablesNamesPaths = paths }()
+	legacyIPTablesNamesPaths = []string{filepath.Join(dir, "ip_tables_names")}
+	assert.Nil(t, ioutil.WriteFile(legacyIPTablesNamesPaths[0], []byte("nat\nfilter\n"), 0644), "should be nil")
+	assert.Equal(t, IPTablesBackend, DetectFirewallBackend(), "the legacy iptables are in use")
+	assert.Equal(t, IPTablesLegacyFlavor, DetectIPTablesFlavor())
+
+	//the tables of kube-proxy created through iptables-nft are handled through the same flavor
+	assert.Nil(t, os.Remove(legacyIPTablesNamesPaths[0]), "should be nil")
+	list := listAllNFTTables
+	defer func() { listAllNFTTables = list }()
+	listAllNFTTables = func() (string, error) { return "table ip nat\ntable ip filter\n", nil }
+	assert.Equal(t, IPTablesNFTFlavor, DetectIPTablesFlavor())
+	assert.Equal(t, IPTablesBackend, DetectFirewallBackend())
+	listAllNFTTables = func() (string, error) { return "", nil }
+	assert.Equal(t, "", DetectIPTablesFlavor(), "no iptables table is in use")
+}
+
+func TestUseIPTablesFlavor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "liqonet")
+	assert.Nil(t, err, "should be nil")
+	defer os.RemoveAll(dir)
+	bin, links := filepath.Join(dir, "bin"), filepath.Join(dir, "links")
+	for _, path := range []string{bin, links} {
+		assert.Nil(t, os.Mkdir(path, 0755), "should be nil")
+	}
+	for _, binary := range []string{"iptables", "iptables-legacy", "iptables-nft", "ip6tables-nft"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, binary), []byte("#!/bin/sh\n"), 0755), "should be nil")
+	}
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	assert.Nil(t, os.Setenv("PATH", bin), "should be nil")
+
+	//the generic commands run the binaries of the flavor
+	assert.Nil(t, UseIPTablesFlavor(IPTablesNFTFlavor, links), "should be nil")
+	for _, command := range iptablesCommands {
+		resolved, err := exec.LookPath(command)
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, filepath.Join(links, command), resolved)
+		target, err := os.Readlink(resolved)
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, filepath.Join(bin, command+"-nft"), target)
+	}
+	//a flavor which is not available is an error
+	assert.NotNil(t, UseIPTablesFlavor(IPTablesLegacyFlavor, links), "should not be nil, ip6tables-legacy is missing")
+}
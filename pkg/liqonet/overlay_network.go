@@ -9,12 +9,8 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"net"
 	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strconv"
-	"strings"
-)
-
-const (
-	vxlanOverhead int = 50
 )
 
 type VxlanNetConfig struct {
@@ -24,29 +20,37 @@ type VxlanNetConfig struct {
 	Vni        string `json:"Vni"`
 }
 
-func CreateVxLANInterface(clientset *kubernetes.Clientset, vxlanConfig VxlanNetConfig) error {
+//CreateVxLANInterface creates the vxlan interface of the node, configuring the address allocated to the node in the
+//vxlan network. The forwarding entries toward the other nodes are added by the route-operator as the nodes join
+func CreateVxLANInterface(c client.Client, clientset kubernetes.Interface, vxlanConfig VxlanNetConfig) error {
 	podIPAddr, err := getPodIP()
 	if err != nil {
 		return err
 	}
-	token := strings.Split(vxlanConfig.Network, "/")
-	vxlanNet := token[0]
+	nodeName, err := GetNodeName()
+	if err != nil {
+		return err
+	}
+	_, vxlanNet, err := net.ParseCIDR(vxlanConfig.Network)
+	if err != nil {
+		return fmt.Errorf("unable to parse the vxlan network %s: %v", vxlanConfig.Network, err)
+	}
 
 	//get the mtu of the default interface
-	mtu, err := getDefaultIfaceMTU()
+	mtu, err := getDefaultIfaceMTU(GetFamily(podIPAddr))
 	if err != nil {
 		return err
 	}
 
-	//derive IP for the vxlan device
-	//take the last octet of the podIP
-	//TODO: use & and | operators with masks
-	temp := strings.Split(podIPAddr.String(), ".")
-	temp1 := strings.Split(vxlanNet, ".")
-	vxlanIPString := temp1[0] + "." + temp1[1] + "." + temp1[2] + "." + temp[3]
-	vxlanIP := net.ParseIP(vxlanIPString)
+	//the address is allocated once and kept across the restarts
+	vxlanIPAddr, err := AllocateVxlanIP(c, vxlanConfig.Network, nodeName)
+	if err != nil {
+		return err
+	}
+	vxlanIP := net.ParseIP(vxlanIPAddr)
 
-	vxlanMTU := mtu - vxlanOverhead
+	//the overhead depends on the family of the addresses of the nodes
+	vxlanMTU := mtu - GetVxlanOverhead(IsIPv6(podIPAddr))
 	vni, err := strconv.Atoi(vxlanConfig.Vni)
 	if err != nil {
 		return fmt.Errorf("unable to convert vxlan vni \"%s\" from string to int: %v", vxlanConfig.Vni, err)
@@ -66,31 +70,12 @@ func CreateVxLANInterface(clientset *kubernetes.Clientset, vxlanConfig VxlanNetC
 	if err != nil {
 		return fmt.Errorf("failed to create vxlan interface on node with ip -> %s: %v", podIPAddr.String(), err)
 	}
-	err = vxlanDev.ConfigureIPAddress(vxlanIP, net.IPv4Mask(255, 255, 255, 0))
+	err = vxlanDev.ConfigureIPAddress(vxlanIP, vxlanNet.Mask)
 	if err != nil {
 		return fmt.Errorf("failed to configure ip in vxlan interface on node with ip -> %s: %v", podIPAddr.String(), err)
 	}
-
-	remoteVETPs, err := getRemoteVTEPS(clientset)
-	if err != nil {
-		return err
-	}
-
-	for _, vtep := range remoteVETPs {
-		macAddr, err := net.ParseMAC("00:00:00:00:00:00")
-		if err != nil {
-			return fmt.Errorf("unable to parse mac address. %v", err)
-		}
-		fdbEntry := Neighbor{
-			MAC: macAddr,
-			IP:  net.ParseIP(vtep),
-		}
-		err = vxlanDev.AddFDB(fdbEntry)
-		if err != nil {
-			return fmt.Errorf("an error occured while adding an fdb entry : %v", err)
-		}
-	}
-	return nil
+	//the other nodes read the address of the gateway from its annotations
+	return SetNodeVxlanIP(clientset, nodeName, vxlanIPAddr)
 }
 
 //this function enables the rp_filter on each vxlan interface on the node
@@ -112,11 +97,11 @@ func Enable_rp_filter() error {
 	return nil
 }
 
-func getDefaultIfaceMTU() (int, error) {
+func getDefaultIfaceMTU(family int) (int, error) {
 	//search for the default route and return the link associated to the route
-	//we consider only the ipv4 routes
+	//we consider only the routes of the family of the node address
 	mtu := 0
-	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	routes, err := netlink.RouteList(nil, family)
 	if err != nil {
 		return mtu, fmt.Errorf("unable to list routes while trying to identify default interface for the host: %v", err)
 	}
@@ -0,0 +1,320 @@
+package liqonet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	clusterCIDRFlag = "--cluster-cidr"
+	//the pod CIDRs of the nodes are aggregated only inside these networks, the ones usually assigned to a cluster
+	ipv4NodeCIDRsAggregationPrefixLength = 16
+	ipv6NodeCIDRsAggregationPrefixLength = 48
+)
+
+var (
+	calicoIPPoolResource = schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "ippools"}
+	//the namespaces the flannel configuration is deployed in by the different versions of its manifest
+	flannelNamespaces     = []string{"kube-system", "kube-flannel"}
+	kubeProxyClusterCIDRs = regexp.MustCompile(`(?m)^clusterCIDR:\s*"?([^"\s]*)"?\s*$`)
+)
+
+//a source of the pod CIDRs of the cluster, it returns no CIDRs if it is not available in the cluster
+type podCIDRSource struct {
+	name   string
+	detect func(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error)
+}
+
+//the resources of the CNI plugins contain the CIDRs the pods actually get their addresses from, hence they are
+//authoritative: the other sources are used only if no CNI plugin is detected
+var (
+	cniPodCIDRSources = []podCIDRSource{
+		{name: "calico", detect: detectCalicoPodCIDRs},
+		{name: "flannel", detect: detectFlannelPodCIDRs},
+		{name: "cilium", detect: detectCiliumPodCIDRs},
+	}
+	clusterPodCIDRSources = []podCIDRSource{
+		{name: "kube-controller-manager", detect: detectControllerManagerPodCIDRs},
+		{name: "kube-proxy", detect: detectKubeProxyPodCIDRs},
+		{name: "nodes", detect: detectNodesPodCIDRs},
+	}
+)
+
+//DetectPodCIDRs returns the pod CIDRs of the cluster, detected from the resources of the CNI plugin or, if no known
+//plugin is found, combining the configuration of kube-controller-manager and kube-proxy with the pod CIDRs assigned to
+//the nodes. The CIDRs contained in other ones are removed, and the CIDRs of the first source providing them come
+//first. The dynamic client can be nil, in that case the CNI plugins configured through custom resources are not
+//detected
+func DetectPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	for _, sources := range [][]podCIDRSource{cniPodCIDRSources, clusterPodCIDRSources} {
+		var podCIDRs []string
+		for _, source := range sources {
+			cidrs, err := source.detect(clientset, dynClient)
+			//the sources the component is not allowed to read are skipped
+			if k8serrors.IsForbidden(err) {
+				klog.Warningf("unable to detect the pod CIDRs from %s: %v", source.name, err)
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("unable to detect the pod CIDRs from %s: %v", source.name, err)
+			}
+			if len(cidrs) > 0 {
+				klog.Infof("pod CIDRs %v detected from %s", cidrs, source.name)
+			}
+			podCIDRs = append(podCIDRs, cidrs...)
+		}
+		if podCIDRs, err := NormalizePodCIDRs(podCIDRs); err != nil {
+			return nil, err
+		} else if len(podCIDRs) > 0 {
+			return podCIDRs, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to detect the pod CIDRs of the cluster, they have to be set in the liqonetConfig.podCIDRs field of the ClusterConfig")
+}
+
+//NormalizePodCIDRs parses the CIDRs, removing the duplicated ones and the ones contained in other CIDRs of the list.
+//The order of the list is kept
+func NormalizePodCIDRs(cidrs []string) ([]string, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("the pod CIDR %s is not valid: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	var podCIDRs []string
+	for i, network := range networks {
+		contained := false
+		for j, other := range networks {
+			ones, _ := network.Mask.Size()
+			otherOnes, _ := other.Mask.Size()
+			//of two equal CIDRs the first one is kept
+			if i != j && other.Contains(network.IP) && (otherOnes < ones || (otherOnes == ones && j < i)) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			podCIDRs = append(podCIDRs, network.String())
+		}
+	}
+	return podCIDRs, nil
+}
+
+//the enabled IP pools of calico
+func detectCalicoPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	if dynClient == nil {
+		return nil, nil
+	}
+	pools, err := dynClient.Resource(calicoIPPoolResource).List(context.TODO(), metav1.ListOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	for _, pool := range pools.Items {
+		if disabled, _, _ := unstructured.NestedBool(pool.Object, "spec", "disabled"); disabled {
+			continue
+		}
+		if cidr, _, _ := unstructured.NestedString(pool.Object, "spec", "cidr"); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+//the networks in the net-conf.json of the flannel ConfigMap
+func detectFlannelPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	for _, namespace := range flannelNamespaces {
+		configMap, err := getConfigMap(clientset, namespace, "kube-flannel-cfg")
+		if err != nil {
+			return nil, err
+		} else if configMap == nil {
+			continue
+		}
+		var netConf struct {
+			Network     string `json:"Network"`
+			IPv6Network string `json:"IPv6Network"`
+		}
+		if err := json.Unmarshal([]byte(configMap.Data["net-conf.json"]), &netConf); err != nil {
+			return nil, fmt.Errorf("unable to parse the flannel network configuration: %v", err)
+		}
+		return nonEmpty(netConf.Network, netConf.IPv6Network), nil
+	}
+	return nil, nil
+}
+
+//the cluster pool of the cilium IPAM, the other IPAM modes use the pod CIDRs of the nodes
+func detectCiliumPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	configMap, err := getConfigMap(clientset, "kube-system", "cilium-config")
+	if err != nil || configMap == nil {
+		return nil, err
+	}
+	if ipam := configMap.Data["ipam"]; ipam != "" && ipam != "cluster-pool" {
+		return nil, nil
+	}
+	var cidrs []string
+	for _, key := range []string{"cluster-pool-ipv4-cidr", "cluster-pool-ipv6-cidr"} {
+		cidrs = append(cidrs, strings.Fields(configMap.Data[key])...)
+	}
+	return cidrs, nil
+}
+
+//the --cluster-cidr flag of kube-controller-manager, running as a static pod
+func detectControllerManagerPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	return getClusterCIDRFlag(clientset, "component=kube-controller-manager")
+}
+
+//the clusterCIDR field of the kube-proxy configuration, or its --cluster-cidr flag
+func detectKubeProxyPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	configMap, err := getConfigMap(clientset, "kube-system", "kube-proxy")
+	if err != nil {
+		return nil, err
+	}
+	if configMap != nil {
+		for _, config := range configMap.Data {
+			if match := kubeProxyClusterCIDRs.FindStringSubmatch(config); match != nil && match[1] != "" {
+				return strings.Split(match[1], ","), nil
+			}
+		}
+	}
+	return getClusterCIDRFlag(clientset, "k8s-app=kube-proxy")
+}
+
+//the pod CIDRs assigned to the physical nodes, aggregated in the smallest networks containing them
+func detectNodesPodCIDRs(clientset kubernetes.Interface, dynClient dynamic.Interface) ([]string, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: "type != virtual-node"})
+	if err != nil {
+		return nil, err
+	}
+	return GetNodesPodCIDRs(nodes.Items), nil
+}
+
+//GetNodesPodCIDRs returns the pod CIDRs assigned to the nodes, the ones in the same /16 (/48 for IPv6) network are
+//replaced by the smallest network containing them
+func GetNodesPodCIDRs(nodes []corev1.Node) []string {
+	var networks []*net.IPNet
+	for _, node := range nodes {
+		podCIDRs := node.Spec.PodCIDRs
+		if len(podCIDRs) == 0 {
+			podCIDRs = nonEmpty(node.Spec.PodCIDR)
+		}
+		for _, podCIDR := range podCIDRs {
+			_, network, err := net.ParseCIDR(podCIDR)
+			if err != nil {
+				klog.Warningf("the pod CIDR %s of node %s is not valid: %v", podCIDR, node.Name, err)
+				continue
+			}
+			networks = append(networks, network)
+		}
+	}
+	return aggregateNodePodCIDRs(networks)
+}
+
+//the pod CIDRs of the nodes in the same /16 (/48 for IPv6) network are replaced by the smallest network containing
+//them, so that a single CIDR is advertised for the nodes of the cluster
+func aggregateNodePodCIDRs(networks []*net.IPNet) []string {
+	aggregated := make(map[string]*net.IPNet)
+	var keys []string
+	for _, network := range networks {
+		prefixLength := ipv4NodeCIDRsAggregationPrefixLength
+		if IsIPv6(network.IP) {
+			prefixLength = ipv6NodeCIDRsAggregationPrefixLength
+		}
+		if ones, _ := network.Mask.Size(); ones < prefixLength {
+			prefixLength = ones
+		}
+		group := &net.IPNet{IP: network.IP.Mask(net.CIDRMask(prefixLength, 8*len(network.IP))), Mask: net.CIDRMask(prefixLength, 8*len(network.IP))}
+		key := group.String()
+		if current, ok := aggregated[key]; ok {
+			aggregated[key] = getSupernet(current, network)
+		} else {
+			aggregated[key] = network
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var cidrs []string
+	for _, key := range keys {
+		cidrs = append(cidrs, aggregated[key].String())
+	}
+	return cidrs
+}
+
+//returns the smallest network containing both the networks, which have to be of the same family
+func getSupernet(a, b *net.IPNet) *net.IPNet {
+	onesA, bits := a.Mask.Size()
+	onesB, _ := b.Mask.Size()
+	ones := onesA
+	if onesB < ones {
+		ones = onesB
+	}
+	for ; ones > 0; ones-- {
+		mask := net.CIDRMask(ones, bits)
+		if a.IP.Mask(mask).Equal(b.IP.Mask(mask)) {
+			break
+		}
+	}
+	mask := net.CIDRMask(ones, bits)
+	return &net.IPNet{IP: a.IP.Mask(mask), Mask: mask}
+}
+
+//returns the CIDRs of the --cluster-cidr flag of the containers of the pods in kube-system with the given labels
+func getClusterCIDRFlag(clientset kubernetes.Interface, selector string) ([]string, error) {
+	pods, err := clientset.CoreV1().Pods("kube-system").List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			args := append(append([]string{}, container.Command...), container.Args...)
+			for i, arg := range args {
+				value := ""
+				if strings.HasPrefix(arg, clusterCIDRFlag+"=") {
+					value = strings.TrimPrefix(arg, clusterCIDRFlag+"=")
+				} else if arg == clusterCIDRFlag && i+1 < len(args) {
+					value = args[i+1]
+				}
+				if value != "" {
+					return strings.Split(value, ","), nil
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+//returns nil if the ConfigMap does not exist
+func getConfigMap(clientset kubernetes.Interface, namespace, name string) (*corev1.ConfigMap, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return configMap, nil
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package liqonet
+
+import (
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func getPodCIDRNode(name string, podCIDRs ...string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{PodCIDRs: podCIDRs},
+	}
+}
+
+func getCalicoIPPool(name, cidr string, disabled bool) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "crd.projectcalico.org/v1",
+		"kind":       "IPPool",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{"cidr": cidr, "disabled": disabled},
+	}}
+}
+
+func TestDetectPodCIDRsFromNodes(t *testing.T) {
+	//the nodes in the same /16 are aggregated, the virtual nodes are ignored
+	virtual := getPodCIDRNode("virtual", "192.168.0.0/24")
+	virtual.Labels = map[string]string{"type": "virtual-node"}
+	clientset := fake.NewSimpleClientset(getPodCIDRNode("node-1", "10.244.0.0/24"), getPodCIDRNode("node-2", "10.244.3.0/24"),
+		getPodCIDRNode("node-3", "172.16.1.0/24", "fd00:1:2:3::/64"), virtual)
+	podCIDRs, err := DetectPodCIDRs(clientset, nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.244.0.0/22", "172.16.1.0/24", "fd00:1:2:3::/64"}, podCIDRs)
+
+	//the pod CIDRs of the nodes are contained in the cluster CIDR of kube-proxy
+	clientset = fake.NewSimpleClientset(getPodCIDRNode("node-1", "10.244.0.0/24"), getPodCIDRNode("node-2", "10.245.0.0/24"),
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-proxy", Namespace: "kube-system"},
+			Data:       map[string]string{"config.conf": "apiVersion: kubeproxy.config.k8s.io/v1alpha1\nclusterCIDR: 10.244.0.0/16\nmode: iptables\n"},
+		})
+	podCIDRs, err = DetectPodCIDRs(clientset, nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.244.0.0/16", "10.245.0.0/24"}, podCIDRs)
+
+	_, err = DetectPodCIDRs(fake.NewSimpleClientset(getPodCIDRNode("node-1")), nil)
+	assert.NotNil(t, err, "should not be nil, no source provides the pod CIDRs")
+}
+
+func TestDetectPodCIDRsFromControllerManager(t *testing.T) {
+	controllerManager := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-controller-manager-master", Namespace: "kube-system",
+			Labels: map[string]string{"component": "kube-controller-manager"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:    "kube-controller-manager",
+			Command: []string{"kube-controller-manager", "--allocate-node-cidrs=true", "--cluster-cidr=10.96.0.0/12,fd00:10:96::/48"},
+		}}},
+	}
+	podCIDRs, err := DetectPodCIDRs(fake.NewSimpleClientset(controllerManager, getPodCIDRNode("node-1", "10.96.0.0/24")), nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.96.0.0/12", "fd00:10:96::/48"}, podCIDRs)
+}
+
+func TestDetectPodCIDRsFromCNI(t *testing.T) {
+	//the IP pools of calico are authoritative, the pod CIDRs of the nodes are not used
+	scheme := runtime.NewScheme()
+	dynClient := dynamicfake.NewSimpleDynamicClient(scheme, getCalicoIPPool("default-ipv4-ippool", "192.168.0.0/16", false),
+		getCalicoIPPool("additional", "172.20.0.0/16", false), getCalicoIPPool("disabled", "172.21.0.0/16", true))
+	podCIDRs, err := DetectPodCIDRs(fake.NewSimpleClientset(getPodCIDRNode("node-1", "10.244.0.0/24")), dynClient)
+	assert.Nil(t, err, "should be nil")
+	assert.ElementsMatch(t, []string{"192.168.0.0/16", "172.20.0.0/16"}, podCIDRs)
+
+	flannel := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-flannel-cfg", Namespace: "kube-flannel"},
+		Data:       map[string]string{"net-conf.json": `{"Network": "10.244.0.0/16", "Backend": {"Type": "vxlan"}}`},
+	}
+	podCIDRs, err = DetectPodCIDRs(fake.NewSimpleClientset(flannel), nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.244.0.0/16"}, podCIDRs)
+
+	//with the kubernetes IPAM cilium uses the pod CIDRs of the nodes
+	cilium := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cilium-config", Namespace: "kube-system"},
+		Data:       map[string]string{"ipam": "cluster-pool", "cluster-pool-ipv4-cidr": "10.0.0.0/8"},
+	}
+	podCIDRs, err = DetectPodCIDRs(fake.NewSimpleClientset(cilium, getPodCIDRNode("node-1", "10.244.0.0/24")), nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.0.0.0/8"}, podCIDRs)
+	cilium.Data["ipam"] = "kubernetes"
+	podCIDRs, err = DetectPodCIDRs(fake.NewSimpleClientset(cilium, getPodCIDRNode("node-1", "10.244.0.0/24")), nil)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.244.0.0/24"}, podCIDRs)
+}
+
+func TestNormalizePodCIDRs(t *testing.T) {
+	podCIDRs, err := NormalizePodCIDRs([]string{"10.244.1.0/24", "10.244.0.0/16", "10.244.0.1/16", "fd00::/48"})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []string{"10.244.0.0/16", "fd00::/48"}, podCIDRs)
+	_, err = NormalizePodCIDRs([]string{"10.244.0.0"})
+	assert.NotNil(t, err, "should not be nil, the CIDR is not valid")
+}
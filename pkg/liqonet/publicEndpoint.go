@@ -0,0 +1,58 @@
+package liqonet
+
+import (
+	"context"
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"strconv"
+)
+
+const (
+	//the local UDP port of the tunnels encapsulated in UDP
+	TunnelPort = 51820
+	//the annotation of the gateway node carrying the address and the port (address:port) the peering clusters
+	//reach the gateway at, read when building the advertisements. If missing the address of the node is used
+	PublicEndpointAnnotation = "liqonet.liqo.io/public-endpoint"
+)
+
+//GetPublicEndpoint returns the public address and port published on the gateway node, if any
+func GetPublicEndpoint(node *corev1.Node) (string, int32, bool) {
+	endpoint, ok := node.Annotations[PublicEndpointAnnotation]
+	if !ok {
+		return "", 0, false
+	}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", 0, false
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, int32(portNumber), true
+}
+
+//SetPublicEndpointAnnotation publishes the public endpoint on the gateway node, an empty address removes it
+func SetPublicEndpointAnnotation(clientset kubernetes.Interface, nodeName, address string, port int32) error {
+	value := "null"
+	if address != "" {
+		value = strconv.Quote(net.JoinHostPort(address, strconv.Itoa(int(port))))
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%s}}}`, PublicEndpointAnnotation, value)
+	_, err := clientset.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+//GetRemoteTunnelPort returns the UDP port the remote gateway is reachable at, the gateways not advertising
+//it are reached at the default tunnel port
+func GetRemoteTunnelPort(endpoint *v1.TunnelEndpoint) int {
+	if endpoint.Spec.TunnelPublicPort != 0 {
+		return int(endpoint.Spec.TunnelPublicPort)
+	}
+	return TunnelPort
+}
@@ -8,15 +8,33 @@ import (
 	"strings"
 )
 
+//the priority of the policy routing rules added by liqonet, lower than the one of the rule looking up the main table
+const RulePriority = 100
+
 type NetLink interface {
 	AddRoute(dst string, gw string, deviceName string, onLink bool) (netlink.Route, error)
+	//adds the route to the given routing table, 0 stands for the main one
+	AddRouteInTable(dst string, gw string, deviceName string, onLink bool, table int) (netlink.Route, error)
 	DelRoute(route netlink.Route) error
+	//adds the rule looking up the table for the packets carrying the firewall mark
+	AddRule(mark int, table int, ipv6 bool) (netlink.Rule, error)
+	DelRule(rule netlink.Rule) error
+	//adds to the vxlan device the forwarding entry toward a remote VTEP
+	AddFDBEntry(deviceName string, vtep string) error
+	//removes from the vxlan device the forwarding entry toward a remote VTEP
+	DelFDBEntry(deviceName string, vtep string) error
+	//returns the routes of both the families using the interface, in all the routing tables
+	ListRoutes(linkIndex int) ([]netlink.Route, error)
 }
 
 type RouteManager struct {
 }
 
 func (rm *RouteManager) AddRoute(dst string, gw string, deviceName string, onLink bool) (netlink.Route, error) {
+	return rm.AddRouteInTable(dst, gw, deviceName, onLink, 0)
+}
+
+func (rm *RouteManager) AddRouteInTable(dst string, gw string, deviceName string, onLink bool, table int) (netlink.Route, error) {
 	var route netlink.Route
 	//convert destination in *net.IPNet
 	destinationIP, destinationNet, err := net.ParseCIDR(dst)
@@ -28,11 +46,12 @@ func (rm *RouteManager) AddRoute(dst string, gw string, deviceName string, onLin
 	if err != nil {
 		return route, fmt.Errorf("unable to retrieve information of \"%s\": %v", deviceName, err)
 	}
-	route = netlink.Route{LinkIndex: iface.Attrs().Index, Dst: destinationNet, Gw: gateway}
+	route = netlink.Route{LinkIndex: iface.Attrs().Index, Dst: destinationNet, Gw: gateway, Table: table}
 	//check if already exist a route for the destination network on our device
 	//we don't care about other routes in devices not managed by liqonet. The user should check the
 	//possible ip conflicts
-	routes, err := netlink.RouteList(iface, netlink.FAMILY_V4)
+	routes, err := netlink.RouteListFiltered(GetFamily(destinationNet.IP), &netlink.Route{LinkIndex: iface.Attrs().Index, Table: getTable(table)},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
 	if err != nil {
 		return route, fmt.Errorf("unable to get routes for \"%s\": %v", destinationIP.String(), err)
 	}
@@ -65,13 +84,13 @@ func (rm *RouteManager) AddRoute(dst string, gw string, deviceName string, onLin
 		}
 	}
 	if onLink {
-		route = netlink.Route{LinkIndex: iface.Attrs().Index, Dst: destinationNet, Gw: gateway, Flags: unix.RTNH_F_ONLINK}
+		route = netlink.Route{LinkIndex: iface.Attrs().Index, Dst: destinationNet, Gw: gateway, Flags: unix.RTNH_F_ONLINK, Table: table}
 
 		if err := netlink.RouteAdd(&route); err != nil {
 			return route, fmt.Errorf("unable to instantiate route for %s  network with gateway %s:%v", dst, gw, err)
 		}
 	} else {
-		route = netlink.Route{LinkIndex: iface.Attrs().Index, Dst: destinationNet, Gw: gateway}
+		route = netlink.Route{LinkIndex: iface.Attrs().Index, Dst: destinationNet, Gw: gateway, Table: table}
 		if err := netlink.RouteAdd(&route); err != nil {
 			return route, fmt.Errorf("unable to instantiate route for %s  network with gateway %s:%v", dst, gw, err)
 		}
@@ -80,13 +99,22 @@ func (rm *RouteManager) AddRoute(dst string, gw string, deviceName string, onLin
 }
 
 func IsRouteConfigTheSame(existing *netlink.Route, new netlink.Route) bool {
-	if existing.LinkIndex == new.LinkIndex && existing.Gw.String() == new.Gw.String() && existing.Dst.String() == new.Dst.String() {
+	if existing.LinkIndex == new.LinkIndex && existing.Gw.String() == new.Gw.String() && existing.Dst.String() == new.Dst.String() &&
+		getTable(existing.Table) == getTable(new.Table) {
 		return true
 	} else {
 		return false
 	}
 }
 
+//the routes added without a table end up in the main one
+func getTable(table int) int {
+	if table == 0 {
+		return unix.RT_TABLE_MAIN
+	}
+	return table
+}
+
 //get the ip of the vxlan interface added by the flannel cni. this ip is
 //the ip of the node where the tunnel operator runs
 func GetGateway() (int, net.IP, error) {
@@ -109,8 +137,8 @@ func (rm *RouteManager) DelRoute(route netlink.Route) error {
 	//try to remove all the routes for that ip
 	err := netlink.RouteDel(&route)
 	if err != nil {
-		if err == unix.ESRCH {
-			//it means the route does not exist so we are done
+		if err == unix.ESRCH || err == unix.ENODEV {
+			//it means the route, or the interface it was using, does not exist so we are done
 			return nil
 		}
 		return fmt.Errorf("unable to delete route %v: %v", route, err)
@@ -118,6 +146,97 @@ func (rm *RouteManager) DelRoute(route netlink.Route) error {
 	return nil
 }
 
+func (rm *RouteManager) ListRoutes(linkIndex int) ([]netlink.Route, error) {
+	link, err := netlink.LinkByIndex(linkIndex)
+	if err != nil {
+		//the routes have been removed together with the interface
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to retrieve information of the interface with index %d: %v", linkIndex, err)
+	}
+	//with the table filter set to unspec the routes of all the tables are returned
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{LinkIndex: linkIndex, Table: unix.RT_TABLE_UNSPEC},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the routes of \"%s\": %v", link.Attrs().Name, err)
+	}
+	return routes, nil
+}
+
+func (rm *RouteManager) AddRule(mark int, table int, ipv6 bool) (netlink.Rule, error) {
+	rule := netlink.NewRule()
+	rule.Mark = mark
+	rule.Table = table
+	rule.Priority = RulePriority
+	rule.Family = netlink.FAMILY_V4
+	if ipv6 {
+		rule.Family = netlink.FAMILY_V6
+	}
+	rules, err := netlink.RuleList(rule.Family)
+	if err != nil {
+		return *rule, fmt.Errorf("unable to get the policy routing rules: %v", err)
+	}
+	for _, existing := range rules {
+		if existing.Mark == mark && existing.Table == table && existing.Priority == RulePriority {
+			return *rule, nil
+		}
+	}
+	if err := netlink.RuleAdd(rule); err != nil && err != unix.EEXIST {
+		return *rule, fmt.Errorf("unable to add the rule for mark %d toward table %d: %v", mark, table, err)
+	}
+	return *rule, nil
+}
+
+func (rm *RouteManager) DelRule(rule netlink.Rule) error {
+	err := netlink.RuleDel(&rule)
+	if err != nil && err != unix.ENOENT {
+		return fmt.Errorf("unable to delete rule for mark %d toward table %d: %v", rule.Mark, rule.Table, err)
+	}
+	return nil
+}
+
+func (rm *RouteManager) AddFDBEntry(deviceName string, vtep string) error {
+	device, neighbor, err := getFDBEntry(deviceName, vtep)
+	if err != nil {
+		return err
+	}
+	err = device.AddFDB(neighbor)
+	if err != nil && err != unix.EEXIST {
+		return fmt.Errorf("an error occurred while adding the fdb entry for %s: %v", vtep, err)
+	}
+	return nil
+}
+
+func (rm *RouteManager) DelFDBEntry(deviceName string, vtep string) error {
+	device, neighbor, err := getFDBEntry(deviceName, vtep)
+	if err != nil {
+		return err
+	}
+	err = device.DelFDB(neighbor)
+	if err != nil && err != unix.ENOENT {
+		return fmt.Errorf("an error occurred while removing the fdb entry for %s: %v", vtep, err)
+	}
+	return nil
+}
+
+//returns the vxlan device and the forwarding entry toward the VTEP, used for the broadcast and unknown traffic
+func getFDBEntry(deviceName string, vtep string) (*VxlanDevice, Neighbor, error) {
+	link, err := netlink.LinkByName(deviceName)
+	if err != nil {
+		return nil, Neighbor{}, fmt.Errorf("unable to retrieve information of \"%s\": %v", deviceName, err)
+	}
+	vxlan, ok := link.(*netlink.Vxlan)
+	if !ok {
+		return nil, Neighbor{}, fmt.Errorf("the interface \"%s\" is not a vxlan device", deviceName)
+	}
+	macAddr, err := net.ParseMAC("00:00:00:00:00:00")
+	if err != nil {
+		return nil, Neighbor{}, fmt.Errorf("unable to parse mac address. %v", err)
+	}
+	return &VxlanDevice{Link: vxlan}, Neighbor{MAC: macAddr, IP: net.ParseIP(vtep)}, nil
+}
+
 func StringtoIPNet(ipNet string) (net.IP, error) {
 	ip, _, err := net.ParseCIDR(ipNet)
 	if err != nil {
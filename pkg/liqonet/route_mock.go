@@ -10,9 +10,32 @@ import (
 
 type MockRouteManager struct {
 	RouteList []netlink.Route
+	//the policy routing rules added
+	RuleList []netlink.Rule
+	//the remote VTEPs added to the forwarding database of the vxlan device
+	FDBEntries []string
+	//the indexes assigned to the interfaces the routes have been added to
+	ifaceIndexes map[string]int
+}
+
+//returns the index of the interface, the first one gets index 12
+func (m *MockRouteManager) getIfaceIndex(deviceName string) int {
+	if m.ifaceIndexes == nil {
+		m.ifaceIndexes = make(map[string]int)
+	}
+	if index, ok := m.ifaceIndexes[deviceName]; ok {
+		return index
+	}
+	index := 12 + len(m.ifaceIndexes)
+	m.ifaceIndexes[deviceName] = index
+	return index
 }
 
 func (m *MockRouteManager) AddRoute(dst string, gw string, deviceName string, onLink bool) (netlink.Route, error) {
+	return m.AddRouteInTable(dst, gw, deviceName, onLink, 0)
+}
+
+func (m *MockRouteManager) AddRouteInTable(dst string, gw string, deviceName string, onLink bool, table int) (netlink.Route, error) {
 	var route netlink.Route
 	//convert destination in *net.IPNet
 	_, destinationNet, err := net.ParseCIDR(dst)
@@ -20,14 +43,24 @@ func (m *MockRouteManager) AddRoute(dst string, gw string, deviceName string, on
 		return route, fmt.Errorf("unable to convert destination \"%s\" from string to net.IPNet: %v", dst, err)
 	}
 	gateway := net.ParseIP(gw)
-	//here we keep the iface index at a fixed value
-	ifaceIndex := 12
+	ifaceIndex := m.getIfaceIndex(deviceName)
 
-	route = netlink.Route{LinkIndex: ifaceIndex, Dst: destinationNet, Gw: gateway}
+	route = netlink.Route{LinkIndex: ifaceIndex, Dst: destinationNet, Gw: gateway, Table: table}
 	//check if already exist a route for the destination network on our device
 	//we don't care about other routes in devices not managed by liqonet. The user should check the
 	//possible ip conflicts
-	routes := m.RouteList
+	var routes []netlink.Route
+	for _, val := range m.RouteList {
+		if getTable(val.Table) != getTable(table) {
+			continue
+		}
+		if val.LinkIndex == ifaceIndex {
+			routes = append(routes, val)
+		} else if val.Dst.String() == route.Dst.String() {
+			//as the kernel, only a route per destination is accepted
+			return route, fmt.Errorf("unable to instantiate route for %s  network with gateway %s: file exists", dst, gw)
+		}
+	}
 	if len(routes) > 0 {
 		//count how many routes exist for the the current destination
 		//if more then one: something went wrong so we remove them all
@@ -57,12 +90,12 @@ func (m *MockRouteManager) AddRoute(dst string, gw string, deviceName string, on
 		}
 	}
 	if onLink {
-		route = netlink.Route{LinkIndex: ifaceIndex, Dst: destinationNet, Gw: gateway, Flags: unix.RTNH_F_ONLINK}
+		route = netlink.Route{LinkIndex: ifaceIndex, Dst: destinationNet, Gw: gateway, Flags: unix.RTNH_F_ONLINK, Table: table}
 
 		//here we add the route
 		m.RouteList = append(m.RouteList, route)
 	} else {
-		route = netlink.Route{LinkIndex: ifaceIndex, Dst: destinationNet, Gw: gateway}
+		route = netlink.Route{LinkIndex: ifaceIndex, Dst: destinationNet, Gw: gateway, Table: table}
 		//here we add the route
 		m.RouteList = append(m.RouteList, route)
 	}
@@ -78,3 +111,53 @@ func (m *MockRouteManager) DelRoute(route netlink.Route) error {
 	}
 	return nil
 }
+
+func (m *MockRouteManager) AddRule(mark int, table int, ipv6 bool) (netlink.Rule, error) {
+	rule := netlink.NewRule()
+	rule.Mark = mark
+	rule.Table = table
+	rule.Priority = RulePriority
+	rule.Family = netlink.FAMILY_V4
+	if ipv6 {
+		rule.Family = netlink.FAMILY_V6
+	}
+	for _, existing := range m.RuleList {
+		if reflect.DeepEqual(existing, *rule) {
+			return *rule, nil
+		}
+	}
+	m.RuleList = append(m.RuleList, *rule)
+	return *rule, nil
+}
+
+func (m *MockRouteManager) DelRule(rule netlink.Rule) error {
+	for i, r := range m.RuleList {
+		if reflect.DeepEqual(r, rule) {
+			m.RuleList = append(m.RuleList[:i], m.RuleList[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MockRouteManager) AddFDBEntry(deviceName string, vtep string) error {
+	if !ContainsString(m.FDBEntries, vtep) {
+		m.FDBEntries = append(m.FDBEntries, vtep)
+	}
+	return nil
+}
+
+func (m *MockRouteManager) DelFDBEntry(deviceName string, vtep string) error {
+	m.FDBEntries = RemoveString(m.FDBEntries, vtep)
+	return nil
+}
+
+func (m *MockRouteManager) ListRoutes(linkIndex int) ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, route := range m.RouteList {
+		if route.LinkIndex == linkIndex {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,171 @@
+package liqonet
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	"hash/fnv"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	//the handles of the qdiscs the traffic sent to and received from the remote clusters is limited by
+	tcRootHandle    = "1:"
+	tcIngressHandle = "ffff:"
+	//the ids of the classes, which are also the priorities of the filters, are in [1, tcMaxClassID]. The filters of
+	//the IPv6 networks have their own priorities, since all the filters with the same priority must have the same protocol
+	tcMaxClassID         = 0x3fff
+	tcIPv6PriorityOffset = 0x4000
+	//the minimum burst, in bytes, of the traffic received from a remote cluster, it has to be greater than the MTU
+	tcMinBurst = 15000
+)
+
+//TrafficShaper limits the rate of the traffic exchanged with a remote cluster through its tunnel
+type TrafficShaper interface {
+	//the rates are in bits per second, 0 means no limit. The limits already applied to the cluster are replaced
+	SetLimits(endpoint *v1.TunnelEndpoint, egress, ingress int64) error
+	//it has to be idempotent
+	RemoveLimits(endpoint *v1.TunnelEndpoint) error
+}
+
+//TCRunner runs the tc commands, returning their output
+type TCRunner interface {
+	Run(args ...string) (string, error)
+}
+
+//TCCommand runs the commands through the tc binary
+type TCCommand struct{}
+
+func (c *TCCommand) Run(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("tc", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("command tc %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+//TCShaper applies the limits through tc on the tunnel interfaces: the traffic sent to each remote cluster is shaped
+//by a class of the htb root qdisc, the received one is policed by the ingress qdisc. Since each remote cluster has its
+//own tunnel interface, all the traffic of the interface is classified as the one of the cluster, whatever the prefixes
+//the clusters reached through it are known at. The class of each cluster is derived from its cluster ID, so that the
+//limits applied before a restart of the operator are found and replaced
+type TCShaper struct {
+	Runner TCRunner
+}
+
+func NewTCShaper(runner TCRunner) *TCShaper {
+	return &TCShaper{
+		Runner: runner,
+	}
+}
+
+func (s *TCShaper) SetLimits(endpoint *v1.TunnelEndpoint, egress, ingress int64) error {
+	if egress == 0 && ingress == 0 {
+		return s.RemoveLimits(endpoint)
+	}
+	iface := endpoint.Status.TunnelIFaceName
+	id := getClassID(endpoint.Spec.ClusterID)
+	if err := s.ensureQdiscs(iface); err != nil {
+		return err
+	}
+	s.deleteFilters(iface, id)
+	classID := tcRootHandle + strconv.FormatInt(int64(id), 16)
+	if egress > 0 {
+		rate := strconv.FormatInt(egress, 10) + "bit"
+		if _, err := s.Runner.Run("class", "replace", "dev", iface, "parent", tcRootHandle, "classid", classID, "htb", "rate", rate, "ceil", rate); err != nil {
+			return err
+		}
+		if err := s.addFilter(iface, tcRootHandle, id, getTunnelNetwork(endpoint), "dst", "flowid", classID); err != nil {
+			return err
+		}
+	} else {
+		//the class of a previous limit is removed, the command fails if there is none
+		_, _ = s.Runner.Run("class", "del", "dev", iface, "classid", classID)
+	}
+	if ingress > 0 {
+		burst := ingress / 8 / 10
+		if burst < tcMinBurst {
+			burst = tcMinBurst
+		}
+		if err := s.addFilter(iface, tcIngressHandle, id, getTunnelNetwork(endpoint), "src", "police", "rate", strconv.FormatInt(ingress, 10)+"bit",
+			"burst", strconv.FormatInt(burst, 10), "drop", "flowid", ":1"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//the filters and the class are removed ignoring the errors, since they could have been removed together with the
+//tunnel interface or never installed
+func (s *TCShaper) RemoveLimits(endpoint *v1.TunnelEndpoint) error {
+	iface := endpoint.Status.TunnelIFaceName
+	if iface == "" {
+		return nil
+	}
+	id := getClassID(endpoint.Spec.ClusterID)
+	s.deleteFilters(iface, id)
+	_, _ = s.Runner.Run("class", "del", "dev", iface, "classid", tcRootHandle+strconv.FormatInt(int64(id), 16))
+	return nil
+}
+
+//returns the id of the class of the remote cluster, derived from its cluster ID. Two clusters can get the same id, but
+//their classes do not collide since each cluster has its own tunnel interface
+func getClassID(clusterID string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(clusterID))
+	return int(hash.Sum32()%tcMaxClassID) + 1
+}
+
+//the network matching all the traffic carried by the tunnel interface of the remote cluster, of the address family of
+//the peering
+func getTunnelNetwork(endpoint *v1.TunnelEndpoint) string {
+	if IsIPv6String(endpoint.Spec.PodCIDR) {
+		return "::/0"
+	}
+	return "0.0.0.0/0"
+}
+
+//installs the htb and the ingress qdiscs on the interface if they are not there yet
+func (s *TCShaper) ensureQdiscs(iface string) error {
+	qdiscs, err := s.Runner.Run("qdisc", "show", "dev", iface)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(qdiscs, "qdisc htb "+tcRootHandle+" root") {
+		if _, err := s.Runner.Run("qdisc", "replace", "dev", iface, "root", "handle", tcRootHandle, "htb"); err != nil {
+			return err
+		}
+	}
+	if !strings.Contains(qdiscs, "qdisc ingress "+tcIngressHandle) {
+		if _, err := s.Runner.Run("qdisc", "add", "dev", iface, "handle", tcIngressHandle, "ingress"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TCShaper) addFilter(iface, parent string, id int, network, direction string, action ...string) error {
+	protocol, match := "ip", "ip"
+	if IsIPv6String(network) {
+		protocol, match = "ipv6", "ip6"
+		id += tcIPv6PriorityOffset
+	}
+	args := append([]string{"filter", "add", "dev", iface, "parent", parent, "protocol", protocol, "prio", strconv.Itoa(id),
+		"u32", "match", match, direction, network}, action...)
+	_, err := s.Runner.Run(args...)
+	return err
+}
+
+//removes the filters of the remote cluster, the commands fail if there are none
+func (s *TCShaper) deleteFilters(iface string, id int) {
+	for _, parent := range []string{tcRootHandle, tcIngressHandle} {
+		for _, priority := range []int{id, id + tcIPv6PriorityOffset} {
+			_, _ = s.Runner.Run("filter", "del", "dev", iface, "parent", parent, "prio", strconv.Itoa(priority))
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package liqonet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+//the subset of RFC 5389 needed to discover the public address of the gateway through a binding request
+const (
+	stunHeaderLength      = 20
+	stunMagicCookie       = 0x2112A442
+	stunBindingRequest    = 0x0001
+	stunBindingResponse   = 0x0101
+	stunMappedAddress     = 0x0001
+	stunXorMappedAddress  = 0x0020
+	stunAddressFamilyIPv4 = 0x01
+	stunAddressFamilyIPv6 = 0x02
+)
+
+//DiscoverPublicAddress sends a binding request to the STUN server (host:port) from the local UDP port of the tunnels,
+//and returns the address and the port the request has been received from, i.e. the ones the NATs in front of the
+//gateway map the tunnel port to
+func DiscoverPublicAddress(server string, localPort int, timeout time.Duration) (net.IP, int, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to resolve the STUN server %s: %v", server, err)
+	}
+	conn, err := listenStun(serverAddr, localPort)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to contact the STUN server %s from port %d: %v", server, localPort, err)
+	}
+	defer conn.Close()
+	request, transactionID, err := newStunBindingRequest()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, 0, err
+	}
+	if err := conn.send(request); err != nil {
+		return nil, 0, fmt.Errorf("unable to send the binding request to the STUN server %s: %v", server, err)
+	}
+	buffer := make([]byte, 1500)
+	for {
+		n, err := conn.receive(buffer)
+		if err != nil {
+			return nil, 0, fmt.Errorf("no binding response from the STUN server %s: %v", server, err)
+		}
+		//the responses to other requests are discarded
+		ip, port, err := parseStunBindingResponse(buffer[:n], transactionID)
+		if err == nil {
+			return ip, port, nil
+		}
+	}
+}
+
+//stunConn exchanges the STUN messages with a server from a given local port
+type stunConn interface {
+	send(request []byte) error
+	//returns the payload of the next datagram received from the server
+	receive(buffer []byte) (int, error)
+	SetDeadline(t time.Time) error
+	Close() error
+}
+
+//returns a socket bound to the local port if it is free, otherwise, as it happens when the tunnel is listening on it,
+//a raw socket sending the datagrams from that port and receiving a copy of the ones the server sends to it
+func listenStun(server *net.UDPAddr, localPort int) (stunConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: localPort})
+	if err == nil {
+		return &stunUDPConn{UDPConn: conn, server: server}, nil
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return nil, err
+	}
+	//the local address is the one of the route toward the server, no datagram is sent by the connected socket
+	probe, err := net.DialUDP("udp", nil, server)
+	if err != nil {
+		return nil, err
+	}
+	local := probe.LocalAddr().(*net.UDPAddr).IP
+	probe.Close()
+	network := "ip4:udp"
+	if local.To4() == nil {
+		network = "ip6:udp"
+	}
+	raw, err := net.ListenIP(network, &net.IPAddr{IP: local})
+	if err != nil {
+		return nil, err
+	}
+	return &stunRawConn{IPConn: raw, local: &net.UDPAddr{IP: local, Port: localPort}, server: server}, nil
+}
+
+type stunUDPConn struct {
+	*net.UDPConn
+	server *net.UDPAddr
+}
+
+func (c *stunUDPConn) send(request []byte) error {
+	_, err := c.WriteToUDP(request, c.server)
+	return err
+}
+
+func (c *stunUDPConn) receive(buffer []byte) (int, error) {
+	for {
+		n, from, err := c.ReadFromUDP(buffer)
+		if err != nil {
+			return 0, err
+		}
+		if from.IP.Equal(c.server.IP) && from.Port == c.server.Port {
+			return n, nil
+		}
+	}
+}
+
+//stunRawConn builds the UDP header of the datagrams, so that they are sent from the port used by the tunnel
+type stunRawConn struct {
+	*net.IPConn
+	local  *net.UDPAddr
+	server *net.UDPAddr
+}
+
+func (c *stunRawConn) send(request []byte) error {
+	datagram := make([]byte, udpHeaderLength+len(request))
+	binary.BigEndian.PutUint16(datagram[0:2], uint16(c.local.Port))
+	binary.BigEndian.PutUint16(datagram[2:4], uint16(c.server.Port))
+	binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)))
+	copy(datagram[udpHeaderLength:], request)
+	binary.BigEndian.PutUint16(datagram[6:8], udpChecksum(c.local.IP, c.server.IP, datagram))
+	_, err := c.WriteToIP(datagram, &net.IPAddr{IP: c.server.IP})
+	return err
+}
+
+func (c *stunRawConn) receive(buffer []byte) (int, error) {
+	datagram := make([]byte, udpHeaderLength+len(buffer))
+	for {
+		//the header of the IPv4 packets is removed by the socket
+		n, from, err := c.ReadFromIP(datagram)
+		if err != nil {
+			return 0, err
+		}
+		if n < udpHeaderLength || !from.IP.Equal(c.server.IP) ||
+			int(binary.BigEndian.Uint16(datagram[0:2])) != c.server.Port ||
+			int(binary.BigEndian.Uint16(datagram[2:4])) != c.local.Port {
+			continue
+		}
+		return copy(buffer, datagram[udpHeaderLength:n]), nil
+	}
+}
+
+//returns the checksum of the UDP datagram, computed over the pseudo header with the addresses
+func udpChecksum(source, destination net.IP, datagram []byte) uint16 {
+	var pseudoHeader []byte
+	if source4, destination4 := source.To4(), destination.To4(); source4 != nil && destination4 != nil {
+		pseudoHeader = append(append(pseudoHeader, source4...), destination4...)
+		pseudoHeader = append(pseudoHeader, 0, syscall.IPPROTO_UDP, byte(len(datagram)>>8), byte(len(datagram)))
+	} else {
+		pseudoHeader = append(append(pseudoHeader, source.To16()...), destination.To16()...)
+		pseudoHeader = append(pseudoHeader, byte(len(datagram)>>24), byte(len(datagram)>>16), byte(len(datagram)>>8), byte(len(datagram)))
+		pseudoHeader = append(pseudoHeader, 0, 0, 0, syscall.IPPROTO_UDP)
+	}
+	var sum uint32
+	for _, data := range [][]byte{pseudoHeader, datagram} {
+		for i := 0; i < len(data); i += 2 {
+			word := uint32(data[i]) << 8
+			if i+1 < len(data) {
+				word |= uint32(data[i+1])
+			}
+			sum += word
+		}
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	//a zero checksum means that it has not been computed, hence it is sent as all ones
+	if checksum := ^uint16(sum); checksum != 0 {
+		return checksum
+	}
+	return 0xffff
+}
+
+func newStunBindingRequest() ([]byte, []byte, error) {
+	request := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(request[2:4], 0)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	if _, err := rand.Read(request[8:stunHeaderLength]); err != nil {
+		return nil, nil, err
+	}
+	return request, request[8:stunHeaderLength], nil
+}
+
+//returns the address carried by the XOR-MAPPED-ADDRESS attribute, or by the MAPPED-ADDRESS one
+//sent by the servers implementing the previous version of the protocol
+func parseStunBindingResponse(data, transactionID []byte) (net.IP, int, error) {
+	if len(data) < stunHeaderLength {
+		return nil, 0, errors.New("the STUN message is too short")
+	}
+	if binary.BigEndian.Uint16(data[0:2]) != stunBindingResponse {
+		return nil, 0, errors.New("the STUN message is not a binding response")
+	}
+	if !bytes.Equal(data[8:stunHeaderLength], transactionID) {
+		return nil, 0, errors.New("the STUN message belongs to another transaction")
+	}
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if len(data) < stunHeaderLength+length {
+		return nil, 0, errors.New("the STUN message is truncated")
+	}
+	var mappedIP net.IP
+	var mappedPort int
+	attributes := data[stunHeaderLength : stunHeaderLength+length]
+	for len(attributes) >= 4 {
+		attrType := binary.BigEndian.Uint16(attributes[0:2])
+		attrLength := int(binary.BigEndian.Uint16(attributes[2:4]))
+		if len(attributes) < 4+attrLength {
+			return nil, 0, errors.New("the STUN attribute is truncated")
+		}
+		value := attributes[4 : 4+attrLength]
+		switch attrType {
+		case stunXorMappedAddress:
+			return parseStunAddress(value, data[4:stunHeaderLength])
+		case stunMappedAddress:
+			ip, port, err := parseStunAddress(value, nil)
+			if err == nil {
+				mappedIP, mappedPort = ip, port
+			}
+		}
+		//the attributes are aligned to 4 bytes
+		padded := (attrLength + 3) &^ 3
+		if len(attributes) < 4+padded {
+			break
+		}
+		attributes = attributes[4+padded:]
+	}
+	if mappedIP == nil {
+		return nil, 0, errors.New("the binding response does not contain the mapped address")
+	}
+	return mappedIP, mappedPort, nil
+}
+
+//parses an address attribute, the xored ones are xored with the magic cookie followed by the transaction ID
+func parseStunAddress(value, xorKey []byte) (net.IP, int, error) {
+	if len(value) < 4 {
+		return nil, 0, errors.New("the STUN address attribute is too short")
+	}
+	var ipLength int
+	switch value[1] {
+	case stunAddressFamilyIPv4:
+		ipLength = net.IPv4len
+	case stunAddressFamilyIPv6:
+		ipLength = net.IPv6len
+	default:
+		return nil, 0, fmt.Errorf("unknown STUN address family %d", value[1])
+	}
+	if len(value) < 4+ipLength {
+		return nil, 0, errors.New("the STUN address attribute is truncated")
+	}
+	port := binary.BigEndian.Uint16(value[2:4])
+	ip := make(net.IP, ipLength)
+	copy(ip, value[4:4+ipLength])
+	if xorKey != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xorKey[i]
+		}
+	}
+	return ip, int(port), nil
+}
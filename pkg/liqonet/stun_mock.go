@@ -0,0 +1,61 @@
+package liqonet
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+//MockStunServer replies to the binding requests with the given public address, as a STUN server behind which the
+//NAT maps the local port of the gateway to the public one. The source port of each request is sent on Sources
+type MockStunServer struct {
+	net.PacketConn
+	Sources chan int
+	ip      net.IP
+	port    int
+}
+
+func NewMockStunServer(ip net.IP, port int) (*MockStunServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	m := &MockStunServer{PacketConn: conn, Sources: make(chan int, 10), ip: ip, port: port}
+	go m.serve()
+	return m, nil
+}
+
+func (m *MockStunServer) serve() {
+	buffer := make([]byte, 1500)
+	for {
+		n, peer, err := m.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if n < stunHeaderLength {
+			continue
+		}
+		select {
+		case m.Sources <- peer.(*net.UDPAddr).Port:
+		default:
+		}
+		_, _ = m.WriteTo(getStunBindingResponse(buffer[:n], m.ip, m.port), peer)
+	}
+}
+
+//builds the binding response to the request, carrying the given address in a XOR-MAPPED-ADDRESS attribute
+func getStunBindingResponse(request []byte, ip net.IP, port int) []byte {
+	value := make([]byte, 8)
+	value[1] = stunAddressFamilyIPv4
+	binary.BigEndian.PutUint16(value[2:4], uint16(port)^uint16(stunMagicCookie>>16))
+	for i, b := range ip.To4() {
+		value[4+i] = b ^ request[4+i]
+	}
+	response := make([]byte, stunHeaderLength+4+len(value))
+	copy(response, request[:stunHeaderLength])
+	binary.BigEndian.PutUint16(response[0:2], stunBindingResponse)
+	binary.BigEndian.PutUint16(response[2:4], uint16(4+len(value)))
+	binary.BigEndian.PutUint16(response[20:22], stunXorMappedAddress)
+	binary.BigEndian.PutUint16(response[22:24], uint16(len(value)))
+	copy(response[24:], value)
+	return response
+}
@@ -0,0 +1,76 @@
+package liqonet
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStunBindingResponse(t *testing.T) {
+	request, transactionID, err := newStunBindingRequest()
+	assert.Nil(t, err, "should be nil")
+	response := getStunBindingResponse(request, net.ParseIP("203.0.113.7"), 41641)
+	ip, port, err := parseStunBindingResponse(response, transactionID)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "203.0.113.7", ip.String())
+	assert.Equal(t, 41641, port)
+
+	//the responses to other transactions are rejected
+	_, _, err = parseStunBindingResponse(response, make([]byte, len(transactionID)))
+	assert.NotNil(t, err, "should not be nil")
+	_, _, err = parseStunBindingResponse(response[:stunHeaderLength+4], transactionID)
+	assert.NotNil(t, err, "should not be nil, the message is truncated")
+}
+
+func TestDiscoverPublicAddress(t *testing.T) {
+	//the NAT maps the local port to a different public one
+	server, err := NewMockStunServer(net.ParseIP("198.51.100.1"), 40000)
+	assert.Nil(t, err, "should be nil")
+	defer server.Close()
+	free, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err, "should be nil")
+	localPort := free.LocalAddr().(*net.UDPAddr).Port
+	assert.Nil(t, free.Close(), "should be nil")
+
+	ip, port, err := DiscoverPublicAddress(server.LocalAddr().String(), localPort, time.Second)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "198.51.100.1", ip.String())
+	assert.Equal(t, 40000, port, "the mapped port should be returned")
+	assert.Equal(t, localPort, <-server.Sources, "the request should be sent from the local port")
+
+	//the port used by the tunnel is already bound, the request is sent through a raw socket
+	tunnel, err := net.ListenPacket("udp", ":0")
+	assert.Nil(t, err, "should be nil")
+	defer tunnel.Close()
+	tunnelPort := tunnel.LocalAddr().(*net.UDPAddr).Port
+	ip, port, err = DiscoverPublicAddress(server.LocalAddr().String(), tunnelPort, time.Second)
+	if err != nil && errors.Is(err, syscall.EPERM) {
+		t.Skip("the raw sockets are not allowed")
+	}
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "198.51.100.1", ip.String())
+	assert.Equal(t, 40000, port, "the mapped port should be returned")
+	assert.Equal(t, tunnelPort, <-server.Sources, "the request should be sent from the port of the tunnel")
+}
+
+func TestUDPChecksum(t *testing.T) {
+	//a datagram from 127.0.0.1:1024 to 127.0.0.1:53 with the "ab" payload
+	datagram := []byte{0x04, 0x00, 0x00, 0x35, 0x00, 0x0a, 0x00, 0x00, 'a', 'b'}
+	assert.Equal(t, uint16(0x9c40), udpChecksum(net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.1"), datagram))
+}
+
+func TestGetPublicEndpoint(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	_, _, ok := GetPublicEndpoint(node)
+	assert.False(t, ok, "the node did not publish its endpoint")
+	node.Annotations = map[string]string{PublicEndpointAnnotation: "203.0.113.7:31820"}
+	address, port, ok := GetPublicEndpoint(node)
+	assert.True(t, ok)
+	assert.Equal(t, "203.0.113.7", address)
+	assert.Equal(t, int32(31820), port)
+}
@@ -2,10 +2,13 @@ package liqonet
 
 import (
 	"errors"
+	"fmt"
+	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/liqoTech/liqo/api/liqonet/v1"
 	"github.com/liqoTech/liqo/internal/errdefs"
 	"github.com/prometheus/common/log"
 	"github.com/vishvananda/netlink"
+	"hash/fnv"
 	"net"
 	"os"
 )
@@ -13,8 +16,26 @@ import (
 const (
 	tunnelNamePrefix = "gretun_"
 	tunnelTtl        = 255
+	//the kernel limits the interface names to IFNAMSIZ (16) bytes, including the terminating null byte
+	maxIfaceNameLength = 15
+	//the pools the tunnel private IPs are derived from. The IPv4 one is part of the link-local range, avoiding the
+	//addresses used by the cloud providers and by the CNIs, e.g. 169.254.169.254 and 169.254.1.1
+	TunnelPrivatePool   = "169.254.64.0/18"
+	TunnelPrivatePoolV6 = "fd00:169:254::/114"
 )
 
+//GetTunnelIfaceName returns the name of the tunnel interface toward a remote cluster: the prefix followed by
+//the hash of the cluster ID, so that each remote cluster has its own interface and the name fits the kernel limit
+func GetTunnelIfaceName(prefix, clusterID string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clusterID))
+	suffix := fmt.Sprintf("%08x", h.Sum32())
+	if len(prefix)+len(suffix) > maxIfaceNameLength {
+		prefix = prefix[:maxIfaceNameLength-len(suffix)]
+	}
+	return prefix + suffix
+}
+
 //Get the LocalTunnelPublicIP which is exported to the pod through an environment
 //variable called LocalTunnelPublicIP. The pod is run with hostNetwork=true so it gets the same IP
 //of the host where it is scheduled. The IP is the same used by the kubelet to register
@@ -41,53 +62,81 @@ func GetLocalTunnelPublicIPToString() (string, error) {
 	return ipAddress, nil
 }
 
-func GetLocalTunnelPrivateIP() (net.IP, error) {
-	ipAddress, isSet := os.LookupEnv("LOCAL_TUNNEL_PRIVATE_IP")
-	if !isSet {
-		return nil, errdefs.NotFound("the pod IP is not set")
-	}
-	if ipAddress == "" {
-		return nil, errors.New("pod IP is not yet set")
-	}
-	return net.ParseIP(ipAddress), nil
+//GetTunnelPrivateIPs returns the tunnel private IPs of the local and of the remote cluster. Each pair of clusters gets
+//its own /31 (/127 for IPv6) of the tunnel private pool, derived from the IDs of the two clusters: both the clusters
+//choose the same one without negotiating it, the cluster with the lower ID takes the first address, and the tunnels
+//toward the different remote clusters get different addresses
+func GetTunnelPrivateIPs(localClusterID, remoteClusterID string, ipv6 bool) (string, string) {
+	first, second := localClusterID, remoteClusterID
+	if first > second {
+		first, second = second, first
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(first + "/" + second))
+	_, pool, _ := net.ParseCIDR(getTunnelPrivatePool(ipv6))
+	ones, bits := pool.Mask.Size()
+	link := int(h.Sum32()%(1<<uint(bits-ones-1))) * 2
+	firstIP, _ := cidr.Host(pool, link)
+	secondIP, _ := cidr.Host(pool, link+1)
+	if localClusterID == first {
+		return firstIP.String(), secondIP.String()
+	}
+	return secondIP.String(), firstIP.String()
 }
 
-func GetLocalTunnelPrivateIPToString() (string, error) {
-	ipAddress, isSet := os.LookupEnv("LOCAL_TUNNEL_PRIVATE_IP")
-	if !isSet {
-		return "", errdefs.NotFound("the pod IP is not set")
-	}
-	if ipAddress == "" {
-		return "", errors.New("pod IP is not yet set")
+//GetPeerTunnelPrivateIP returns the other address of the /31 of the given tunnel private IP, i.e. the local one given
+//the one published by the remote cluster
+func GetPeerTunnelPrivateIP(address string) (string, error) {
+	ip := net.ParseIP(address)
+	_, pool, _ := net.ParseCIDR(getTunnelPrivatePool(IsIPv6(ip)))
+	if ip == nil || !pool.Contains(ip) {
+		return "", fmt.Errorf("the tunnel private IP %s does not belong to %s", address, pool)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	peer := make(net.IP, len(ip))
+	copy(peer, ip)
+	peer[len(peer)-1] ^= 1
+	return peer.String(), nil
+}
+
+func getTunnelPrivatePool(ipv6 bool) string {
+	if ipv6 {
+		return TunnelPrivatePoolV6
 	}
-	return ipAddress, nil
+	return TunnelPrivatePool
 }
 
 func InstallGreTunnel(endpoint *v1.TunnelEndpoint) (int, string, error) {
-	//TODO configure the name according to the max length permitted by the kernel
-	name := tunnelNamePrefix
+	return installGreTunnel(endpoint, gretunAttributes{name: GetTunnelIfaceName(tunnelNamePrefix, endpoint.Spec.ClusterID)})
+}
+
+//installs the gre tunnel with the given name and encapsulation
+func installGreTunnel(endpoint *v1.TunnelEndpoint, attr gretunAttributes) (int, string, error) {
 	//get the local ip address and use it as local ip for the gre tunnel
 	local, err := GetLocalTunnelPublicIP()
 	if err != nil {
 		return 0, "", err
 	}
-	remote := net.ParseIP(endpoint.Spec.TunnelPublicIP)
-	ttl := tunnelTtl
-	attr := gretunAttributes{
-		name:   name,
-		local:  local,
-		remote: remote,
-		ttl:    uint8(ttl),
+	attr.local = local
+	attr.remote = net.ParseIP(endpoint.Spec.TunnelPublicIP)
+	return setupGreTunnel(endpoint, attr)
+}
+
+//creates the gre tunnel between the given addresses and configures on it the local tunnel private IP
+func setupGreTunnel(endpoint *v1.TunnelEndpoint, attr gretunAttributes) (int, string, error) {
+	attr.ttl = tunnelTtl
+	attr.mtu = endpoint.Status.MTU
+	//the ip6gre tunnels are created when the addresses are IPv6 ones
+	if attr.remote == nil || IsIPv6(attr.local) != IsIPv6(attr.remote) {
+		return 0, "", fmt.Errorf("the local tunnel address %s and the remote one %s belong to different families", attr.local, attr.remote)
 	}
 	gretunnel, err := newGretunInterface(&attr)
 	if err != nil {
 		return 0, "", err
 	}
-	ownPrivateIP, err := GetLocalTunnelPrivateIPToString()
-	if err != nil {
-		return 0, "", err
-	}
-	address, network, err := net.ParseCIDR(ownPrivateIP + "/32")
+	address, network, err := net.ParseCIDR(HostCIDR(endpoint.Status.LocalTunnelPrivateIP))
 	if err != nil {
 		return 0, "", err
 	}
@@ -109,8 +158,18 @@ func RemoveGreTunnel(endpoint *v1.TunnelEndpoint) error {
 		log.Info("no tunnel installed. Do nothing")
 		return nil
 	} else {
-		existingIface, err := GetIfaceByIndex(endpoint.Status.TunnelIFaceIndex)
-
+		var existingIface netlink.Link
+		var err error
+		//the interface is looked up by name, since the index can be reused by the kernel for another interface
+		if endpoint.Status.TunnelIFaceName != "" {
+			existingIface, err = netlink.LinkByName(endpoint.Status.TunnelIFaceName)
+		} else {
+			existingIface, err = GetIfaceByIndex(endpoint.Status.TunnelIFaceIndex)
+		}
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			log.Info("tunnel interface not found. Do nothing")
+			return nil
+		}
 		if err != nil {
 			if err.Error() == "Link not found" {
 				log.Error(err, "Interface not found")
@@ -0,0 +1,93 @@
+package liqonet
+
+import (
+	"context"
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+const (
+	GreProtocol       = "gre"
+	GreUdpProtocol    = "gre-udp"
+	WireGuardProtocol = "wireguard"
+
+	//the annotation of the gateway node carrying the comma separated list of the protocols it supports,
+	//read when building the advertisements
+	TunnelProtocolsAnnotation = "liqonet.liqo.io/tunnel-protocols"
+)
+
+//the tunnel protocols in order of preference: the first one supported by both the clusters is used
+var tunnelProtocolsPreference = []string{WireGuardProtocol, GreUdpProtocol, GreProtocol}
+
+//TunnelDriver installs and removes the tunnel toward a remote cluster described by a TunnelEndpoint
+type TunnelDriver interface {
+	//it returns the index and the name of the interface the traffic for the remote cluster has to be routed to
+	Install(endpoint *v1.TunnelEndpoint) (int, string, error)
+	//it has to be idempotent
+	Remove(endpoint *v1.TunnelEndpoint) error
+}
+
+//TunnelStats contains the counters of the traffic exchanged with a remote cluster through its tunnel
+type TunnelStats struct {
+	SentBytes       uint64
+	ReceivedBytes   uint64
+	SentPackets     uint64
+	ReceivedPackets uint64
+}
+
+//TunnelStatsReader is implemented by the drivers able to count the traffic exchanged with each remote cluster
+type TunnelStatsReader interface {
+	GetStats(endpoint *v1.TunnelEndpoint) (TunnelStats, error)
+}
+
+//GreDriver sets up an unencrypted gre tunnel toward each remote cluster
+type GreDriver struct{}
+
+func (d *GreDriver) Install(endpoint *v1.TunnelEndpoint) (int, string, error) {
+	return InstallGreTunnel(endpoint)
+}
+
+func (d *GreDriver) Remove(endpoint *v1.TunnelEndpoint) error {
+	return RemoveGreTunnel(endpoint)
+}
+
+func (d *GreDriver) GetStats(endpoint *v1.TunnelEndpoint) (TunnelStats, error) {
+	return getLinkStats(endpoint.Status.TunnelIFaceName)
+}
+
+//returns the protocols the local drivers support, in order of preference
+func GetSupportedProtocols(drivers map[string]TunnelDriver) []string {
+	var protocols []string
+	for _, protocol := range tunnelProtocolsPreference {
+		if _, ok := drivers[protocol]; ok {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+//SelectTunnelProtocol returns the preferred protocol supported by both the clusters. Since the preference order is
+//the same in both the clusters, they choose the same protocol. A remote cluster not advertising its protocols
+//supports only gre.
+func SelectTunnelProtocol(local, remote []string) (string, error) {
+	if len(remote) == 0 {
+		remote = []string{GreProtocol}
+	}
+	for _, protocol := range tunnelProtocolsPreference {
+		if ContainsString(local, protocol) && ContainsString(remote, protocol) {
+			return protocol, nil
+		}
+	}
+	return "", fmt.Errorf("no tunnel protocol is supported by both the clusters: local %v, remote %v", local, remote)
+}
+
+//SetTunnelProtocolsAnnotation publishes on the gateway node the protocols it supports
+func SetTunnelProtocolsAnnotation(clientset kubernetes.Interface, nodeName string, protocols []string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, TunnelProtocolsAnnotation, strings.Join(protocols, ","))
+	_, err := clientset.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
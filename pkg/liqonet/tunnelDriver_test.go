@@ -0,0 +1,167 @@
+package liqonet
+
+import (
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSelectTunnelProtocol(t *testing.T) {
+	tests := []struct {
+		local    []string
+		remote   []string
+		expected string
+	}{
+		{[]string{WireGuardProtocol, GreProtocol}, []string{WireGuardProtocol, GreProtocol}, WireGuardProtocol},
+		//the preference order does not depend on the order advertised by the clusters
+		{[]string{GreProtocol, WireGuardProtocol}, []string{GreProtocol, WireGuardProtocol}, WireGuardProtocol},
+		{[]string{GreProtocol}, []string{WireGuardProtocol, GreProtocol}, GreProtocol},
+		{[]string{WireGuardProtocol, GreProtocol}, []string{GreProtocol}, GreProtocol},
+		//a remote cluster which does not advertise its protocols supports only gre
+		{[]string{WireGuardProtocol, GreProtocol}, nil, GreProtocol},
+		//the gre tunnels are encapsulated in UDP when both the gateways support it
+		{[]string{GreUdpProtocol, GreProtocol}, []string{WireGuardProtocol, GreUdpProtocol, GreProtocol}, GreUdpProtocol},
+		{[]string{WireGuardProtocol, GreProtocol}, []string{GreUdpProtocol, GreProtocol}, GreProtocol},
+	}
+	for _, test := range tests {
+		protocol, err := SelectTunnelProtocol(test.local, test.remote)
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, test.expected, protocol, "local %v, remote %v", test.local, test.remote)
+	}
+	_, err := SelectTunnelProtocol([]string{WireGuardProtocol}, nil)
+	assert.NotNil(t, err, "should not be nil, the clusters do not share any protocol")
+}
+
+func TestGetSupportedProtocols(t *testing.T) {
+	drivers := map[string]TunnelDriver{GreProtocol: &GreDriver{}}
+	assert.Equal(t, []string{GreProtocol}, GetSupportedProtocols(drivers))
+	drivers[WireGuardProtocol] = &WireGuardDriver{}
+	assert.Equal(t, []string{WireGuardProtocol, GreProtocol}, GetSupportedProtocols(drivers))
+	drivers[GreUdpProtocol] = &GreUdpDriver{}
+	assert.Equal(t, []string{WireGuardProtocol, GreUdpProtocol, GreProtocol}, GetSupportedProtocols(drivers))
+}
+
+func TestWireGuardKeys(t *testing.T) {
+	//test vector from RFC 7748
+	publicKey, err := WireGuardPublicKey("dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=", publicKey)
+
+	privateKey, err := GenerateWireGuardPrivateKey()
+	assert.Nil(t, err, "should be nil")
+	_, err = WireGuardPublicKey(privateKey)
+	assert.Nil(t, err, "should be nil")
+
+	_, err = WireGuardPublicKey("dGVzdA==")
+	assert.NotNil(t, err, "should not be nil, the key is too short")
+}
+
+func TestProbeResultPacketLoss(t *testing.T) {
+	assert.Equal(t, 0, ProbeResult{}.PacketLoss(), "no probe has been sent")
+	assert.Equal(t, 0, ProbeResult{Sent: 3, Received: 3}.PacketLoss())
+	assert.Equal(t, 66, ProbeResult{Sent: 3, Received: 1}.PacketLoss())
+	assert.Equal(t, 100, ProbeResult{Sent: 3}.PacketLoss())
+}
+
+func TestTCShaper(t *testing.T) {
+	runner := &MockTCRunner{}
+	shaper := NewTCShaper(runner)
+	endpoint := &v1.TunnelEndpoint{
+		Spec:   v1.TunnelEndpointSpec{ClusterID: "cluster-1", PodCIDR: "10.1.0.0/16", TunnelPrivateIP: "192.168.1.1"},
+		Status: v1.TunnelEndpointStatus{RemoteRemappedPodCIDR: "None", TunnelIFaceName: "wgtun_cluster-1"},
+	}
+	//the qdiscs are installed once, all the traffic of the tunnel interface is the one of the cluster, including the
+	//one of the clusters reached through it
+	endpoint.Status.TransitRoutes = []v1.TransitRoute{{ClusterID: "cluster-d", PodCIDR: "10.3.0.0/16", RemappedPodCIDR: "10.4.0.0/16", Hops: 2}}
+	assert.Nil(t, shaper.SetLimits(endpoint, 10000000, 0), "error should be nil")
+	assert.Contains(t, runner.Commands, "qdisc replace dev wgtun_cluster-1 root handle 1: htb")
+	assert.Contains(t, runner.Commands, "qdisc add dev wgtun_cluster-1 handle ffff: ingress")
+	assert.Contains(t, runner.Commands, "class replace dev wgtun_cluster-1 parent 1: classid 1:36f3 htb rate 10000000bit ceil 10000000bit")
+	assert.Equal(t, []string{"filter add dev wgtun_cluster-1 parent 1: protocol ip prio 14067 u32 match ip dst 0.0.0.0/0 flowid 1:36f3"},
+		getFilterCommands(runner.Commands), "the traffic should be classified by a single filter")
+
+	//a second cluster gets its own class
+	other := endpoint.DeepCopy()
+	other.Spec.ClusterID = "cluster-2"
+	other.Spec.PodCIDR = "fd00:2::/48"
+	other.Status.TunnelIFaceName = "wgtun_cluster-2"
+	runner.Commands = nil
+	assert.Nil(t, shaper.SetLimits(other, 0, 20000000), "error should be nil")
+	assert.Contains(t, runner.Commands, "filter add dev wgtun_cluster-2 parent ffff: protocol ipv6 prio 31878 u32 match ip6 src ::/0 police rate 20000000bit burst 250000 drop flowid :1")
+	assert.Contains(t, runner.Commands, "class del dev wgtun_cluster-2 classid 1:3c86")
+
+	//the class is derived from the cluster ID, the limits applied before a restart are removed by a new shaper
+	runner.Commands = nil
+	assert.Nil(t, NewTCShaper(runner).SetLimits(endpoint, 0, 0), "error should be nil")
+	assert.Contains(t, runner.Commands, "filter del dev wgtun_cluster-1 parent 1: prio 14067")
+	assert.Contains(t, runner.Commands, "filter del dev wgtun_cluster-1 parent ffff: prio 14067")
+	assert.Contains(t, runner.Commands, "class del dev wgtun_cluster-1 classid 1:36f3")
+
+	//there is nothing to remove if the tunnel is not installed
+	runner.Commands = nil
+	endpoint.Status.TunnelIFaceName = ""
+	assert.Nil(t, shaper.RemoveLimits(endpoint), "error should be nil")
+	assert.Empty(t, runner.Commands)
+}
+
+func getFilterCommands(commands []string) []string {
+	var filters []string
+	for _, command := range commands {
+		if strings.HasPrefix(command, "filter add") {
+			filters = append(filters, command)
+		}
+	}
+	return filters
+}
+
+func TestParseWireGuardTransfer(t *testing.T) {
+	dump := "cHJpdmF0ZQ==\tcHVibGlj\t5871\toff\n" +
+		"cGVlcjE=\t(none)\t192.168.5.1:5871\t10.1.0.0/16,192.168.1.1/32\t1600000000\t2048\t1024\t25\n"
+	stats, err := parseWireGuardTransfer(dump, "cGVlcjE=")
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, TunnelStats{SentBytes: 1024, ReceivedBytes: 2048}, stats)
+	_, err = parseWireGuardTransfer(dump, "cGVlcjI=")
+	assert.NotNil(t, err, "error should not be nil, the peer does not exist")
+}
+
+func TestGetTunnelMTU(t *testing.T) {
+	assert.Equal(t, 1416, GetTunnelMTU(1500, WireGuardProtocol, false), "the gre tunnel is encapsulated in wireguard")
+	assert.Equal(t, 1368, GetTunnelMTU(1500, WireGuardProtocol, true), "the IPv6 headers are 20 bytes longer")
+	assert.Equal(t, 1476, GetTunnelMTU(1500, GreProtocol, false))
+	assert.Equal(t, 1448, GetTunnelMTU(1500, GreProtocol, true), "ip6gre adds the encapsulation limit option")
+	assert.Equal(t, 1468, GetTunnelMTU(1500, GreUdpProtocol, false))
+	assert.Equal(t, 1280, GetTunnelMTU(1300, WireGuardProtocol, true), "the MTU should not be lower than the IPv6 minimum")
+	assert.Equal(t, 1450, 1500-GetVxlanOverhead(false))
+	assert.Equal(t, 1430, 1500-GetVxlanOverhead(true))
+}
+
+func TestGetTunnelPrivateIPs(t *testing.T) {
+	_, pool, _ := net.ParseCIDR(TunnelPrivatePool)
+	//both the clusters derive the same /31, each one takes a different address
+	localA, remoteA := GetTunnelPrivateIPs("cluster-a", "cluster-b", false)
+	localB, remoteB := GetTunnelPrivateIPs("cluster-b", "cluster-a", false)
+	assert.Equal(t, localA, remoteB)
+	assert.Equal(t, remoteA, localB)
+	assert.NotEqual(t, localA, localB)
+	assert.True(t, pool.Contains(net.ParseIP(localA)), "the address should belong to the pool")
+	peer, err := GetPeerTunnelPrivateIP(remoteA)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, localA, peer)
+	peer, err = GetPeerTunnelPrivateIP(localA)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, remoteA, peer)
+	//the tunnels toward different remote clusters get different addresses
+	localC, _ := GetTunnelPrivateIPs("cluster-a", "cluster-c", false)
+	assert.NotEqual(t, localA, localC)
+	//the IPv6 peerings get a /127 of the IPv6 pool
+	_, poolV6, _ := net.ParseCIDR(TunnelPrivatePoolV6)
+	localV6, remoteV6 := GetTunnelPrivateIPs("cluster-a", "cluster-b", true)
+	assert.True(t, poolV6.Contains(net.ParseIP(localV6)), "the address should belong to the IPv6 pool")
+	peer, err = GetPeerTunnelPrivateIP(remoteV6)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, localV6, peer)
+	_, err = GetPeerTunnelPrivateIP("192.168.1.1")
+	assert.NotNil(t, err, "should not be nil, the address does not belong to the pool")
+}
@@ -0,0 +1,137 @@
+package liqonet
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	icmpProtocolNumber   = 1
+	icmpv6ProtocolNumber = 58
+)
+
+//ProbeResult is the outcome of the probes sent to the remote end of a tunnel
+type ProbeResult struct {
+	Sent     int
+	Received int
+	//the average round trip time of the replies
+	RTT time.Duration
+}
+
+//PacketLoss returns the percentage of the probes without a reply
+func (r ProbeResult) PacketLoss() int {
+	if r.Sent == 0 {
+		return 0
+	}
+	return (r.Sent - r.Received) * 100 / r.Sent
+}
+
+//TunnelProber checks that the packets flow through a tunnel, probing the remote tunnel private IP through the tunnel
+//interface
+type TunnelProber interface {
+	Probe(iface, destination string, count int, timeout time.Duration) (ProbeResult, error)
+}
+
+//ICMPProber sends ICMP echo requests to the remote tunnel private IP. The socket is bound to the tunnel interface, so
+//that the requests can not be answered by a local address or reach the remote cluster through another path, and only
+//the replies coming back through the tunnel are received
+type ICMPProber struct {
+	//the source address of the echo requests, chosen by the kernel if empty
+	Source string
+}
+
+func (p *ICMPProber) Probe(iface, destination string, count int, timeout time.Duration) (ProbeResult, error) {
+	result := ProbeResult{}
+	dst := net.ParseIP(destination)
+	if dst == nil {
+		return result, fmt.Errorf("unable to parse the probe destination %s", destination)
+	}
+	//the echo requests of the family of the destination are sent
+	network, protocol := "ip4:icmp", icmpProtocolNumber
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if IsIPv6(dst) {
+		network, protocol = "ip6:ipv6-icmp", icmpv6ProtocolNumber
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	conn, err := listenOnDevice(network, p.Source, iface)
+	if err != nil {
+		return result, fmt.Errorf("unable to open the icmp socket on interface %s: %v", iface, err)
+	}
+	defer conn.Close()
+	//the raw socket receives all the icmp replies, the ones of this probe are recognized by the identifier
+	id := rand.Intn(0xffff)
+	var totalRTT time.Duration
+	for seq := 1; seq <= count; seq++ {
+		request := icmp.Message{
+			Type: requestType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("liqonet-probe")},
+		}
+		data, err := request.Marshal(nil)
+		if err != nil {
+			return result, err
+		}
+		start := time.Now()
+		if _, err := conn.WriteTo(data, &net.IPAddr{IP: dst}); err != nil {
+			return result, fmt.Errorf("unable to send the probe to %s: %v", destination, err)
+		}
+		result.Sent++
+		if rtt, ok := waitEchoReply(conn, protocol, replyType, dst, id, seq, start, timeout); ok {
+			result.Received++
+			totalRTT += rtt
+		}
+	}
+	if result.Received > 0 {
+		result.RTT = totalRTT / time.Duration(result.Received)
+	}
+	return result, nil
+}
+
+//opens a raw socket bound to the interface through SO_BINDTODEVICE, the packets are sent and received only through it
+func listenOnDevice(network, address, iface string) (net.PacketConn, error) {
+	config := net.ListenConfig{
+		Control: func(_, _ string, conn syscall.RawConn) error {
+			var err error
+			if controlErr := conn.Control(func(fd uintptr) {
+				err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+			}); controlErr != nil {
+				return controlErr
+			}
+			return err
+		},
+	}
+	return config.ListenPacket(context.Background(), network, address)
+}
+
+//waits for the reply to the given echo request until the timeout expires
+func waitEchoReply(conn net.PacketConn, protocol int, replyType icmp.Type, dst net.IP, id, seq int, start time.Time, timeout time.Duration) (time.Duration, bool) {
+	//the replies to the path MTU probes can be as large as the MTU of the interface
+	buffer := make([]byte, 65535)
+	deadline := start.Add(timeout)
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return 0, false
+	}
+	for {
+		n, peer, err := conn.ReadFrom(buffer)
+		if err != nil {
+			//the deadline expired
+			return 0, false
+		}
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(dst) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(protocol, buffer[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+			return time.Since(start), true
+		}
+	}
+}
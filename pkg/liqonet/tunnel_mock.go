@@ -0,0 +1,118 @@
+package liqonet
+
+import (
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	"strings"
+	"time"
+)
+
+//MockTunnelDriver keeps in memory the tunnel interfaces, one for each remote cluster as the gre driver
+type MockTunnelDriver struct {
+	//for each remote cluster the index of its tunnel interface
+	Tunnels map[string]int
+	//for each interface name the index assigned to it
+	ifaceIndexes map[string]int
+	//for each remote cluster the counters returned as the traffic of its tunnel
+	Stats map[string]TunnelStats
+	//for each remote cluster the MTU its tunnel has been installed with
+	MTUs map[string]int
+}
+
+func (m *MockTunnelDriver) Install(endpoint *v1.TunnelEndpoint) (int, string, error) {
+	if m.Tunnels == nil {
+		m.Tunnels = make(map[string]int)
+	}
+	if m.ifaceIndexes == nil {
+		m.ifaceIndexes = make(map[string]int)
+	}
+	if m.MTUs == nil {
+		m.MTUs = make(map[string]int)
+	}
+	m.MTUs[endpoint.Spec.ClusterID] = endpoint.Status.MTU
+	name := GetTunnelIfaceName(tunnelNamePrefix, endpoint.Spec.ClusterID)
+	index, ok := m.ifaceIndexes[name]
+	if !ok {
+		index = len(m.ifaceIndexes) + 1
+		m.ifaceIndexes[name] = index
+	}
+	m.Tunnels[endpoint.Spec.ClusterID] = index
+	return index, name, nil
+}
+
+func (m *MockTunnelDriver) Remove(endpoint *v1.TunnelEndpoint) error {
+	delete(m.Tunnels, endpoint.Spec.ClusterID)
+	return nil
+}
+
+func (m *MockTunnelDriver) GetStats(endpoint *v1.TunnelEndpoint) (TunnelStats, error) {
+	return m.Stats[endpoint.Spec.ClusterID], nil
+}
+
+//MockTrafficShaper keeps in memory the egress and the ingress limits applied to each remote cluster
+type MockTrafficShaper struct {
+	Limits map[string][2]int64
+}
+
+func (m *MockTrafficShaper) SetLimits(endpoint *v1.TunnelEndpoint, egress, ingress int64) error {
+	if m.Limits == nil {
+		m.Limits = make(map[string][2]int64)
+	}
+	if egress == 0 && ingress == 0 {
+		return m.RemoveLimits(endpoint)
+	}
+	m.Limits[endpoint.Spec.ClusterID] = [2]int64{egress, ingress}
+	return nil
+}
+
+func (m *MockTrafficShaper) RemoveLimits(endpoint *v1.TunnelEndpoint) error {
+	delete(m.Limits, endpoint.Spec.ClusterID)
+	return nil
+}
+
+//MockTunnelProber returns the configured result for each destination, the destinations not configured always reply.
+//The probes which are not bound to an interface are never answered
+type MockTunnelProber struct {
+	Results map[string]ProbeResult
+}
+
+func (m *MockTunnelProber) Probe(iface, destination string, count int, timeout time.Duration) (ProbeResult, error) {
+	if iface == "" {
+		return ProbeResult{Sent: count}, nil
+	}
+	if result, ok := m.Results[destination]; ok {
+		return result, nil
+	}
+	return ProbeResult{Sent: count, Received: count, RTT: time.Millisecond}, nil
+}
+
+//MockTCRunner records the tc commands, the qdiscs added are listed by the show command
+type MockTCRunner struct {
+	Commands []string
+	qdiscs   string
+}
+
+func (m *MockTCRunner) Run(args ...string) (string, error) {
+	command := strings.Join(args, " ")
+	if strings.HasPrefix(command, "qdisc show") {
+		return m.qdiscs, nil
+	}
+	m.Commands = append(m.Commands, command)
+	if strings.HasPrefix(command, "qdisc replace") && strings.HasSuffix(command, "htb") {
+		m.qdiscs += "qdisc htb 1: root refcnt 2 r2q 10 default 0 direct_packets_stat 0\n"
+	} else if strings.HasPrefix(command, "qdisc add") && strings.HasSuffix(command, "ingress") {
+		m.qdiscs += "qdisc ingress ffff: parent ffff:fff1 ----------------\n"
+	}
+	return "", nil
+}
+
+//MockPathMTUProber returns the configured MTU for each destination, the destinations not configured have a 1500 MTU
+type MockPathMTUProber struct {
+	MTUs map[string]int
+}
+
+func (m *MockPathMTUProber) ProbePathMTU(destination string, timeout time.Duration) (int, error) {
+	if mtu, ok := m.MTUs[destination]; ok {
+		return mtu, nil
+	}
+	return 1500, nil
+}
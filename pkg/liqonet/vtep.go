@@ -0,0 +1,136 @@
+package liqonet
+
+import (
+	"context"
+	"fmt"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	"net"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+const (
+	//VxlanIPAnnotationKey is the annotation of the nodes holding the address of their vxlan interface
+	VxlanIPAnnotationKey = "liqonet.liqo.io/vxlan-ip"
+	//the name of the IpamStorage resource holding the addresses allocated to the nodes in the vxlan network
+	vxlanIPStorageName = "vxlan-ipamstorage"
+)
+
+//the route-operators of all the nodes allocate their address at the same time when liqo is installed,
+//hence the allocation is retried more times than the default
+var vxlanIPAllocationBackoff = wait.Backoff{
+	Steps:    10,
+	Duration: 50 * time.Millisecond,
+	Factor:   1.5,
+	Jitter:   0.5,
+}
+
+//AllocateVxlanIP returns the address of the node in the vxlan network, allocating it if the node has not got one yet.
+//The addresses are saved in a cluster scoped IpamStorage resource, which is updated with optimistic concurrency so
+//that two nodes never get the same address. The addresses of the nodes which left the cluster, or outside the
+//vxlan network, are released. The client has to read directly from the API server
+func AllocateVxlanIP(c client.Client, vxlanNetwork, nodeName string) (string, error) {
+	_, network, err := net.ParseCIDR(vxlanNetwork)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse the vxlan network %s: %v", vxlanNetwork, err)
+	}
+	var vxlanIP string
+	retriable := func(err error) bool {
+		return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+	}
+	err = retry.OnError(vxlanIPAllocationBackoff, retriable, func() error {
+		var nodes corev1.NodeList
+		if err := c.List(context.TODO(), &nodes); err != nil {
+			return fmt.Errorf("unable to list the nodes: %v", err)
+		}
+		existing := map[string]bool{nodeName: true}
+		for _, node := range nodes.Items {
+			existing[node.Name] = true
+		}
+		storage := &liqonetv1.IpamStorage{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: vxlanIPStorageName}, storage)
+		notFound := k8serrors.IsNotFound(err)
+		if err != nil && !notFound {
+			return err
+		}
+		vxlanIPs := make(map[string]string)
+		used := make(map[string]bool)
+		for node, ip := range storage.Spec.VxlanIPs {
+			if address := net.ParseIP(ip); !existing[node] || address == nil || !network.Contains(address) {
+				klog.Infof("releasing the vxlan address %s of node %s", ip, node)
+				continue
+			}
+			vxlanIPs[node] = ip
+			used[ip] = true
+		}
+		if _, ok := vxlanIPs[nodeName]; !ok {
+			address, err := getFreeVxlanIP(network, used)
+			if err != nil {
+				return err
+			}
+			vxlanIPs[nodeName] = address.String()
+		}
+		if !notFound && reflect.DeepEqual(vxlanIPs, storage.Spec.VxlanIPs) {
+			vxlanIP = vxlanIPs[nodeName]
+			return nil
+		}
+		storage.Spec.VxlanIPs = vxlanIPs
+		if notFound {
+			storage.Name = vxlanIPStorageName
+			err = c.Create(context.TODO(), storage)
+		} else {
+			err = c.Update(context.TODO(), storage)
+		}
+		if err == nil {
+			vxlanIP = vxlanIPs[nodeName]
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to allocate the vxlan address of node %s: %v", nodeName, err)
+	}
+	return vxlanIP, nil
+}
+
+//returns the first address of the network which is not used, the network and the broadcast addresses are skipped
+func getFreeVxlanIP(network *net.IPNet, used map[string]bool) (net.IP, error) {
+	for ip := nextIP(network.IP.Mask(network.Mask)); network.Contains(ip); ip = nextIP(ip) {
+		if !IsIPv6(ip) && !network.Contains(nextIP(ip)) {
+			break
+		}
+		if !used[ip.String()] {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("no addresses left in the vxlan network %s", network.String())
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+//SetNodeVxlanIP publishes the address of the vxlan interface of the node in its annotations
+func SetNodeVxlanIP(clientset kubernetes.Interface, nodeName, vxlanIP string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, VxlanIPAnnotationKey, vxlanIP)
+	if _, err := clientset.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("unable to set the vxlan address annotation on node %s: %v", nodeName, err)
+	}
+	return nil
+}
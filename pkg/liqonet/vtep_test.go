@@ -0,0 +1,82 @@
+package liqonet
+
+import (
+	"context"
+	liqonetv1 "github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"net"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func getVxlanIPClient(t *testing.T, nodes ...string) client.Client {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme), "should be nil")
+	assert.Nil(t, liqonetv1.AddToScheme(scheme), "should be nil")
+	var objects []runtime.Object
+	for _, node := range nodes {
+		objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: node}})
+	}
+	return fake.NewFakeClientWithScheme(scheme, objects...)
+}
+
+func TestAllocateVxlanIP(t *testing.T) {
+	c := getVxlanIPClient(t, "node-1", "node-2", "node-3")
+	//the nodes whose internal IPs end with the same byte get different addresses
+	allocated := make(map[string]bool)
+	for _, node := range []string{"node-1", "node-2", "node-3"} {
+		ip, err := AllocateVxlanIP(c, "192.168.200.0/24", node)
+		assert.Nil(t, err, "should be nil")
+		assert.False(t, allocated[ip], "the address %s has already been allocated", ip)
+		allocated[ip] = true
+	}
+	assert.True(t, allocated["192.168.200.1"], "the first address of the network should be allocated")
+	//the address is kept across the restarts
+	ip, err := AllocateVxlanIP(c, "192.168.200.0/24", "node-2")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "192.168.200.2", ip)
+
+	//the address of the node which left the cluster is allocated to the new one
+	assert.Nil(t, c.Delete(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}), "should be nil")
+	assert.Nil(t, c.Create(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-4"}}), "should be nil")
+	ip, err = AllocateVxlanIP(c, "192.168.200.0/24", "node-4")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "192.168.200.1", ip)
+	storage := &liqonetv1.IpamStorage{}
+	assert.Nil(t, c.Get(context.TODO(), types.NamespacedName{Name: vxlanIPStorageName}, storage), "should be nil")
+	_, ok := storage.Spec.VxlanIPs["node-1"]
+	assert.False(t, ok, "the address of the node which left the cluster should be released")
+
+	//the addresses are allocated again when the vxlan network changes
+	ip, err = AllocateVxlanIP(c, "10.200.0.0/16", "node-3")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "10.200.0.1", ip)
+}
+
+func TestAllocateVxlanIPExhausted(t *testing.T) {
+	c := getVxlanIPClient(t, "node-1", "node-2", "node-3")
+	//a /30 network has two usable addresses
+	for _, node := range []string{"node-1", "node-2"} {
+		_, err := AllocateVxlanIP(c, "192.168.200.0/30", node)
+		assert.Nil(t, err, "should be nil")
+	}
+	_, err := AllocateVxlanIP(c, "192.168.200.0/30", "node-3")
+	assert.NotNil(t, err, "should not be nil, the network has no addresses left")
+}
+
+func TestGetFreeVxlanIP(t *testing.T) {
+	_, network, _ := net.ParseCIDR("fd00:200::/126")
+	ip, err := getFreeVxlanIP(network, map[string]bool{"fd00:200::1": true})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "fd00:200::2", ip.String())
+	//the last address of an IPv6 network can be allocated
+	ip, err = getFreeVxlanIP(network, map[string]bool{"fd00:200::1": true, "fd00:200::2": true})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "fd00:200::3", ip.String())
+}
@@ -126,10 +126,22 @@ func (vxlan *VxlanDevice) ConfigureIPAddress(ipAddress net.IP, mask net.IPMask)
 	err := netlink.AddrAdd(vxlan.Link, address)
 	if err == syscall.EEXIST {
 		klog.V(4).Infof("ip address %v is already configured on vxlan %v", address, vxlan.Link.Name)
-		return nil
 	} else if err != nil {
 		return fmt.Errorf("unable to configure address %s on vxlan interface %s. %v", ipAddress, vxlan.Link.Name, err)
 	}
+	//the addresses allocated to the node with a previous configuration of the vxlan network are removed
+	addresses, err := netlink.AddrList(vxlan.Link, GetFamily(ipAddress))
+	if err != nil {
+		return fmt.Errorf("unable to list the addresses of vxlan interface %s. %v", vxlan.Link.Name, err)
+	}
+	for i := range addresses {
+		if addresses[i].IP.Equal(ipAddress) || !addresses[i].IP.IsGlobalUnicast() {
+			continue
+		}
+		if err := netlink.AddrDel(vxlan.Link, &addresses[i]); err != nil {
+			return fmt.Errorf("unable to remove address %s from vxlan interface %s. %v", addresses[i].IP, vxlan.Link.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -144,7 +156,16 @@ func (device *VxlanDevice) DeleteVxLanIface() error {
 
 func (vxlan *VxlanDevice) AddFDB(n Neighbor) error {
 	klog.V(4).Infof("calling AppendFDB: %v, %v", n.IP, n.MAC)
-	return netlink.NeighAppend(&netlink.Neigh{
+	return netlink.NeighAppend(vxlan.getFDBNeigh(n))
+}
+
+func (vxlan *VxlanDevice) DelFDB(n Neighbor) error {
+	klog.V(4).Infof("calling DelFDB: %v, %v", n.IP, n.MAC)
+	return netlink.NeighDel(vxlan.getFDBNeigh(n))
+}
+
+func (vxlan *VxlanDevice) getFDBNeigh(n Neighbor) *netlink.Neigh {
+	return &netlink.Neigh{
 		LinkIndex:    vxlan.Link.Index,
 		State:        netlink.NUD_PERMANENT | netlink.NUD_NOARP,
 		Family:       syscall.AF_BRIDGE,
@@ -152,5 +173,5 @@ func (vxlan *VxlanDevice) AddFDB(n Neighbor) error {
 		Type:         netlink.NDA_DST,
 		IP:           n.IP,
 		HardwareAddr: n.MAC,
-	})
+	}
 }
@@ -0,0 +1,271 @@
+package liqonet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/liqoTech/liqo/api/liqonet/v1"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/crypto/curve25519"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	//all the remote clusters are peers of the same wireguard interface
+	wireGuardIfaceName = "liqo-wg"
+	//the prefix of the gre tunnels encapsulated in the wireguard one, one for each remote cluster
+	wireGuardTunnelPrefix = "wgtun_"
+	//the keepalive keeps open the NAT mappings between the gateways
+	wireGuardKeepalive = 25
+	wireGuardKeyLength = 32
+
+	//the annotation of the gateway node carrying its wireguard public key, read when building the advertisements
+	WireGuardPublicKeyAnnotation = "liqonet.liqo.io/wireguard-public-key"
+	//the secret the private key is stored in, so that the key does not change when the tunnel-operator restarts
+	wireGuardKeySecretName   = "liqonet-wireguard-key"
+	wireGuardPrivateKeyField = "privateKey"
+)
+
+//WireGuardDriver sets up an encrypted tunnel toward each remote cluster, as a peer of the local wireguard interface.
+//The peer is reached only at its tunnel private IP: the traffic of the remote cluster crosses a gre tunnel between the
+//tunnel private IPs, which gives each remote cluster its own interface, and the networks of the remote clusters are
+//routed toward it regardless of the ones of the other clusters
+type WireGuardDriver struct {
+	PublicKey string
+	link      netlink.Link
+	//the MTU of the wireguard interface needed by the gre tunnel toward each remote cluster, the interface gets the
+	//highest one since it is shared by all of them
+	mtus map[string]int
+}
+
+//NewWireGuardDriver creates and configures the wireguard interface with the given private key,
+//it fails if wireguard is not supported by the node
+func NewWireGuardDriver(privateKey string) (*WireGuardDriver, error) {
+	publicKey, err := WireGuardPublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("wg"); err != nil {
+		return nil, fmt.Errorf("the wg tool is not available: %v", err)
+	}
+	link := &netlink.GenericLink{
+		LinkAttrs: netlink.LinkAttrs{Name: wireGuardIfaceName},
+		LinkType:  WireGuardProtocol,
+	}
+	if err := netlink.LinkAdd(link); err != nil && err != syscall.EEXIST {
+		return nil, fmt.Errorf("unable to create the wireguard interface: %v", err)
+	}
+	existing, err := netlink.LinkByName(wireGuardIfaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the wireguard interface info: %v", err)
+	}
+	//the private key is passed through the standard input, so that it is not written anywhere
+	cmd := exec.Command("wg", "set", wireGuardIfaceName, "listen-port", strconv.Itoa(TunnelPort), "private-key", "/dev/stdin")
+	cmd.Stdin = strings.NewReader(privateKey)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("unable to configure the wireguard interface: %v %s", err, out)
+	}
+	if err := netlink.LinkSetUp(existing); err != nil {
+		return nil, fmt.Errorf("unable to bring up the wireguard interface: %v", err)
+	}
+	return &WireGuardDriver{PublicKey: publicKey, link: existing, mtus: make(map[string]int)}, nil
+}
+
+func (d *WireGuardDriver) Install(endpoint *v1.TunnelEndpoint) (int, string, error) {
+	if endpoint.Spec.TunnelPublicKey == "" {
+		return 0, "", fmt.Errorf("the remote cluster %s did not advertise its wireguard public key", endpoint.Spec.ClusterID)
+	}
+	//the interface gets the tunnel private IP of each remote cluster, the /31 routes the remote one through the interface
+	address := getTunnelLinkAddress(endpoint.Status.LocalTunnelPrivateIP)
+	if address == nil {
+		return 0, "", fmt.Errorf("invalid local tunnel private IP %s", endpoint.Status.LocalTunnelPrivateIP)
+	}
+	if err := netlink.AddrAdd(d.link, address); err != nil && err != syscall.EEXIST {
+		return 0, "", fmt.Errorf("unable to configure IP address (%s) on the wireguard interface: %v", endpoint.Status.LocalTunnelPrivateIP, err)
+	}
+	remote := net.JoinHostPort(endpoint.Spec.TunnelPublicIP, strconv.Itoa(GetRemoteTunnelPort(endpoint)))
+	err := runWg("set", wireGuardIfaceName, "peer", endpoint.Spec.TunnelPublicKey, "endpoint", remote,
+		"allowed-ips", HostCIDR(endpoint.Status.RemoteTunnelPrivateIP),
+		"persistent-keepalive", strconv.Itoa(wireGuardKeepalive))
+	if err != nil {
+		return 0, "", err
+	}
+	klog.Infof("wireguard peer %s of cluster %s configured with endpoint %s", endpoint.Spec.TunnelPublicKey, endpoint.Spec.ClusterID, remote)
+	if endpoint.Status.MTU > 0 {
+		d.mtus[endpoint.Spec.ClusterID] = endpoint.Status.MTU + GetTunnelOverhead(GreProtocol, IsIPv6String(endpoint.Status.LocalTunnelPrivateIP))
+		if err := d.updateMTU(); err != nil {
+			return 0, "", err
+		}
+	}
+	//the gre packets are sent through the wireguard interface, where the remote tunnel private IP is directly connected
+	return setupGreTunnel(endpoint, gretunAttributes{
+		name:   GetTunnelIfaceName(wireGuardTunnelPrefix, endpoint.Spec.ClusterID),
+		local:  net.ParseIP(endpoint.Status.LocalTunnelPrivateIP),
+		remote: net.ParseIP(endpoint.Status.RemoteTunnelPrivateIP),
+		link:   d.link.Attrs().Index,
+	})
+}
+
+func (d *WireGuardDriver) Remove(endpoint *v1.TunnelEndpoint) error {
+	if err := RemoveGreTunnel(endpoint); err != nil {
+		return err
+	}
+	if endpoint.Spec.TunnelPublicKey == "" {
+		return nil
+	}
+	//removing a peer which does not exist is not an error
+	if err := runWg("set", wireGuardIfaceName, "peer", endpoint.Spec.TunnelPublicKey, "remove"); err != nil {
+		return err
+	}
+	if address := getTunnelLinkAddress(endpoint.Status.LocalTunnelPrivateIP); address != nil {
+		if err := netlink.AddrDel(d.link, address); err != nil && err != syscall.EADDRNOTAVAIL {
+			return fmt.Errorf("unable to remove IP address (%s) from the wireguard interface: %v", endpoint.Status.LocalTunnelPrivateIP, err)
+		}
+	}
+	if _, ok := d.mtus[endpoint.Spec.ClusterID]; ok {
+		delete(d.mtus, endpoint.Spec.ClusterID)
+		return d.updateMTU()
+	}
+	return nil
+}
+
+//the local tunnel private IP with the /31 (/127 for IPv6) shared with the remote cluster
+func getTunnelLinkAddress(localTunnelPrivateIP string) *netlink.Addr {
+	ip := net.ParseIP(localTunnelPrivateIP)
+	if ip == nil {
+		return nil
+	}
+	ones, bits := HostMask(ip).Size()
+	return &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: net.CIDRMask(ones-1, bits)}}
+}
+
+//sets on the interface the highest MTU needed by the tunnels toward the remote clusters, so that the packets of each
+//gre tunnel fit it, it is kept if there are none
+func (d *WireGuardDriver) updateMTU() error {
+	mtu := 0
+	for _, m := range d.mtus {
+		if m > mtu {
+			mtu = m
+		}
+	}
+	if mtu == 0 || mtu == d.link.Attrs().MTU {
+		return nil
+	}
+	if err := netlink.LinkSetMTU(d.link, mtu); err != nil {
+		return fmt.Errorf("unable to set the MTU %d on the wireguard interface: %v", mtu, err)
+	}
+	d.link.Attrs().MTU = mtu
+	return nil
+}
+
+//GetStats returns the bytes exchanged with the peer of the remote cluster, wireguard does not count the packets
+func (d *WireGuardDriver) GetStats(endpoint *v1.TunnelEndpoint) (TunnelStats, error) {
+	out, err := exec.Command("wg", "show", wireGuardIfaceName, "dump").Output()
+	if err != nil {
+		return TunnelStats{}, fmt.Errorf("command wg show %s dump failed: %v", wireGuardIfaceName, err)
+	}
+	return parseWireGuardTransfer(string(out), endpoint.Spec.TunnelPublicKey)
+}
+
+//parses the output of wg show dump: the first line describes the interface, the other ones a peer each with the
+//fields public-key, preshared-key, endpoint, allowed-ips, latest-handshake, transfer-rx, transfer-tx, keepalive
+func parseWireGuardTransfer(dump, publicKey string) (TunnelStats, error) {
+	for _, line := range strings.Split(dump, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 8 || fields[0] != publicKey {
+			continue
+		}
+		received, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return TunnelStats{}, fmt.Errorf("unable to parse the received bytes of peer %s: %v", publicKey, err)
+		}
+		sent, err := strconv.ParseUint(fields[6], 10, 64)
+		if err != nil {
+			return TunnelStats{}, fmt.Errorf("unable to parse the sent bytes of peer %s: %v", publicKey, err)
+		}
+		return TunnelStats{SentBytes: sent, ReceivedBytes: received}, nil
+	}
+	return TunnelStats{}, fmt.Errorf("the peer %s is not configured on the wireguard interface", publicKey)
+}
+
+func runWg(args ...string) error {
+	if out, err := exec.Command("wg", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("command wg %s failed: %v %s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+//GenerateWireGuardPrivateKey returns a new base64 encoded curve25519 private key
+func GenerateWireGuardPrivateKey() (string, error) {
+	key := make([]byte, wireGuardKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	//clamp the key as required by curve25519
+	key[0] &= 248
+	key[31] &= 127
+	key[31] |= 64
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+//WireGuardPublicKey returns the base64 encoded public key of a base64 encoded private key
+func WireGuardPublicKey(privateKey string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode the wireguard private key: %v", err)
+	}
+	if len(key) != wireGuardKeyLength {
+		return "", errors.New("the wireguard private key has to be 32 bytes long")
+	}
+	var private, public [wireGuardKeyLength]byte
+	copy(private[:], key)
+	curve25519.ScalarBaseMult(&public, &private)
+	return base64.StdEncoding.EncodeToString(public[:]), nil
+}
+
+//GetWireGuardPrivateKey returns the private key stored in the namespace, generating it the first time
+func GetWireGuardPrivateKey(clientset kubernetes.Interface, namespace string) (string, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), wireGuardKeySecretName, metav1.GetOptions{})
+	if err == nil {
+		if key, ok := secret.Data[wireGuardPrivateKeyField]; ok {
+			return string(key), nil
+		}
+		return "", fmt.Errorf("the secret %s/%s does not contain the %s field", namespace, wireGuardKeySecretName, wireGuardPrivateKeyField)
+	} else if !k8serrors.IsNotFound(err) {
+		return "", err
+	}
+	privateKey, err := GenerateWireGuardPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      wireGuardKeySecretName,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{wireGuardPrivateKeyField: []byte(privateKey)},
+	}
+	if _, err = clientset.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+		return "", err
+	}
+	return privateKey, nil
+}
+
+//SetWireGuardPublicKeyAnnotation publishes the public key on the gateway node, from where it is advertised
+func SetWireGuardPublicKeyAnnotation(clientset kubernetes.Interface, nodeName, publicKey string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, WireGuardPublicKeyAnnotation, publicKey)
+	_, err := clientset.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/liqoTech/liqo/internal/kubernetes/test"
 	pkg "github.com/liqoTech/liqo/pkg/advertisement-operator"
 	"github.com/liqoTech/liqo/pkg/crdClient"
+	"github.com/liqoTech/liqo/pkg/liqonet"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -58,7 +59,6 @@ func createBroadcaster(clusterConfig policyv1.ClusterConfigSpec) advertisement_o
 		RemoteClient:               foreignClient,
 		HomeClusterId:              test.HomeClusterId,
 		ForeignClusterId:           test.ForeignClusterId,
-		GatewayPrivateIP:           "10.0.0.1",
 		ClusterConfig:              clusterConfig,
 		PeeringRequestName:         test.ForeignClusterId,
 	}
@@ -259,7 +259,8 @@ func TestCreateAdvertisement(t *testing.T) {
 	assert.Equal(t, neighbours, adv.Spec.Neighbors)
 	assert.Equal(t, pNodes.Items[0].Spec.PodCIDR, adv.Spec.Network.PodCIDR)
 	assert.Equal(t, gatewayNode.Status.Addresses[0].Address, adv.Spec.Network.GatewayIP)
-	assert.Equal(t, "10.0.0.1", adv.Spec.Network.GatewayPrivateIP)
+	gatewayPrivateIP, _ := liqonet.GetTunnelPrivateIPs(broadcaster.HomeClusterId, broadcaster.ForeignClusterId, false)
+	assert.Equal(t, gatewayPrivateIP, adv.Spec.Network.GatewayPrivateIP)
 	assert.Empty(t, adv.Status, "Status should not be set")
 }
 
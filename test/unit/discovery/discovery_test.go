@@ -3,6 +3,7 @@ package discovery
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	protocolv1 "github.com/liqoTech/liqo/api/advertisement-operator/v1"
 	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
 	v1 "github.com/liqoTech/liqo/api/discovery/v1"
@@ -12,6 +13,7 @@ import (
 	"github.com/liqoTech/liqo/pkg/crdClient"
 	"gotest.tools/assert"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog"
 	"os"
@@ -71,6 +73,7 @@ func TestDiscovery(t *testing.T) {
 	t.Run("testBidirectionalJoin", testBidirectionalJoin)
 	t.Run("testMergeClusters", testMergeClusters)
 	t.Run("testCreateKubeconfig", testCreateKubeconfig)
+	t.Run("testCaFingerprint", testCaFingerprint)
 }
 
 // ------
@@ -423,3 +426,84 @@ func testCreateKubeconfig(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Assert(t, strings.Contains(kc, "1234"), "non-default port not set")
 }
+
+// ------
+// tests that the CA downloaded in untrusted mode is stored only if it matches the expected fingerprint
+func testCaFingerprint(t *testing.T) {
+	// setup: the foreign cluster exposes its CA in a dedicated namespace
+	_, err := serverCluster.client.Client().CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ca-test",
+		},
+	}, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	_, err = serverCluster.client.Client().CoreV1().Secrets("ca-test").Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ca-data",
+		},
+		Data: map[string][]byte{
+			"ca.crt": serverCluster.cfg.CAData,
+		},
+	}, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	fingerprint, err := v1.GetCaFingerprint(serverCluster.cfg.CAData)
+	assert.NilError(t, err)
+
+	fc := &v1.ForeignCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "fc-ca-test",
+		},
+		Spec: v1.ForeignClusterSpec{
+			ClusterID:     "ca-test-cluster",
+			Namespace:     "ca-test",
+			Join:          false,
+			ApiUrl:        serverCluster.cfg.Host,
+			DiscoveryType: v1.ManualDiscovery,
+			CaFingerprint: fingerprint,
+			CaCertHash:    "sha256:" + strings.Repeat("00", 32),
+		},
+	}
+	tmp, err := clientCluster.client.Resource("foreignclusters").Create(fc, metav1.CreateOptions{})
+	assert.NilError(t, err)
+	fc, ok := tmp.(*v1.ForeignCluster)
+	assert.Assert(t, ok)
+
+	// the hash handed out of band takes precedence over the advertised fingerprint
+	err = fc.LoadForeignCA(clientCluster.client.Client(), "default", serverCluster.cfg)
+	var mismatch *v1.CaFingerprintMismatchError
+	assert.Assert(t, errors.As(err, &mismatch), "CA not matching the expected fingerprint has been accepted")
+	assert.Equal(t, mismatch.Actual, fingerprint)
+	assert.Assert(t, fc.Status.Outgoing.CaDataRef == nil, "CaDataRef set for a CA not matching the expected fingerprint")
+	condition := fc.Status.GetCondition(v1.CaVerifiedCondition)
+	assert.Assert(t, condition != nil, "CaVerified condition not set")
+	assert.Equal(t, condition.Status, corev1.ConditionFalse)
+	assert.Equal(t, condition.Reason, v1.CaFingerprintMismatchReason)
+	_, err = clientCluster.client.Client().CoreV1().Secrets("default").Get(context.TODO(), fc.Name+"-ca-data", metav1.GetOptions{})
+	assert.Assert(t, k8serrors.IsNotFound(err), "CA not matching the expected fingerprint has been stored")
+
+	// the colons separating the bytes are accepted
+	var colonFingerprint []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colonFingerprint = append(colonFingerprint, strings.ToUpper(fingerprint[i:i+2]))
+	}
+	fc.Spec.CaCertHash = "sha256:" + strings.Join(colonFingerprint, ":")
+	err = fc.LoadForeignCA(clientCluster.client.Client(), "default", serverCluster.cfg)
+	assert.NilError(t, err)
+	assert.Assert(t, fc.Status.Outgoing.CaDataRef != nil, "CaDataRef not set")
+	condition = fc.Status.GetCondition(v1.CaVerifiedCondition)
+	assert.Equal(t, condition.Status, corev1.ConditionTrue)
+	assert.Equal(t, condition.Reason, v1.CaFingerprintMatchReason)
+	secret, err := clientCluster.client.Client().CoreV1().Secrets("default").Get(context.TODO(), fc.Name+"-ca-data", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, secret.Data["caData"], serverCluster.cfg.CAData)
+
+	// the stored CA is not used anymore if the expected fingerprint changes
+	fc.Spec.CaCertHash = ""
+	fc.Spec.CaFingerprint = strings.Repeat("ff", 32)
+	_, err = fc.GetConfig(clientCluster.client.Client())
+	assert.Assert(t, errors.As(err, &mismatch), "stored CA not matching the expected fingerprint has been used")
+
+	// teardown
+	err = clientCluster.client.Resource("foreignclusters").Delete(fc.Name, metav1.DeleteOptions{})
+	assert.NilError(t, err)
+}
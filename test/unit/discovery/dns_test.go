@@ -1,13 +1,19 @@
 package discovery
 
 import (
+	"context"
+	policyv1 "github.com/liqoTech/liqo/api/cluster-config/v1"
 	v1 "github.com/liqoTech/liqo/api/discovery/v1"
 	"github.com/liqoTech/liqo/internal/discovery"
 	search_domain_operator "github.com/liqoTech/liqo/internal/discovery/search-domain-operator"
+	"github.com/miekg/dns"
 	"gotest.tools/assert"
 	v12 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -17,6 +23,7 @@ func TestDns(t *testing.T) {
 	t.Run("testCNAME", testCname)
 	t.Run("testSDCreation", testSDCreation)
 	t.Run("testSDDelete", testSDDelete)
+	t.Run("testDnsRegistration", testDnsRegistration)
 }
 
 // ------
@@ -159,8 +166,153 @@ func testSDDelete(t *testing.T) {
 	}
 }
 
+// ------
+// tests if the cluster registers itself with dynamic updates in the records read by the DNS discovery
+func testDnsRegistration(t *testing.T) {
+	// the updates are received through TCP, the queries through UDP
+	updateServer := &updateHandler{}
+	for _, network := range []string{"tcp", "udp"} {
+		dnsServer := dns.Server{
+			Addr:       "127.0.0.1:8054",
+			Net:        network,
+			Handler:    updateServer,
+			TsigSecret: map[string]string{"liqo.": tsigSecret},
+			// the updates are refused by default
+			MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+				return dns.MsgAccept
+			},
+		}
+		go func() {
+			if err := dnsServer.ListenAndServe(); err != nil {
+				klog.Fatal("Failed to set listener ", err.Error())
+			}
+		}()
+		defer func() {
+			_ = dnsServer.Shutdown()
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := clientCluster.client.Client().CoreV1().Secrets("default").Create(context.TODO(), &v12.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "liqo-tsig",
+		},
+		Data: map[string][]byte{
+			"secret": []byte(tsigSecret),
+		},
+	}, metav1.CreateOptions{})
+	assert.NilError(t, err, "Error creating TSIG Secret")
+	hostPort := strings.Split(clientCluster.cfg.Host, ":")
+	assert.NilError(t, os.Setenv("APISERVER", hostPort[0]))
+	assert.NilError(t, os.Setenv("APISERVER_PORT", hostPort[1]))
+	defer func() {
+		_ = os.Unsetenv("APISERVER")
+		_ = os.Unsetenv("APISERVER_PORT")
+	}()
+
+	discoveryCtrl := &clientCluster.discoveryCtrl
+	discoveryCtrl.Config.DnsRegistration = policyv1.DnsRegistrationConfig{
+		Domain:         "register.liqo.io",
+		Server:         "127.0.0.1:8054",
+		TsigKeyName:    "liqo",
+		TsigSecretName: "liqo-tsig",
+	}
+	defer func() {
+		discoveryCtrl.Config.DnsRegistration = policyv1.DnsRegistrationConfig{}
+	}()
+
+	// updates not authenticated are refused
+	discoveryCtrl.Config.DnsRegistration.TsigKeyName = ""
+	assert.Assert(t, discoveryCtrl.RegisterDns() != nil, "Unsigned update should be refused")
+	discoveryCtrl.Config.DnsRegistration.TsigKeyName = "liqo"
+
+	err = discoveryCtrl.RegisterDns()
+	assert.NilError(t, err, "Error registering the cluster")
+	txts, err := search_domain_operator.Wan("127.0.0.1:8054", "register.liqo.io.", true)
+	assert.NilError(t, err, "Error during WAN DNS discovery")
+	assert.Equal(t, len(txts), 1)
+	assert.Equal(t, txts[0].ID, clientCluster.clusterId.GetClusterID())
+	assert.Equal(t, txts[0].Namespace, "default")
+	assert.Equal(t, txts[0].ApiUrl, "https://"+clientCluster.cfg.Host)
+
+	// the records are updated when the API server changes
+	assert.NilError(t, os.Setenv("APISERVER", "127.0.0.2"))
+	err = discoveryCtrl.RegisterDns()
+	assert.NilError(t, err, "Error updating the registration")
+	txts, err = search_domain_operator.Wan("127.0.0.1:8054", "register.liqo.io.", true)
+	assert.NilError(t, err, "Error during WAN DNS discovery")
+	assert.Equal(t, len(txts), 1)
+	assert.Equal(t, txts[0].ApiUrl, "https://127.0.0.2:"+hostPort[1])
+
+	err = discoveryCtrl.UnregisterDns()
+	assert.NilError(t, err, "Error unregistering the cluster")
+	txts, err = search_domain_operator.Wan("127.0.0.1:8054", "register.liqo.io.", true)
+	assert.NilError(t, err, "Error during WAN DNS discovery")
+	assert.Equal(t, len(txts), 0, "Records not removed")
+}
+
 // utility functions
 
+const tsigSecret = "bGlxby10c2lnLXNlY3JldA=="
+
+// DNS server applying the dynamic updates signed with the TSIG key to the records it serves
+type updateHandler struct {
+	mutex   sync.Mutex
+	records []dns.RR
+}
+
+func (h *updateHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	msg := dns.Msg{}
+	msg.SetReply(r)
+	if r.Opcode == dns.OpcodeUpdate {
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			msg.Rcode = dns.RcodeRefused
+		} else {
+			for _, rr := range r.Ns {
+				h.apply(rr)
+			}
+			msg.SetTsig(r.IsTsig().Hdr.Name, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+	} else {
+		msg.Authoritative = true
+		for _, rr := range h.records {
+			if rr.Header().Name == r.Question[0].Name && rr.Header().Rrtype == r.Question[0].Qtype {
+				msg.Answer = append(msg.Answer, rr)
+			}
+		}
+	}
+	if err := w.WriteMsg(&msg); err != nil {
+		klog.Error(err, err.Error())
+	}
+}
+
+func (h *updateHandler) apply(update dns.RR) {
+	var records []dns.RR
+	for _, rr := range h.records {
+		removed := false
+		switch update.Header().Class {
+		case dns.ClassANY:
+			removed = rr.Header().Name == update.Header().Name &&
+				(update.Header().Rrtype == dns.TypeANY || rr.Header().Rrtype == update.Header().Rrtype)
+		case dns.ClassNONE:
+			deleted := dns.Copy(update)
+			deleted.Header().Class = dns.ClassINET
+			removed = dns.IsDuplicate(rr, deleted)
+		case dns.ClassINET:
+			removed = dns.IsDuplicate(rr, update)
+		}
+		if !removed {
+			records = append(records, rr)
+		}
+	}
+	if update.Header().Class == dns.ClassINET {
+		records = append(records, update)
+	}
+	h.records = records
+}
+
 func getTxtData(cluster *Cluster, id string) *discovery.TxtData {
 	return &discovery.TxtData{
 		ID:               id,
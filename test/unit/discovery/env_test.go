@@ -238,11 +238,10 @@ func getLiqoConfig(client kubernetes.Interface) {
 			Name: "liqo-config",
 		},
 		Data: map[string]string{
-			"clusterID":        "cluster-1",
-			"podCIDR":          "10.244.0.0/16",
-			"serviceCIDR":      "10.96.0.0/12",
-			"gatewayPrivateIP": "10.244.2.47",
-			"gatewayIP":        "10.251.0.1",
+			"clusterID":   "cluster-1",
+			"podCIDR":     "10.244.0.0/16",
+			"serviceCIDR": "10.96.0.0/12",
+			"gatewayIP":   "10.251.0.1",
 		},
 	}
 	_, err := client.CoreV1().ConfigMaps("default").Create(context.TODO(), cm, metav1.CreateOptions{})
@@ -279,8 +278,7 @@ func getClusterConfig(config rest.Config) {
 				DnsServer:           "8.8.8.8:53",
 			},
 			LiqonetConfig: policyv1.LiqonetConfig{
-				ReservedSubnets:  []string{"10.0.0.0/16"},
-				GatewayPrivateIP: "192.168.1.1",
+				ReservedSubnets: []string{"10.0.0.0/16"},
 				VxlanNetConfig: liqonet.VxlanNetConfig{
 					Network:    "",
 					DeviceName: "",
@@ -15,6 +15,7 @@ var txtData discovery.TxtData
 
 func TestMdns(t *testing.T) {
 	t.Run("testTxtData", testTxtData)
+	t.Run("testTxtDataV1", testTxtDataV1)
 	t.Run("testMDNS", testMdns)
 	t.Run("testForeignClusterCreation", testForeignClusterCreation)
 	t.Run("testTtl", testTtl)
@@ -28,13 +29,52 @@ func testTxtData(t *testing.T) {
 		Namespace:        "default",
 		ApiUrl:           "https://" + serverCluster.cfg.Host,
 		AllowUntrustedCA: true,
+		Version:          discovery.TxtVersion,
+		ClusterName:      "My Liqo",
+		LiqoVersion:      "v0.2",
+		NetworkProtocols: []string{"wireguard", "gre"},
+		CaFingerprint:    strings.Repeat("ab", 32),
+		Capabilities:     []string{discovery.CapabilityNetworkConfig},
 	}
 	txt, err := txtData.Encode()
 	assert.NilError(t, err, "Error encoding txtData to DNS format")
 
 	txtData2, err := discovery.Decode("127.0.0.1", strings.Split(serverCluster.cfg.Host, ":")[1], txt)
 	assert.NilError(t, err, "Error decoding txtData from DNS format")
-	assert.Equal(t, txtData, *txtData2, "TxtData before and after encoding doesn't match")
+	assert.DeepEqual(t, txtData, *txtData2)
+
+	// the explicit API URL is optional, the resolved address is used without it
+	txtData.ApiUrl = ""
+	txt, err = txtData.Encode()
+	assert.NilError(t, err, "Error encoding txtData to DNS format")
+	txtData2, err = discovery.Decode("127.0.0.1", "6443", txt)
+	assert.NilError(t, err, "Error decoding txtData from DNS format")
+	assert.Equal(t, txtData2.ApiUrl, "https://127.0.0.1:6443")
+}
+
+// ------
+// tests if the TXT data of the clusters using the first format, without version, are decoded
+func testTxtDataV1(t *testing.T) {
+	txt := []string{
+		"id=old-cluster",
+		"namespace=liqo",
+		"untrusted-ca=true",
+	}
+	txtData2, err := discovery.Decode("127.0.0.1", "6443", txt)
+	assert.NilError(t, err, "Error decoding txtData from DNS format")
+	assert.DeepEqual(t, discovery.TxtData{
+		ID:               "old-cluster",
+		Namespace:        "liqo",
+		ApiUrl:           "https://127.0.0.1:6443",
+		AllowUntrustedCA: true,
+		Version:          1,
+	}, *txtData2)
+
+	// the keys unknown to this version are ignored
+	txtData2, err = discovery.Decode("127.0.0.1", "6443", append(txt, "txtvers=3", "future=value"))
+	assert.NilError(t, err, "Error decoding txtData from DNS format")
+	assert.Equal(t, txtData2.Version, 3)
+	assert.Equal(t, txtData2.ID, "old-cluster")
 }
 
 // ------
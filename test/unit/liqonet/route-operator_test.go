@@ -64,6 +64,7 @@ func setupRouteOperator() error {
 		IPTablesChains:                     make(map[string]liqonet.IPTableChain),
 		IPtablesRuleSpecsPerRemoteCluster:  make(map[string][]liqonet.IPtableRule),
 		RoutesPerRemoteCluster:             make(map[string][]netlink.Route),
+		ServiceRulesPerRemoteCluster:       make(map[string]netlink.Rule),
 		RetryTimeout:                       0,
 	}
 	err = routeOperator.SetupWithManager(k8sManager)
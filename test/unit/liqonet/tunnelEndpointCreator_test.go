@@ -47,9 +47,8 @@ func getClusterConfigurationCR(reservedSubnets []string) *policyv1.ClusterConfig
 			AdvertisementConfig: policyv1.AdvertisementConfig{},
 			DiscoveryConfig:     policyv1.DiscoveryConfig{},
 			LiqonetConfig: policyv1.LiqonetConfig{
-				ReservedSubnets:  reservedSubnets,
-				GatewayPrivateIP: "",
-				VxlanNetConfig:   liqonetOperator.VxlanNetConfig{},
+				ReservedSubnets: reservedSubnets,
+				VxlanNetConfig:  liqonetOperator.VxlanNetConfig{},
 			},
 		},
 		Status: policyv1.ClusterConfigStatus{},
@@ -148,6 +147,31 @@ func TestGetConfiguration(t *testing.T) {
 	}
 }
 
+func TestGetConfigurationReservesServiceCIDR(t *testing.T) {
+	//the service CIDR of the local cluster is reserved even if it is not listed in the reserved subnets
+	tep := getTunnelEndpointCreator()
+	clusterConfig := getClusterConfigurationCR([]string{"10.24.0.0/16"})
+	clusterConfig.Spec.LiqonetConfig.ServiceCIDR = "10.96.0.0/12"
+	reservedSubnets, err := tep.GetConfiguration(clusterConfig)
+	assert.Nil(t, err, "error should be nil")
+	_, ok := reservedSubnets["10.96.0.0/12"]
+	assert.True(t, ok, "the service CIDR should be reserved")
+	assert.Nil(t, tep.InitConfiguration(reservedSubnets, make(map[string]*net.IPNet)), "error should be nil")
+
+	//a peer subnet overlapping the local service CIDR is remapped
+	_, peerSubnet, _ := net.ParseCIDR("10.100.0.0/16")
+	remapped, err := tep.IPManager.GetNewSubnetPerCluster(peerSubnet, "cluster-1")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, remapped, "the subnet of the peer should be remapped")
+	assert.False(t, liqonetOperator.VerifyNoOverlap(reservedSubnets, remapped), "the remapped subnet should not overlap the reserved subnets")
+
+	//a peer subnet not overlapping the local CIDRs is kept
+	_, peerSubnet, _ = net.ParseCIDR("192.168.0.0/16")
+	remapped, err = tep.IPManager.GetNewSubnetPerCluster(peerSubnet, "cluster-2")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, remapped, "the subnet of the peer should not be remapped")
+}
+
 func TestInitConfiguration(t *testing.T) {
 	tests := []struct {
 		clusterSubnets  []string
@@ -369,6 +393,21 @@ func TestUpdateTunEndpoint(t *testing.T) {
 	assert.Equal(t, "Processed", tep.Status.Phase, "phase should be set to Processed")
 	assert.Equal(t, "192.168.1.0/24", tep.Status.LocalRemappedPodCIDR, "should be equal")
 
+	//test4: the remote cluster exposes its services with a CIDR overlapping with the subnet allocated to
+	//the previous cluster, we expect that the service CIDR is remapped as well
+	serviceAdv := getAdv()
+	serviceAdv.Name = "services-testing"
+	serviceAdv.Spec.ClusterId = "services"
+	serviceAdv.Spec.Network.PodCIDR = "10.201.0.0/16"
+	serviceAdv.Spec.Network.ServiceCIDR = tep.Status.RemoteRemappedPodCIDR
+	err = tunEndpointCreator.Create(ctx, serviceAdv)
+	assert.Nil(t, err, "should be nil")
+	time.Sleep(2 * time.Second)
+	serviceTep, err := tunEndpointCreator.GetTunEndPerADV(serviceAdv)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, serviceAdv.Spec.Network.ServiceCIDR, serviceTep.Spec.ServiceCIDR, "service CIDRs should be equal")
+	assert.NotEqual(t, "None", serviceTep.Status.RemoteRemappedServiceCIDR, "the remote service CIDR should be remapped")
+	assert.NotEqual(t, "", serviceTep.Status.RemoteRemappedServiceCIDR, "the remote service CIDR should be remapped")
 }
 
 func TestDeleteTunEndpoint(t *testing.T) {